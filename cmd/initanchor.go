@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/spf13/cobra"
+)
+
+var initAnchorCmd = &cobra.Command{
+	Use:   "init-anchor-key",
+	Short: "Generate service key signing Merkle tree heads",
+	Long: `Generates P-256 service key. Server anchors signature chains when
+anchor.key_file (anchor-key.pem) is set. Inclusion proofs can be verified by
+anyone holding anchor-pub.pem, see verify-inclusion.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+
+		key, public, err := crypto.GenerateServiceKey()
+		if err != nil {
+			log.Fatalf("failed to generate service key: %v", err)
+		}
+
+		files := []struct {
+			name string
+			data []byte
+			perm os.FileMode
+		}{
+			{"anchor-pub.pem", public, 0o644},
+			{"anchor-key.pem", key, 0o600},
+		}
+		if err := os.MkdirAll(out, 0o700); err != nil {
+			log.Fatalf("failed to create %s: %v", out, err)
+		}
+		// existing key is never overwritten, published tree heads would stop
+		// verifying
+		for _, f := range files {
+			if _, err := os.Stat(filepath.Join(out, f.name)); !errors.Is(err, os.ErrNotExist) {
+				log.Fatalf("%s already exists", filepath.Join(out, f.name))
+			}
+		}
+		for _, f := range files {
+			if err := os.WriteFile(filepath.Join(out, f.name), f.data, f.perm); err != nil {
+				log.Fatalf("failed to write %s: %v", f.name, err)
+			}
+		}
+		fmt.Printf("Service key written to %s\n", out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initAnchorCmd)
+
+	initAnchorCmd.Flags().String("out", "./anchor", "Output directory")
+}
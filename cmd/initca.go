@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/spf13/cobra"
+)
+
+var initCACmd = &cobra.Command{
+	Use:   "init-ca",
+	Short: "Generate self-signed root and intermediate CA for device certificates",
+	Long: `Generates self-signed root CA and intermediate CA signed by it. Server uses
+intermediate to issue device certificates (ca.root_cert_file,
+ca.intermediate_cert_file and ca.intermediate_key_file). Root key is only
+needed to issue next intermediate, keep it offline.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		name, _ := cmd.Flags().GetString("name")
+		validity, _ := cmd.Flags().GetDuration("validity")
+
+		material, err := crypto.GenerateCertificateAuthority(name, validity)
+		if err != nil {
+			log.Fatalf("failed to generate CA: %v", err)
+		}
+
+		files := []struct {
+			name string
+			data []byte
+			perm os.FileMode
+		}{
+			{"root.pem", material.RootCert, 0o644},
+			{"root-key.pem", material.RootKey, 0o600},
+			{"intermediate.pem", material.IntermediateCert, 0o644},
+			{"intermediate-key.pem", material.IntermediateKey, 0o600},
+		}
+		if err := os.MkdirAll(out, 0o700); err != nil {
+			log.Fatalf("failed to create %s: %v", out, err)
+		}
+		// existing CA is never overwritten, certificates issued by it would
+		// stop verifying
+		for _, f := range files {
+			if _, err := os.Stat(filepath.Join(out, f.name)); !errors.Is(err, os.ErrNotExist) {
+				log.Fatalf("%s already exists", filepath.Join(out, f.name))
+			}
+		}
+		for _, f := range files {
+			if err := os.WriteFile(filepath.Join(out, f.name), f.data, f.perm); err != nil {
+				log.Fatalf("failed to write %s: %v", f.name, err)
+			}
+		}
+		fmt.Printf("CA written to %s\n", out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initCACmd)
+
+	initCACmd.Flags().String("out", "./ca", "Output directory")
+	initCACmd.Flags().String("name", "Signature Service", "Name used in CA certificate subjects")
+	initCACmd.Flags().Duration("validity", 5*365*24*time.Hour, "Intermediate CA validity, root is valid twice as long")
+}
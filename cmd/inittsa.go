@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/spf13/cobra"
+)
+
+var initTSACmd = &cobra.Command{
+	Use:   "init-tsa",
+	Short: "Generate self-signed root and certificate for embedded time-stamping authority",
+	Long: `Generates self-signed root and time-stamping certificate signed by it. Server
+time-stamps signatures with embedded TSA when tsa.cert_file (tsa.pem) and
+tsa.key_file (tsa-key.pem) are set. Tokens can be verified by anyone holding
+tsa-root.pem, e.g. with openssl ts -verify. Root key is not kept.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		name, _ := cmd.Flags().GetString("name")
+		validity, _ := cmd.Flags().GetDuration("validity")
+
+		material, err := crypto.GenerateTimeStampAuthority(name, validity)
+		if err != nil {
+			log.Fatalf("failed to generate TSA: %v", err)
+		}
+
+		files := []struct {
+			name string
+			data []byte
+			perm os.FileMode
+		}{
+			{"tsa-root.pem", material.RootCert, 0o644},
+			{"tsa.pem", material.Chain, 0o644},
+			{"tsa-key.pem", material.Key, 0o600},
+		}
+		if err := os.MkdirAll(out, 0o700); err != nil {
+			log.Fatalf("failed to create %s: %v", out, err)
+		}
+		// existing TSA is never overwritten, tokens issued by it would stop
+		// verifying
+		for _, f := range files {
+			if _, err := os.Stat(filepath.Join(out, f.name)); !errors.Is(err, os.ErrNotExist) {
+				log.Fatalf("%s already exists", filepath.Join(out, f.name))
+			}
+		}
+		for _, f := range files {
+			if err := os.WriteFile(filepath.Join(out, f.name), f.data, f.perm); err != nil {
+				log.Fatalf("failed to write %s: %v", f.name, err)
+			}
+		}
+		fmt.Printf("TSA written to %s\n", out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initTSACmd)
+
+	initTSACmd.Flags().String("out", "./tsa", "Output directory")
+	initTSACmd.Flags().String("name", "Signature Service", "Name used in TSA certificate subjects")
+	initTSACmd.Flags().Duration("validity", 5*365*24*time.Hour, "TSA certificate validity, root is valid twice as long")
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	stdcrypto "crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/spf13/cobra"
+)
+
+var monitorLogCmd = &cobra.Command{
+	Use:   "monitor-log",
+	Short: "Poll signature log and verify it's never rewritten",
+	Long: `Polls signed tree head of signature log (GET /api/v1/log/sth), checks it's
+signed by service key given by --key and that log it covers extends the last
+verified one (GET /api/v1/log/consistency). The last verified tree head is kept
+in --state, so history is checked across runs. Exits with status 1 when log
+history was rewritten.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		server, _ := cmd.Flags().GetString("url")
+		keyPath, _ := cmd.Flags().GetString("key")
+		statePath, _ := cmd.Flags().GetString("state")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		once, _ := cmd.Flags().GetBool("once")
+
+		keyPEM, err := os.ReadFile(keyPath)
+		if err != nil {
+			log.Fatalf("failed to read key: %v", err)
+		}
+		key, err := crypto.ParsePublicKeyPEM(keyPEM)
+		if err != nil {
+			log.Fatalf("failed to parse key: %v", err)
+		}
+		m := &logMonitor{server: strings.TrimRight(server, "/"), key: key, statePath: statePath, client: &http.Client{Timeout: 30 * time.Second}}
+		if err := m.loadState(); err != nil {
+			log.Fatalf("failed to load state: %v", err)
+		}
+
+		for {
+			err := m.check()
+			if errors.Is(err, domain.ErrLogRewritten) {
+				fmt.Fprintf(os.Stderr, "verification failed: %v\n", err)
+				os.Exit(1)
+			}
+			if err != nil {
+				if once {
+					log.Fatalf("check failed: %v", err)
+				}
+				// server may be unavailable for a while, keep the trusted head
+				log.Printf("check failed: %v", err)
+			}
+			if once {
+				return
+			}
+			time.Sleep(interval)
+		}
+	},
+}
+
+// logMonitor keeps the last verified tree head of signature log
+type logMonitor struct {
+	server    string
+	key       stdcrypto.PublicKey
+	statePath string
+	client    *http.Client
+	trusted   *domain.SignedTreeHead
+}
+
+// check verifies the latest tree head against the trusted one and trusts it
+func (m *logMonitor) check() error {
+	var head domain.SignedTreeHead
+	if err := m.get("/api/v1/log/sth", &head); err != nil {
+		return err
+	}
+	if err := domain.VerifyLogTreeHead(&head, m.key); err != nil {
+		return err
+	}
+
+	if m.trusted != nil {
+		// equal or smaller tree needs no proof, roots are compared directly
+		proof := &domain.ConsistencyProof{First: m.trusted.TreeSize, Second: head.TreeSize}
+		if head.TreeSize > m.trusted.TreeSize {
+			query := url.Values{
+				"first":  {fmt.Sprint(m.trusted.TreeSize)},
+				"second": {fmt.Sprint(head.TreeSize)},
+			}
+			if err := m.get("/api/v1/log/consistency?"+query.Encode(), proof); err != nil {
+				return err
+			}
+		}
+		if err := domain.VerifyConsistency(m.trusted, &head, proof); err != nil {
+			return err
+		}
+		fmt.Printf("%s tree size %d consistent with %d\n", head.Timestamp.Format(time.RFC3339), head.TreeSize, m.trusted.TreeSize)
+	} else {
+		fmt.Printf("%s tree size %d trusted on first use\n", head.Timestamp.Format(time.RFC3339), head.TreeSize)
+	}
+
+	m.trusted = &head
+	return m.saveState()
+}
+
+// get decodes JSON document returned by server
+func (m *logMonitor) get(path string, v any) error {
+	resp, err := m.client.Get(m.server + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (m *logMonitor) loadState() error {
+	if m.statePath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var head domain.SignedTreeHead
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	// state file could be swapped as well as server answers
+	if err := domain.VerifyLogTreeHead(&head, m.key); err != nil {
+		return err
+	}
+	m.trusted = &head
+	return nil
+}
+
+func (m *logMonitor) saveState() error {
+	if m.statePath == "" {
+		return nil
+	}
+	data, err := json.Marshal(m.trusted)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.statePath, data, 0o644)
+}
+
+func init() {
+	rootCmd.AddCommand(monitorLogCmd)
+
+	monitorLogCmd.Flags().String("url", "http://localhost:8080", "Signature service URL")
+	monitorLogCmd.Flags().String("key", "./anchor/anchor-pub.pem", "Service public key, PEM")
+	monitorLogCmd.Flags().String("state", "", "File keeping the last verified tree head")
+	monitorLogCmd.Flags().Duration("interval", time.Minute, "Polling interval")
+	monitorLogCmd.Flags().Bool("once", false, "Check once and exit")
+}
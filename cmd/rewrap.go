@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/config"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/inmemory"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/mongo"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/postgres"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/spf13/cobra"
+)
+
+var rewrapKeysCmd = &cobra.Command{
+	Use:   "rewrap-keys",
+	Short: "Re-wrap device private keys with current master key",
+	Long: `Re-wraps data keys of all devices with current master key version, devices
+still stored in plaintext get encrypted. Key ring has to contain old master
+keys as well. Run it while service is stopped, afterwards old master keys
+can be removed from key ring.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := config.Load()
+
+		encryptor, err := newKeyEncryptor(cfg)
+		if err != nil {
+			log.Fatalf("failed to load master key: %v", err)
+		}
+		if encryptor.CurrentVersion() == "" {
+			log.Fatal("master key is not configured, set keys.master_key or keys.master_key_file")
+		}
+
+		var (
+			deviceRepo persistence.DeviceRepository
+			save       = func() error { return nil }
+		)
+		switch cfg.DBType {
+		case "postgres":
+			deviceRepo, _, _, _, _, _, _, err = postgres.NewRepositories(cfg.Postgres.DSN)
+		case "mongo":
+			deviceRepo, _, _, _, _, _, _, err = mongo.NewRepositories(cfg.Mongo.URI, cfg.Mongo.Database)
+		default: // inmemory
+			var store *inmemory.MemoryStore
+			store, err = inmemory.NewMemoryStore(cfg.InMemory.DBFilePath)
+			if err == nil {
+				deviceRepo, save = store.DeviceRepo, store.Save
+			}
+		}
+		if err != nil {
+			log.Fatalf("failed to initialize storage: %v", err)
+		}
+
+		result, err := persistence.RewrapKeys(context.Background(), deviceRepo, encryptor)
+		if err != nil {
+			log.Fatalf("rewrap failed after %d devices: %v", result.Rewrapped, err)
+		}
+		if err := save(); err != nil {
+			log.Fatalf("failed to save storage: %v", err)
+		}
+
+		fmt.Printf("Rewrapped %d device keys with master key %s, %d skipped\n",
+			result.Rewrapped, encryptor.CurrentVersion(), result.Skipped)
+	},
+}
+
+// newKeyEncryptor builds private key encryptor from configured key ring, when
+// no master key is configured keys are kept in plaintext
+func newKeyEncryptor(cfg config.Config) (crypto.KeyEncryptor, error) {
+	spec := cfg.Keys.MasterKey
+	if cfg.Keys.MasterKeyFile != "" {
+		data, err := os.ReadFile(cfg.Keys.MasterKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		spec += "\n" + string(data)
+	}
+	if strings.TrimSpace(spec) == "" {
+		return crypto.PlaintextEncryptor{}, nil
+	}
+	encryptor, err := crypto.ParseKeyRing(spec, cfg.Keys.MasterKeyVersion)
+	if err != nil {
+		return nil, err
+	}
+	return encryptor, nil
+}
+
+func init() {
+	rootCmd.AddCommand(rewrapKeysCmd)
+}
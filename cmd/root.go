@@ -31,6 +31,12 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Config file (yaml/json)")
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
 
+	// master key ring is shared by server and rewrap-keys commands
+	rootCmd.PersistentFlags().String("keys.master_key_file", "", "File with master key ring (version:base64key per line) used to encrypt private keys")
+	_ = viper.BindPFlag("keys.master_key_file", rootCmd.PersistentFlags().Lookup("keys.master_key_file"))
+	rootCmd.PersistentFlags().String("keys.master_key_version", "", "Master key version used for new keys, defaults to last key in ring")
+	_ = viper.BindPFlag("keys.master_key_version", rootCmd.PersistentFlags().Lookup("keys.master_key_version"))
+
 	viper.SetEnvPrefix("SIG") // np. SIG_PORT, SIG_DB_TYPE
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
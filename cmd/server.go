@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"context"
+	stdcrypto "crypto"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -13,6 +16,7 @@ import (
 	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/inmemory"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/mongo"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/postgres"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/logger"
 	"go.uber.org/zap"
 
@@ -32,6 +36,10 @@ var serverCmd = &cobra.Command{
 			deviceRepo    persistence.DeviceRepository
 			signatureRepo persistence.SignatureRepository
 			userRepo      persistence.UserRepository
+			signingStore  persistence.SigningStore
+			treeHeadRepo  persistence.TreeHeadRepository
+			logRepo       persistence.LogRepository
+			idempotency   persistence.IdempotencyStore
 			err           error
 		)
 		shutdownCtx, cancel := context.WithTimeout(cmd.Context(), 5*time.Second)
@@ -40,9 +48,9 @@ var serverCmd = &cobra.Command{
 
 		switch cfg.DBType {
 		case "postgres":
-			deviceRepo, signatureRepo, userRepo, err = postgres.NewRepositories(cfg.Postgres.DSN)
+			deviceRepo, signatureRepo, userRepo, signingStore, treeHeadRepo, logRepo, idempotency, err = postgres.NewRepositories(cfg.Postgres.DSN)
 		case "mongo":
-			deviceRepo, signatureRepo, userRepo, err = mongo.NewRepositories(cfg.Mongo.URI, cfg.Mongo.Database)
+			deviceRepo, signatureRepo, userRepo, signingStore, treeHeadRepo, logRepo, idempotency, err = mongo.NewRepositories(cfg.Mongo.URI, cfg.Mongo.Database)
 		default: // inmemory
 			inMemoryStore, err := inmemory.NewMemoryStore(cfg.InMemory.DBFilePath)
 			if err != nil {
@@ -52,6 +60,10 @@ var serverCmd = &cobra.Command{
 			deviceRepo = inMemoryStore.DeviceRepo
 			signatureRepo = inMemoryStore.SignatureRepo
 			userRepo = inMemoryStore.UserRepo
+			signingStore = inMemoryStore.SigningStore
+			treeHeadRepo = inMemoryStore.TreeHeadRepo
+			logRepo = inMemoryStore.LogRepo
+			idempotency = inMemoryStore.Idempotency
 			defer inMemoryStore.SaveOnShutdown(shutdownCtx)
 		}
 
@@ -59,7 +71,99 @@ var serverCmd = &cobra.Command{
 			logger.Fatal("failed to initialize storage", zap.Error(err))
 		}
 
-		router := api.NewRouter(deviceRepo, signatureRepo, userRepo)
+		keyPolicy := crypto.DefaultKeyPolicy
+		if cfg.Keys.MinRSAKeySize > 0 {
+			keyPolicy.MinRSAKeySize = cfg.Keys.MinRSAKeySize
+		}
+
+		// token backend is registered even when software keys are default,
+		// devices created earlier with token keys keep signing
+		if cfg.Keys.PKCS11.Module != "" {
+			hsm, err := crypto.NewPKCS11Backend(crypto.PKCS11Config{
+				ModulePath: cfg.Keys.PKCS11.Module,
+				TokenLabel: cfg.Keys.PKCS11.TokenLabel,
+				PIN:        cfg.Keys.PKCS11.PIN,
+			})
+			if err != nil {
+				logger.Fatal("failed to initialize PKCS#11 key backend", zap.Error(err))
+			}
+			defer hsm.Close()
+			if err := crypto.RegisterKeyBackend(hsm); err != nil {
+				logger.Fatal("failed to register PKCS#11 key backend", zap.Error(err))
+			}
+		}
+		if _, err := crypto.LookupKeyBackend(cfg.Keys.Backend); err != nil {
+			logger.Fatal("invalid key backend", zap.Error(err))
+		}
+		keyPolicy.Backend = cfg.Keys.Backend
+
+		encryptor, err := newKeyEncryptor(cfg)
+		if err != nil {
+			logger.Fatal("failed to load master key", zap.Error(err))
+		}
+		if encryptor.CurrentVersion() == "" {
+			logger.Warn("master key is not configured, device private keys are stored in plaintext")
+		}
+		deviceRepo = persistence.NewEncryptedDeviceRepository(deviceRepo, encryptor)
+		signingStore = persistence.NewEncryptedSigningStore(signingStore, encryptor)
+
+		var ca *crypto.CertificateAuthority
+		if cfg.CA.IntermediateKeyFile != "" {
+			ca, err = crypto.LoadCertificateAuthority(cfg.CA.RootCertFile, cfg.CA.IntermediateCertFile, cfg.CA.IntermediateKeyFile, cfg.CA.Validity)
+			if err != nil {
+				logger.Fatal("failed to load certificate authority", zap.Error(err))
+			}
+		} else {
+			logger.Warn("certificate authority is not configured, device certificates are not issued")
+		}
+
+		timestamper, tsa, tsaRoots, err := newTimestamping(cfg)
+		if err != nil {
+			logger.Fatal("failed to initialize time-stamping", zap.Error(err))
+		}
+		if timestamper != nil {
+			signingStore = persistence.NewTimestampingSigningStore(signingStore, timestamper)
+		} else {
+			logger.Warn("time-stamping authority is not configured, signatures are not time-stamped")
+		}
+
+		var anchorKey stdcrypto.PublicKey
+		if cfg.Anchor.KeyFile != "" {
+			key, err := crypto.LoadServiceKey(cfg.Anchor.KeyFile)
+			if err != nil {
+				logger.Fatal("failed to load anchoring key", zap.Error(err))
+			}
+			if cfg.Anchor.Interval <= 0 {
+				logger.Fatal("anchoring interval must be positive", zap.Duration("interval", cfg.Anchor.Interval))
+			}
+			anchorKey = key.Public()
+			anchorCtx, stopAnchoring := context.WithCancel(cmd.Context())
+			defer stopAnchoring()
+			go runPeriodically(anchorCtx, cfg.Anchor.Interval, func(ctx context.Context) {
+				anchor(ctx, logger, deviceRepo, signatureRepo, treeHeadRepo, logRepo, key)
+			})
+		} else {
+			logger.Warn("anchoring key is not configured, signature chains are not anchored and logged")
+		}
+
+		if cfg.Idempotency.Retention <= 0 {
+			logger.Fatal("idempotency retention must be positive", zap.Duration("retention", cfg.Idempotency.Retention))
+		}
+		if cfg.Idempotency.Lease < time.Second {
+			logger.Fatal("idempotency lease must be at least one second", zap.Duration("lease", cfg.Idempotency.Lease))
+		}
+		cleanupCtx, stopCleanup := context.WithCancel(cmd.Context())
+		defer stopCleanup()
+		go runPeriodically(cleanupCtx, idempotencyCleanupInterval, func(ctx context.Context) {
+			deleted, err := idempotency.DeleteExpired(ctx, time.Now())
+			if err != nil {
+				logger.Error("idempotency keys cleanup failed", zap.Error(err))
+			} else if deleted > 0 {
+				logger.Info("expired idempotency keys deleted", zap.Int("deleted", deleted))
+			}
+		})
+
+		router := api.NewRouter(deviceRepo, signatureRepo, userRepo, signingStore, treeHeadRepo, logRepo, idempotency, cfg.Idempotency.Retention, cfg.Idempotency.Lease, keyPolicy, ca, tsa, tsaRoots, anchorKey)
 
 		srv := &http.Server{
 			Addr:    fmt.Sprintf(":%s", cfg.Port),
@@ -88,6 +192,87 @@ var serverCmd = &cobra.Command{
 	},
 }
 
+// idempotencyCleanupInterval is how often expired idempotency keys are
+// deleted, expired key is free to reuse even before
+const idempotencyCleanupInterval = 10 * time.Minute
+
+// runPeriodically runs job every interval until context is done
+func runPeriodically(ctx context.Context, interval time.Duration, run func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run(ctx)
+		}
+	}
+}
+
+// anchor signs tree heads of grown device chains and appends new signatures
+// to signature log. Failures are logged and retried with the next run.
+func anchor(
+	ctx context.Context,
+	logger *zap.Logger,
+	devices persistence.DeviceRepository,
+	signatures persistence.SignatureRepository,
+	treeHeads persistence.TreeHeadRepository,
+	log persistence.LogRepository,
+	key stdcrypto.Signer,
+) {
+	anchored, err := persistence.AnchorChains(ctx, devices, signatures, treeHeads, key, time.Now())
+	if err != nil {
+		logger.Error("anchoring failed", zap.Error(err))
+	} else if anchored.Anchored > 0 {
+		logger.Info("signature chains anchored", zap.Int("anchored", anchored.Anchored))
+	}
+
+	logged, err := persistence.SequenceLog(ctx, devices, signatures, log, key, time.Now())
+	if err != nil {
+		logger.Error("signature log sequencing failed", zap.Error(err))
+	} else if logged.Appended > 0 {
+		logger.Info("signatures logged", zap.Int("appended", logged.Appended), zap.Uint64("tree_size", logged.TreeSize))
+	}
+}
+
+// newTimestamping selects embedded or remote TSA. Embedded TSA is returned
+// as well, so it can be served over HTTP. Roots trusted to issue tokens come
+// from roots file or, for embedded TSA, from its own chain.
+func newTimestamping(cfg config.Config) (crypto.Timestamper, *crypto.TimeStampAuthority, *x509.CertPool, error) {
+	var roots *x509.CertPool
+	if cfg.TSA.RootsFile != "" {
+		certs, err := crypto.ReadCertificates(cfg.TSA.RootsFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		roots = x509.NewCertPool()
+		for _, c := range certs {
+			roots.AddCert(c)
+		}
+	}
+
+	switch {
+	case cfg.TSA.KeyFile != "" && cfg.TSA.URL != "":
+		return nil, nil, nil, errors.New("tsa.key_file and tsa.url are mutually exclusive")
+	case cfg.TSA.KeyFile != "":
+		tsa, err := crypto.LoadTimeStampAuthority(cfg.TSA.CertFile, cfg.TSA.KeyFile, cfg.TSA.Policy)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if roots == nil {
+			roots = tsa.Roots()
+		}
+		return tsa, tsa, roots, nil
+	case cfg.TSA.URL != "":
+		client := &crypto.TimeStampClient{URL: cfg.TSA.URL, HTTPClient: &http.Client{Timeout: cfg.TSA.Timeout}}
+		return client, nil, roots, nil
+	default:
+		// tokens of signatures made earlier can still be verified
+		return nil, nil, roots, nil
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(serverCmd)
 
@@ -103,4 +288,48 @@ func init() {
 
 	serverCmd.Flags().String("db.inmemory.filepath", "./database/inmemory/database.json", "Database file path")
 	_ = viper.BindPFlag("db.inmemory.dbfilepath", serverCmd.Flags().Lookup("db.inmemory.filepath"))
+
+	serverCmd.Flags().Int("keys.min_rsa_key_size", crypto.DefaultKeyPolicy.MinRSAKeySize, "Minimal RSA key size accepted for new devices")
+	_ = viper.BindPFlag("keys.min_rsa_key_size", serverCmd.Flags().Lookup("keys.min_rsa_key_size"))
+
+	serverCmd.Flags().String("ca.root_cert_file", "", "Self-signed root CA certificate (PEM)")
+	_ = viper.BindPFlag("ca.root_cert_file", serverCmd.Flags().Lookup("ca.root_cert_file"))
+	serverCmd.Flags().String("ca.intermediate_cert_file", "", "Intermediate CA certificate issuing device certificates (PEM)")
+	_ = viper.BindPFlag("ca.intermediate_cert_file", serverCmd.Flags().Lookup("ca.intermediate_cert_file"))
+	serverCmd.Flags().String("ca.intermediate_key_file", "", "Intermediate CA private key (PEM)")
+	_ = viper.BindPFlag("ca.intermediate_key_file", serverCmd.Flags().Lookup("ca.intermediate_key_file"))
+	serverCmd.Flags().Duration("ca.validity", crypto.DefaultCertificateValidity, "Validity of issued device certificates")
+	_ = viper.BindPFlag("ca.validity", serverCmd.Flags().Lookup("ca.validity"))
+
+	serverCmd.Flags().String("keys.backend", crypto.KeyBackendSoftware, "Key backend for new devices (software|pkcs11)")
+	_ = viper.BindPFlag("keys.backend", serverCmd.Flags().Lookup("keys.backend"))
+	serverCmd.Flags().String("keys.pkcs11.module", "", "Path to PKCS#11 module, e.g. libsofthsm2.so")
+	_ = viper.BindPFlag("keys.pkcs11.module", serverCmd.Flags().Lookup("keys.pkcs11.module"))
+	serverCmd.Flags().String("keys.pkcs11.token_label", "", "Label of PKCS#11 token holding device keys")
+	_ = viper.BindPFlag("keys.pkcs11.token_label", serverCmd.Flags().Lookup("keys.pkcs11.token_label"))
+	serverCmd.Flags().String("keys.pkcs11.pin", "", "User PIN of PKCS#11 token")
+	_ = viper.BindPFlag("keys.pkcs11.pin", serverCmd.Flags().Lookup("keys.pkcs11.pin"))
+
+	serverCmd.Flags().String("tsa.url", "", "URL of remote RFC 3161 time-stamping authority")
+	_ = viper.BindPFlag("tsa.url", serverCmd.Flags().Lookup("tsa.url"))
+	serverCmd.Flags().String("tsa.cert_file", "", "Embedded TSA certificate chain, TSA certificate first (PEM)")
+	_ = viper.BindPFlag("tsa.cert_file", serverCmd.Flags().Lookup("tsa.cert_file"))
+	serverCmd.Flags().String("tsa.key_file", "", "Embedded TSA private key (PEM)")
+	_ = viper.BindPFlag("tsa.key_file", serverCmd.Flags().Lookup("tsa.key_file"))
+	serverCmd.Flags().String("tsa.policy", "", "Policy OID of embedded TSA tokens, anyPolicy by default")
+	_ = viper.BindPFlag("tsa.policy", serverCmd.Flags().Lookup("tsa.policy"))
+	serverCmd.Flags().String("tsa.roots_file", "", "Roots trusted to issue time-stamp tokens (PEM)")
+	_ = viper.BindPFlag("tsa.roots_file", serverCmd.Flags().Lookup("tsa.roots_file"))
+	serverCmd.Flags().Duration("tsa.timeout", 10*time.Second, "Timeout of remote TSA requests")
+	_ = viper.BindPFlag("tsa.timeout", serverCmd.Flags().Lookup("tsa.timeout"))
+
+	serverCmd.Flags().String("anchor.key_file", "", "Service key signing Merkle tree heads of signature chains and log (PEM)")
+	_ = viper.BindPFlag("anchor.key_file", serverCmd.Flags().Lookup("anchor.key_file"))
+	serverCmd.Flags().Duration("anchor.interval", time.Minute, "Interval of anchoring signature chains and log")
+	_ = viper.BindPFlag("anchor.interval", serverCmd.Flags().Lookup("anchor.interval"))
+
+	serverCmd.Flags().Duration("idempotency.retention", 24*time.Hour, "How long responses of requests with Idempotency-Key are replayed")
+	_ = viper.BindPFlag("idempotency.retention", serverCmd.Flags().Lookup("idempotency.retention"))
+	serverCmd.Flags().Duration("idempotency.lease", time.Minute, "How long key of running request stays reserved without being extended")
+	_ = viper.BindPFlag("idempotency.lease", serverCmd.Flags().Lookup("idempotency.lease"))
 }
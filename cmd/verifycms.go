@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/spf13/cobra"
+)
+
+var verifyCMSCmd = &cobra.Command{
+	Use:   "verify-cms",
+	Short: "Verify detached CMS signature of document",
+	Long: `Verifies detached CMS SignedData produced by POST /api/v1/devices/{id}/sign/cms
+against signed document. Signer certificate embedded in signature has to chain
+to root given by --ca. Works offline, server isn't needed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		signaturePath, _ := cmd.Flags().GetString("signature")
+		contentPath, _ := cmd.Flags().GetString("content")
+		caPath, _ := cmd.Flags().GetString("ca")
+
+		signature, err := os.ReadFile(signaturePath)
+		if err != nil {
+			log.Fatalf("failed to read signature: %v", err)
+		}
+		// both DER and PEM output of server is accepted
+		if block, _ := pem.Decode(signature); block != nil {
+			signature = block.Bytes
+		}
+		caPEM, err := os.ReadFile(caPath)
+		if err != nil {
+			log.Fatalf("failed to read CA: %v", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			log.Fatalf("no PEM certificates in %s", caPath)
+		}
+		content, err := os.Open(contentPath)
+		if err != nil {
+			log.Fatalf("failed to open content: %v", err)
+		}
+		defer content.Close()
+
+		result, err := crypto.VerifyDetachedCMS(signature, content, roots)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "verification failed: %v\n", err)
+			os.Exit(1)
+		}
+
+		var uris []string
+		for _, u := range result.Signer.URIs {
+			uris = append(uris, u.String())
+		}
+		fmt.Println("Verification successful")
+		fmt.Printf("Signer:       %s\n", result.Signer.Subject)
+		fmt.Printf("Identities:   %s\n", strings.Join(uris, ", "))
+		fmt.Printf("Issuer:       %s\n", result.Signer.Issuer)
+		fmt.Printf("Signing time: %s\n", result.SigningTime)
+		fmt.Printf("Digest:       %s\n", result.Digest)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCMSCmd)
+
+	verifyCMSCmd.Flags().String("signature", "", "CMS signature file, DER or PEM")
+	verifyCMSCmd.Flags().String("content", "", "Signed document")
+	verifyCMSCmd.Flags().String("ca", "./ca/root.pem", "Trusted root certificates, PEM")
+	_ = verifyCMSCmd.MarkFlagRequired("signature")
+	_ = verifyCMSCmd.MarkFlagRequired("content")
+}
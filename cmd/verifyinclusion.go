@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/spf13/cobra"
+)
+
+var verifyInclusionCmd = &cobra.Command{
+	Use:   "verify-inclusion",
+	Short: "Verify inclusion proof of signature in signed tree head",
+	Long: `Verifies proof returned by GET /api/v1/signatures/{id}/inclusion-proof
+against service public key given by --key. Works offline, server isn't needed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		proofPath, _ := cmd.Flags().GetString("proof")
+		keyPath, _ := cmd.Flags().GetString("key")
+
+		data, err := os.ReadFile(proofPath)
+		if err != nil {
+			log.Fatalf("failed to read proof: %v", err)
+		}
+		var proof domain.InclusionProof
+		if err := json.Unmarshal(data, &proof); err != nil {
+			log.Fatalf("failed to parse proof: %v", err)
+		}
+		keyPEM, err := os.ReadFile(keyPath)
+		if err != nil {
+			log.Fatalf("failed to read key: %v", err)
+		}
+		key, err := crypto.ParsePublicKeyPEM(keyPEM)
+		if err != nil {
+			log.Fatalf("failed to parse key: %v", err)
+		}
+
+		if err := domain.VerifyInclusionProof(&proof, key); err != nil {
+			fmt.Fprintf(os.Stderr, "verification failed: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Verification successful")
+		fmt.Printf("Signature:  %s\n", proof.SignatureID)
+		fmt.Printf("Device:     %s\n", proof.TreeHead.DeviceID)
+		fmt.Printf("Leaf:       %d of %d\n", proof.LeafIndex, proof.TreeHead.TreeSize)
+		fmt.Printf("Root hash:  %s\n", base64.StdEncoding.EncodeToString(proof.TreeHead.RootHash))
+		fmt.Printf("Anchored:   %s\n", proof.TreeHead.Timestamp)
+		fmt.Printf("Key:        %s\n", proof.TreeHead.KeyID)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyInclusionCmd)
+
+	verifyInclusionCmd.Flags().String("proof", "", "Inclusion proof, JSON")
+	verifyInclusionCmd.Flags().String("key", "./anchor/anchor-pub.pem", "Service public key, PEM")
+	_ = verifyInclusionCmd.MarkFlagRequired("proof")
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
+)
+
+// AlgorithmHandler exposes signing algorithms supported by service
+type AlgorithmHandler struct{}
+
+// NewAlgorithmHandler used to create algorithm handler
+func NewAlgorithmHandler() *AlgorithmHandler {
+	return &AlgorithmHandler{}
+}
+
+// AlgorithmResponse describes single algorithm which can be used by device
+type AlgorithmResponse struct {
+	Name               string                     `json:"name"`
+	SignatureEncodings []crypto.SignatureEncoding `json:"signature_encodings,omitempty"`
+	DefaultEncoding    crypto.SignatureEncoding   `json:"default_encoding,omitempty"`
+	Curves             []string                   `json:"curves,omitempty"`
+	Hashes             []crypto.HashAlgorithm     `json:"hashes,omitempty"`
+	Paddings           []crypto.RSAPadding        `json:"paddings,omitempty"`
+	DefaultParams      crypto.KeyParams           `json:"default_params"`
+}
+
+// ListAlgorithms returns algorithms from crypto registry
+func (h *AlgorithmHandler) ListAlgorithms(w http.ResponseWriter, r *http.Request) error {
+	var list []AlgorithmResponse
+	for _, a := range crypto.Algorithms() {
+		resp := AlgorithmResponse{
+			Name:               a.Name,
+			SignatureEncodings: a.Encodings,
+			Curves:             a.Curves,
+			Hashes:             a.Hashes,
+			Paddings:           a.Paddings,
+			DefaultParams:      a.DefaultParams,
+		}
+		if len(a.Encodings) > 0 {
+			resp.DefaultEncoding = a.Encodings[0]
+		}
+		list = append(list, resp)
+	}
+	jsonw.Success(w, list, http.StatusOK)
+	return nil
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// helper type to decode algorithms response
+type algorithmsResponse struct {
+	Status string              `json:"status"`
+	Data   []AlgorithmResponse `json:"data"`
+}
+
+func TestListAlgorithms(t *testing.T) {
+	h := NewAlgorithmHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/algorithms", nil)
+	w := httptest.NewRecorder()
+
+	if err := h.ListAlgorithms(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp algorithmsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+
+	got := map[string]AlgorithmResponse{}
+	for _, a := range resp.Data {
+		got[a.Name] = a
+	}
+	for _, name := range []string{"RSA", "ECC", "ED25519"} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("expected algorithm %s to be listed", name)
+		}
+	}
+	if got["ECC"].DefaultEncoding != "ASN1_DER" {
+		t.Errorf("expected ECC default encoding ASN1_DER, got %q", got["ECC"].DefaultEncoding)
+	}
+}
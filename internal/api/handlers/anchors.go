@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	stdcrypto "crypto"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
+)
+
+// AnchorHandler serves inclusion proofs of signatures in signed Merkle tree
+// heads and service key verifying them
+type AnchorHandler struct {
+	signatureRepo persistence.SignatureRepository
+	treeHeadRepo  persistence.TreeHeadRepository
+	publicKey     stdcrypto.PublicKey
+}
+
+// NewAnchorHandler used to create anchoring handler
+func NewAnchorHandler(signatureRepo persistence.SignatureRepository, treeHeadRepo persistence.TreeHeadRepository, publicKey stdcrypto.PublicKey) *AnchorHandler {
+	return &AnchorHandler{signatureRepo: signatureRepo, treeHeadRepo: treeHeadRepo, publicKey: publicKey}
+}
+
+// GetInclusionProof returns audit path of signature in the earliest tree head
+// covering it. Proof is returned without response envelope, so it can be
+// stored and verified offline with service public key.
+func (h *AnchorHandler) GetInclusionProof(w http.ResponseWriter, r *http.Request) error {
+	signature, err := h.signatureRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil || signature == nil {
+		jsonw.Error(w, "signature not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrSignatureNotFound, err)
+	}
+	records, err := h.signatureRepo.ListByDevice(r.Context(), signature.DeviceID)
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrListSignatures, err)
+	}
+	heads, err := h.treeHeadRepo.ListByDevice(r.Context(), signature.DeviceID)
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrInclusionProof, err)
+	}
+
+	proof, err := domain.NewInclusionProof(signature.ID, records, heads)
+	if errors.Is(err, domain.ErrNotAnchored) {
+		jsonw.Error(w, err.Error(), nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrInclusionProof, err)
+	}
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrInclusionProof, err)
+	}
+	return writeJSON(w, "application/json", proof)
+}
+
+// GetServiceKey returns PEM public key verifying tree heads
+func (h *AnchorHandler) GetServiceKey(w http.ResponseWriter, r *http.Request) error {
+	encoded, err := crypto.EncodePublicKeyPEM(h.publicKey)
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrPublishKey, err)
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(encoded)
+	return err
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/mocks/database"
+)
+
+func TestGetInclusionProof(t *testing.T) {
+	keyPEM, publicPEM, err := crypto.GenerateServiceKey()
+	if err != nil {
+		t.Fatalf("generate service key: %v", err)
+	}
+	key, err := crypto.ParseCAKey(keyPEM)
+	if err != nil {
+		t.Fatalf("parse service key: %v", err)
+	}
+
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	var records []*domain.SignatureRecord
+	for _, id := range []string{"sig-0", "sig-1", "sig-2"} {
+		signedData, signature, err := domain.SignData(device, id)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		records = append(records, &domain.SignatureRecord{
+			ID: id, DeviceID: device.ID, Counter: device.SignatureCounter,
+			SignedData: signedData, Signature: signature, CreatedAt: time.Now(),
+		})
+		device.IncrementCounter(signature)
+	}
+	head, err := domain.BuildTreeHead(device.ID, records[:2], time.Now())
+	if err != nil {
+		t.Fatalf("build tree head: %v", err)
+	}
+	if err := domain.SignTreeHead(head, key); err != nil {
+		t.Fatalf("sign tree head: %v", err)
+	}
+
+	signatureRepo := &database.MockSignatureRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureRecord, error) {
+			for _, rec := range records {
+				if rec.ID == id {
+					return rec, nil
+				}
+			}
+			return nil, errors.New("signature not found")
+		},
+		ListByDeviceFn: func(ctx context.Context, deviceID string) ([]*domain.SignatureRecord, error) {
+			return records, nil
+		},
+	}
+	treeHeadRepo := &database.MockTreeHeadRepo{
+		ListByDeviceFn: func(ctx context.Context, deviceID string) ([]*domain.TreeHead, error) {
+			return []*domain.TreeHead{head}, nil
+		},
+	}
+	h := NewAnchorHandler(signatureRepo, treeHeadRepo, key.Public())
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "anchored signature", id: "sig-1", wantStatus: http.StatusOK},
+		{name: "signature not anchored yet", id: "sig-2", wantStatus: http.StatusNotFound, wantErr: true},
+		{name: "unknown signature", id: "sig-9", wantStatus: http.StatusNotFound, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/signatures/"+tc.id+"/inclusion-proof", nil)
+			req.SetPathValue("id", tc.id)
+			w := httptest.NewRecorder()
+
+			err := h.GetInclusionProof(w, req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected %d, got %d", tc.wantStatus, w.Code)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			// proof is verified offline with published key only
+			var proof domain.InclusionProof
+			if err := json.Unmarshal(w.Body.Bytes(), &proof); err != nil {
+				t.Fatalf("decode proof: %v", err)
+			}
+			keyReq := httptest.NewRequest(http.MethodGet, "/api/v1/anchors/key", nil)
+			keyW := httptest.NewRecorder()
+			if err := h.GetServiceKey(keyW, keyReq); err != nil {
+				t.Fatalf("get service key: %v", err)
+			}
+			if keyW.Body.String() != string(publicPEM) {
+				t.Fatalf("expected published service key")
+			}
+			published, err := crypto.ParsePublicKeyPEM(keyW.Body.Bytes())
+			if err != nil {
+				t.Fatalf("parse published key: %v", err)
+			}
+			if err := domain.VerifyInclusionProof(&proof, published); err != nil {
+				t.Fatalf("verify proof: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/validation"
+)
+
+// maxCertificateChainSize limits uploaded PEM chain
+const maxCertificateChainSize = 64 << 10
+
+// CertificateHandler hands out X.509 certificates of device keys
+type CertificateHandler struct {
+	deviceRepo   persistence.DeviceRepository
+	signingStore persistence.SigningStore
+	// ca is nil when service CA is not configured
+	ca *crypto.CertificateAuthority
+}
+
+// NewCertificateHandler used to create certificate handler
+func NewCertificateHandler(
+	deviceRepo persistence.DeviceRepository,
+	signingStore persistence.SigningStore,
+	ca *crypto.CertificateAuthority,
+) *CertificateHandler {
+	return &CertificateHandler{deviceRepo: deviceRepo, signingStore: signingStore, ca: ca}
+}
+
+// GetCertificate returns stored certificate of device current key, it's never
+// issued here. Format "pem" (default) returns whole chain, "der" device
+// certificate only.
+func (h *CertificateHandler) GetCertificate(w http.ResponseWriter, r *http.Request) error {
+	deviceID := r.PathValue("id")
+	format, err := validFormat(w, r)
+	if err != nil {
+		return err
+	}
+
+	device, err := h.deviceRepo.GetByID(r.Context(), deviceID)
+	if err != nil {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+	if !device.HasValidCertificate(time.Now()) {
+		jsonw.Error(w, "device has no valid certificate", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - device %s", ErrCertificateNotFound, device.ID)
+	}
+
+	return writeDER(w, format, "CERTIFICATE", "application/pkix-cert", device.CertificateChain)
+}
+
+// IssueCertificate certifies device current key with service CA and returns
+// chain like GetCertificate. Valid certificate is returned as it is, so it's
+// issued again only after key rotation or expiry.
+func (h *CertificateHandler) IssueCertificate(w http.ResponseWriter, r *http.Request) error {
+	format, err := validFormat(w, r)
+	if err != nil {
+		return err
+	}
+
+	device, err := h.deviceRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+	if !device.HasValidCertificate(time.Now()) {
+		if err := issueCertificate(w, r, h.signingStore, h.ca, device); err != nil {
+			return err
+		}
+	}
+
+	return writeDER(w, format, "CERTIFICATE", "application/pkix-cert", device.CertificateChain)
+}
+
+// issueCertificate certifies device current key with service CA and stores
+// chain, error response is written on failure
+func issueCertificate(w http.ResponseWriter, r *http.Request, signingStore persistence.SigningStore, ca *crypto.CertificateAuthority, device *domain.SignatureDevice) error {
+	if ca == nil {
+		jsonw.Error(w, "certificate authority is not configured", nil, http.StatusServiceUnavailable)
+		return ErrNoCertificateAuthority
+	}
+	if err := domain.IssueCertificate(device, ca); err != nil {
+		switch {
+		case errors.Is(err, domain.ErrDeviceDeactivated):
+			jsonw.Error(w, err.Error(), nil, http.StatusConflict)
+		case errors.Is(err, domain.ErrExternalCertificate):
+			jsonw.Error(w, "device certificate is issued by external CA, upload renewed chain", nil, http.StatusConflict)
+		default:
+			jsonw.Error(w, "failed to issue certificate", nil, http.StatusInternalServerError)
+		}
+		return fmt.Errorf("%v - %v", ErrIssueCertificate, err)
+	}
+	err := signingStore.UpdateCertificate(r.Context(), device.ID, device.SigningKeyVersion, device.CertificateChain)
+	if errors.Is(err, persistence.ErrKeyVersionChanged) {
+		jsonw.Error(w, "device key was rotated, retry request", nil, http.StatusConflict)
+		return fmt.Errorf("%v - %v", ErrIssueCertificate, err)
+	}
+	if err != nil {
+		jsonw.Error(w, "failed to store certificate", nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrIssueCertificate, err)
+	}
+	return nil
+}
+
+// writeDER writes DER encoded objects as PEM blocks or, for "der" format,
+// first object only
+func writeDER(w http.ResponseWriter, format, pemType, derContentType string, objects [][]byte) error {
+	if format == "der" {
+		w.Header().Set("Content-Type", derContentType)
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write(objects[0])
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.WriteHeader(http.StatusOK)
+	for _, der := range objects {
+		if err := pem.Encode(w, &pem.Block{Type: pemType, Bytes: der}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validFormat checks format query parameter of endpoints returning PEM or DER
+func validFormat(w http.ResponseWriter, r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "pem" && format != "der" {
+		jsonw.Error(w, "format must be pem or der", nil, http.StatusBadRequest)
+		return "", fmt.Errorf("%v - unsupported format %q", ErrBadRequest, format)
+	}
+	return format, nil
+}
+
+// CreateCSRRequest holds subject of certificate signing request, common name
+// defaults to device ID
+type CreateCSRRequest struct {
+	CommonName         string `json:"common_name" validate:"omitempty,max=64"`
+	Organization       string `json:"organization"`
+	OrganizationalUnit string `json:"organizational_unit"`
+	Country            string `json:"country" validate:"omitempty,len=2"`
+	Province           string `json:"province"`
+	Locality           string `json:"locality"`
+}
+
+func (req CreateCSRRequest) subject() pkix.Name {
+	return pkix.Name{
+		CommonName:         req.CommonName,
+		Organization:       optionalAttribute(req.Organization),
+		OrganizationalUnit: optionalAttribute(req.OrganizationalUnit),
+		Country:            optionalAttribute(req.Country),
+		Province:           optionalAttribute(req.Province),
+		Locality:           optionalAttribute(req.Locality),
+	}
+}
+
+// optionalAttribute leaves empty subject attributes out of name
+func optionalAttribute(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+// CreateCSR returns PKCS#10 certificate signing request signed by device key,
+// so device can be certified by external CA. Body with subject is optional.
+func (h *CertificateHandler) CreateCSR(w http.ResponseWriter, r *http.Request) error {
+	format, err := validFormat(w, r)
+	if err != nil {
+		return err
+	}
+	var req CreateCSRRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		jsonw.Error(w, "invalid json", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - %v", ErrInvalidJson, err)
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+		return err
+	}
+
+	device, err := h.deviceRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+	csr, err := domain.CreateCertificateRequest(device, req.subject())
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusUnprocessableEntity)
+		return fmt.Errorf("%v - %v", ErrCreateCSR, err)
+	}
+	return writeDER(w, format, "CERTIFICATE REQUEST", "application/pkcs10", [][]byte{csr})
+}
+
+// CertificateResponse describes stored device certificate
+type CertificateResponse struct {
+	DeviceID          string    `json:"device_id"`
+	SigningKeyVersion int       `json:"signing_key_version"`
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SerialNumber      string    `json:"serial_number"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	ChainLength       int       `json:"chain_length"`
+}
+
+// UploadCertificate stores certificate chain issued by external CA for device
+// current key. Body is PEM, device certificate first followed by CA
+// certificates. It replaces certificate issued by service CA.
+func (h *CertificateHandler) UploadCertificate(w http.ResponseWriter, r *http.Request) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCertificateChainSize+1))
+	if err != nil || len(body) > maxCertificateChainSize {
+		jsonw.Error(w, "certificate chain is too large", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - certificate chain is too large", ErrBadRequest)
+	}
+	var chain [][]byte
+	for block, rest := pem.Decode(body); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		jsonw.Error(w, "body must contain PEM certificates", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - no PEM certificates", ErrBadRequest)
+	}
+
+	device, err := h.deviceRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+	if err := device.AttachCertificateChain(chain, time.Now()); err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - %v", ErrUploadCertificate, err)
+	}
+	err = h.signingStore.UpdateCertificate(r.Context(), device.ID, device.SigningKeyVersion, device.CertificateChain)
+	if errors.Is(err, persistence.ErrKeyVersionChanged) {
+		jsonw.Error(w, "device key was rotated, certificate doesn't match it anymore", nil, http.StatusConflict)
+		return fmt.Errorf("%v - %v", ErrUploadCertificate, err)
+	}
+	if err != nil {
+		jsonw.Error(w, "failed to store certificate", nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrUploadCertificate, err)
+	}
+
+	leaf, _ := x509.ParseCertificate(chain[0])
+	jsonw.Success(w, CertificateResponse{
+		DeviceID:          device.ID,
+		SigningKeyVersion: device.SigningKeyVersion,
+		Subject:           leaf.Subject.String(),
+		Issuer:            leaf.Issuer.String(),
+		SerialNumber:      leaf.SerialNumber.Text(16),
+		NotBefore:         leaf.NotBefore,
+		NotAfter:          leaf.NotAfter,
+		ChainLength:       len(chain),
+	}, http.StatusOK)
+	return nil
+}
@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/mocks/database"
+)
+
+// newTestCA generates CA files and loads them the way server does
+func newTestCA(t *testing.T) *crypto.CertificateAuthority {
+	t.Helper()
+	material, err := crypto.GenerateCertificateAuthority("Test", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("generate CA: %v", err)
+	}
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"root.pem":             material.RootCert,
+		"intermediate.pem":     material.IntermediateCert,
+		"intermediate-key.pem": material.IntermediateKey,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	ca, err := crypto.LoadCertificateAuthority(
+		filepath.Join(dir, "root.pem"), filepath.Join(dir, "intermediate.pem"), filepath.Join(dir, "intermediate-key.pem"), time.Hour)
+	if err != nil {
+		t.Fatalf("load CA: %v", err)
+	}
+	return ca
+}
+
+func getCertificate(t *testing.T, h *CertificateHandler, format string) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/devices/dev-1/certificate?format="+format, nil)
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	return w, h.GetCertificate(w, req)
+}
+
+func postCertificate(t *testing.T, h *CertificateHandler, format string) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/certificate?format="+format, nil)
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	return w, h.IssueCertificate(w, req)
+}
+
+// expiredCertificate returns leaf certificate of device key which expired an
+// hour ago, signed by key of unrelated CA
+func expiredCertificate(t *testing.T, device *domain.SignatureDevice) []byte {
+	t.Helper()
+	pub, err := device.ParsePublicKey()
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	issuer := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "External CA"}}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: device.ID},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-time.Hour),
+	}, issuer, pub, caKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return der
+}
+
+func TestIssueCertificate_IssuesAndStores(t *testing.T) {
+	ca := newTestCA(t)
+	device := newTestDevice(t, domain.AlgorithmECC)
+	device.UserID = "user-1"
+	device.Label = "till 7"
+
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	updates := 0
+	signingStore := &database.MockSigningStore{
+		UpdateCertificateFn: func(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+			updates++
+			device.CertificateChain = chain
+			return nil
+		},
+	}
+	h := NewCertificateHandler(deviceRepo, signingStore, ca)
+
+	w, err := postCertificate(t, h, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-pem-file" {
+		t.Fatalf("expected PEM response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var certs []*x509.Certificate
+	for rest := w.Body.Bytes(); ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("parse certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) != 3 {
+		t.Fatalf("expected device, intermediate and root certificate, got %d", len(certs))
+	}
+
+	leaf := certs[0]
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(certs[1])
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: ca.Roots(), Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		t.Fatalf("certificate doesn't chain to CA root: %v", err)
+	}
+	if leaf.Subject.CommonName != "dev-1" || len(leaf.URIs) != 2 || leaf.URIs[1].String() != "urn:signing-user:user-1" {
+		t.Errorf("unexpected subject %s %v", leaf.Subject, leaf.URIs)
+	}
+	pub, _ := device.ParsePublicKey()
+	if !crypto.SamePublicKey(pub, leaf.PublicKey) {
+		t.Errorf("certificate doesn't hold device public key")
+	}
+
+	// stored certificate is reused, DER returns device certificate only
+	w, err = getCertificate(t, h, "der")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updates != 1 {
+		t.Errorf("expected certificate to be issued once, got %d", updates)
+	}
+	if string(w.Body.Bytes()) != string(leaf.Raw) {
+		t.Errorf("expected DER device certificate")
+	}
+}
+
+func TestIssueCertificate_RenewedAfterRotation(t *testing.T) {
+	ca := newTestCA(t)
+	device := newTestDevice(t, domain.AlgorithmRSA)
+	if err := domain.IssueCertificate(device, ca); err != nil {
+		t.Fatalf("issue certificate: %v", err)
+	}
+	if _, _, err := domain.RotateKey(device); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	var storedVersion int
+	signingStore := &database.MockSigningStore{
+		UpdateCertificateFn: func(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+			storedVersion = keyVersion
+			return nil
+		},
+	}
+	h := NewCertificateHandler(deviceRepo, signingStore, ca)
+
+	if _, err := postCertificate(t, h, "der"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if storedVersion != 1 || !device.HasValidCertificate(time.Now()) {
+		t.Errorf("expected certificate for rotated key version 1, got version %d", storedVersion)
+	}
+}
+
+func TestGetCertificate_AfterRotation(t *testing.T) {
+	ca := newTestCA(t)
+	device := newTestDevice(t, domain.AlgorithmECC)
+	if err := domain.IssueCertificate(device, ca); err != nil {
+		t.Fatalf("issue certificate: %v", err)
+	}
+
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			return fn(device)
+		},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/rotate-key", nil)
+	req.SetPathValue("id", "dev-1")
+	if err := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, ca).RotateKey(httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	w, err := getCertificate(t, NewCertificateHandler(deviceRepo, signingStore, ca), "der")
+	if err != nil {
+		t.Fatalf("expected certificate right after rotation: %v", err)
+	}
+	cert, err := x509.ParseCertificate(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	pub, err := device.ParsePublicKey()
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	if !pub.(*ecdsa.PublicKey).Equal(cert.PublicKey) || device.SigningKeyVersion != 1 {
+		t.Errorf("expected certificate of rotated key")
+	}
+}
+
+func TestGetCertificate_NotIssued(t *testing.T) {
+	tests := map[string]struct {
+		expired bool
+	}{
+		"no certificate": {},
+		"expired":        {expired: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			device := newTestDevice(t, domain.AlgorithmECC)
+			if tc.expired {
+				device.CertificateChain = [][]byte{expiredCertificate(t, device)}
+			}
+			deviceRepo := &database.MockDeviceRepo{
+				GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+					return device, nil
+				},
+			}
+			signingStore := &database.MockSigningStore{
+				UpdateCertificateFn: func(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+					t.Errorf("certificate must not be stored by GET")
+					return nil
+				},
+			}
+			h := NewCertificateHandler(deviceRepo, signingStore, newTestCA(t))
+
+			w, err := getCertificate(t, h, "")
+			if err == nil || w.Code != http.StatusNotFound {
+				t.Fatalf("expected 404, got %d (%v)", w.Code, err)
+			}
+		})
+	}
+}
+
+func TestIssueCertificate_Errors(t *testing.T) {
+	tests := map[string]struct {
+		ca          bool
+		format      string
+		updateErr   error
+		missing     bool
+		deactivated bool
+		external    bool
+		wantStatus  int
+		wantUpdates int
+	}{
+		"no CA":            {wantStatus: http.StatusServiceUnavailable},
+		"bad format":       {ca: true, format: "p7b", wantStatus: http.StatusBadRequest},
+		"device missing":   {ca: true, missing: true, wantStatus: http.StatusNotFound},
+		"key rotated":      {ca: true, updateErr: persistence.ErrKeyVersionChanged, wantStatus: http.StatusConflict, wantUpdates: 1},
+		"deactivated":      {ca: true, deactivated: true, wantStatus: http.StatusConflict},
+		"external expired": {ca: true, external: true, wantStatus: http.StatusConflict},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			device := newTestDevice(t, domain.AlgorithmEd25519)
+			if tc.deactivated {
+				device.Status = domain.DeviceStatusDeactivated
+			}
+			if tc.external {
+				device.CertificateChain = [][]byte{expiredCertificate(t, device)}
+			}
+			deviceRepo := &database.MockDeviceRepo{
+				GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+					if tc.missing {
+						return nil, persistence.ErrDeviceNotFound
+					}
+					return device, nil
+				},
+			}
+			updates := 0
+			signingStore := &database.MockSigningStore{
+				UpdateCertificateFn: func(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+					updates++
+					return tc.updateErr
+				},
+			}
+			var ca *crypto.CertificateAuthority
+			if tc.ca {
+				ca = newTestCA(t)
+			}
+			h := NewCertificateHandler(deviceRepo, signingStore, ca)
+
+			w, err := postCertificate(t, h, tc.format)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if w.Code != tc.wantStatus || updates != tc.wantUpdates {
+				t.Errorf("expected status %d with %d updates, got %d with %d", tc.wantStatus, tc.wantUpdates, w.Code, updates)
+			}
+		})
+	}
+}
+
+func TestCreateCSR(t *testing.T) {
+	tests := map[string]struct {
+		algorithm domain.AlgorithmType
+		params    crypto.KeyParams
+		padding   crypto.RSAPadding
+		encoding  crypto.SignatureEncoding
+		want      x509.SignatureAlgorithm
+	}{
+		"rsa":        {algorithm: domain.AlgorithmRSA, params: crypto.KeyParams{Hash: crypto.HashSHA384}, want: x509.SHA384WithRSA},
+		"rsa pss":    {algorithm: domain.AlgorithmRSA, padding: crypto.PaddingPSS, want: x509.SHA256WithRSAPSS},
+		"ecc p1363":  {algorithm: domain.AlgorithmECC, encoding: crypto.EncodingP1363, want: x509.ECDSAWithSHA256},
+		"ecc sha512": {algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Curve: crypto.CurveP521, Hash: crypto.HashSHA512}, want: x509.ECDSAWithSHA512},
+		"ed25519":    {algorithm: domain.AlgorithmEd25519, want: x509.PureEd25519},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "dev-1", UserID: "user-1", Algorithm: tc.algorithm}
+			if err := device.ConfigureKeyParams(tc.params, crypto.DefaultKeyPolicy); err != nil {
+				t.Fatalf("configure params: %v", err)
+			}
+			if err := device.ConfigureSignatureEncoding(tc.encoding); err != nil {
+				t.Fatalf("configure encoding: %v", err)
+			}
+			if err := device.ConfigurePadding(tc.padding, 0); err != nil {
+				t.Fatalf("configure padding: %v", err)
+			}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+			deviceRepo := &database.MockDeviceRepo{
+				GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+					return device, nil
+				},
+			}
+			h := NewCertificateHandler(deviceRepo, &database.MockSigningStore{}, nil)
+
+			body := `{"common_name":"till-7","organization":"Shop","country":"DE"}`
+			req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/csr?format=der", strings.NewReader(body))
+			req.SetPathValue("id", "dev-1")
+			w := httptest.NewRecorder()
+			if err := h.CreateCSR(w, req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			csr, err := x509.ParseCertificateRequest(w.Body.Bytes())
+			if err != nil {
+				t.Fatalf("parse CSR: %v", err)
+			}
+			if err := csr.CheckSignature(); err != nil {
+				t.Fatalf("CSR signature is invalid: %v", err)
+			}
+			if csr.SignatureAlgorithm != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, csr.SignatureAlgorithm)
+			}
+			pub, _ := device.ParsePublicKey()
+			if !crypto.SamePublicKey(pub, csr.PublicKey) {
+				t.Errorf("CSR doesn't hold device public key")
+			}
+			if csr.Subject.CommonName != "till-7" || csr.Subject.Country[0] != "DE" || csr.URIs[0].String() != "urn:signing-device:dev-1" {
+				t.Errorf("unexpected subject %s %v", csr.Subject, csr.URIs)
+			}
+		})
+	}
+}
+
+func TestCreateCSR_UnsupportedPSSSalt(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmRSA}
+	_ = device.ConfigureKeyParams(crypto.KeyParams{}, crypto.DefaultKeyPolicy)
+	_ = device.ConfigurePadding(crypto.PaddingPSS, 20)
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	h := NewCertificateHandler(deviceRepo, &database.MockSigningStore{}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/csr", nil)
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	if err := h.CreateCSR(w, req); err == nil {
+		t.Fatalf("expected error")
+	}
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", w.Code)
+	}
+}
+
+func TestUploadCertificate(t *testing.T) {
+	externalCA := newTestCA(t)
+	device := newTestDevice(t, domain.AlgorithmECC)
+	other := newTestDevice(t, domain.AlgorithmECC)
+
+	issue := func(d *domain.SignatureDevice) [][]byte {
+		pub, _ := d.ParsePublicKey()
+		chain, err := externalCA.Issue(crypto.CertificateSubject{DeviceID: d.ID}, pub)
+		if err != nil {
+			t.Fatalf("issue: %v", err)
+		}
+		return chain
+	}
+	encode := func(chain [][]byte) string {
+		var b strings.Builder
+		for _, der := range chain {
+			_ = pem.Encode(&b, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+		}
+		return b.String()
+	}
+	valid := issue(device)
+
+	tests := map[string]struct {
+		body       string
+		wantStatus int
+	}{
+		"valid chain":      {body: encode(valid), wantStatus: http.StatusOK},
+		"leaf only":        {body: encode(valid[:1]), wantStatus: http.StatusOK},
+		"other device key": {body: encode(issue(other)), wantStatus: http.StatusBadRequest},
+		"wrong order":      {body: encode([][]byte{valid[0], valid[2], valid[1]}), wantStatus: http.StatusBadRequest},
+		"not PEM":          {body: "certificate", wantStatus: http.StatusBadRequest},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stored [][]byte
+			deviceRepo := &database.MockDeviceRepo{
+				GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+					d := *device
+					return &d, nil
+				},
+			}
+			signingStore := &database.MockSigningStore{
+				UpdateCertificateFn: func(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+					stored = chain
+					return nil
+				},
+			}
+			h := NewCertificateHandler(deviceRepo, signingStore, nil)
+
+			req := httptest.NewRequest(http.MethodPut, "/devices/dev-1/certificate", strings.NewReader(tc.body))
+			req.SetPathValue("id", "dev-1")
+			w := httptest.NewRecorder()
+			err := h.UploadCertificate(w, req)
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d (%v)", tc.wantStatus, w.Code, err)
+			}
+			if tc.wantStatus == http.StatusOK && (err != nil || len(stored) == 0) {
+				t.Errorf("expected chain to be stored, got %v", err)
+			}
+			if tc.wantStatus != http.StatusOK && stored != nil {
+				t.Errorf("invalid chain must not be stored")
+			}
+		})
+	}
+}
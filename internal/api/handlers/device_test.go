@@ -3,7 +3,13 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -14,6 +20,8 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
 	"github.com/piotrklosek/signing-service-challenge-go/mocks/database"
 )
 
@@ -26,13 +34,15 @@ func TestCreateDevice_Success(t *testing.T) {
 		},
 	}
 
+	var created *domain.SignatureDevice
 	deviceRepo := &database.MockDeviceRepo{
 		CreateFn: func(ctx context.Context, d *domain.SignatureDevice) error {
+			created = d
 			return nil
 		},
 	}
 
-	h := NewDeviceHandler(deviceRepo, userRepo)
+	h := NewDeviceHandler(deviceRepo, userRepo, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
 
 	body := []byte(`{"user_id":"` + userID + `","algorithm":"RSA","label":"test_device"}`)
 	req := httptest.NewRequest(http.MethodPost, "/devices", bytes.NewReader(body))
@@ -42,10 +52,16 @@ func TestCreateDevice_Success(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+	if created.SignedDataVersion != domain.SignedDataCurrent {
+		t.Errorf("expected new device to sign v%d envelopes, got v%d", domain.SignedDataCurrent, created.SignedDataVersion)
+	}
 }
 
 func TestCreateDevice_InvalidJSON(t *testing.T) {
-	h := NewDeviceHandler(&database.MockDeviceRepo{}, &database.MockUserRepo{})
+	h := NewDeviceHandler(&database.MockDeviceRepo{}, &database.MockUserRepo{}, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
 
 	req := httptest.NewRequest(http.MethodPost, "/devices", bytes.NewReader([]byte("{bad-json")))
 	w := httptest.NewRecorder()
@@ -64,7 +80,7 @@ func TestCreateDevice_UserNotFound(t *testing.T) {
 			return nil, errors.New("user not found")
 		},
 	}
-	h := NewDeviceHandler(&database.MockDeviceRepo{}, userRepo)
+	h := NewDeviceHandler(&database.MockDeviceRepo{}, userRepo, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
 
 	body := []byte(`{"user_id":"` + uuid.NewString() + `","algorithm":"RSA"}`)
 	req := httptest.NewRequest(http.MethodPost, "/devices", bytes.NewReader(body))
@@ -90,7 +106,7 @@ func TestCreateDevice_DeviceRepoError(t *testing.T) {
 		},
 	}
 
-	h := NewDeviceHandler(deviceRepo, userRepo)
+	h := NewDeviceHandler(deviceRepo, userRepo, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
 
 	body := []byte(`{"user_id":"` + userID + `","algorithm":"RSA"}`)
 	req := httptest.NewRequest(http.MethodPost, "/devices", bytes.NewReader(body))
@@ -110,7 +126,7 @@ func TestListDevices_RepoError(t *testing.T) {
 		},
 	}
 
-	h := NewDeviceHandler(deviceRepo, &database.MockUserRepo{})
+	h := NewDeviceHandler(deviceRepo, &database.MockUserRepo{}, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
 
 	req := httptest.NewRequest(http.MethodGet, "/devices", nil)
 	w := httptest.NewRecorder()
@@ -144,7 +160,7 @@ func TestListDevices_Success(t *testing.T) {
 		},
 	}
 
-	h := NewDeviceHandler(deviceRepo, &database.MockUserRepo{})
+	h := NewDeviceHandler(deviceRepo, &database.MockUserRepo{}, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
 
 	req := httptest.NewRequest(http.MethodGet, "/devices", nil)
 	w := httptest.NewRecorder()
@@ -187,7 +203,7 @@ func TestGetDevice_Success(t *testing.T) {
 		},
 	}
 
-	h := NewDeviceHandler(deviceRepo, &database.MockUserRepo{})
+	h := NewDeviceHandler(deviceRepo, &database.MockUserRepo{}, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
 
 	req := httptest.NewRequest(http.MethodGet, "/devices/dev-1", nil)
 	req.SetPathValue("id", "dev-1")
@@ -223,7 +239,7 @@ func TestGetDevice_NotFound(t *testing.T) {
 		},
 	}
 
-	h := NewDeviceHandler(deviceRepo, &database.MockUserRepo{})
+	h := NewDeviceHandler(deviceRepo, &database.MockUserRepo{}, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
 
 	req := httptest.NewRequest(http.MethodGet, "/devices/xyz", nil)
 	req.SetPathValue("id", "xyz")
@@ -237,3 +253,120 @@ func TestGetDevice_NotFound(t *testing.T) {
 		t.Errorf("expected 404, got %d", w.Result().StatusCode)
 	}
 }
+
+func TestCreateDevice_WeakKeyRejected(t *testing.T) {
+	userRepo := &database.MockUserRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.User, error) {
+			return &domain.User{ID: id}, nil
+		},
+	}
+	h := NewDeviceHandler(&database.MockDeviceRepo{}, userRepo, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
+
+	body := []byte(`{"user_id":"` + uuid.NewString() + `","algorithm":"RSA","key_size":1024}`)
+	req := httptest.NewRequest(http.MethodPost, "/devices", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	if err := h.CreateDevice(w, req); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Result().StatusCode)
+	}
+}
+
+func TestCreateDevice_ImportedKey(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	userRepo := &database.MockUserRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.User, error) {
+			return &domain.User{ID: id}, nil
+		},
+	}
+	var stored *domain.SignatureDevice
+	deviceRepo := &database.MockDeviceRepo{
+		CreateFn: func(ctx context.Context, d *domain.SignatureDevice) error {
+			stored = d
+			return nil
+		},
+	}
+	h := NewDeviceHandler(deviceRepo, userRepo, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
+
+	// algorithm is detected from imported key
+	body, _ := json.Marshal(map[string]string{"user_id": uuid.NewString(), "private_key": keyPEM})
+	req := httptest.NewRequest(http.MethodPost, "/devices", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	if err := h.CreateDevice(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored.Algorithm != domain.AlgorithmECC || stored.Curve != crypto.CurveP256 {
+		t.Errorf("expected ECC P-256 device, got %s %s", stored.Algorithm, stored.Curve)
+	}
+	pub, err := crypto.NewECCMarshaler().DecodePublic(stored.PublicKey)
+	if err != nil || !pub.Equal(&ecKey.PublicKey) {
+		t.Errorf("expected device to use imported key")
+	}
+}
+
+func TestCreateDevice_ImportedKeyMismatch(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	userRepo := &database.MockUserRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.User, error) {
+			return &domain.User{ID: id}, nil
+		},
+	}
+	h := NewDeviceHandler(&database.MockDeviceRepo{}, userRepo, &database.MockSigningStore{}, crypto.DefaultKeyPolicy)
+
+	body, _ := json.Marshal(map[string]string{"user_id": uuid.NewString(), "algorithm": "RSA", "private_key": keyPEM})
+	req := httptest.NewRequest(http.MethodPost, "/devices", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	err := h.CreateDevice(w, req)
+	if err == nil || !strings.Contains(err.Error(), ErrImportKey.Error()) {
+		t.Fatalf("expected import error, got %v", err)
+	}
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Result().StatusCode)
+	}
+}
+
+func TestDeactivateDevice(t *testing.T) {
+	var stored domain.DeviceStatus
+	signingStore := &database.MockSigningStore{
+		UpdateStatusFn: func(ctx context.Context, deviceID string, status domain.DeviceStatus) error {
+			if deviceID != "dev-1" {
+				return persistence.ErrDeviceNotFound
+			}
+			stored = status
+			return nil
+		},
+	}
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return &domain.SignatureDevice{ID: id, Status: stored}, nil
+		},
+	}
+	h := NewDeviceHandler(deviceRepo, &database.MockUserRepo{}, signingStore, crypto.DefaultKeyPolicy)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/deactivate", nil)
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	if err := h.DeactivateDevice(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored != domain.DeviceStatusDeactivated {
+		t.Errorf("expected device to be deactivated, got %q", stored)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/devices/missing/deactivate", nil)
+	req.SetPathValue("id", "missing")
+	w = httptest.NewRecorder()
+	if err := h.DeactivateDevice(w, req); err == nil || w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
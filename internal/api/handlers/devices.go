@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -9,23 +10,45 @@ import (
 	"github.com/google/uuid"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/validation"
 )
 
 type DeviceHandler struct {
-	deviceRepo persistence.DeviceRepository
-	userRepo   persistence.UserRepository
+	deviceRepo   persistence.DeviceRepository
+	userRepo     persistence.UserRepository
+	signingStore persistence.SigningStore
+	keyPolicy    crypto.KeyPolicy
 }
 
-func NewDeviceHandler(deviceRepo persistence.DeviceRepository, userRepo persistence.UserRepository) *DeviceHandler {
-	return &DeviceHandler{deviceRepo: deviceRepo, userRepo: userRepo}
+func NewDeviceHandler(deviceRepo persistence.DeviceRepository, userRepo persistence.UserRepository, signingStore persistence.SigningStore, keyPolicy crypto.KeyPolicy) *DeviceHandler {
+	return &DeviceHandler{deviceRepo: deviceRepo, userRepo: userRepo, signingStore: signingStore, keyPolicy: keyPolicy}
 }
 
 type CreateDeviceRequest struct {
-	UserID    string `json:"user_id" validate:"required,uuid4"`
-	Algorithm string `json:"algorithm" validate:"required,algorithm"`
+	UserID string `json:"user_id" validate:"required,uuid4"`
+	// Algorithm may be omitted for imported keys, it's detected from the key
+	Algorithm string `json:"algorithm" validate:"required_without=PrivateKey,omitempty,algorithm"`
 	Label     string `json:"label" validate:"omitempty,min=3,max=100"`
+
+	SignatureEncoding string `json:"signature_encoding"`
+	// SignatureFormat is default output of sign endpoint, raw or jws
+	SignatureFormat string `json:"signature_format" validate:"omitempty,oneof=raw jws"`
+
+	// optional key parameters, algorithm defaults are used when empty
+	KeySize int    `json:"key_size" validate:"omitempty,min=1"`
+	Curve   string `json:"curve"`
+	Hash    string `json:"hash"`
+
+	// RSA signature scheme, PKCS1v15 when empty
+	Padding    string `json:"padding"`
+	SaltLength int    `json:"salt_length" validate:"omitempty,min=1"`
+
+	// PEM encoded private key to import instead of generating new one,
+	// password is required for encrypted PKCS#8 keys
+	PrivateKey         string `json:"private_key"`
+	PrivateKeyPassword string `json:"private_key_password"`
 }
 
 func (h *DeviceHandler) CreateDevice(w http.ResponseWriter, r *http.Request) error {
@@ -47,19 +70,55 @@ func (h *DeviceHandler) CreateDevice(w http.ResponseWriter, r *http.Request) err
 	}
 
 	device := &domain.SignatureDevice{
-		ID:               uuid.NewString(),
-		UserID:           req.UserID,
-		Algorithm:        domain.AlgorithmType(req.Algorithm),
-		Label:            req.Label,
-		SignatureCounter: 0,
-		LastSignature:    "", // fill during signing document
-		CreatedAt:        time.Now(),
-		UpdatedAt:        time.Now(),
+		ID:        uuid.NewString(),
+		UserID:    req.UserID,
+		Algorithm: domain.AlgorithmType(req.Algorithm),
+		Label:     req.Label,
+		Status:    domain.DeviceStatusActive,
+		// new devices sign versioned envelopes, legacy format stays for existing ones
+		SignedDataVersion: domain.SignedDataCurrent,
+		SignatureCounter:  0,
+		LastSignature:     "", // fill during signing document
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+	if req.PrivateKey == "" {
+		device.KeyBackend = h.keyPolicy.Backend
 	}
 
-	if err := device.GenerateKeys(); err != nil {
-		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
-		return fmt.Errorf("%v - %v", ErrGenerateKeys, err)
+	// imported key decides device algorithm, so it goes before other settings
+	keyParams := crypto.KeyParams{KeySize: req.KeySize, Curve: req.Curve, Hash: crypto.HashAlgorithm(req.Hash)}
+	if req.PrivateKey != "" {
+		if err := device.ImportKeys([]byte(req.PrivateKey), []byte(req.PrivateKeyPassword), keyParams, h.keyPolicy); err != nil {
+			jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+			return fmt.Errorf("%v - %v", ErrImportKey, err)
+		}
+	} else if err := device.ConfigureKeyParams(keyParams, h.keyPolicy); err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - %v", ErrBadRequest, err)
+	}
+
+	if err := device.ConfigureSignatureEncoding(crypto.SignatureEncoding(req.SignatureEncoding)); err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - %v", ErrBadRequest, err)
+	}
+
+	if err := device.ConfigurePadding(crypto.RSAPadding(req.Padding), req.SaltLength); err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - %v", ErrBadRequest, err)
+	}
+
+	if req.PrivateKey == "" {
+		if err := device.GenerateKeys(); err != nil {
+			jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+			return fmt.Errorf("%v - %v", ErrGenerateKeys, err)
+		}
+	}
+
+	// JWS algorithm depends on the key itself, so format goes after keys
+	if err := device.ConfigureSignatureFormat(domain.SignatureFormat(req.SignatureFormat)); err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - %v", ErrBadRequest, err)
 	}
 
 	if err := h.deviceRepo.Create(r.Context(), device); err != nil {
@@ -90,3 +149,26 @@ func (h *DeviceHandler) GetDevice(w http.ResponseWriter, r *http.Request) error
 	jsonw.Success(w, device, http.StatusOK)
 	return nil
 }
+
+// DeactivateDevice stops device from signing and removes its key from
+// published key set. Deactivation is permanent.
+func (h *DeviceHandler) DeactivateDevice(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	err := h.signingStore.UpdateStatus(r.Context(), id, domain.DeviceStatusDeactivated)
+	if errors.Is(err, persistence.ErrDeviceNotFound) {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrDeactivate, err)
+	}
+
+	device, err := h.deviceRepo.GetByID(r.Context(), id)
+	if err != nil {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+	jsonw.Success(w, device, http.StatusOK)
+	return nil
+}
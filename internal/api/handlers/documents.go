@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
+)
+
+// maxDocumentSize limits document signed as CMS, it's hashed while read
+const maxDocumentSize = 64 << 20
+
+// DocumentHandler signs whole documents with device keys
+type DocumentHandler struct {
+	deviceRepo   persistence.DeviceRepository
+	signingStore persistence.SigningStore
+	// ca is nil when service CA is not configured
+	ca *crypto.CertificateAuthority
+}
+
+// NewDocumentHandler used to create document handler
+func NewDocumentHandler(
+	deviceRepo persistence.DeviceRepository,
+	signingStore persistence.SigningStore,
+	ca *crypto.CertificateAuthority,
+) *DocumentHandler {
+	return &DocumentHandler{deviceRepo: deviceRepo, signingStore: signingStore, ca: ca}
+}
+
+// SignCMS returns detached CMS SignedData over request body with device
+// certificate embedded, DER by default or PEM with format "pem". Device
+// without certificate gets one from service CA. Document digest is also
+// signed into device chain, so every use of device key stays counted.
+func (h *DocumentHandler) SignCMS(w http.ResponseWriter, r *http.Request) error {
+	format, err := validFormat(w, r)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = "der"
+	}
+
+	device, err := h.deviceRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+	hash, err := device.CMSHash()
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusUnprocessableEntity)
+		return fmt.Errorf("%v - %v", ErrSignCMS, err)
+	}
+	if !device.HasValidCertificate(time.Now()) {
+		if err := issueCertificate(w, r, h.signingStore, h.ca, device); err != nil {
+			return err
+		}
+	}
+
+	hasher := hash.New()
+	if _, err := io.Copy(hasher, http.MaxBytesReader(w, r.Body, maxDocumentSize)); err != nil {
+		jsonw.Error(w, "document can't be read or is too large", nil, http.StatusRequestEntityTooLarge)
+		return fmt.Errorf("%v - %v", ErrBadRequest, err)
+	}
+	digest := hasher.Sum(nil)
+
+	var signature []byte
+	_, err = h.signingStore.SignAtomically(r.Context(), device.ID, func(device *domain.SignatureDevice) (*domain.SignatureRecord, error) {
+		now := time.Now()
+		signedData, chainSignature, err := domain.SignData(device, domain.CMSStatement(hash, digest))
+		if err != nil {
+			return nil, err
+		}
+		if signature, err = domain.SignCMS(device, digest, now); err != nil {
+			return nil, err
+		}
+
+		record := &domain.SignatureRecord{
+			ID:         uuid.NewString(),
+			DeviceID:   device.ID,
+			Counter:    device.SignatureCounter,
+			SignedData: signedData,
+			Signature:  chainSignature,
+			CreatedAt:  now,
+
+			SignatureEncoding: device.SigningEncoding(),
+			Kind:              domain.RecordKindCMS,
+			SigningKeyVersion: device.SigningKeyVersion,
+			SignedDataVersion: device.SignedDataVersion,
+		}
+		device.IncrementCounter(chainSignature)
+		return record, nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, persistence.ErrDeviceNotFound):
+			jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		case errors.Is(err, domain.ErrDeviceDeactivated):
+			jsonw.Error(w, err.Error(), nil, http.StatusConflict)
+		case errors.Is(err, domain.ErrNoValidCertificate):
+			jsonw.Error(w, "device key was rotated, retry request", nil, http.StatusConflict)
+		case errors.Is(err, domain.ErrTimestampUnavailable):
+			jsonw.Error(w, err.Error(), nil, http.StatusServiceUnavailable)
+		default:
+			jsonw.Error(w, "failed to sign document", nil, http.StatusInternalServerError)
+		}
+		return fmt.Errorf("%v - %v", ErrSignCMS, err)
+	}
+
+	return writeDER(w, format, "CMS", "application/pkcs7-signature", [][]byte{signature})
+}
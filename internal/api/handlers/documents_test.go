@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/mocks/database"
+)
+
+// newDocumentHandler serves single device, stores certificates on it and
+// collects chain records
+func newDocumentHandler(device *domain.SignatureDevice, ca *crypto.CertificateAuthority, records *[]*domain.SignatureRecord) *DocumentHandler {
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			rec, err := fn(device)
+			if err == nil {
+				*records = append(*records, rec)
+			}
+			return rec, err
+		},
+		UpdateCertificateFn: func(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+			device.CertificateChain = chain
+			return nil
+		},
+	}
+	return NewDocumentHandler(deviceRepo, signingStore, ca)
+}
+
+func signCMS(t *testing.T, h *DocumentHandler, document []byte, format string) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign/cms?format="+format, bytes.NewReader(document))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	return w, h.SignCMS(w, req)
+}
+
+func TestSignCMS(t *testing.T) {
+	tests := map[string]struct {
+		algorithm domain.AlgorithmType
+		params    crypto.KeyParams
+		padding   crypto.RSAPadding
+	}{
+		"rsa":        {algorithm: domain.AlgorithmRSA},
+		"rsa pss":    {algorithm: domain.AlgorithmRSA, params: crypto.KeyParams{Hash: crypto.HashSHA384}, padding: crypto.PaddingPSS},
+		"ecc p1363":  {algorithm: domain.AlgorithmECC},
+		"ecc sha512": {algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Curve: crypto.CurveP521, Hash: crypto.HashSHA512}},
+		"ed25519":    {algorithm: domain.AlgorithmEd25519},
+	}
+	ca := newTestCA(t)
+	document := []byte("%PDF-1.7 invoice 2024/0042")
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "dev-1", Algorithm: tc.algorithm}
+			if err := device.ConfigureKeyParams(tc.params, crypto.DefaultKeyPolicy); err != nil {
+				t.Fatalf("configure params: %v", err)
+			}
+			if err := device.ConfigurePadding(tc.padding, 0); err != nil {
+				t.Fatalf("configure padding: %v", err)
+			}
+			// chain signatures keep device encoding, CMS is always DER
+			if err := device.ConfigureSignatureEncoding(""); err != nil {
+				t.Fatalf("configure encoding: %v", err)
+			}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+			var records []*domain.SignatureRecord
+			h := newDocumentHandler(device, ca, &records)
+
+			w, err := signCMS(t, h, document, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/pkcs7-signature" {
+				t.Fatalf("expected DER CMS, got %q", ct)
+			}
+
+			result, err := crypto.VerifyDetachedCMS(w.Body.Bytes(), bytes.NewReader(document), ca.Roots())
+			if err != nil {
+				t.Fatalf("CMS doesn't verify: %v", err)
+			}
+			if result.Signer.Subject.CommonName != "dev-1" || result.SigningTime.IsZero() {
+				t.Errorf("unexpected signer %s at %v", result.Signer.Subject, result.SigningTime)
+			}
+			if _, err := crypto.VerifyDetachedCMS(w.Body.Bytes(), bytes.NewReader(append(document, ' ')), ca.Roots()); err == nil {
+				t.Errorf("expected modified document to fail verification")
+			}
+
+			// document digest is signed into device chain
+			if len(records) != 1 || records[0].Kind != domain.RecordKindCMS || device.SignatureCounter != 1 {
+				t.Fatalf("expected CMS chain record, got %+v", records)
+			}
+			if report := domain.VerifyChain(device, records); !report.Valid {
+				t.Errorf("chain with CMS record is invalid: %+v", report.Issues)
+			}
+		})
+	}
+}
+
+func TestSignCMS_PEMAndUntrustedRoot(t *testing.T) {
+	ca := newTestCA(t)
+	device := newTestDevice(t, domain.AlgorithmECC)
+	var records []*domain.SignatureRecord
+	h := newDocumentHandler(device, ca, &records)
+
+	w, err := signCMS(t, h, []byte("<export/>"), "pem")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	block, _ := pem.Decode(w.Body.Bytes())
+	if block == nil || block.Type != "CMS" {
+		t.Fatalf("expected PEM CMS block")
+	}
+	if _, err := crypto.VerifyDetachedCMS(block.Bytes, bytes.NewReader([]byte("<export/>")), newTestCA(t).Roots()); err == nil {
+		t.Fatalf("expected signature to be rejected with other root")
+	}
+}
+
+func TestSignCMS_Errors(t *testing.T) {
+	t.Run("no certificate and no CA", func(t *testing.T) {
+		var records []*domain.SignatureRecord
+		h := newDocumentHandler(newTestDevice(t, domain.AlgorithmECC), nil, &records)
+		w, err := signCMS(t, h, []byte("doc"), "")
+		if !errors.Is(err, ErrNoCertificateAuthority) || w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d %v", w.Code, err)
+		}
+		if len(records) != 0 {
+			t.Errorf("nothing must be signed")
+		}
+	})
+	t.Run("deactivated device", func(t *testing.T) {
+		device := newTestDevice(t, domain.AlgorithmECC)
+		device.Status = domain.DeviceStatusDeactivated
+		var records []*domain.SignatureRecord
+		h := newDocumentHandler(device, newTestCA(t), &records)
+		if w, _ := signCMS(t, h, []byte("doc"), ""); w.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d", w.Code)
+		}
+	})
+	t.Run("legacy RSA device", func(t *testing.T) {
+		device := newTestDevice(t, domain.AlgorithmRSA)
+		var records []*domain.SignatureRecord
+		h := newDocumentHandler(device, newTestCA(t), &records)
+		if w, _ := signCMS(t, h, []byte("doc"), ""); w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("expected 422, got %d", w.Code)
+		}
+	})
+}
@@ -6,14 +6,37 @@ var (
 	// general errors
 	ErrInvalidJson = errors.New("invalid json")
 	ErrBadRequest  = errors.New("bad request")
+	ErrIdempotency = errors.New("idempotency key error")
 
 	// signature errors
+	ErrSigningFailed     = errors.New("signing failed")
+	ErrListSignatures    = errors.New("error list signatures")
+	ErrVerifySignature   = errors.New("error verifying signature")
+	ErrKeyRotation       = errors.New("key rotation failed")
+	ErrSignCMS           = errors.New("error signing document")
+	ErrTimestamp         = errors.New("error time-stamping")
+	ErrSignatureNotFound = errors.New("signature not found")
+	ErrInclusionProof    = errors.New("error proving signature inclusion")
+	ErrLogTreeHead       = errors.New("error reading log tree head")
+	ErrConsistencyProof  = errors.New("error proving log consistency")
 
 	// device errors
 	ErrDeviceNotFounc = errors.New("device not founc")
 	ErrGenerateKeys   = errors.New("error generating keys")
+	ErrImportKey      = errors.New("error importing key")
 	ErrCreatingDevice = errors.New("error creating device")
 	ErrListDevices    = errors.New("error list devices")
+	ErrDeactivate     = errors.New("error deactivating device")
+	// ErrDeviceDeactivated is returned for keys of deactivated devices
+	ErrDeviceDeactivated = errors.New("device is deactivated")
+	ErrPublishKey        = errors.New("error publishing device key")
+
+	// certificate errors
+	ErrNoCertificateAuthority = errors.New("certificate authority is not configured")
+	ErrIssueCertificate       = errors.New("error issuing certificate")
+	ErrCertificateNotFound    = errors.New("certificate not found")
+	ErrUploadCertificate      = errors.New("error uploading certificate")
+	ErrCreateCSR              = errors.New("error creating certificate request")
 
 	// user errors
 	ErrUserNotFounc = errors.New("user not found")
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
+)
+
+const (
+	// IdempotencyKeyHeader carries client chosen key of request
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks response replayed from idempotency store
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency makes handlers safe to retry, request repeated with the same
+// Idempotency-Key within retention gets the original response instead of
+// being executed again
+type Idempotency struct {
+	store     persistence.IdempotencyStore
+	retention time.Duration
+	// lease is how long key of running request stays reserved without being
+	// extended, it bounds lock of request which never finished (e.g. server
+	// crashed). Running request extends it every half of lease.
+	lease time.Duration
+}
+
+// NewIdempotency create idempotency wrapper keeping responses for retention
+func NewIdempotency(store persistence.IdempotencyStore, retention, lease time.Duration) *Idempotency {
+	return &Idempotency{store: store, retention: retention, lease: lease}
+}
+
+// Wrap returns handler which runs next at most once per idempotency key.
+// Only successful responses are kept, failed request releases its key so it
+// can be retried. Requests without key are passed through.
+func (i *Idempotency) Wrap(next func(http.ResponseWriter, *http.Request) error) func(http.ResponseWriter, *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return next(w, r)
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			jsonw.Error(w, fmt.Sprintf("%s can't be longer than %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength), nil, http.StatusBadRequest)
+			return fmt.Errorf("%v - idempotency key too long", ErrBadRequest)
+		}
+
+		// body is kept in memory for hashing, wrapped handlers are sign
+		// handlers and the same limit applies
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignRequestSize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			jsonw.Error(w, fmt.Sprintf("request body can't be larger than %d bytes", maxSignRequestSize), nil, http.StatusRequestEntityTooLarge)
+			return fmt.Errorf("%v - %v", ErrBadRequest, err)
+		}
+		if err != nil {
+			jsonw.Error(w, "failed to read request body", nil, http.StatusBadRequest)
+			return fmt.Errorf("%v - %v", ErrBadRequest, err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// stores keep creation time in milliseconds at least, it identifies
+		// reservation
+		now := time.Now().Truncate(time.Millisecond)
+		rec := &domain.IdempotencyRecord{
+			Scope:       r.URL.Path,
+			Key:         key,
+			RequestHash: requestHash(r, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(i.lease),
+		}
+		existing, err := i.store.Reserve(r.Context(), rec)
+		if errors.Is(err, persistence.ErrIdempotencyKeyExists) {
+			return replay(w, rec, existing)
+		}
+		if err != nil {
+			jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+			return fmt.Errorf("%v - %v", ErrIdempotency, err)
+		}
+
+		// key is settled even when client went away, its retry comes next
+		ctx := context.WithoutCancel(r.Context())
+		tee := &teeResponseWriter{ResponseWriter: w}
+		stopExtending := i.extend(ctx, rec)
+		err = next(tee, r)
+		stopExtending()
+
+		if err != nil || tee.status < 200 || tee.status > 299 {
+			if releaseErr := i.store.Release(ctx, rec); releaseErr != nil {
+				return errors.Join(err, fmt.Errorf("%v - %v", ErrIdempotency, releaseErr))
+			}
+			return err
+		}
+
+		rec.StatusCode = tee.status
+		rec.ContentType = w.Header().Get("Content-Type")
+		rec.Body = tee.body.Bytes()
+		rec.ExpiresAt = time.Now().Add(i.retention)
+		if err := i.store.Complete(ctx, rec); err != nil {
+			// response is already sent and can't be taken back. When
+			// reservation was lost, request which took key over keeps it and
+			// its response is the one replayed.
+			return fmt.Errorf("%v - key %q: %v", ErrIdempotency, rec.Key, err)
+		}
+		return nil
+	}
+}
+
+// extend keeps reservation of rec until returned stop is called. Failed
+// extension is retried on next tick, lost reservation is detected by Complete.
+func (i *Idempotency) extend(ctx context.Context, rec *domain.IdempotencyRecord) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(max(i.lease/2, time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				extended := *rec
+				extended.ExpiresAt = time.Now().Add(i.lease)
+				if err := i.store.Extend(ctx, &extended); errors.Is(err, persistence.ErrIdempotencyReservationLost) {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// replay writes response stored for key, or rejects request when key is
+// used for other request or its first request is still running
+func replay(w http.ResponseWriter, rec, existing *domain.IdempotencyRecord) error {
+	if existing.RequestHash != rec.RequestHash {
+		jsonw.Error(w, fmt.Sprintf("%s was already used for other request", IdempotencyKeyHeader), nil, http.StatusUnprocessableEntity)
+		return fmt.Errorf("%v - key %q reused with other request", ErrIdempotency, rec.Key)
+	}
+	if !existing.Completed() {
+		jsonw.Error(w, fmt.Sprintf("request with this %s is in progress", IdempotencyKeyHeader), nil, http.StatusConflict)
+		return fmt.Errorf("%v - key %q in progress", ErrIdempotency, rec.Key)
+	}
+
+	if existing.ContentType != "" {
+		w.Header().Set("Content-Type", existing.ContentType)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(existing.StatusCode)
+	_, err := w.Write(existing.Body)
+	return err
+}
+
+// requestHash identifies request by method, path with query, Accept header
+// and body, JSON body is compacted so formatting doesn't matter
+func requestHash(r *http.Request, body []byte) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err == nil {
+		body = compact.Bytes()
+	}
+	h := sha256.New()
+	for _, part := range []string{r.Method, r.URL.RequestURI(), r.Header.Get("Accept")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// teeResponseWriter copies response status and body while writing it
+type teeResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (t *teeResponseWriter) WriteHeader(status int) {
+	if t.status == 0 {
+		t.status = status
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *teeResponseWriter) Write(b []byte) (int, error) {
+	if t.status == 0 {
+		t.status = http.StatusOK
+	}
+	t.body.Write(b)
+	return t.ResponseWriter.Write(b)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
+	"github.com/piotrklosek/signing-service-challenge-go/mocks/database"
+)
+
+// newIdempotencyMock keeps copies of records in map, the way real store does
+func newIdempotencyMock() (*database.MockIdempotencyStore, map[string]*domain.IdempotencyRecord) {
+	records := make(map[string]*domain.IdempotencyRecord)
+	return &database.MockIdempotencyStore{
+		ReserveFn: func(ctx context.Context, rec *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+			if existing, ok := records[rec.Key]; ok {
+				return existing, persistence.ErrIdempotencyKeyExists
+			}
+			stored := *rec
+			records[rec.Key] = &stored
+			return nil, nil
+		},
+		CompleteFn: func(ctx context.Context, rec *domain.IdempotencyRecord) error {
+			if existing, ok := records[rec.Key]; !ok || !existing.Reserves(rec) {
+				return persistence.ErrIdempotencyReservationLost
+			}
+			stored := *rec
+			records[rec.Key] = &stored
+			return nil
+		},
+		ReleaseFn: func(ctx context.Context, rec *domain.IdempotencyRecord) error {
+			if existing, ok := records[rec.Key]; ok && existing.Reserves(rec) {
+				delete(records, rec.Key)
+			}
+			return nil
+		},
+	}, records
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	store, records := newIdempotencyMock()
+	calls := 0
+	h := NewIdempotency(store, time.Hour, time.Minute).Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		calls++
+		jsonw.Success(w, map[string]int{"counter": calls}, http.StatusOK)
+		return nil
+	})
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/devices/dev-1/sign", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		_ = h(w, req)
+		return w
+	}
+
+	first := send("key-1", `{"data":"tx-1"}`)
+	if first.Code != http.StatusOK || records["key-1"].StatusCode != http.StatusOK {
+		t.Fatalf("expected stored response, got %d", first.Code)
+	}
+	if records["key-1"].ExpiresAt.Before(time.Now().Add(59 * time.Minute)) {
+		t.Fatalf("expected response kept for retention")
+	}
+
+	// formatting of JSON body doesn't make it other request
+	retry := send("key-1", "{ \"data\": \"tx-1\" }")
+	if calls != 1 || retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+		t.Fatalf("expected original response replayed, got %d %s", retry.Code, retry.Body)
+	}
+	if retry.Header().Get(IdempotentReplayedHeader) != "true" || retry.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Fatalf("expected replayed response headers, got %v", retry.Header())
+	}
+
+	if w := send("key-1", `{"data":"tx-2"}`); w.Code != http.StatusUnprocessableEntity || calls != 1 {
+		t.Fatalf("expected 422 for key reused with other body, got %d", w.Code)
+	}
+	if w := send("", `{"data":"tx-1"}`); w.Code != http.StatusOK || calls != 2 {
+		t.Fatalf("expected request without key to run, got %d", w.Code)
+	}
+	if w := send(strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for too long key, got %d", w.Code)
+	}
+}
+
+func TestIdempotency_InProgress(t *testing.T) {
+	store, _ := newIdempotencyMock()
+	idempotency := NewIdempotency(store, time.Hour, time.Minute)
+	var retry *httptest.ResponseRecorder
+	var h func(w http.ResponseWriter, r *http.Request) error
+	h = idempotency.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		// client retries while the first request is still signing
+		if retry == nil {
+			retry = httptest.NewRecorder()
+			_ = h(retry, newKeyedRequest("key-1"))
+		}
+		jsonw.Success(w, nil, http.StatusOK)
+		return nil
+	})
+
+	if err := h(httptest.NewRecorder(), newKeyedRequest("key-1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if retry.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for request in progress, got %d", retry.Code)
+	}
+}
+
+func TestIdempotency_FailureReleasesKey(t *testing.T) {
+	store, records := newIdempotencyMock()
+	fail := true
+	h := NewIdempotency(store, time.Hour, time.Minute).Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		if fail {
+			jsonw.Error(w, "db error", nil, http.StatusInternalServerError)
+			return errors.New("db error")
+		}
+		jsonw.Success(w, nil, http.StatusOK)
+		return nil
+	})
+
+	if err := h(httptest.NewRecorder(), newKeyedRequest("key-1")); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if _, ok := records["key-1"]; ok {
+		t.Fatalf("expected failed request to release key")
+	}
+	fail = false
+	w := httptest.NewRecorder()
+	if err := h(w, newKeyedRequest("key-1")); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected retry to run, got %d: %v", w.Code, err)
+	}
+}
+
+func TestIdempotency_BodyTooLarge(t *testing.T) {
+	store, records := newIdempotencyMock()
+	h := NewIdempotency(store, time.Hour, time.Minute).Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		t.Fatalf("request must not run with too large body")
+		return nil
+	})
+	body := `{"data":"` + strings.Repeat("a", maxSignRequestSize) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/devices/dev-1/sign", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+	if err := h(w, req); err == nil || w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %v", w.Code, err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected no key reserved")
+	}
+}
+
+func TestIdempotency_StoreError(t *testing.T) {
+	store := &database.MockIdempotencyStore{
+		ReserveFn: func(ctx context.Context, rec *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+			return nil, errors.New("db error")
+		},
+	}
+	h := NewIdempotency(store, time.Hour, time.Minute).Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		t.Fatalf("request must not run without reserved key")
+		return nil
+	})
+	w := httptest.NewRecorder()
+	if err := h(w, newKeyedRequest("key-1")); err == nil || w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %v", w.Code, err)
+	}
+}
+
+func TestIdempotency_LeaseExtendedWhileRunning(t *testing.T) {
+	store, records := newIdempotencyMock()
+	var extended []time.Time
+	store.ExtendFn = func(ctx context.Context, rec *domain.IdempotencyRecord) error {
+		if !records[rec.Key].Reserves(rec) {
+			return persistence.ErrIdempotencyReservationLost
+		}
+		extended = append(extended, rec.ExpiresAt)
+		return nil
+	}
+	lease := 20 * time.Millisecond
+	h := NewIdempotency(store, time.Hour, lease).Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		// request runs longer than lease, e.g. large batch with remote TSA
+		time.Sleep(5 * lease)
+		jsonw.Success(w, nil, http.StatusOK)
+		return nil
+	})
+
+	if err := h(httptest.NewRecorder(), newKeyedRequest("key-1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(extended) < 2 {
+		t.Fatalf("expected reservation extended while request runs, got %d extensions", len(extended))
+	}
+}
+
+func TestIdempotency_ReservationLost(t *testing.T) {
+	store, records := newIdempotencyMock()
+	h := NewIdempotency(store, time.Hour, time.Minute).Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		// reservation expired and retry took key over
+		taken := *records["key-1"]
+		taken.CreatedAt = taken.CreatedAt.Add(time.Minute)
+		records["key-1"] = &taken
+		jsonw.Success(w, nil, http.StatusOK)
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	err := h(w, newKeyedRequest("key-1"))
+	if err == nil || !strings.Contains(err.Error(), persistence.ErrIdempotencyReservationLost.Error()) {
+		t.Fatalf("expected lost reservation error, got %v", err)
+	}
+	if w.Code != http.StatusOK || records["key-1"].Completed() {
+		t.Fatalf("expected response sent and record of other request kept, got %d", w.Code)
+	}
+}
+
+func newKeyedRequest(key string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/devices/dev-1/sign", strings.NewReader(`{"data":"tx-1"}`))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	return req
+}
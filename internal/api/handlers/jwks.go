@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
+)
+
+// KeySetHandler publishes device public keys as JSON Web Keys
+type KeySetHandler struct {
+	deviceRepo persistence.DeviceRepository
+}
+
+// NewKeySetHandler used to create key set handler
+func NewKeySetHandler(deviceRepo persistence.DeviceRepository) *KeySetHandler {
+	return &KeySetHandler{deviceRepo: deviceRepo}
+}
+
+// GetDeviceJWK returns current public key of active device as bare JWK, so
+// it can be used by JOSE libraries as it is
+func (h *KeySetHandler) GetDeviceJWK(w http.ResponseWriter, r *http.Request) error {
+	device, err := h.deviceRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+	if !device.Active() {
+		jsonw.Error(w, "device is deactivated", nil, http.StatusGone)
+		return fmt.Errorf("%v - device %s", ErrDeviceDeactivated, device.ID)
+	}
+	jwk, err := device.JWK()
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrPublishKey, err)
+	}
+	return writeJSON(w, "application/jwk+json", jwk)
+}
+
+// GetJWKS returns key set with current keys of all active devices
+func (h *KeySetHandler) GetJWKS(w http.ResponseWriter, r *http.Request) error {
+	devices, err := h.deviceRepo.List(r.Context())
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrListDevices, err)
+	}
+
+	set := crypto.JWKSet{Keys: []crypto.JWK{}}
+	for _, device := range devices {
+		if !device.Active() {
+			continue
+		}
+		jwk, err := device.JWK()
+		if err != nil {
+			// one broken device must not take whole key set down
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return writeJSON(w, "application/jwk-set+json", set)
+}
+
+// writeJSON writes document without response envelope, for standard formats
+// consumed by other tools
+func writeJSON(w http.ResponseWriter, contentType string, v any) error {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/mocks/database"
+)
+
+// jwkPublicKey decodes JWK back into standard library key
+func jwkPublicKey(t *testing.T, jwk crypto.JWK) any {
+	t.Helper()
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("decode JWK member: %v", err)
+		}
+		return b
+	}
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		point := append([]byte{4}, append(decode(jwk.X), decode(jwk.Y)...)...)
+		key, err := ecdsa.ParseUncompressedPublicKey(curves[jwk.Crv], point)
+		if err != nil {
+			t.Fatalf("parse EC point: %v", err)
+		}
+		return key
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+	t.Fatalf("unexpected kty %q", jwk.Kty)
+	return nil
+}
+
+func TestGetDeviceJWK(t *testing.T) {
+	tests := map[string]struct {
+		algorithm domain.AlgorithmType
+		params    crypto.KeyParams
+		padding   crypto.RSAPadding
+		wantKty   string
+		wantAlg   string
+	}{
+		"rsa":            {algorithm: domain.AlgorithmRSA, wantKty: "RSA", wantAlg: "RS256"},
+		"rsa pss":        {algorithm: domain.AlgorithmRSA, params: crypto.KeyParams{Hash: crypto.HashSHA512}, padding: crypto.PaddingPSS, wantKty: "RSA", wantAlg: "PS512"},
+		"ecc p256":       {algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Curve: crypto.CurveP256}, wantKty: "EC", wantAlg: "ES256"},
+		"ecc p521":       {algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Curve: crypto.CurveP521, Hash: crypto.HashSHA512}, wantKty: "EC", wantAlg: "ES512"},
+		"ecc no jws alg": {algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Curve: crypto.CurveP384, Hash: crypto.HashSHA256}, wantKty: "EC"},
+		"ed25519":        {algorithm: domain.AlgorithmEd25519, wantKty: "OKP", wantAlg: "EdDSA"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "dev-1", Algorithm: tc.algorithm, SigningKeyVersion: 3}
+			if err := device.ConfigureKeyParams(tc.params, crypto.DefaultKeyPolicy); err != nil {
+				t.Fatalf("configure params: %v", err)
+			}
+			if err := device.ConfigurePadding(tc.padding, 0); err != nil {
+				t.Fatalf("configure padding: %v", err)
+			}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+			deviceRepo := &database.MockDeviceRepo{
+				GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+					return device, nil
+				},
+			}
+			h := NewKeySetHandler(deviceRepo)
+
+			req := httptest.NewRequest(http.MethodGet, "/devices/dev-1/jwk", nil)
+			req.SetPathValue("id", "dev-1")
+			w := httptest.NewRecorder()
+			if err := h.GetDeviceJWK(w, req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var jwk crypto.JWK
+			if err := json.NewDecoder(w.Body).Decode(&jwk); err != nil {
+				t.Fatalf("decode JWK: %v", err)
+			}
+			if jwk.Kty != tc.wantKty || jwk.Alg != tc.wantAlg || jwk.Kid != "dev-1-v3" || jwk.Use != "sig" {
+				t.Errorf("unexpected JWK %+v", jwk)
+			}
+			pub, _ := device.ParsePublicKey()
+			if !crypto.SamePublicKey(pub, jwkPublicKey(t, jwk)) {
+				t.Errorf("JWK doesn't hold device public key")
+			}
+		})
+	}
+}
+
+func TestGetDeviceJWK_Deactivated(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmECC)
+	device.Status = domain.DeviceStatusDeactivated
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	h := NewKeySetHandler(deviceRepo)
+
+	req := httptest.NewRequest(http.MethodGet, "/devices/dev-1/jwk", nil)
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	if err := h.GetDeviceJWK(w, req); err == nil {
+		t.Fatalf("expected error")
+	}
+	if w.Code != http.StatusGone {
+		t.Errorf("expected 410, got %d", w.Code)
+	}
+}
+
+func TestGetJWKS(t *testing.T) {
+	active := newTestDevice(t, domain.AlgorithmRSA)
+	legacy := newTestDevice(t, domain.AlgorithmEd25519)
+	legacy.ID = "dev-2"
+	deactivated := newTestDevice(t, domain.AlgorithmECC)
+	deactivated.ID = "dev-3"
+	active.Status = domain.DeviceStatusActive
+	deactivated.Status = domain.DeviceStatusDeactivated
+
+	deviceRepo := &database.MockDeviceRepo{
+		ListFn: func(ctx context.Context) ([]*domain.SignatureDevice, error) {
+			return []*domain.SignatureDevice{active, legacy, deactivated}, nil
+		},
+	}
+	h := NewKeySetHandler(deviceRepo)
+
+	w := httptest.NewRecorder()
+	if err := h.GetJWKS(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/jwk-set+json" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	var set crypto.JWKSet
+	if err := json.NewDecoder(w.Body).Decode(&set); err != nil {
+		t.Fatalf("decode JWKS: %v", err)
+	}
+	if len(set.Keys) != 2 || set.Keys[0].Kid != "dev-1-v0" || set.Keys[1].Kid != "dev-2-v0" {
+		t.Fatalf("expected keys of active devices only, got %+v", set.Keys)
+	}
+}
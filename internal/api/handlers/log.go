@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
+)
+
+// LogHandler serves signed tree heads of signature log and consistency
+// proofs between them, so auditors can check log history is never rewritten
+type LogHandler struct {
+	logRepo persistence.LogRepository
+}
+
+// NewLogHandler used to create signature log handler
+func NewLogHandler(logRepo persistence.LogRepository) *LogHandler {
+	return &LogHandler{logRepo: logRepo}
+}
+
+// GetTreeHead returns the latest signed tree head of signature log
+func (h *LogHandler) GetTreeHead(w http.ResponseWriter, r *http.Request) error {
+	head, err := h.logRepo.LatestTreeHead(r.Context())
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrLogTreeHead, err)
+	}
+	if head == nil {
+		jsonw.Error(w, "signature log has no signed tree head yet", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - no signed tree head", ErrLogTreeHead)
+	}
+	return writeJSON(w, "application/json", head)
+}
+
+// GetConsistency returns proof that log of first size is prefix of log of
+// second size, second can't be larger than the latest signed tree head
+func (h *LogHandler) GetConsistency(w http.ResponseWriter, r *http.Request) error {
+	first, errFirst := strconv.ParseUint(r.URL.Query().Get("first"), 10, 64)
+	second, errSecond := strconv.ParseUint(r.URL.Query().Get("second"), 10, 64)
+	if errFirst != nil || errSecond != nil || first > second {
+		jsonw.Error(w, "first and second have to be tree sizes, first not larger than second", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - invalid tree sizes %q and %q", ErrBadRequest, r.URL.Query().Get("first"), r.URL.Query().Get("second"))
+	}
+
+	head, err := h.logRepo.LatestTreeHead(r.Context())
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrLogTreeHead, err)
+	}
+	if head == nil || second > head.TreeSize {
+		jsonw.Error(w, "second is larger than the latest signed tree head", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - tree size %d isn't signed", ErrBadRequest, second)
+	}
+	log, err := h.logRepo.List(r.Context())
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrConsistencyProof, err)
+	}
+	proof, err := domain.NewConsistencyProof(log, first, second)
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrConsistencyProof, err)
+	}
+	return writeJSON(w, "application/json", proof)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/mocks/database"
+)
+
+func TestLogHandler(t *testing.T) {
+	keyPEM, _, err := crypto.GenerateServiceKey()
+	if err != nil {
+		t.Fatalf("generate service key: %v", err)
+	}
+	key, err := crypto.ParseCAKey(keyPEM)
+	if err != nil {
+		t.Fatalf("parse service key: %v", err)
+	}
+	var log []*domain.LogEntry
+	for i := 0; i < 5; i++ {
+		log = append(log, &domain.LogEntry{
+			Index: uint64(i), SignatureID: fmt.Sprintf("sig-%d", i), DeviceID: "dev-1",
+			LeafHash: crypto.MerkleLeafHash([]byte{byte(i)}),
+		})
+	}
+	signed := func(size int) *domain.SignedTreeHead {
+		head, err := domain.BuildSignedTreeHead(log[:size], time.Now())
+		if err != nil {
+			t.Fatalf("build tree head: %v", err)
+		}
+		if err := domain.SignLogTreeHead(head, key); err != nil {
+			t.Fatalf("sign tree head: %v", err)
+		}
+		return head
+	}
+	older, latest := signed(2), signed(4)
+
+	h := NewLogHandler(&database.MockLogRepo{
+		ListFn: func(ctx context.Context) ([]*domain.LogEntry, error) {
+			return log, nil
+		},
+		LatestTreeHeadFn: func(ctx context.Context) (*domain.SignedTreeHead, error) {
+			return latest, nil
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/log/sth", nil)
+	w := httptest.NewRecorder()
+	if err := h.GetTreeHead(w, req); err != nil {
+		t.Fatalf("get tree head: %v", err)
+	}
+	var head domain.SignedTreeHead
+	if err := json.Unmarshal(w.Body.Bytes(), &head); err != nil {
+		t.Fatalf("decode tree head: %v", err)
+	}
+	if err := domain.VerifyLogTreeHead(&head, key.Public()); err != nil || head.TreeSize != 4 {
+		t.Fatalf("expected verifiable tree head of size 4, got %d: %v", head.TreeSize, err)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "consistent heads", query: "first=2&second=4", wantStatus: http.StatusOK},
+		{name: "missing first", query: "second=4", wantStatus: http.StatusBadRequest},
+		{name: "first larger than second", query: "first=4&second=2", wantStatus: http.StatusBadRequest},
+		{name: "second not signed yet", query: "first=2&second=5", wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/log/consistency?"+tc.query, nil)
+			w := httptest.NewRecorder()
+
+			err := h.GetConsistency(w, req)
+			if (err != nil) != (tc.wantStatus != http.StatusOK) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected %d, got %d", tc.wantStatus, w.Code)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var proof domain.ConsistencyProof
+			if err := json.Unmarshal(w.Body.Bytes(), &proof); err != nil {
+				t.Fatalf("decode proof: %v", err)
+			}
+			if err := domain.VerifyConsistency(older, &head, &proof); err != nil {
+				t.Fatalf("verify proof: %v", err)
+			}
+		})
+	}
+}
+
+func TestLogHandler_NoTreeHead(t *testing.T) {
+	h := NewLogHandler(&database.MockLogRepo{})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/log/sth", nil)
+	w := httptest.NewRecorder()
+	if err := h.GetTreeHead(w, req); err == nil || w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %v", w.Code, err)
+	}
+}
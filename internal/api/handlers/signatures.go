@@ -1,80 +1,421 @@
 package handlers
 
 import (
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/validation"
 )
 
 // SignatureHandler represents object used to create signatures
 type SignatureHandler struct {
 	signatureRepo persistence.SignatureRepository
 	deviceRepo    persistence.DeviceRepository
+	signingStore  persistence.SigningStore
+	// tsaRoots are trusted roots of time-stamping authority, nil when
+	// time-stamp tokens can't be verified
+	tsaRoots *x509.CertPool
+	// ca certifies rotated device keys, nil when service CA is not configured
+	ca *crypto.CertificateAuthority
 }
 
 // NewSignatureHandler used to create signature handler
-func NewSignatureHandler(signatureRepo persistence.SignatureRepository, deviceRepo persistence.DeviceRepository) *SignatureHandler {
-	return &SignatureHandler{signatureRepo: signatureRepo, deviceRepo: deviceRepo}
+func NewSignatureHandler(
+	signatureRepo persistence.SignatureRepository,
+	deviceRepo persistence.DeviceRepository,
+	signingStore persistence.SigningStore,
+	tsaRoots *x509.CertPool,
+	ca *crypto.CertificateAuthority,
+) *SignatureHandler {
+	return &SignatureHandler{signatureRepo: signatureRepo, deviceRepo: deviceRepo, signingStore: signingStore, tsaRoots: tsaRoots, ca: ca}
+}
+
+// coseSign1ContentType is media type of COSE_Sign1 messages (RFC 9052)
+const coseSign1ContentType = `application/cose; cose-type="cose-sign1"`
+
+// maxCOSEMessageSize limits COSE_Sign1 message accepted for verification
+const maxCOSEMessageSize = 64 << 10
+
+// maxSignRequestSize limits body of sign requests, batch of MaxSignBatchSize
+// payloads of a few kilobytes fits in
+const maxSignRequestSize = 4 << 20
+
+// decodeSignRequest decodes JSON body of sign request, error response is
+// written on failure
+func decodeSignRequest(w http.ResponseWriter, r *http.Request, v any) error {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSignRequestSize)).Decode(v)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		jsonw.Error(w, fmt.Sprintf("request body can't be larger than %d bytes", maxSignRequestSize), nil, http.StatusRequestEntityTooLarge)
+		return fmt.Errorf("%v - %v", ErrBadRequest, err)
+	}
+	if err != nil {
+		jsonw.Error(w, "invalid json", nil, http.StatusBadRequest)
+		return err
+	}
+	return nil
+}
+
+// acceptsCOSE reports whether client asked for COSE_Sign1 response
+func acceptsCOSE(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == "application/cose" && (params["cose-type"] == "" || params["cose-type"] == "cose-sign1") {
+			return true
+		}
+	}
+	return false
+}
+
+// PayloadRequest carries transaction payload as text data, binary data or
+// digest of data hashed by client, only one of them can be set
+type PayloadRequest struct {
+	Data string `json:"data,omitempty"`
+	// DataBase64 is standard base64 of arbitrary bytes
+	DataBase64 string `json:"data_base64,omitempty"`
+	// Digest is hex digest computed with DigestAlgorithm, e.g. of large file
+	Digest          string `json:"digest,omitempty"`
+	DigestAlgorithm string `json:"digest_algorithm,omitempty"`
+}
+
+// empty reports whether request carries no payload at all
+func (p PayloadRequest) empty() bool {
+	return p.Data == "" && p.DataBase64 == "" && p.Digest == "" && p.DigestAlgorithm == ""
+}
+
+// payload returns domain payload of request, empty request is empty text
+func (p PayloadRequest) payload() (domain.Payload, error) {
+	set := 0
+	for _, present := range []bool{p.Data != "", p.DataBase64 != "", p.Digest != "" || p.DigestAlgorithm != ""} {
+		if present {
+			set++
+		}
+	}
+	if set > 1 {
+		return domain.Payload{}, fmt.Errorf("%w: only one of data, data_base64 and digest can be set", domain.ErrInvalidPayload)
+	}
+
+	switch {
+	case p.DataBase64 != "":
+		data, err := base64.StdEncoding.Strict().DecodeString(p.DataBase64)
+		if err != nil {
+			return domain.Payload{}, fmt.Errorf("%w: data_base64 isn't valid base64", domain.ErrInvalidPayload)
+		}
+		return domain.NewBinaryPayload(data), nil
+	case p.Digest != "" || p.DigestAlgorithm != "":
+		return domain.NewDigestPayload(crypto.HashAlgorithm(p.DigestAlgorithm), p.Digest)
+	default:
+		return domain.NewTextPayload(p.Data), nil
+	}
 }
 
 type SignTransactionRequest struct {
-	Data string `json:"data"`
+	PayloadRequest
 }
 
 // SignTransactionData and return signature and signed data, and updates devices details about signatures
 func (h *SignatureHandler) SignTransactionData(w http.ResponseWriter, r *http.Request) error {
 	deviceID := r.PathValue("id")
-	device, err := h.deviceRepo.GetByID(r.Context(), deviceID)
-	if err != nil {
-		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
-		return err
+	// format query parameter overrides device default format
+	format := domain.SignatureFormat(r.URL.Query().Get("format"))
+	if format != "" && format != domain.SignatureFormatRaw && format != domain.SignatureFormatJWS {
+		jsonw.Error(w, "format must be raw or jws", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - unsupported format %q", ErrBadRequest, format)
+	}
+	// COSE_Sign1 is selected by Accept header, it replaces JSON response
+	cose := acceptsCOSE(r)
+	if cose && format != "" {
+		jsonw.Error(w, "format can't be combined with COSE response", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - format %q with COSE response", ErrBadRequest, format)
 	}
 
 	var req SignTransactionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		jsonw.Error(w, "invalid json", nil, http.StatusBadRequest)
+	if err := decodeSignRequest(w, r, &req); err != nil {
 		return err
 	}
 
-	// sign data using domain logic
-	signedData, signature, err := domain.SignData(device, req.Data)
+	payload, err := req.payload()
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - %v", ErrBadRequest, err)
+	}
+
+	// signing, saving record and moving device counter happens as one unit of work
+	var jws string
+	var coseMessage []byte
+	record, err := h.signingStore.SignAtomically(r.Context(), deviceID, func(device *domain.SignatureDevice) (*domain.SignatureRecord, error) {
+		outputFormat := format
+		if outputFormat == "" {
+			outputFormat = device.SignatureFormat
+		}
+		record, err := newTransactionRecord(device, payload)
+		if err != nil {
+			return nil, err
+		}
+		// JWS and COSE are made before anything is stored, device without
+		// such algorithm doesn't produce chain record either
+		if cose {
+			if coseMessage, err = domain.SignCOSE(device, record.SignedData); err != nil {
+				return nil, err
+			}
+		} else if outputFormat == domain.SignatureFormatJWS {
+			if jws, err = domain.SignJWS(device, record.SignedData, record.Counter); err != nil {
+				return nil, err
+			}
+		}
+		device.IncrementCounter(record.Signature)
+		return record, nil
+	})
 	if err != nil {
-		jsonw.Error(w, "signing failed: "+err.Error(), nil, http.StatusInternalServerError)
+		return signingError(w, err)
+	}
+
+	if cose {
+		// time-stamp token is obtained after message was signed
+		if coseMessage, err = domain.AttachCOSETimestamp(coseMessage, record); err != nil {
+			jsonw.Error(w, "failed to attach time-stamp token", nil, http.StatusInternalServerError)
+			return fmt.Errorf("%v - %v", ErrSigningFailed, err)
+		}
+		w.Header().Set("Content-Type", coseSign1ContentType)
+		w.WriteHeader(http.StatusCreated)
+		_, err := w.Write(coseMessage)
 		return err
 	}
 
-	// createding and saving signature record details
-	record := &domain.SignatureRecord{
+	resp := map[string]string{
+		"signature":   record.Signature,
+		"signed_data": record.SignedData,
+	}
+	if jws != "" {
+		resp["jws"] = jws
+	}
+	if len(record.TimeStampToken) > 0 {
+		resp["timestamp_token"] = base64.StdEncoding.EncodeToString(record.TimeStampToken)
+	}
+	jsonw.Created(w, resp)
+
+	return nil
+}
+
+// newTransactionRecord signs payload as the next record of device chain,
+// device counter is moved by caller
+func newTransactionRecord(device *domain.SignatureDevice, payload domain.Payload) (*domain.SignatureRecord, error) {
+	signedData, signature, err := domain.SignPayload(device, payload)
+	if errors.Is(err, domain.ErrDeviceDeactivated) || errors.Is(err, domain.ErrInvalidPayload) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v - %v", ErrSigningFailed, err)
+	}
+
+	return &domain.SignatureRecord{
 		ID:         uuid.NewString(),
 		DeviceID:   device.ID,
+		Counter:    device.SignatureCounter,
 		SignedData: signedData,
 		Signature:  signature,
 		CreatedAt:  time.Now(),
+
+		SignatureEncoding: device.SigningEncoding(),
+		SigningKeyVersion: device.SigningKeyVersion,
+		PayloadMode:       payload.Mode,
+		SignedDataVersion: device.SignedDataVersion,
+	}, nil
+}
+
+// signingError writes response for error of signing unit of work
+func signingError(w http.ResponseWriter, err error) error {
+	if errors.Is(err, persistence.ErrDeviceNotFound) {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
 	}
-	if err := h.signatureRepo.Create(r.Context(), record); err != nil {
-		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+	if errors.Is(err, domain.ErrDeviceDeactivated) {
+		jsonw.Error(w, err.Error(), nil, http.StatusConflict)
 		return err
 	}
+	if errors.Is(err, domain.ErrInvalidPayload) {
+		jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - %v", ErrBadRequest, err)
+	}
+	if errors.Is(err, domain.ErrJWSUnsupported) {
+		jsonw.Error(w, err.Error(), nil, http.StatusUnprocessableEntity)
+		return fmt.Errorf("%v - %v", ErrSigningFailed, err)
+	}
+	if errors.Is(err, domain.ErrTimestampUnavailable) {
+		jsonw.Error(w, err.Error(), nil, http.StatusServiceUnavailable)
+		return fmt.Errorf("%v - %v", ErrSigningFailed, err)
+	}
+	jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+	return err
+}
 
-	// update device counter and last signature
-	device.SignatureCounter++
-	device.LastSignature = signature
-	device.UpdatedAt = time.Now()
-	if err := h.deviceRepo.Update(r.Context(), device); err != nil {
-		jsonw.Error(w, "failed to update device counter", nil, http.StatusInternalServerError)
+// MaxSignBatchSize limits payloads of one batch, device is locked while batch
+// is signed
+const MaxSignBatchSize = 1000
+
+// SignBatchRequest carries payloads signed as consecutive chain records
+type SignBatchRequest struct {
+	Payloads []PayloadRequest `json:"payloads"`
+}
+
+// SignBatchItem is chain record made for payload of the same position
+type SignBatchItem struct {
+	Counter        uint64 `json:"counter"`
+	Signature      string `json:"signature"`
+	SignedData     string `json:"signed_data"`
+	JWS            string `json:"jws,omitempty"`
+	TimeStampToken []byte `json:"timestamp_token,omitempty"`
+}
+
+// SignBatch signs payloads in given order as consecutive records of device
+// chain. Batch is all-or-nothing, when any payload can't be signed or stored
+// no record is stored and device doesn't move.
+func (h *SignatureHandler) SignBatch(w http.ResponseWriter, r *http.Request) error {
+	deviceID := r.PathValue("id")
+	format := domain.SignatureFormat(r.URL.Query().Get("format"))
+	if format != "" && format != domain.SignatureFormatRaw && format != domain.SignatureFormatJWS {
+		jsonw.Error(w, "format must be raw or jws", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - unsupported format %q", ErrBadRequest, format)
+	}
+
+	var req SignBatchRequest
+	if err := decodeSignRequest(w, r, &req); err != nil {
 		return err
 	}
+	if len(req.Payloads) == 0 || len(req.Payloads) > MaxSignBatchSize {
+		jsonw.Error(w, fmt.Sprintf("payloads must have 1 to %d items", MaxSignBatchSize), nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - batch of %d payloads", ErrBadRequest, len(req.Payloads))
+	}
+	// every payload is checked before device is locked
+	payloads := make([]domain.Payload, len(req.Payloads))
+	for i, p := range req.Payloads {
+		payload, err := p.payload()
+		if err != nil {
+			jsonw.Error(w, fmt.Sprintf("payloads[%d]: %v", i, err), nil, http.StatusBadRequest)
+			return fmt.Errorf("%v - payloads[%d]: %v", ErrBadRequest, i, err)
+		}
+		payloads[i] = payload
+	}
 
-	jsonw.Success(w, map[string]string{
-		"signature":   signature,
-		"signed_data": signedData,
-	}, http.StatusCreated)
+	items := make([]SignBatchItem, len(payloads))
+	records, err := h.signingStore.SignBatchAtomically(r.Context(), deviceID, func(device *domain.SignatureDevice) ([]*domain.SignatureRecord, error) {
+		outputFormat := format
+		if outputFormat == "" {
+			outputFormat = device.SignatureFormat
+		}
+		records := make([]*domain.SignatureRecord, len(payloads))
+		for i, payload := range payloads {
+			record, err := newTransactionRecord(device, payload)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = SignBatchItem{Counter: record.Counter, Signature: record.Signature, SignedData: record.SignedData}
+			if outputFormat == domain.SignatureFormatJWS {
+				if items[i].JWS, err = domain.SignJWS(device, record.SignedData, record.Counter); err != nil {
+					return nil, err
+				}
+			}
+			device.IncrementCounter(record.Signature)
+			records[i] = record
+		}
+		return records, nil
+	})
+	if err != nil {
+		return signingError(w, err)
+	}
 
+	// tokens are attached by store after records were made
+	for i, record := range records {
+		items[i].TimeStampToken = record.TimeStampToken
+	}
+	jsonw.Created(w, map[string]any{"device_id": deviceID, "items": items})
+	return nil
+}
+
+// RotateKeyResponse describes device key after rotation and chain record
+// proving continuity between old and new key
+type RotateKeyResponse struct {
+	DeviceID          string                  `json:"device_id"`
+	SigningKeyVersion int                     `json:"signing_key_version"`
+	PublicKey         []byte                  `json:"public_key"`
+	RotationRecord    *domain.SignatureRecord `json:"rotation_record"`
+}
+
+// RotateKey replaces device key pair, outgoing key signs rotation record into
+// device signature chain. New key is certified when service CA is configured.
+func (h *SignatureHandler) RotateKey(w http.ResponseWriter, r *http.Request) error {
+	deviceID := r.PathValue("id")
+
+	var resp RotateKeyResponse
+	record, err := h.signingStore.SignAtomically(r.Context(), deviceID, func(device *domain.SignatureDevice) (*domain.SignatureRecord, error) {
+		previousVersion := device.SigningKeyVersion
+		signedData, signature, err := domain.RotateKey(device)
+		if errors.Is(err, domain.ErrDeviceDeactivated) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v - %v", ErrKeyRotation, err)
+		}
+		// new key is certified with rotation, so device isn't left without
+		// certificate until it's issued again
+		if h.ca != nil {
+			if err := domain.IssueCertificate(device, h.ca); err != nil {
+				return nil, fmt.Errorf("%v - %v", ErrIssueCertificate, err)
+			}
+		}
+
+		record := &domain.SignatureRecord{
+			ID:         uuid.NewString(),
+			DeviceID:   device.ID,
+			Counter:    device.SignatureCounter,
+			SignedData: signedData,
+			Signature:  signature,
+			CreatedAt:  time.Now(),
+
+			SignatureEncoding: device.SigningEncoding(),
+			Kind:              domain.RecordKindKeyRotation,
+			SigningKeyVersion: previousVersion,
+			SignedDataVersion: device.SignedDataVersion,
+		}
+		device.IncrementCounter(signature)
+
+		resp.DeviceID = device.ID
+		resp.SigningKeyVersion = device.SigningKeyVersion
+		resp.PublicKey = device.PublicKey
+		return record, nil
+	})
+	if err != nil {
+		if errors.Is(err, persistence.ErrDeviceNotFound) {
+			jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+			return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+		}
+		if errors.Is(err, domain.ErrDeviceDeactivated) {
+			jsonw.Error(w, err.Error(), nil, http.StatusConflict)
+			return err
+		}
+		if errors.Is(err, domain.ErrTimestampUnavailable) {
+			jsonw.Error(w, err.Error(), nil, http.StatusServiceUnavailable)
+			return fmt.Errorf("%v - %v", ErrKeyRotation, err)
+		}
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return err
+	}
+
+	resp.RotationRecord = record
+	jsonw.Success(w, resp, http.StatusOK)
 	return nil
 }
 
@@ -90,3 +431,117 @@ func (h *SignatureHandler) ListSignatures(w http.ResponseWriter, r *http.Request
 	jsonw.Success(w, records, http.StatusOK)
 	return nil
 }
+
+// AuditDevice verifies whole signature chain of device and reports broken links
+func (h *SignatureHandler) AuditDevice(w http.ResponseWriter, r *http.Request) error {
+	deviceID := r.PathValue("id")
+	device, err := h.deviceRepo.GetByID(r.Context(), deviceID)
+	if err != nil {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+
+	records, err := h.signatureRepo.ListByDevice(r.Context(), deviceID)
+	if err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrListSignatures, err)
+	}
+
+	report := domain.VerifyChain(device, records)
+	report.AddTimestamps(records, h.tsaRoots)
+	jsonw.Success(w, report, http.StatusOK)
+	return nil
+}
+
+type VerifySignatureRequest struct {
+	Signature         string `json:"signature" validate:"required,base64"`
+	SignedData        string `json:"signed_data" validate:"required"`
+	SignatureEncoding string `json:"signature_encoding"`
+	// TimestampToken is optional RFC 3161 token over signature, when it's
+	// missing token stored with signature record is checked
+	TimestampToken []byte `json:"timestamp_token"`
+	// optional payload which signed data has to stand for, digest payloads
+	// are matched against data hashed by service
+	PayloadRequest
+}
+
+// VerifySignature checks if provided signature and signed data were produced by device
+func (h *SignatureHandler) VerifySignature(w http.ResponseWriter, r *http.Request) error {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/cose" {
+		return h.verifyCOSE(w, r)
+	}
+
+	var req VerifySignatureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonw.Error(w, "invalid json", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - %v", ErrInvalidJson, err)
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+		return err
+	}
+	content, err := req.payload()
+	if err != nil && !req.PayloadRequest.empty() {
+		jsonw.Error(w, err.Error(), nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - %v", ErrBadRequest, err)
+	}
+
+	deviceID := r.PathValue("id")
+	device, err := h.deviceRepo.GetByID(r.Context(), deviceID)
+	if err != nil {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+
+	result := domain.VerifySignedData(device, req.SignedData, req.Signature, crypto.SignatureEncoding(req.SignatureEncoding))
+	if !req.PayloadRequest.empty() {
+		result.CheckPayload(content)
+	}
+	if err := h.checkTimestamp(r, &result, req.Signature, req.TimestampToken); err != nil {
+		jsonw.Error(w, "error reading signature record", nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrVerifySignature, err)
+	}
+	jsonw.Success(w, result, http.StatusOK)
+	return nil
+}
+
+// checkTimestamp describes time-stamp token of verified signature, given
+// token or the one stored with signature record. Token doesn't change
+// signature verdict, it's reported separately.
+func (h *SignatureHandler) checkTimestamp(r *http.Request, result *domain.VerificationResult, signature string, token []byte) error {
+	if !result.Valid {
+		return nil
+	}
+	if len(token) == 0 {
+		rec, err := h.signatureRepo.GetBySignature(r.Context(), result.DeviceID, signature)
+		if err != nil {
+			return err
+		}
+		if rec != nil {
+			token = rec.TimeStampToken
+		}
+	}
+	if len(token) > 0 {
+		verdict := domain.VerifyTimestamp(signature, token, h.tsaRoots)
+		result.Timestamp = &verdict
+	}
+	return nil
+}
+
+// verifyCOSE checks COSE_Sign1 message sent as request body
+func (h *SignatureHandler) verifyCOSE(w http.ResponseWriter, r *http.Request) error {
+	message, err := io.ReadAll(io.LimitReader(r.Body, maxCOSEMessageSize+1))
+	if err != nil || len(message) > maxCOSEMessageSize {
+		jsonw.Error(w, "COSE message is too large", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - COSE message is too large", ErrBadRequest)
+	}
+
+	device, err := h.deviceRepo.GetByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		jsonw.Error(w, "device not found", nil, http.StatusNotFound)
+		return fmt.Errorf("%v - %v", ErrDeviceNotFounc, err)
+	}
+
+	jsonw.Success(w, domain.VerifyCOSE(device, message), http.StatusOK)
+	return nil
+}
@@ -1,3 +1,907 @@
-package handlers_test
+package handlers
 
-// TODO add test for singatures handlers
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/mocks/database"
+)
+
+// helper type to decode sign response
+type signResponse struct {
+	Status string            `json:"status"`
+	Data   map[string]string `json:"data"`
+}
+
+func newTestDevice(t *testing.T, algorithm domain.AlgorithmType) *domain.SignatureDevice {
+	t.Helper()
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: algorithm}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	return device
+}
+
+func TestSignTransactionData_Success(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmECC)
+
+	var stored *domain.SignatureRecord
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			rec, err := fn(device)
+			stored = rec
+			return rec, err
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign", bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+
+	if err := h.SignTransactionData(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp signResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if resp.Data["signature"] != stored.Signature || resp.Data["signed_data"] != stored.SignedData {
+		t.Errorf("response doesn't match stored record")
+	}
+	if stored.Counter != 0 {
+		t.Errorf("expected record counter 0, got %d", stored.Counter)
+	}
+	if device.SignatureCounter != 1 || device.LastSignature != stored.Signature {
+		t.Errorf("expected device to move forward, got counter=%d", device.SignatureCounter)
+	}
+}
+
+func TestSignTransactionData_DeviceNotFound(t *testing.T) {
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			return nil, persistence.ErrDeviceNotFound
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/xyz/sign", bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+	req.SetPathValue("id", "xyz")
+	w := httptest.NewRecorder()
+
+	err := h.SignTransactionData(w, req)
+	if err == nil || !strings.Contains(err.Error(), ErrDeviceNotFounc.Error()) {
+		t.Errorf("expected error[%v], got[%v]", ErrDeviceNotFounc, err)
+	}
+	if w.Result().StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Result().StatusCode)
+	}
+}
+
+func TestSignTransactionData_StoreError(t *testing.T) {
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			return nil, errors.New("db error")
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign", bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+
+	if err := h.SignTransactionData(w, req); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if w.Result().StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", w.Result().StatusCode)
+	}
+}
+
+func TestSignTransactionData_InvalidJSON(t *testing.T) {
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, &database.MockSigningStore{}, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign", bytes.NewReader([]byte("{bad-json")))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+
+	if err := h.SignTransactionData(w, req); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Result().StatusCode)
+	}
+}
+
+// helper type to decode audit response
+type auditResponse struct {
+	Status string             `json:"status"`
+	Data   domain.ChainReport `json:"data"`
+}
+
+func TestAuditDevice_Success(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmECC)
+	signedData, signature, err := domain.SignData(device, "tx-1")
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	record := &domain.SignatureRecord{
+		ID:                "sig-1",
+		DeviceID:          device.ID,
+		SignedData:        signedData,
+		Signature:         signature,
+		SignatureEncoding: device.SigningEncoding(),
+	}
+	device.IncrementCounter(signature)
+
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	signatureRepo := &database.MockSignatureRepo{
+		ListByDeviceFn: func(ctx context.Context, deviceID string) ([]*domain.SignatureRecord, error) {
+			return []*domain.SignatureRecord{record}, nil
+		},
+	}
+	h := NewSignatureHandler(signatureRepo, deviceRepo, &database.MockSigningStore{}, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/devices/dev-1/audit", nil)
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+
+	if err := h.AuditDevice(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp auditResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !resp.Data.Valid || resp.Data.Checked != 1 {
+		t.Errorf("expected valid chain with 1 record, got %+v", resp.Data)
+	}
+}
+
+func TestAuditDevice_NotFound(t *testing.T) {
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return nil, errors.New("device not found")
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, deviceRepo, &database.MockSigningStore{}, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/devices/xyz/audit", nil)
+	req.SetPathValue("id", "xyz")
+	w := httptest.NewRecorder()
+
+	if err := h.AuditDevice(w, req); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if w.Result().StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Result().StatusCode)
+	}
+}
+
+// helper type to decode verify response
+type verifyResponse struct {
+	Status string                    `json:"status"`
+	Data   domain.VerificationResult `json:"data"`
+}
+
+func TestVerifySignature_Success(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmRSA)
+	signedData, signature, err := domain.SignData(device, "tx-1")
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, deviceRepo, &database.MockSigningStore{}, nil, nil)
+
+	body, _ := json.Marshal(VerifySignatureRequest{Signature: signature, SignedData: signedData})
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/verify", bytes.NewReader(body))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+
+	if err := h.VerifySignature(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp verifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !resp.Data.Valid || resp.Data.Algorithm != domain.AlgorithmRSA {
+		t.Errorf("expected valid RSA verdict, got %+v", resp.Data)
+	}
+}
+
+func TestVerifySignature_LookupFailure(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmECC)
+	signedData, signature, err := domain.SignData(device, "tx-1")
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	signatureRepo := &database.MockSignatureRepo{
+		GetBySignatureFn: func(ctx context.Context, deviceID, sig string) (*domain.SignatureRecord, error) {
+			if deviceID != device.ID || sig != signature {
+				t.Errorf("unexpected lookup of %q by %q", sig, deviceID)
+			}
+			return nil, errors.New("connection refused")
+		},
+	}
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	h := NewSignatureHandler(signatureRepo, deviceRepo, &database.MockSigningStore{}, nil, nil)
+
+	body, _ := json.Marshal(VerifySignatureRequest{Signature: signature, SignedData: signedData})
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/verify", bytes.NewReader(body))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+
+	err = h.VerifySignature(w, req)
+	if err == nil || !strings.Contains(err.Error(), ErrVerifySignature.Error()) {
+		t.Fatalf("expected verification error, got %v", err)
+	}
+	if w.Result().StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", w.Result().StatusCode)
+	}
+}
+
+func TestVerifySignature_MissingFields(t *testing.T) {
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, &database.MockSigningStore{}, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/verify", bytes.NewReader([]byte(`{"signature":""}`)))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+
+	if err := h.VerifySignature(w, req); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Result().StatusCode)
+	}
+}
+
+func TestRotateKey_Success(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmECC)
+	oldPublicKey := device.PublicKey
+
+	var stored *domain.SignatureRecord
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			rec, err := fn(device)
+			stored = rec
+			return rec, err
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/rotate-key", nil)
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+
+	if err := h.RotateKey(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp struct {
+		Data RotateKeyResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if resp.Data.SigningKeyVersion != 1 || bytes.Equal(resp.Data.PublicKey, oldPublicKey) {
+		t.Errorf("expected new key with version 1, got version %d", resp.Data.SigningKeyVersion)
+	}
+	if stored.Kind != domain.RecordKindKeyRotation || stored.SigningKeyVersion != 0 {
+		t.Errorf("expected rotation record signed by key version 0, got %+v", stored)
+	}
+	if report := domain.VerifyChain(device, []*domain.SignatureRecord{stored}); !report.Valid {
+		t.Errorf("expected valid chain after rotation, got %+v", report.Issues)
+	}
+}
+
+func TestRotateKey_DeviceNotFound(t *testing.T) {
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			return nil, persistence.ErrDeviceNotFound
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/missing/rotate-key", nil)
+	req.SetPathValue("id", "missing")
+	w := httptest.NewRecorder()
+
+	if err := h.RotateKey(w, req); err == nil {
+		t.Fatalf("expected error")
+	}
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestSignTransactionData_DeactivatedDevice(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmECC)
+	device.Status = domain.DeviceStatusDeactivated
+
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			return fn(device)
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign", bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+
+	if err := h.SignTransactionData(w, req); !errors.Is(err, domain.ErrDeviceDeactivated) {
+		t.Fatalf("expected deactivated error, got %v", err)
+	}
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+	if device.SignatureCounter != 0 {
+		t.Errorf("deactivated device must not move forward")
+	}
+}
+
+func TestSignTransactionData_JWS(t *testing.T) {
+	tests := map[string]struct {
+		query        string
+		deviceFormat domain.SignatureFormat
+		wantJWS      bool
+		wantStatus   int
+	}{
+		"query format":           {query: "?format=jws", wantJWS: true, wantStatus: http.StatusCreated},
+		"device default":         {deviceFormat: domain.SignatureFormatJWS, wantJWS: true, wantStatus: http.StatusCreated},
+		"query overrides device": {query: "?format=raw", deviceFormat: domain.SignatureFormatJWS, wantStatus: http.StatusCreated},
+		"unknown format":         {query: "?format=xml", wantStatus: http.StatusBadRequest},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			device := newTestDevice(t, domain.AlgorithmEd25519)
+			device.SignatureFormat = tc.deviceFormat
+			signingStore := &database.MockSigningStore{
+				SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+					return fn(device)
+				},
+			}
+			h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign"+tc.query, bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+			req.SetPathValue("id", "dev-1")
+			w := httptest.NewRecorder()
+			_ = h.SignTransactionData(w, req)
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d", tc.wantStatus, w.Code)
+			}
+			var resp signResponse
+			_ = json.NewDecoder(w.Body).Decode(&resp)
+			if (resp.Data["jws"] != "") != tc.wantJWS {
+				t.Fatalf("unexpected jws %q", resp.Data["jws"])
+			}
+			if !tc.wantJWS {
+				return
+			}
+			parts := strings.Split(resp.Data["jws"], ".")
+			payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			if len(parts) != 3 || string(payload) != resp.Data["signed_data"] {
+				t.Errorf("JWS payload must be signed data, got %q", payload)
+			}
+		})
+	}
+}
+
+func TestSignTransactionData_JWSUnsupported(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	_ = device.ConfigureKeyParams(crypto.KeyParams{Curve: crypto.CurveP521, Hash: crypto.HashSHA256}, crypto.DefaultKeyPolicy)
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			return fn(device)
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign?format=jws", bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	if err := h.SignTransactionData(w, req); err == nil {
+		t.Fatalf("expected error")
+	}
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", w.Code)
+	}
+	if device.SignatureCounter != 0 {
+		t.Errorf("failed JWS must not move device forward")
+	}
+}
+
+func TestSignTransactionData_COSE(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmEd25519)
+	var stored *domain.SignatureRecord
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			rec, err := fn(device)
+			stored = rec
+			return rec, err
+		},
+	}
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, deviceRepo, signingStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign", bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+	req.Header.Set("Accept", `application/json;q=0.5, application/cose; cose-type="cose-sign1"`)
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	if err := h.SignTransactionData(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusCreated || !strings.HasPrefix(ct, "application/cose") {
+		t.Fatalf("expected 201 with COSE content type, got %d %q", w.Code, ct)
+	}
+	message := w.Body.Bytes()
+
+	// message goes back through verify endpoint
+	req = httptest.NewRequest(http.MethodPost, "/devices/dev-1/verify", bytes.NewReader(message))
+	req.Header.Set("Content-Type", "application/cose")
+	req.SetPathValue("id", "dev-1")
+	w = httptest.NewRecorder()
+	if err := h.VerifySignature(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var resp verifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !resp.Data.Valid || resp.Data.SignedData != stored.SignedData {
+		t.Errorf("expected valid COSE verdict for stored record, got %+v", resp.Data)
+	}
+}
+
+func TestSignTransactionData_COSETimestamp(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmEd25519)
+	token := []byte{0x30, 0x03, 0x02, 0x01, 0x01}
+	var stored *domain.SignatureRecord
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			rec, err := fn(device)
+			if err != nil {
+				return nil, err
+			}
+			// time-stamping store attaches token after fn
+			rec.TimeStampToken = token
+			stored = rec
+			return rec, nil
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign", bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+	req.Header.Set("Accept", "application/cose")
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	if err := h.SignTransactionData(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msg, err := crypto.ParseCOSESign1(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("parse COSE: %v", err)
+	}
+	if got, _ := msg.Unprotected[domain.COSEHeaderTimestampToken].([]byte); !bytes.Equal(got, token) {
+		t.Errorf("expected time-stamp token in unprotected header, got %x", got)
+	}
+	if got := msg.Unprotected[domain.COSEHeaderChainSignature]; got != stored.Signature {
+		t.Errorf("expected chain record signature next to token, got %v", got)
+	}
+	if result := domain.VerifyCOSE(device, w.Body.Bytes()); !result.Valid {
+		t.Errorf("expected message with token to verify: %s", result.Reason)
+	}
+}
+
+func TestSignTransactionData_COSEWithFormat(t *testing.T) {
+	for _, format := range []string{"jws", "raw"} {
+		t.Run(format, func(t *testing.T) {
+			signingStore := &database.MockSigningStore{
+				SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+					t.Errorf("conflicting request must not be signed")
+					return nil, nil
+				},
+			}
+			h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign?format="+format, bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+			req.Header.Set("Accept", "application/cose")
+			req.SetPathValue("id", "dev-1")
+			w := httptest.NewRecorder()
+			if err := h.SignTransactionData(w, req); err == nil || w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d (%v)", w.Code, err)
+			}
+		})
+	}
+}
+
+func TestSignTransactionData_BodyTooLarge(t *testing.T) {
+	signingStore := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			t.Errorf("too large request must not be signed")
+			return nil, nil
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+	body := `{"data":"` + strings.Repeat("a", maxSignRequestSize) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign", strings.NewReader(body))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	if err := h.SignTransactionData(w, req); err == nil || w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d (%v)", w.Code, err)
+	}
+}
+
+func TestSignTransactionData_PayloadModes(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	tests := []struct {
+		name          string
+		version       domain.SignedDataVersion
+		body          string
+		wantStatus    int
+		wantMode      domain.PayloadMode
+		wantStatement string
+	}{
+		{"text", domain.SignedDataV0, `{"data":"tx-1"}`, http.StatusCreated, domain.PayloadModeText, "tx-1"},
+		{"binary", domain.SignedDataV0, `{"data_base64":"AP8="}`, http.StatusCreated, domain.PayloadModeBase64, "base64:AP8="},
+		{"digest", domain.SignedDataV0, `{"digest":"` + digest + `","digest_algorithm":"SHA-256"}`, http.StatusCreated, domain.PayloadModeDigest, "digest:SHA-256:" + digest},
+		{"invalid base64", domain.SignedDataV0, `{"data_base64":"***"}`, http.StatusBadRequest, "", ""},
+		{"digest without algorithm", domain.SignedDataV0, `{"digest":"` + digest + `"}`, http.StatusBadRequest, "", ""},
+		{"digest of wrong size", domain.SignedDataV0, `{"digest":"abcd","digest_algorithm":"SHA-256"}`, http.StatusBadRequest, "", ""},
+		{"two modes", domain.SignedDataV0, `{"data":"tx-1","data_base64":"AP8="}`, http.StatusBadRequest, "", ""},
+		{"v0 text with reserved prefix", domain.SignedDataV0, `{"data":"base64:AP8="}`, http.StatusBadRequest, "", ""},
+		{"v1 text with reserved prefix", domain.SignedDataV1, `{"data":"base64:AP8="}`, http.StatusCreated, domain.PayloadModeText, "base64:AP8="},
+		{"v1 binary", domain.SignedDataV1, `{"data_base64":"AP8="}`, http.StatusCreated, domain.PayloadModeBase64, "base64:AP8="},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			device := newTestDevice(t, domain.AlgorithmECC)
+			device.SignedDataVersion = tc.version
+			var stored *domain.SignatureRecord
+			signingStore := &database.MockSigningStore{
+				SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+					rec, err := fn(device)
+					stored = rec
+					return rec, err
+				},
+			}
+			h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign", strings.NewReader(tc.body))
+			req.SetPathValue("id", "dev-1")
+			w := httptest.NewRecorder()
+
+			err := h.SignTransactionData(w, req)
+			if w.Result().StatusCode != tc.wantStatus {
+				t.Fatalf("expected %d, got %d (err: %v)", tc.wantStatus, w.Result().StatusCode, err)
+			}
+			if tc.wantStatus != http.StatusCreated {
+				if stored != nil {
+					t.Errorf("rejected payload must not be signed")
+				}
+				return
+			}
+			if stored.PayloadMode != tc.wantMode {
+				t.Errorf("expected payload mode %q, got %q", tc.wantMode, stored.PayloadMode)
+			}
+			envelope, err := domain.ParseSignedData(stored.SignedData)
+			if err != nil {
+				t.Fatalf("parse signed data: %v", err)
+			}
+			if envelope.Version != tc.version || envelope.Data != tc.wantStatement {
+				t.Errorf("expected v%d signed data with %q, got %q", tc.version, tc.wantStatement, stored.SignedData)
+			}
+			if tc.version == domain.SignedDataV1 && envelope.Mode != tc.wantMode {
+				t.Errorf("expected v1 envelope to record mode %q, got %q", tc.wantMode, envelope.Mode)
+			}
+			if report := domain.VerifyChain(device, []*domain.SignatureRecord{stored}); !report.Valid {
+				t.Errorf("expected valid chain, got %+v", report.Issues)
+			}
+		})
+	}
+}
+
+func TestVerifySignature_Payload(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmRSA)
+	document := []byte("large document")
+	digest, err := crypto.HashSHA512.Digest(document)
+	if err != nil {
+		t.Fatalf("digest: %v", err)
+	}
+	payload, err := domain.NewDigestPayload(crypto.HashSHA512, hex.EncodeToString(digest))
+	if err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	signedData, signature, err := domain.SignData(device, payload.Statement())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, deviceRepo, &database.MockSigningStore{}, nil, nil)
+
+	tests := []struct {
+		name      string
+		content   PayloadRequest
+		wantValid bool
+	}{
+		{"no content", PayloadRequest{}, true},
+		{"original document", PayloadRequest{DataBase64: base64.StdEncoding.EncodeToString(document)}, true},
+		{"the same digest", PayloadRequest{Digest: hex.EncodeToString(digest), DigestAlgorithm: "SHA-512"}, true},
+		{"other document", PayloadRequest{Data: "other document"}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(VerifySignatureRequest{Signature: signature, SignedData: signedData, PayloadRequest: tc.content})
+			req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/verify", bytes.NewReader(body))
+			req.SetPathValue("id", "dev-1")
+			w := httptest.NewRecorder()
+
+			if err := h.VerifySignature(w, req); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var resp verifyResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+			if resp.Data.Valid != tc.wantValid {
+				t.Errorf("expected valid=%v, got %+v", tc.wantValid, resp.Data)
+			}
+			if resp.Data.Payload == nil || resp.Data.Payload.Mode != domain.PayloadModeDigest || resp.Data.Payload.DigestAlgorithm != crypto.HashSHA512 {
+				t.Errorf("expected SHA-512 digest payload, got %+v", resp.Data.Payload)
+			}
+		})
+	}
+}
+
+func TestSignTransactionData_Timestamp(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmECC)
+	tsa := newTestTSA(t)
+
+	var records []*domain.SignatureRecord
+	store := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			rec, err := fn(device)
+			if err == nil {
+				records = append(records, rec)
+			}
+			return rec, err
+		},
+	}
+	signatureRepo := &database.MockSignatureRepo{
+		ListByDeviceFn: func(ctx context.Context, deviceID string) ([]*domain.SignatureRecord, error) {
+			return records, nil
+		},
+		GetBySignatureFn: func(ctx context.Context, deviceID, signature string) (*domain.SignatureRecord, error) {
+			for _, rec := range records {
+				if rec.Signature == signature {
+					return rec, nil
+				}
+			}
+			return nil, nil
+		},
+	}
+	deviceRepo := &database.MockDeviceRepo{
+		GetByIDFn: func(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+			return device, nil
+		},
+	}
+	h := NewSignatureHandler(signatureRepo, deviceRepo, persistence.NewTimestampingSigningStore(store, tsa), tsa.Roots(), nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign", bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	if err := h.SignTransactionData(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var signed signResponse
+	if err := json.NewDecoder(w.Body).Decode(&signed); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if signed.Data["timestamp_token"] != base64.StdEncoding.EncodeToString(records[0].TimeStampToken) {
+		t.Fatalf("expected stored token in response")
+	}
+
+	// token stored with signature is reported by verification
+	body, _ := json.Marshal(VerifySignatureRequest{Signature: signed.Data["signature"], SignedData: signed.Data["signed_data"]})
+	req = httptest.NewRequest(http.MethodPost, "/devices/dev-1/verify", bytes.NewReader(body))
+	req.SetPathValue("id", "dev-1")
+	w = httptest.NewRecorder()
+	if err := h.VerifySignature(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var verified verifyResponse
+	if err := json.NewDecoder(w.Body).Decode(&verified); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !verified.Data.Valid || verified.Data.Timestamp == nil || !verified.Data.Timestamp.Valid {
+		t.Fatalf("expected valid signature with valid time-stamp, got %+v", verified.Data)
+	}
+
+	// token given by caller has to cover signature
+	other, err := domain.TimestampSignature(context.Background(), tsa, base64.StdEncoding.EncodeToString([]byte("other")))
+	if err != nil {
+		t.Fatalf("timestamp: %v", err)
+	}
+	body, _ = json.Marshal(VerifySignatureRequest{Signature: signed.Data["signature"], SignedData: signed.Data["signed_data"], TimestampToken: other})
+	req = httptest.NewRequest(http.MethodPost, "/devices/dev-1/verify", bytes.NewReader(body))
+	req.SetPathValue("id", "dev-1")
+	w = httptest.NewRecorder()
+	if err := h.VerifySignature(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	verified = verifyResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&verified); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !verified.Data.Valid || verified.Data.Timestamp == nil || verified.Data.Timestamp.Valid {
+		t.Fatalf("expected valid signature with invalid time-stamp, got %+v", verified.Data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/devices/dev-1/audit", nil)
+	req.SetPathValue("id", "dev-1")
+	w = httptest.NewRecorder()
+	if err := h.AuditDevice(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var audit auditResponse
+	if err := json.NewDecoder(w.Body).Decode(&audit); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if !audit.Data.Valid || len(audit.Data.Timestamps) != 1 || !audit.Data.Timestamps[0].Valid {
+		t.Fatalf("expected audit with valid time-stamp, got %+v", audit.Data)
+	}
+}
+
+func TestSignTransactionData_TimestampUnavailable(t *testing.T) {
+	store := &database.MockSigningStore{
+		SignAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+			return nil, fmt.Errorf("%w: connection refused", domain.ErrTimestampUnavailable)
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, store, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign", bytes.NewReader([]byte(`{"data":"tx-1"}`)))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	if err := h.SignTransactionData(w, req); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestSignBatch(t *testing.T) {
+	device := newTestDevice(t, domain.AlgorithmECC)
+	var stored []*domain.SignatureRecord
+	signingStore := &database.MockSigningStore{
+		SignBatchAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.BatchSignFunc) ([]*domain.SignatureRecord, error) {
+			records, err := fn(device)
+			if err == nil {
+				stored = records
+			}
+			return records, err
+		},
+	}
+	h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+	body := `{"payloads":[{"data":"tx-1"},{"data_base64":"AAEC"},{"data":"tx-3"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign/batch", strings.NewReader(body))
+	req.SetPathValue("id", "dev-1")
+	w := httptest.NewRecorder()
+	if err := h.SignBatch(w, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+
+	var resp struct {
+		Data struct {
+			Items []SignBatchItem `json:"items"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(resp.Data.Items) != 3 || len(stored) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(resp.Data.Items))
+	}
+	for i, item := range resp.Data.Items {
+		if item.Counter != uint64(i) || item.Signature != stored[i].Signature || item.SignedData != stored[i].SignedData {
+			t.Fatalf("item %d doesn't match chain record", i)
+		}
+	}
+	if stored[1].PayloadMode != domain.PayloadModeBase64 {
+		t.Errorf("expected binary payload of second item, got %q", stored[1].PayloadMode)
+	}
+	if device.SignatureCounter != 3 || device.LastSignature != stored[2].Signature {
+		t.Errorf("expected device to move over whole batch, got counter=%d", device.SignatureCounter)
+	}
+}
+
+func TestSignBatch_Rejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		deactivate bool
+		wantStatus int
+	}{
+		{name: "empty batch", body: `{"payloads":[]}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid payload", body: `{"payloads":[{"data":"tx-1"},{"data":"a","digest":"00"}]}`, wantStatus: http.StatusBadRequest},
+		{name: "too large batch", body: `{"payloads":[` + strings.Repeat(`{"data":"x"},`, MaxSignBatchSize) + `{"data":"x"}]}`, wantStatus: http.StatusBadRequest},
+		{name: "deactivated device", body: `{"payloads":[{"data":"tx-1"}]}`, deactivate: true, wantStatus: http.StatusConflict},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			device := newTestDevice(t, domain.AlgorithmECC)
+			if tc.deactivate {
+				device.Status = domain.DeviceStatusDeactivated
+			}
+			signingStore := &database.MockSigningStore{
+				SignBatchAtomicallyFn: func(ctx context.Context, deviceID string, fn persistence.BatchSignFunc) ([]*domain.SignatureRecord, error) {
+					return fn(device)
+				},
+			}
+			h := NewSignatureHandler(&database.MockSignatureRepo{}, &database.MockDeviceRepo{}, signingStore, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/devices/dev-1/sign/batch", strings.NewReader(tc.body))
+			req.SetPathValue("id", "dev-1")
+			w := httptest.NewRecorder()
+			if err := h.SignBatch(w, req); err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected %d, got %d", tc.wantStatus, w.Code)
+			}
+			if device.SignatureCounter != 0 {
+				t.Fatalf("rejected batch must not move device")
+			}
+		})
+	}
+}
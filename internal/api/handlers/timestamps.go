@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/jsonw"
+)
+
+// maxTimeStampQuerySize limits time-stamp request, it carries single digest
+const maxTimeStampQuerySize = 16 << 10
+
+// TimestampHandler exposes embedded time-stamping authority over RFC 3161
+// HTTP transport
+type TimestampHandler struct {
+	tsa *crypto.TimeStampAuthority
+}
+
+// NewTimestampHandler used to create time-stamping handler
+func NewTimestampHandler(tsa *crypto.TimeStampAuthority) *TimestampHandler {
+	return &TimestampHandler{tsa: tsa}
+}
+
+// Timestamp answers DER time-stamp query with DER time-stamp reply. Invalid
+// queries are answered with rejection reply, as RFC 3161 expects.
+func (h *TimestampHandler) Timestamp(w http.ResponseWriter, r *http.Request) error {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != crypto.TimeStampQueryContentType {
+		jsonw.Error(w, "content type must be "+crypto.TimeStampQueryContentType, nil, http.StatusUnsupportedMediaType)
+		return fmt.Errorf("%v - unsupported content type %q", ErrBadRequest, r.Header.Get("Content-Type"))
+	}
+	query, err := io.ReadAll(io.LimitReader(r.Body, maxTimeStampQuerySize+1))
+	if err != nil || len(query) > maxTimeStampQuerySize {
+		jsonw.Error(w, "time-stamp query is too large", nil, http.StatusBadRequest)
+		return fmt.Errorf("%v - time-stamp query is too large", ErrBadRequest)
+	}
+
+	reply, err := h.tsa.Respond(query)
+	if err != nil {
+		jsonw.Error(w, "failed to encode time-stamp reply", nil, http.StatusInternalServerError)
+		return fmt.Errorf("%v - %v", ErrTimestamp, err)
+	}
+	w.Header().Set("Content-Type", crypto.TimeStampReplyContentType)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(reply)
+	return err
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	stdcrypto "crypto"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+func newTestTSA(t *testing.T) *crypto.TimeStampAuthority {
+	t.Helper()
+	material, err := crypto.GenerateTimeStampAuthority("Test", time.Hour)
+	if err != nil {
+		t.Fatalf("generate TSA: %v", err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tsa.pem"), filepath.Join(dir, "tsa-key.pem")
+	if err := os.WriteFile(certFile, material.Chain, 0o644); err != nil {
+		t.Fatalf("write chain: %v", err)
+	}
+	if err := os.WriteFile(keyFile, material.Key, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	tsa, err := crypto.LoadTimeStampAuthority(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("load TSA: %v", err)
+	}
+	return tsa
+}
+
+func TestTimestamp_Client(t *testing.T) {
+	tsa := newTestTSA(t)
+	h := NewTimestampHandler(tsa)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := h.Timestamp(w, r); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	digest := sha256.Sum256([]byte("signature"))
+	client := &crypto.TimeStampClient{URL: srv.URL, HTTPClient: srv.Client()}
+	token, err := client.Timestamp(context.Background(), digest[:], stdcrypto.SHA256)
+	if err != nil {
+		t.Fatalf("timestamp: %v", err)
+	}
+	info, err := crypto.VerifyTimeStampToken(token, digest[:], tsa.Roots())
+	if err != nil {
+		t.Fatalf("verify token: %v", err)
+	}
+	if !info.Policy.Equal(crypto.DefaultTimeStampPolicy) || info.Nonce == nil {
+		t.Errorf("expected default policy and nonce, got %v %v", info.Policy, info.Nonce)
+	}
+}
+
+func TestTimestamp_Errors(t *testing.T) {
+	h := NewTimestampHandler(newTestTSA(t))
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantStatus  int
+		wantErr     bool
+	}{
+		{name: "wrong content type", contentType: "application/json", body: []byte("{}"), wantStatus: http.StatusUnsupportedMediaType, wantErr: true},
+		{name: "query too large", contentType: crypto.TimeStampQueryContentType, body: make([]byte, maxTimeStampQuerySize+1), wantStatus: http.StatusBadRequest, wantErr: true},
+		// malformed query is answered with rejection reply
+		{name: "malformed query", contentType: crypto.TimeStampQueryContentType, body: []byte{1, 2, 3}, wantStatus: http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/tsa", bytes.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			w := httptest.NewRecorder()
+
+			err := h.Timestamp(w, req)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if w.Code != tc.wantStatus {
+				t.Fatalf("expected %d, got %d", tc.wantStatus, w.Code)
+			}
+			if tc.wantStatus == http.StatusOK {
+				if _, err := crypto.ParseTimeStampResponse(w.Body.Bytes()); err == nil {
+					t.Errorf("expected rejection reply")
+				}
+			}
+		})
+	}
+}
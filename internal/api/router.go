@@ -1,10 +1,14 @@
 package api
 
 import (
+	stdcrypto "crypto"
+	"crypto/x509"
 	"net/http"
+	"time"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/api/handlers"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
 	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/logger"
 )
 
@@ -14,6 +18,17 @@ func NewRouter(
 	deviceRepo persistence.DeviceRepository,
 	signatureRepo persistence.SignatureRepository,
 	userRepo persistence.UserRepository,
+	signingStore persistence.SigningStore,
+	treeHeadRepo persistence.TreeHeadRepository,
+	logRepo persistence.LogRepository,
+	idempotencyStore persistence.IdempotencyStore,
+	idempotencyRetention time.Duration,
+	idempotencyLease time.Duration,
+	keyPolicy crypto.KeyPolicy,
+	ca *crypto.CertificateAuthority,
+	tsa *crypto.TimeStampAuthority,
+	tsaRoots *x509.CertPool,
+	anchorKey stdcrypto.PublicKey,
 ) http.Handler {
 
 	mux := http.NewServeMux()
@@ -21,18 +36,58 @@ func NewRouter(
 
 	// Handlers
 	healthHandler := handlers.NewHealthHandler()
-	deviceHandler := handlers.NewDeviceHandler(deviceRepo, userRepo)
-	signatureHandler := handlers.NewSignatureHandler(signatureRepo, deviceRepo)
+	deviceHandler := handlers.NewDeviceHandler(deviceRepo, userRepo, signingStore, keyPolicy)
+	signatureHandler := handlers.NewSignatureHandler(signatureRepo, deviceRepo, signingStore, tsaRoots, ca)
+	certificateHandler := handlers.NewCertificateHandler(deviceRepo, signingStore, ca)
+	documentHandler := handlers.NewDocumentHandler(deviceRepo, signingStore, ca)
 	userHandler := handlers.NewUserHandler(userRepo)
+	algorithmHandler := handlers.NewAlgorithmHandler()
+	keySetHandler := handlers.NewKeySetHandler(deviceRepo)
+	idempotency := handlers.NewIdempotency(idempotencyStore, idempotencyRetention, idempotencyLease)
 
 	// Devices
 	mux.Handle("POST /api/v1/devices", middleware(apiLogger, deviceHandler.CreateDevice))
 	mux.Handle("GET /api/v1/devices", middleware(apiLogger, deviceHandler.ListDevices))
 	mux.Handle("GET /api/v1/devices/{id}", middleware(apiLogger, deviceHandler.GetDevice))
+	mux.Handle("POST /api/v1/devices/{id}/deactivate", middleware(apiLogger, deviceHandler.DeactivateDevice))
 
 	// Signatures
-	mux.Handle("POST /api/v1/devices/{id}/sign", middleware(apiLogger, signatureHandler.SignTransactionData))
+	mux.Handle("POST /api/v1/devices/{id}/sign", middleware(apiLogger, idempotency.Wrap(signatureHandler.SignTransactionData)))
 	mux.Handle("GET /api/v1/devices/{id}/signatures", middleware(apiLogger, signatureHandler.ListSignatures))
+	mux.Handle("GET /api/v1/devices/{id}/audit", middleware(apiLogger, signatureHandler.AuditDevice))
+	mux.Handle("POST /api/v1/devices/{id}/verify", middleware(apiLogger, signatureHandler.VerifySignature))
+	mux.Handle("POST /api/v1/devices/{id}/rotate-key", middleware(apiLogger, signatureHandler.RotateKey))
+	mux.Handle("POST /api/v1/devices/{id}/sign/batch", middleware(apiLogger, idempotency.Wrap(signatureHandler.SignBatch)))
+	mux.Handle("POST /api/v1/devices/{id}/sign/cms", middleware(apiLogger, documentHandler.SignCMS))
+
+	// Certificates
+	mux.Handle("GET /api/v1/devices/{id}/certificate", middleware(apiLogger, certificateHandler.GetCertificate))
+	mux.Handle("POST /api/v1/devices/{id}/certificate", middleware(apiLogger, certificateHandler.IssueCertificate))
+	mux.Handle("PUT /api/v1/devices/{id}/certificate", middleware(apiLogger, certificateHandler.UploadCertificate))
+	mux.Handle("POST /api/v1/devices/{id}/csr", middleware(apiLogger, certificateHandler.CreateCSR))
+
+	// Public keys
+	mux.Handle("GET /api/v1/devices/{id}/jwk", middleware(apiLogger, keySetHandler.GetDeviceJWK))
+	mux.Handle("GET /.well-known/jwks.json", middleware(apiLogger, keySetHandler.GetJWKS))
+
+	// Time-stamping, only when service runs its own TSA
+	if tsa != nil {
+		timestampHandler := handlers.NewTimestampHandler(tsa)
+		mux.Handle("POST /api/v1/tsa", middleware(apiLogger, timestampHandler.Timestamp))
+	}
+
+	// Merkle anchoring and signature log, only when service key signs tree heads
+	if anchorKey != nil {
+		anchorHandler := handlers.NewAnchorHandler(signatureRepo, treeHeadRepo, anchorKey)
+		logHandler := handlers.NewLogHandler(logRepo)
+		mux.Handle("GET /api/v1/signatures/{id}/inclusion-proof", middleware(apiLogger, anchorHandler.GetInclusionProof))
+		mux.Handle("GET /api/v1/anchors/key", middleware(apiLogger, anchorHandler.GetServiceKey))
+		mux.Handle("GET /api/v1/log/sth", middleware(apiLogger, logHandler.GetTreeHead))
+		mux.Handle("GET /api/v1/log/consistency", middleware(apiLogger, logHandler.GetConsistency))
+	}
+
+	// Algorithms
+	mux.Handle("GET /api/v1/algorithms", middleware(apiLogger, algorithmHandler.ListAlgorithms))
 
 	// Users as an extra for user management
 	mux.Handle("POST /api/v1/users", middleware(apiLogger, userHandler.CreateUser))
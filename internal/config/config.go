@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -20,6 +21,54 @@ type Config struct {
 	InMemory struct {
 		DBFilePath string `env:"SIG_DB_MEMORY_FILE"`
 	}
+	Keys struct {
+		MinRSAKeySize int `env:"SIG_KEYS_MIN_RSA_KEY_SIZE"`
+		// master key ring used to encrypt device private keys at rest,
+		// entries in "version:base64key" form
+		MasterKey        string `env:"SIG_KEYS_MASTER_KEY"`
+		MasterKeyFile    string `env:"SIG_KEYS_MASTER_KEY_FILE"`
+		MasterKeyVersion string `env:"SIG_KEYS_MASTER_KEY_VERSION"`
+		// Backend holding keys of new devices (software|pkcs11)
+		Backend string `env:"SIG_KEYS_BACKEND"`
+		PKCS11  struct {
+			Module     string `env:"SIG_KEYS_PKCS11_MODULE"`
+			TokenLabel string `env:"SIG_KEYS_PKCS11_TOKEN_LABEL"`
+			PIN        string `env:"SIG_KEYS_PKCS11_PIN"`
+		}
+	}
+	// CA issuing device certificates, disabled when files are not set
+	CA struct {
+		RootCertFile         string        `env:"SIG_CA_ROOT_CERT_FILE"`
+		IntermediateCertFile string        `env:"SIG_CA_INTERMEDIATE_CERT_FILE"`
+		IntermediateKeyFile  string        `env:"SIG_CA_INTERMEDIATE_KEY_FILE"`
+		Validity             time.Duration `env:"SIG_CA_VALIDITY"`
+	}
+	// TSA time-stamping signatures, embedded when key file is set, remote
+	// when URL is set and disabled otherwise
+	TSA struct {
+		URL      string `env:"SIG_TSA_URL"`
+		CertFile string `env:"SIG_TSA_CERT_FILE"`
+		KeyFile  string `env:"SIG_TSA_KEY_FILE"`
+		// Policy is dotted OID put into tokens of embedded TSA
+		Policy string `env:"SIG_TSA_POLICY"`
+		// RootsFile holds PEM roots trusted to issue tokens, embedded TSA
+		// trusts its own root
+		RootsFile string        `env:"SIG_TSA_ROOTS_FILE"`
+		Timeout   time.Duration `env:"SIG_TSA_TIMEOUT"`
+	}
+	// Anchor signs Merkle tree heads over device chains and signature log,
+	// disabled when key file is not set
+	Anchor struct {
+		KeyFile  string        `env:"SIG_ANCHOR_KEY_FILE"`
+		Interval time.Duration `env:"SIG_ANCHOR_INTERVAL"`
+	}
+	// Idempotency keeps responses of requests made with Idempotency-Key
+	Idempotency struct {
+		Retention time.Duration `env:"SIG_IDEMPOTENCY_RETENTION"`
+		// Lease is how long key of running request stays reserved when it's
+		// not extended, e.g. after server crash
+		Lease time.Duration `env:"SIG_IDEMPOTENCY_LEASE"`
+	}
 }
 
 // Load config values from env and config file
@@ -37,6 +86,38 @@ func Load() Config {
 
 	cfg.InMemory.DBFilePath = viper.GetString("db.inmemory.dbfilepath")
 
+	// key policy
+	cfg.Keys.MinRSAKeySize = viper.GetInt("keys.min_rsa_key_size")
+	cfg.Keys.MasterKey = viper.GetString("keys.master_key")
+	cfg.Keys.MasterKeyFile = viper.GetString("keys.master_key_file")
+	cfg.Keys.MasterKeyVersion = viper.GetString("keys.master_key_version")
+	cfg.Keys.Backend = viper.GetString("keys.backend")
+	cfg.Keys.PKCS11.Module = viper.GetString("keys.pkcs11.module")
+	cfg.Keys.PKCS11.TokenLabel = viper.GetString("keys.pkcs11.token_label")
+	cfg.Keys.PKCS11.PIN = viper.GetString("keys.pkcs11.pin")
+
+	// device certificates
+	cfg.CA.RootCertFile = viper.GetString("ca.root_cert_file")
+	cfg.CA.IntermediateCertFile = viper.GetString("ca.intermediate_cert_file")
+	cfg.CA.IntermediateKeyFile = viper.GetString("ca.intermediate_key_file")
+	cfg.CA.Validity = viper.GetDuration("ca.validity")
+
+	// signature time-stamping
+	cfg.TSA.URL = viper.GetString("tsa.url")
+	cfg.TSA.CertFile = viper.GetString("tsa.cert_file")
+	cfg.TSA.KeyFile = viper.GetString("tsa.key_file")
+	cfg.TSA.Policy = viper.GetString("tsa.policy")
+	cfg.TSA.RootsFile = viper.GetString("tsa.roots_file")
+	cfg.TSA.Timeout = viper.GetDuration("tsa.timeout")
+
+	// Merkle anchoring
+	cfg.Anchor.KeyFile = viper.GetString("anchor.key_file")
+	cfg.Anchor.Interval = viper.GetDuration("anchor.interval")
+
+	// idempotency keys
+	cfg.Idempotency.Retention = viper.GetDuration("idempotency.retention")
+	cfg.Idempotency.Lease = viper.GetDuration("idempotency.lease")
+
 	if err := viper.Unmarshal(&cfg); err != nil {
 		log.Fatalf("error parsing config: %v", err)
 	}
@@ -0,0 +1,257 @@
+package domain
+
+import (
+	"bytes"
+	stdcrypto "crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// ErrNotAnchored is returned when no tree head covers signature yet
+var ErrNotAnchored = errors.New("signature is not anchored yet")
+
+// TreeHead is signed root of Merkle tree over first TreeSize records of
+// device chain in counter order. Trees of one device only grow, so every
+// head covers all records of the previous one.
+type TreeHead struct {
+	ID        string    `json:"id"`
+	DeviceID  string    `json:"device_id"`
+	TreeSize  uint64    `json:"tree_size"`
+	RootHash  []byte    `json:"root_hash"`
+	Timestamp time.Time `json:"timestamp"`
+	// KeyID is fingerprint of service key which signed tree head
+	KeyID     string `json:"key_id"`
+	Signature []byte `json:"signature"`
+}
+
+// treeHeadV1 is signed form of tree head, fields are in lexicographic order
+// of their keys
+type treeHeadV1 struct {
+	DeviceID  string `json:"device_id"`
+	KeyID     string `json:"key_id"`
+	RootHash  string `json:"root_hash"`
+	Timestamp string `json:"timestamp"`
+	TreeSize  uint64 `json:"tree_size"`
+	Version   int    `json:"v"`
+}
+
+// SignedData returns canonical JSON covered by tree head signature, root
+// hash is standard base64 and timestamp UTC with nanoseconds
+func (h *TreeHead) SignedData() (string, error) {
+	return canonicalJSON(treeHeadV1{
+		DeviceID:  h.DeviceID,
+		KeyID:     h.KeyID,
+		RootHash:  base64.StdEncoding.EncodeToString(h.RootHash),
+		Timestamp: h.Timestamp.UTC().Format(time.RFC3339Nano),
+		TreeSize:  h.TreeSize,
+		Version:   1,
+	})
+}
+
+// recordLeaf is record content hashed into Merkle tree, fields are in
+// lexicographic order of their keys
+type recordLeaf struct {
+	Counter    uint64 `json:"counter"`
+	DeviceID   string `json:"device_id"`
+	ID         string `json:"id"`
+	Signature  string `json:"signature"`
+	SignedData string `json:"signed_data"`
+}
+
+// RecordLeaf returns canonical JSON of record hashed into Merkle tree
+func RecordLeaf(rec *SignatureRecord) (string, error) {
+	return canonicalJSON(recordLeaf{
+		Counter:    rec.Counter,
+		DeviceID:   rec.DeviceID,
+		ID:         rec.ID,
+		Signature:  rec.Signature,
+		SignedData: rec.SignedData,
+	})
+}
+
+// leafHashes returns Merkle leaf hashes of records in chain order
+func leafHashes(records []*SignatureRecord) ([][]byte, error) {
+	hashes := make([][]byte, 0, len(records))
+	for _, rec := range records {
+		leaf, err := RecordLeaf(rec)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, crypto.MerkleLeafHash([]byte(leaf)))
+	}
+	return hashes, nil
+}
+
+// BuildTreeHead computes unsigned tree head over all device records
+func BuildTreeHead(deviceID string, records []*SignatureRecord, timestamp time.Time) (*TreeHead, error) {
+	leaves, err := leafHashes(chainOrder(records))
+	if err != nil {
+		return nil, err
+	}
+	return &TreeHead{
+		DeviceID:  deviceID,
+		TreeSize:  uint64(len(leaves)),
+		RootHash:  crypto.MerkleRoot(leaves),
+		Timestamp: timestamp,
+	}, nil
+}
+
+// SignTreeHead signs tree head with service key
+func SignTreeHead(head *TreeHead, key stdcrypto.Signer) error {
+	keyID, signature, err := signServiceStatement(key, func(keyID string) (string, error) {
+		head.KeyID = keyID
+		return head.SignedData()
+	})
+	if err != nil {
+		return err
+	}
+	head.KeyID, head.Signature = keyID, signature
+	return nil
+}
+
+// VerifyTreeHead checks tree head signature with service public key
+func VerifyTreeHead(head *TreeHead, publicKey stdcrypto.PublicKey) error {
+	signedData, err := head.SignedData()
+	if err != nil {
+		return err
+	}
+	if err := verifyServiceStatement(publicKey, head.KeyID, signedData, head.Signature); err != nil {
+		return fmt.Errorf("invalid tree head: %w", err)
+	}
+	return nil
+}
+
+// signServiceStatement signs canonical statement of service, signedData gets
+// key ID which has to be part of the statement
+func signServiceStatement(key stdcrypto.Signer, signedData func(keyID string) (string, error)) (string, []byte, error) {
+	keyID, err := serviceKeyID(key.Public())
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := signedData(keyID)
+	if err != nil {
+		return "", nil, err
+	}
+	signer, err := crypto.NewKeySigner(key)
+	if err != nil {
+		return "", nil, err
+	}
+	signature, err := signer.Sign([]byte(data))
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID, signature, nil
+}
+
+// verifyServiceStatement checks that statement is signed by service key
+func verifyServiceStatement(publicKey stdcrypto.PublicKey, keyID, signedData string, signature []byte) error {
+	expected, err := serviceKeyID(publicKey)
+	if err != nil {
+		return err
+	}
+	if keyID != expected {
+		return fmt.Errorf("signed by key %s, not %s", keyID, expected)
+	}
+	if err := crypto.VerifyKeySignature(publicKey, []byte(signedData), signature); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	return nil
+}
+
+// serviceKeyID returns fingerprint of service public key
+func serviceKeyID(publicKey stdcrypto.PublicKey) (string, error) {
+	encoded, err := crypto.EncodePublicKeyPEM(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return crypto.Fingerprint(encoded)
+}
+
+// InclusionProof proves that signature record was part of device chain when
+// tree head was signed
+type InclusionProof struct {
+	SignatureID string `json:"signature_id"`
+	LeafIndex   uint64 `json:"leaf_index"`
+	// Leaf is canonical JSON of record, see RecordLeaf
+	Leaf      string   `json:"leaf"`
+	AuditPath [][]byte `json:"audit_path"`
+	TreeHead  TreeHead `json:"tree_head"`
+}
+
+// NewInclusionProof proves record in the earliest tree head covering it, it
+// proves the earliest time record is known to exist. Records have to be all
+// records of device, heads its tree heads.
+func NewInclusionProof(signatureID string, records []*SignatureRecord, heads []*TreeHead) (*InclusionProof, error) {
+	sorted := chainOrder(records)
+	index := -1
+	for i, rec := range sorted {
+		if rec.ID == signatureID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("signature %s is not in device chain", signatureID)
+	}
+
+	var head *TreeHead
+	for _, h := range heads {
+		if h.TreeSize > uint64(index) && h.TreeSize <= uint64(len(sorted)) && (head == nil || h.TreeSize < head.TreeSize) {
+			head = h
+		}
+	}
+	if head == nil {
+		return nil, ErrNotAnchored
+	}
+
+	leaves, err := leafHashes(sorted[:head.TreeSize])
+	if err != nil {
+		return nil, err
+	}
+	// stored records have to be the ones anchored, otherwise chain was
+	// changed after anchoring
+	if !bytes.Equal(crypto.MerkleRoot(leaves), head.RootHash) {
+		return nil, fmt.Errorf("device records don't match tree head %s", head.ID)
+	}
+	path, err := crypto.MerkleAuditPath(index, leaves)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := RecordLeaf(sorted[index])
+	if err != nil {
+		return nil, err
+	}
+	return &InclusionProof{
+		SignatureID: signatureID,
+		LeafIndex:   uint64(index),
+		Leaf:        leaf,
+		AuditPath:   path,
+		TreeHead:    *head,
+	}, nil
+}
+
+// VerifyInclusionProof checks that leaf is included in tree head, that tree
+// head is signed by service key and that leaf is the proved signature. It
+// needs nothing but proof and service public key.
+func VerifyInclusionProof(proof *InclusionProof, publicKey stdcrypto.PublicKey) error {
+	if err := VerifyTreeHead(&proof.TreeHead, publicKey); err != nil {
+		return err
+	}
+	leafHash := crypto.MerkleLeafHash([]byte(proof.Leaf))
+	if err := crypto.VerifyMerkleInclusion(proof.LeafIndex, proof.TreeHead.TreeSize, leafHash, proof.AuditPath, proof.TreeHead.RootHash); err != nil {
+		return err
+	}
+	var leaf recordLeaf
+	if err := json.Unmarshal([]byte(proof.Leaf), &leaf); err != nil {
+		return fmt.Errorf("malformed leaf: %w", err)
+	}
+	if leaf.ID != proof.SignatureID || leaf.DeviceID != proof.TreeHead.DeviceID {
+		return errors.New("leaf doesn't describe proved signature")
+	}
+	return nil
+}
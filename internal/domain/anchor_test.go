@@ -0,0 +1,153 @@
+package domain_test
+
+import (
+	stdcrypto "crypto"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+func newServiceKey(t *testing.T) stdcrypto.Signer {
+	t.Helper()
+	keyPEM, _, err := crypto.GenerateServiceKey()
+	if err != nil {
+		t.Fatalf("generate service key: %v", err)
+	}
+	key, err := crypto.ParseCAKey(keyPEM)
+	if err != nil {
+		t.Fatalf("parse service key: %v", err)
+	}
+	return key
+}
+
+// anchor builds and signs tree head over records
+func anchor(t *testing.T, key stdcrypto.Signer, records []*domain.SignatureRecord) *domain.TreeHead {
+	t.Helper()
+	head, err := domain.BuildTreeHead("dev-1", records, time.Now())
+	if err != nil {
+		t.Fatalf("build tree head: %v", err)
+	}
+	head.ID = "head"
+	if err := domain.SignTreeHead(head, key); err != nil {
+		t.Fatalf("sign tree head: %v", err)
+	}
+	return head
+}
+
+func TestInclusionProof_AllTreeSizes(t *testing.T) {
+	key := newServiceKey(t)
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	records := buildChain(t, device, 9)
+
+	for size := 1; size <= len(records); size++ {
+		head := anchor(t, key, records[:size])
+		for i := 0; i < size; i++ {
+			proof, err := domain.NewInclusionProof(records[i].ID, records, []*domain.TreeHead{head})
+			if err != nil {
+				t.Fatalf("size %d, index %d: %v", size, i, err)
+			}
+			if proof.LeafIndex != uint64(i) || proof.TreeHead.TreeSize != uint64(size) {
+				t.Fatalf("size %d, index %d: unexpected proof position %d/%d", size, i, proof.LeafIndex, proof.TreeHead.TreeSize)
+			}
+			if err := domain.VerifyInclusionProof(proof, key.Public()); err != nil {
+				t.Fatalf("size %d, index %d: verify: %v", size, i, err)
+			}
+		}
+	}
+}
+
+func TestInclusionProof_EarliestHead(t *testing.T) {
+	key := newServiceKey(t)
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	records := buildChain(t, device, 6)
+	heads := []*domain.TreeHead{anchor(t, key, records[:2]), anchor(t, key, records[:4])}
+
+	proof, err := domain.NewInclusionProof(records[2].ID, records, heads)
+	if err != nil {
+		t.Fatalf("proof: %v", err)
+	}
+	if proof.TreeHead.TreeSize != 4 {
+		t.Errorf("expected proof in tree of size 4, got %d", proof.TreeHead.TreeSize)
+	}
+	if _, err := domain.NewInclusionProof(records[5].ID, records, heads); !errors.Is(err, domain.ErrNotAnchored) {
+		t.Errorf("expected ErrNotAnchored, got %v", err)
+	}
+	if _, err := domain.NewInclusionProof("unknown", records, heads); err == nil {
+		t.Errorf("expected error for signature out of chain")
+	}
+
+	// record changed after anchoring can't be proved
+	records[1].SignedData = "forged"
+	if _, err := domain.NewInclusionProof(records[0].ID, records, heads); err == nil {
+		t.Errorf("expected error for chain changed after anchoring")
+	}
+}
+
+func TestVerifyInclusionProof_Invalid(t *testing.T) {
+	key := newServiceKey(t)
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	records := buildChain(t, device, 5)
+	head := anchor(t, key, records)
+
+	tests := []struct {
+		name   string
+		tamper func(p *domain.InclusionProof) stdcrypto.PublicKey
+	}{
+		{name: "other service key", tamper: func(p *domain.InclusionProof) stdcrypto.PublicKey {
+			return newServiceKey(t).Public()
+		}},
+		{name: "forged leaf", tamper: func(p *domain.InclusionProof) stdcrypto.PublicKey {
+			p.Leaf = p.Leaf[:len(p.Leaf)-1] + " }"
+			return key.Public()
+		}},
+		{name: "other leaf index", tamper: func(p *domain.InclusionProof) stdcrypto.PublicKey {
+			p.LeafIndex = 3
+			return key.Public()
+		}},
+		{name: "truncated audit path", tamper: func(p *domain.InclusionProof) stdcrypto.PublicKey {
+			p.AuditPath = p.AuditPath[1:]
+			return key.Public()
+		}},
+		{name: "tampered audit path", tamper: func(p *domain.InclusionProof) stdcrypto.PublicKey {
+			p.AuditPath[0] = append([]byte{}, p.AuditPath[1]...)
+			return key.Public()
+		}},
+		{name: "tampered tree size", tamper: func(p *domain.InclusionProof) stdcrypto.PublicKey {
+			p.TreeHead.TreeSize = 4
+			return key.Public()
+		}},
+		{name: "tampered root hash", tamper: func(p *domain.InclusionProof) stdcrypto.PublicKey {
+			p.TreeHead.RootHash[0] ^= 1
+			return key.Public()
+		}},
+		{name: "other signature", tamper: func(p *domain.InclusionProof) stdcrypto.PublicKey {
+			p.SignatureID = records[1].ID
+			return key.Public()
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			signed := *head
+			signed.RootHash = append([]byte{}, head.RootHash...)
+			proof, err := domain.NewInclusionProof(records[2].ID, records, []*domain.TreeHead{&signed})
+			if err != nil {
+				t.Fatalf("proof: %v", err)
+			}
+			if err := domain.VerifyInclusionProof(proof, tc.tamper(proof)); err == nil {
+				t.Fatalf("expected verification to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package domain
+
+import (
+	stdcrypto "crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// ErrExternalCertificate is returned when service CA would replace
+// certificate of device current key uploaded from external CA
+var ErrExternalCertificate = errors.New("device certificate is issued by external CA")
+
+// ParsePublicKey decodes device public key into standard library key
+func (d *SignatureDevice) ParsePublicKey() (stdcrypto.PublicKey, error) {
+	alg, err := d.algorithm()
+	if err != nil {
+		return nil, err
+	}
+	return alg.ParsePublicKey(d.PublicKey)
+}
+
+// HasValidCertificate reports whether device certificate certifies current
+// public key and is within its validity period
+func (d *SignatureDevice) HasValidCertificate(now time.Time) bool {
+	if len(d.CertificateChain) == 0 {
+		return false
+	}
+	cert, err := x509.ParseCertificate(d.CertificateChain[0])
+	if err != nil || now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return false
+	}
+	return certifiesKey(cert, d) == nil
+}
+
+// certifiesKey checks that certificate holds device public key
+func certifiesKey(cert *x509.Certificate, d *SignatureDevice) error {
+	pub, err := d.ParsePublicKey()
+	if err != nil {
+		return err
+	}
+	if !crypto.SamePublicKey(pub, cert.PublicKey) {
+		return errors.New("certificate public key doesn't match device public key")
+	}
+	return nil
+}
+
+// IssueCertificate certifies device current public key with service CA.
+// Deactivated devices aren't certified and chain uploaded for current key
+// from external CA is never replaced, also when it's expired.
+func IssueCertificate(device *SignatureDevice, ca *crypto.CertificateAuthority) error {
+	if !device.Active() {
+		return ErrDeviceDeactivated
+	}
+	if len(device.CertificateChain) > 0 {
+		cert, err := x509.ParseCertificate(device.CertificateChain[0])
+		if err == nil && certifiesKey(cert, device) == nil && !ca.Issued(cert) {
+			return ErrExternalCertificate
+		}
+	}
+	pub, err := device.ParsePublicKey()
+	if err != nil {
+		return err
+	}
+	chain, err := ca.Issue(crypto.CertificateSubject{
+		DeviceID: device.ID,
+		UserID:   device.UserID,
+		Label:    device.Label,
+	}, pub)
+	if err != nil {
+		return err
+	}
+	device.CertificateChain = chain
+	return nil
+}
+
+// x509Signer returns device key as standard library signer together with
+// X.509 signature algorithm matching device signature options
+func (d *SignatureDevice) x509Signer() (stdcrypto.Signer, x509.SignatureAlgorithm, error) {
+	opts := d.signatureOptions(crypto.EncodingASN1DER)
+	sigAlg, err := crypto.X509SignatureAlgorithm(string(d.Algorithm), opts)
+	if err != nil {
+		return nil, x509.UnknownSignatureAlgorithm, err
+	}
+	pub, err := d.ParsePublicKey()
+	if err != nil {
+		return nil, x509.UnknownSignatureAlgorithm, err
+	}
+	signer, err := d.signer(opts)
+	if err != nil {
+		return nil, x509.UnknownSignatureAlgorithm, err
+	}
+	return crypto.MessageSigner{PublicKey: pub, Signer: signer}, sigAlg, nil
+}
+
+// CreateCertificateRequest creates DER encoded PKCS#10 request for device
+// current key, signed by the key. Subject common name defaults to device ID,
+// device and owner are also named in subject alternative names like in
+// certificates issued by service CA.
+func CreateCertificateRequest(device *SignatureDevice, subject pkix.Name) ([]byte, error) {
+	signer, sigAlg, err := device.x509Signer()
+	if err != nil {
+		return nil, err
+	}
+	if subject.CommonName == "" {
+		subject.CommonName = device.ID
+	}
+	uris := []*url.URL{crypto.DeviceURI(device.ID)}
+	if device.UserID != "" {
+		uris = append(uris, crypto.UserURI(device.UserID))
+	}
+	return x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:            subject,
+		URIs:               uris,
+		SignatureAlgorithm: sigAlg,
+	}, signer)
+}
+
+// AttachCertificateChain sets certificate chain issued by external CA. Chain
+// starts with device certificate, which has to hold device current public key
+// and be valid now, every certificate has to be signed by the next one.
+func (d *SignatureDevice) AttachCertificateChain(chain [][]byte, now time.Time) error {
+	if len(chain) == 0 {
+		return errors.New("certificate chain is empty")
+	}
+	certs := make([]*x509.Certificate, len(chain))
+	for i, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("invalid certificate %d in chain: %w", i, err)
+		}
+		certs[i] = cert
+	}
+
+	leaf := certs[0]
+	if err := certifiesKey(leaf, d); err != nil {
+		return err
+	}
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return errors.New("certificate is not valid at this time")
+	}
+	for i := 0; i+1 < len(certs); i++ {
+		if err := certs[i].CheckSignatureFrom(certs[i+1]); err != nil {
+			return fmt.Errorf("certificate %d is not issued by next certificate in chain: %w", i, err)
+		}
+	}
+	d.CertificateChain = chain
+	return nil
+}
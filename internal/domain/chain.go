@@ -0,0 +1,193 @@
+package domain
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// ChainIssue describes single problem found in device signature chain
+type ChainIssue struct {
+	Counter     uint64 `json:"counter"`
+	SignatureID string `json:"signature_id,omitempty"`
+	Reason      string `json:"reason"`
+}
+
+// ChainReport is a result of signature chain verification
+type ChainReport struct {
+	DeviceID        string       `json:"device_id"`
+	Valid           bool         `json:"valid"`
+	Checked         int          `json:"checked"`
+	FirstBrokenLink *ChainIssue  `json:"first_broken_link,omitempty"`
+	Gaps            []uint64     `json:"gaps,omitempty"`
+	Duplicates      []uint64     `json:"duplicates,omitempty"`
+	Issues          []ChainIssue `json:"issues,omitempty"`
+	// Timestamps describe time-stamp tokens of records, see AddTimestamps
+	Timestamps []RecordTimestamp `json:"timestamps,omitempty"`
+}
+
+// firstLinkReference returns value chained into the very first signature
+func firstLinkReference(device *SignatureDevice) string {
+	return base64.StdEncoding.EncodeToString([]byte(device.ID))
+}
+
+// chainOrder returns copy of records sorted by counter, duplicated counters
+// by creation time
+func chainOrder(records []*SignatureRecord) []*SignatureRecord {
+	sorted := make([]*SignatureRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Counter == sorted[j].Counter {
+			return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+		}
+		return sorted[i].Counter < sorted[j].Counter
+	})
+	return sorted
+}
+
+// VerifyChain walks device signatures in counter order, checks every signature
+// against device key version which produced it and checks that each record
+// embeds signature of its predecessor. Key rotation records have to endorse
+// the key used by following records. Gaps and duplicated counters are reported
+// separately.
+func VerifyChain(device *SignatureDevice, records []*SignatureRecord) ChainReport {
+	report := ChainReport{DeviceID: device.ID, Checked: len(records)}
+
+	sorted := chainOrder(records)
+
+	addIssue := func(issue ChainIssue) {
+		report.Issues = append(report.Issues, issue)
+	}
+
+	var (
+		expected   uint64
+		prevSig    = firstLinkReference(device)
+		keyVersion int
+	)
+	for i, rec := range sorted {
+		if i > 0 && rec.Counter == sorted[i-1].Counter {
+			report.Duplicates = append(report.Duplicates, rec.Counter)
+			addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: "duplicated counter"})
+			continue
+		}
+		for ; expected < rec.Counter; expected++ {
+			report.Gaps = append(report.Gaps, expected)
+			addIssue(ChainIssue{Counter: expected, Reason: "missing signature"})
+		}
+		expected = rec.Counter + 1
+
+		if rec.DeviceID != device.ID {
+			addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: "signature belongs to other device"})
+		}
+		if err := verifyRecord(device, rec); err != nil {
+			addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: "signature verification failed: " + err.Error()})
+		}
+		if err := checkPayload(rec); err != nil {
+			addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: err.Error()})
+		}
+		// previous signature and active key are only known when predecessor is present
+		hasPredecessor := rec.Counter == 0 || (i > 0 && sorted[i-1].Counter == rec.Counter-1)
+		envelope, err := ParseSignedData(rec.SignedData)
+		if err != nil {
+			addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: err.Error()})
+		} else {
+			if envelope.Version != rec.SignedDataVersion {
+				addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: fmt.Sprintf("signed data is v%d, record declares v%d", envelope.Version, rec.SignedDataVersion)})
+			}
+			if envelope.Counter != rec.Counter {
+				addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: "signed data doesn't carry record counter"})
+			}
+			if envelope.Version != SignedDataV0 && envelope.DeviceID != device.ID {
+				addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: "signed data names other device"})
+			}
+			if hasPredecessor && envelope.Prev != prevSig {
+				addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: "signed data doesn't reference previous signature"})
+			}
+		}
+		if hasPredecessor && rec.SigningKeyVersion != keyVersion {
+			addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: fmt.Sprintf("signed with key version %d, expected %d", rec.SigningKeyVersion, keyVersion)})
+		}
+		keyVersion = rec.SigningKeyVersion
+		if rec.Kind == RecordKindKeyRotation {
+			if err := checkRotation(device, rec); err != nil {
+				addIssue(ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: "invalid key rotation: " + err.Error()})
+			}
+			keyVersion = rec.SigningKeyVersion + 1
+		}
+		prevSig = rec.Signature
+	}
+
+	// signatures missing at the end of chain
+	for ; expected < device.SignatureCounter; expected++ {
+		report.Gaps = append(report.Gaps, expected)
+		addIssue(ChainIssue{Counter: expected, Reason: "missing signature"})
+	}
+	if device.SignatureCounter > 0 && device.LastSignature != prevSig {
+		addIssue(ChainIssue{Counter: device.SignatureCounter, Reason: "device last signature doesn't match chain head"})
+	}
+	if device.SignatureCounter > 0 && device.SigningKeyVersion != keyVersion {
+		addIssue(ChainIssue{Counter: device.SignatureCounter, Reason: "device key version doesn't match chain head"})
+	}
+
+	// issues are collected in counter order
+	report.conclude()
+	return report
+}
+
+// conclude derives verdict and first broken link from issues, which have to
+// be in counter order
+func (r *ChainReport) conclude() {
+	r.FirstBrokenLink = nil
+	if len(r.Issues) > 0 {
+		first := r.Issues[0]
+		r.FirstBrokenLink = &first
+	}
+	r.Valid = len(r.Issues) == 0
+}
+
+// checkRotation verifies that rotation record endorses next key version of device
+func checkRotation(device *SignatureDevice, rec *SignatureRecord) error {
+	version, fingerprint, err := parseRotationStatement(rec.SignedData)
+	if err != nil {
+		return err
+	}
+	if version != rec.SigningKeyVersion+1 {
+		return fmt.Errorf("endorses key version %d instead of %d", version, rec.SigningKeyVersion+1)
+	}
+	publicKey, err := device.PublicKeyVersion(version)
+	if err != nil {
+		return err
+	}
+	actual, err := crypto.Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	if actual != fingerprint {
+		return fmt.Errorf("endorsed fingerprint doesn't match key version %d", version)
+	}
+	return nil
+}
+
+// checkPayload verifies that signed data of transaction record carries
+// payload in recorded mode
+func checkPayload(rec *SignatureRecord) error {
+	if rec.PayloadMode == "" {
+		return nil
+	}
+	if rec.Kind != "" {
+		return fmt.Errorf("%s record carries %s payload", rec.Kind, rec.PayloadMode)
+	}
+	envelope, err := ParseSignedData(rec.SignedData)
+	if err != nil {
+		return err
+	}
+	if envelope.Version != SignedDataV0 && envelope.Mode != rec.PayloadMode {
+		return fmt.Errorf("signed data carries %q payload, record declares %s", envelope.Mode, rec.PayloadMode)
+	}
+	if _, err := ParsePayload(rec.PayloadMode, envelope.Data); err != nil {
+		return fmt.Errorf("%s payload: %v", rec.PayloadMode, err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package domain_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+)
+
+// buildChain signs n payloads on device and returns produced records
+func buildChain(t *testing.T, device *domain.SignatureDevice, n int) []*domain.SignatureRecord {
+	t.Helper()
+	var records []*domain.SignatureRecord
+	for i := 0; i < n; i++ {
+		signedData, signature, err := domain.SignData(device, fmt.Sprintf("tx_%d", i))
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		records = append(records, &domain.SignatureRecord{
+			ID:         fmt.Sprintf("sig-%d", i),
+			DeviceID:   device.ID,
+			Counter:    device.SignatureCounter,
+			SignedData: signedData,
+			Signature:  signature,
+			CreatedAt:  time.Now(),
+
+			SignatureEncoding: device.SigningEncoding(),
+			SignedDataVersion: device.SignedDataVersion,
+		})
+		device.IncrementCounter(signature)
+	}
+	return records
+}
+
+func TestVerifyChain(t *testing.T) {
+	tests := []struct {
+		name           string
+		algorithm      domain.AlgorithmType
+		version        domain.SignedDataVersion
+		tamper         func(device *domain.SignatureDevice, records []*domain.SignatureRecord) []*domain.SignatureRecord
+		wantValid      bool
+		wantFirstBreak uint64
+		wantGaps       int
+		wantDuplicates int
+	}{
+		{
+			name:      "RSA valid chain",
+			algorithm: domain.AlgorithmRSA,
+			wantValid: true,
+		},
+		{
+			name:      "Ed25519 valid chain",
+			algorithm: domain.AlgorithmEd25519,
+			wantValid: true,
+		},
+		{
+			name:      "ECC valid chain in shuffled order",
+			algorithm: domain.AlgorithmECC,
+			tamper: func(_ *domain.SignatureDevice, r []*domain.SignatureRecord) []*domain.SignatureRecord {
+				return []*domain.SignatureRecord{r[3], r[1], r[0], r[4], r[2]}
+			},
+			wantValid: true,
+		},
+		{
+			name:      "tampered signed data",
+			algorithm: domain.AlgorithmECC,
+			tamper: func(_ *domain.SignatureDevice, r []*domain.SignatureRecord) []*domain.SignatureRecord {
+				r[2].SignedData = "2_forged_" + r[1].Signature
+				return r
+			},
+			wantFirstBreak: 2,
+		},
+		{
+			name:      "v1 valid chain",
+			algorithm: domain.AlgorithmECC,
+			version:   domain.SignedDataV1,
+			wantValid: true,
+		},
+		{
+			name:      "v1 record declaring legacy format",
+			algorithm: domain.AlgorithmECC,
+			version:   domain.SignedDataV1,
+			tamper: func(_ *domain.SignatureDevice, r []*domain.SignatureRecord) []*domain.SignatureRecord {
+				r[1].SignedDataVersion = domain.SignedDataV0
+				return r
+			},
+			wantFirstBreak: 1,
+		},
+		{
+			name:      "v1 envelope naming other device",
+			algorithm: domain.AlgorithmECC,
+			version:   domain.SignedDataV1,
+			tamper: func(d *domain.SignatureDevice, r []*domain.SignatureRecord) []*domain.SignatureRecord {
+				other := *d
+				other.ID = "dev-2"
+				other.SignatureCounter = 2
+				other.LastSignature = r[1].Signature
+				signedData, signature, _ := domain.SignData(&other, "tx_2")
+				r[2].SignedData, r[2].Signature = signedData, signature
+				return r
+			},
+			wantFirstBreak: 2,
+		},
+		{
+			name:      "payload mode doesn't match signed data",
+			algorithm: domain.AlgorithmECC,
+			tamper: func(_ *domain.SignatureDevice, r []*domain.SignatureRecord) []*domain.SignatureRecord {
+				r[2].PayloadMode = domain.PayloadModeBase64
+				return r
+			},
+			wantFirstBreak: 2,
+		},
+		{
+			name:      "missing signature in the middle",
+			algorithm: domain.AlgorithmECC,
+			tamper: func(_ *domain.SignatureDevice, r []*domain.SignatureRecord) []*domain.SignatureRecord {
+				return append(r[:1], r[2:]...)
+			},
+			wantFirstBreak: 1,
+			wantGaps:       1,
+		},
+		{
+			name:      "missing signature at the end",
+			algorithm: domain.AlgorithmECC,
+			tamper: func(_ *domain.SignatureDevice, r []*domain.SignatureRecord) []*domain.SignatureRecord {
+				return r[:4]
+			},
+			wantFirstBreak: 4,
+			wantGaps:       1,
+		},
+		{
+			name:      "duplicated counter",
+			algorithm: domain.AlgorithmECC,
+			tamper: func(_ *domain.SignatureDevice, r []*domain.SignatureRecord) []*domain.SignatureRecord {
+				dup := *r[3]
+				dup.ID = "sig-dup"
+				dup.CreatedAt = dup.CreatedAt.Add(time.Second)
+				return append(r, &dup)
+			},
+			wantFirstBreak: 3,
+			wantDuplicates: 1,
+		},
+		{
+			name:      "forked chain signed with valid key",
+			algorithm: domain.AlgorithmECC,
+			tamper: func(d *domain.SignatureDevice, r []*domain.SignatureRecord) []*domain.SignatureRecord {
+				fork := *d
+				fork.SignatureCounter = 3
+				fork.LastSignature = "unknown"
+				signedData, signature, _ := domain.SignData(&fork, "fork")
+				r[3].SignedData, r[3].Signature = signedData, signature
+				return r
+			},
+			wantFirstBreak: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "dev-1", Algorithm: tc.algorithm, SignedDataVersion: tc.version}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+			records := buildChain(t, device, 5)
+			if tc.tamper != nil {
+				records = tc.tamper(device, records)
+			}
+
+			report := domain.VerifyChain(device, records)
+
+			if report.Valid != tc.wantValid {
+				t.Fatalf("expected valid=%v, got %v (issues: %+v)", tc.wantValid, report.Valid, report.Issues)
+			}
+			if !tc.wantValid {
+				if report.FirstBrokenLink == nil {
+					t.Fatalf("expected first broken link to be reported")
+				}
+				if report.FirstBrokenLink.Counter != tc.wantFirstBreak {
+					t.Errorf("expected first broken link at %d, got %d", tc.wantFirstBreak, report.FirstBrokenLink.Counter)
+				}
+			}
+			if len(report.Gaps) != tc.wantGaps {
+				t.Errorf("expected %d gaps, got %v", tc.wantGaps, report.Gaps)
+			}
+			if len(report.Duplicates) != tc.wantDuplicates {
+				t.Errorf("expected %d duplicates, got %v", tc.wantDuplicates, report.Duplicates)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	stdcrypto "crypto"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// RecordKindCMS marks chain record binding digest of document signed as CMS
+const RecordKindCMS RecordKind = "CMS"
+
+// ErrNoValidCertificate is returned when signature has to name device
+// certificate, but device key isn't certified
+var ErrNoValidCertificate = errors.New("device has no valid certificate")
+
+// CMSHash returns digest algorithm of documents signed by device as CMS
+func (d *SignatureDevice) CMSHash() (stdcrypto.Hash, error) {
+	sigAlg, err := crypto.X509SignatureAlgorithm(string(d.Algorithm), d.signatureOptions(crypto.EncodingASN1DER))
+	if err != nil {
+		return 0, err
+	}
+	return crypto.CMSHash(sigAlg)
+}
+
+// CMSStatement is data signed into device chain for document signed as CMS
+func CMSStatement(hash stdcrypto.Hash, digest []byte) string {
+	return fmt.Sprintf("%s:%s:%x", RecordKindCMS, hash, digest)
+}
+
+// SignCMS creates detached CMS SignedData over document digest computed with
+// CMSHash. Device certificate chain is embedded, so device key has to be
+// certified at signing time.
+func SignCMS(device *SignatureDevice, digest []byte, signingTime time.Time) ([]byte, error) {
+	if !device.Active() {
+		return nil, ErrDeviceDeactivated
+	}
+	if !device.HasValidCertificate(signingTime) {
+		return nil, ErrNoValidCertificate
+	}
+	opts := device.signatureOptions(crypto.EncodingASN1DER)
+	sigAlg, err := crypto.X509SignatureAlgorithm(string(device.Algorithm), opts)
+	if err != nil {
+		return nil, err
+	}
+	s, err := device.signer(opts)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.SignDetachedCMS(digest, device.CertificateChain, signingTime, s, sigAlg)
+}
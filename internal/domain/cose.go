@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// COSE protected header labels placing signature in device chain. Text labels
+// can't collide with IANA registered integer labels.
+const (
+	COSEHeaderDeviceID          = "device_id"
+	COSEHeaderCounter           = "counter"
+	COSEHeaderPreviousSignature = "previous_signature"
+)
+
+// COSE unprotected header labels carrying RFC 3161 token of chain record.
+// Token is over chain record signature, not over COSE signature, so that
+// signature is carried next to it.
+const (
+	COSEHeaderChainSignature = "chain_signature"
+	COSEHeaderTimestampToken = "timestamp_token"
+)
+
+// coseAlgorithm returns COSE algorithm of signatures made with given device
+// key
+func (d *SignatureDevice) coseAlgorithm(key RetiredKey) (int64, error) {
+	alg, err := d.algorithm()
+	if err != nil {
+		return 0, err
+	}
+	pub, err := alg.ParsePublicKey(key.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	jwsAlg, err := crypto.JWSAlgorithm(pub, d.keyOptions(key, ""))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrJWSUnsupported, err)
+	}
+	return crypto.COSEAlgorithm(jwsAlg)
+}
+
+// SignCOSE signs payload as COSE_Sign1 message with device current key. It
+// has to be called before device counter moves, protected header references
+// the same chain position as signed data. Devices without JWS algorithm have
+// no COSE algorithm either and get ErrJWSUnsupported.
+func SignCOSE(device *SignatureDevice, payload string) ([]byte, error) {
+	if !device.Active() {
+		return nil, ErrDeviceDeactivated
+	}
+	alg, err := device.coseAlgorithm(device.currentKey())
+	if err != nil {
+		return nil, err
+	}
+	s, err := device.signer(device.signatureOptions(crypto.EncodingP1363))
+	if err != nil {
+		return nil, err
+	}
+	protected := map[any]any{
+		crypto.COSEHeaderAlg:        alg,
+		crypto.COSEHeaderKid:        []byte(device.KeyID()),
+		COSEHeaderDeviceID:          device.ID,
+		COSEHeaderCounter:           device.SignatureCounter,
+		COSEHeaderPreviousSignature: previousLinkReference(device),
+	}
+	return crypto.SignCOSESign1(protected, []byte(payload), s)
+}
+
+// AttachCOSETimestamp adds time-stamp token of chain record to unprotected
+// header of message signed for the record, message without token is returned
+// as it is
+func AttachCOSETimestamp(message []byte, record *SignatureRecord) ([]byte, error) {
+	if len(record.TimeStampToken) == 0 {
+		return message, nil
+	}
+	msg, err := crypto.ParseCOSESign1(message)
+	if err != nil {
+		return nil, err
+	}
+	msg.Unprotected[COSEHeaderChainSignature] = record.Signature
+	msg.Unprotected[COSEHeaderTimestampToken] = record.TimeStampToken
+	return msg.Marshal()
+}
+
+// VerifyCOSE checks COSE_Sign1 message produced by SignCOSE. Key version is
+// taken from kid, so messages signed before key rotation stay verifiable.
+// Chain headers have to match signed data carried as payload.
+func VerifyCOSE(device *SignatureDevice, message []byte) VerificationResult {
+	result := VerificationResult{DeviceID: device.ID, Algorithm: device.Algorithm}
+
+	msg, err := crypto.ParseCOSESign1(message)
+	if err != nil {
+		result.Reason = "malformed COSE_Sign1: " + err.Error()
+		return result
+	}
+	if id, _ := msg.Protected[COSEHeaderDeviceID].(string); id != device.ID {
+		result.Reason = "message was signed by other device"
+		return result
+	}
+
+	kid, _ := msg.Protected[crypto.COSEHeaderKid].([]byte)
+	version, err := strconv.Atoi(strings.TrimPrefix(string(kid), device.ID+"-v"))
+	if err != nil || string(kid) != device.ID+"-v"+strconv.Itoa(version) {
+		result.Reason = fmt.Sprintf("unknown key id %q", kid)
+		return result
+	}
+	key, err := device.keyVersion(version)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	result.SigningKeyVersion = version
+	result.KeyFingerprint, _ = crypto.Fingerprint(key.PublicKey)
+
+	expected, err := device.coseAlgorithm(key)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	if alg, _ := msg.Protected[crypto.COSEHeaderAlg].(int64); alg != expected {
+		result.Reason = fmt.Sprintf("unexpected algorithm %d, device signs with %d", alg, expected)
+		return result
+	}
+
+	alg, err := device.algorithm()
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	v, err := alg.NewVerifier(key.PublicKey, device.keyOptions(key, crypto.EncodingP1363))
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	if err := msg.Verify(v); err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+
+	signedData := string(msg.Payload)
+	counter, _ := msg.Protected[COSEHeaderCounter].(int64)
+	previous, _ := msg.Protected[COSEHeaderPreviousSignature].(string)
+	envelope, err := ParseSignedData(signedData)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	if counter < 0 || envelope.Counter != uint64(counter) || envelope.Prev != previous ||
+		(envelope.Version != SignedDataV0 && envelope.DeviceID != device.ID) {
+		result.Reason = "chain headers don't match signed data"
+		return result
+	}
+
+	result.Valid = true
+	result.SignedData = signedData
+	result.setPayload(signedData)
+	return result
+}
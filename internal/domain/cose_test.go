@@ -0,0 +1,157 @@
+package domain_test
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/cbor"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// signCOSE signs data into device chain and returns signed data with COSE message
+func signCOSE(t *testing.T, device *domain.SignatureDevice, data string) (string, []byte) {
+	t.Helper()
+	signedData, signature, err := domain.SignData(device, data)
+	if err != nil {
+		t.Fatalf("sign data: %v", err)
+	}
+	message, err := domain.SignCOSE(device, signedData)
+	if err != nil {
+		t.Fatalf("sign COSE: %v", err)
+	}
+	device.IncrementCounter(signature)
+	return signedData, message
+}
+
+func TestSignCOSE(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm domain.AlgorithmType
+		params    crypto.KeyParams
+		padding   crypto.RSAPadding
+		version   domain.SignedDataVersion
+		wantAlg   int64
+	}{
+		{name: "ES256", algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Curve: crypto.CurveP256}, wantAlg: -7},
+		{name: "ES384", algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Hash: crypto.HashSHA384}, wantAlg: -35},
+		{name: "PS256", algorithm: domain.AlgorithmRSA, padding: crypto.PaddingPSS, wantAlg: -37},
+		{name: "RS256", algorithm: domain.AlgorithmRSA, wantAlg: -257},
+		{name: "EdDSA", algorithm: domain.AlgorithmEd25519, wantAlg: -8},
+		{name: "EdDSA v1 envelope", algorithm: domain.AlgorithmEd25519, version: domain.SignedDataV1, wantAlg: -8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "dev-1", Algorithm: tt.algorithm, SignedDataVersion: tt.version}
+			if err := device.ConfigureKeyParams(tt.params, crypto.DefaultKeyPolicy); err != nil {
+				t.Fatalf("configure params: %v", err)
+			}
+			if err := device.ConfigurePadding(tt.padding, 0); err != nil {
+				t.Fatalf("configure padding: %v", err)
+			}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+
+			_, _ = signCOSE(t, device, "tx-1")
+			previous := device.LastSignature
+			signedData, message := signCOSE(t, device, "tx-2")
+
+			result := domain.VerifyCOSE(device, message)
+			if !result.Valid || result.SignedData != signedData {
+				t.Fatalf("expected valid message, got %+v", result)
+			}
+
+			msg, err := crypto.ParseCOSESign1(message)
+			if err != nil {
+				t.Fatalf("parse COSE: %v", err)
+			}
+			h := msg.Protected
+			if h[crypto.COSEHeaderAlg] != tt.wantAlg || string(h[crypto.COSEHeaderKid].([]byte)) != "dev-1-v0" ||
+				h[domain.COSEHeaderDeviceID] != "dev-1" || h[domain.COSEHeaderCounter] != int64(1) ||
+				h[domain.COSEHeaderPreviousSignature] != previous {
+				t.Errorf("unexpected protected header %v", h)
+			}
+		})
+	}
+}
+
+func TestSignCOSE_WireFormat(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmEd25519}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	signedData, message := signCOSE(t, device, "tx-1")
+
+	// tag 18 followed by array of 4 items
+	if message[0] != 0xd2 || message[1] != 0x84 {
+		t.Fatalf("expected tagged COSE_Sign1, got % x", message[:2])
+	}
+	decoded, err := cbor.Unmarshal(message)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	parts := decoded.(cbor.Tag).Content.([]any)
+	protected, signature := parts[0].([]byte), parts[3].([]byte)
+	if string(parts[2].([]byte)) != signedData {
+		t.Fatalf("payload must be signed data")
+	}
+
+	// signature covers Sig_structure as defined by RFC 9052 section 4.4
+	toBeSigned, _ := cbor.Marshal([]any{"Signature1", protected, []byte{}, []byte(signedData)})
+	pub, _ := device.ParsePublicKey()
+	if !ed25519.Verify(pub.(ed25519.PublicKey), toBeSigned, signature) {
+		t.Fatalf("signature doesn't cover Sig_structure")
+	}
+}
+
+func TestVerifyCOSE_AfterRotation(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.ConfigureKeyParams(crypto.KeyParams{Curve: crypto.CurveP256}, crypto.DefaultKeyPolicy); err != nil {
+		t.Fatalf("configure params: %v", err)
+	}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	_, before := signCOSE(t, device, "tx-1")
+	rotate(t, device)
+	_, after := signCOSE(t, device, "tx-2")
+
+	if result := domain.VerifyCOSE(device, before); !result.Valid || result.SigningKeyVersion != 0 {
+		t.Fatalf("expected message of retired key to verify, got %+v", result)
+	}
+	if result := domain.VerifyCOSE(device, after); !result.Valid || result.SigningKeyVersion != 1 {
+		t.Fatalf("expected message of current key to verify, got %+v", result)
+	}
+}
+
+func TestVerifyCOSE_Invalid(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmEd25519}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	other := &domain.SignatureDevice{ID: "dev-2", Algorithm: domain.AlgorithmEd25519}
+	if err := other.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	_, message := signCOSE(t, device, "tx-1")
+	_, otherMessage := signCOSE(t, other, "tx-1")
+
+	tampered := append([]byte{}, message...)
+	// payload sits before 64 byte signature and its 2 byte header
+	tampered[len(tampered)-67] ^= 1
+
+	tests := map[string][]byte{
+		"garbage":          []byte("not cbor"),
+		"tampered payload": tampered,
+		"other device":     otherMessage,
+		"trailing data":    append(append([]byte{}, message...), 0),
+	}
+	for name, msg := range tests {
+		t.Run(name, func(t *testing.T) {
+			if result := domain.VerifyCOSE(device, msg); result.Valid || result.Reason == "" {
+				t.Fatalf("expected invalid message with reason, got %+v", result)
+			}
+		})
+	}
+}
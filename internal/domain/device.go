@@ -2,6 +2,8 @@ package domain
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
@@ -13,8 +15,21 @@ type AlgorithmType string
 const (
 	AlgorithmRSA AlgorithmType = "RSA"
 	AlgorithmECC AlgorithmType = "ECC"
+	// AlgorithmEd25519 used for compact signatures, preferred by mobile clients
+	AlgorithmEd25519 AlgorithmType = "ED25519"
 )
 
+// DeviceStatus tells whether device key may still be used
+type DeviceStatus string
+
+const (
+	DeviceStatusActive      DeviceStatus = "active"
+	DeviceStatusDeactivated DeviceStatus = "deactivated"
+)
+
+// ErrDeviceDeactivated is returned when deactivated device is asked to sign
+var ErrDeviceDeactivated = errors.New("device is deactivated")
+
 // SignatureDevice represent signature device
 type SignatureDevice struct {
 	ID               string        `json:"id"`
@@ -27,48 +42,217 @@ type SignatureDevice struct {
 	LastSignature    string        `json:"last_signature"`
 	CreatedAt        time.Time     `json:"created_at"`
 	UpdatedAt        time.Time     `json:"updated_at"`
+
+	SignatureEncoding crypto.SignatureEncoding `json:"signature_encoding,omitempty"`
+	KeySize           int                      `json:"key_size,omitempty"`
+	Curve             string                   `json:"curve,omitempty"`
+	Hash              crypto.HashAlgorithm     `json:"hash,omitempty"`
+	Padding           crypto.RSAPadding        `json:"padding,omitempty"`
+	SaltLength        int                      `json:"salt_length,omitempty"`
+	// KeyVersion is version of master key wrapping PrivateKey at rest, empty
+	// when private key is stored in plaintext
+	KeyVersion string `json:"key_version,omitempty"`
+
+	// SigningKeyVersion numbers device key pairs, every rotation increases it
+	SigningKeyVersion int `json:"signing_key_version"`
+	// KeyHistory keeps public keys retired by rotation, so signatures made
+	// before rotation stay verifiable
+	KeyHistory []RetiredKey `json:"key_history,omitempty"`
+
+	// KeyBackend names backend holding private key, empty means software key
+	// stored in PrivateKey
+	KeyBackend string `json:"key_backend,omitempty"`
+	// KeyLabel names private key inside backend which doesn't export keys
+	KeyLabel string `json:"key_label,omitempty"`
+
+	// CertificateChain certifies current public key, DER encoded device
+	// certificate first followed by issuing CA certificates
+	CertificateChain [][]byte `json:"certificate_chain,omitempty"`
+
+	// Status of device, empty status of devices created before statuses
+	// were introduced means active
+	Status DeviceStatus `json:"status,omitempty"`
+
+	// SignatureFormat is returned when sign request doesn't select format,
+	// empty means raw signature
+	SignatureFormat SignatureFormat `json:"signature_format,omitempty"`
+
+	// SignedDataVersion is format of data signed by device, devices created
+	// before signed data was versioned use legacy v0
+	SignedDataVersion SignedDataVersion `json:"signed_data_version"`
+}
+
+// Active reports whether device may sign and publish its key
+func (d *SignatureDevice) Active() bool {
+	return d.Status == "" || d.Status == DeviceStatusActive
+}
+
+// algorithm returns crypto implementation registered for device algorithm
+func (d *SignatureDevice) algorithm() (crypto.Algorithm, error) {
+	alg, ok := crypto.LookupAlgorithm(string(d.Algorithm))
+	if !ok {
+		return crypto.Algorithm{}, errors.New("unsupported algorithm: " + string(d.Algorithm))
+	}
+	return alg, nil
 }
 
 // GenerateKeys generate pair of keys based on choosen algorithm
 func (d *SignatureDevice) GenerateKeys() error {
-	switch d.Algorithm {
-	case AlgorithmRSA:
-		gen := crypto.RSAGenerator{}
-		marshaler := crypto.NewRSAMarshaler()
-
-		keyPair, err := gen.Generate()
-		if err != nil {
-			return err
-		}
-		pub, priv, err := marshaler.Marshal(*keyPair)
-		if err != nil {
-			return err
-		}
-		d.PublicKey = pub
-		d.PrivateKey = priv
+	alg, err := d.algorithm()
+	if err != nil {
+		return err
+	}
 
-	case AlgorithmECC:
-		gen := crypto.ECCGenerator{}
-		marshaler := crypto.NewECCMarshaler()
+	backend, err := crypto.LookupKeyBackend(d.KeyBackend)
+	if err != nil {
+		return err
+	}
 
-		keyPair, err := gen.Generate()
-		if err != nil {
-			return err
-		}
-		pub, priv, err := marshaler.Encode(*keyPair)
-		if err != nil {
-			return err
-		}
-		d.PublicKey = pub
-		d.PrivateKey = priv
+	// every key pair version gets own label, retired keys stay in token
+	label := fmt.Sprintf("%s-v%d", d.ID, d.SigningKeyVersion)
+	pub, handle, err := backend.GenerateKeys(alg, d.KeyParams(), label)
+	if err != nil {
+		return err
+	}
+	d.PublicKey = pub
+	d.PrivateKey = handle.PrivateKey
+	d.KeyLabel = handle.Label
 
-	default:
-		return errors.New("unsupported algorithm: " + string(d.Algorithm))
+	return nil
+}
+
+// signer returns signer of device current key from device key backend
+func (d *SignatureDevice) signer(opts crypto.SignatureOptions) (crypto.Signer, error) {
+	alg, err := d.algorithm()
+	if err != nil {
+		return nil, err
+	}
+	backend, err := crypto.LookupKeyBackend(d.KeyBackend)
+	if err != nil {
+		return nil, err
 	}
+	return backend.NewSigner(alg, crypto.KeyHandle{PrivateKey: d.PrivateKey, Label: d.KeyLabel}, opts)
+}
 
+// ImportKeys sets externally generated key pair on device. Algorithm and key
+// parameters are detected from the key; when device algorithm or requested
+// params are already set they have to match the key. Key is validated against
+// key policy the same way generated keys are. It replaces ConfigureKeyParams
+// and GenerateKeys for devices with imported keys.
+func (d *SignatureDevice) ImportKeys(privateKeyPEM []byte, password []byte, requested crypto.KeyParams, policy crypto.KeyPolicy) error {
+	if d.KeyBackend != "" && d.KeyBackend != crypto.KeyBackendSoftware {
+		return fmt.Errorf("keys can't be imported into %s key backend", d.KeyBackend)
+	}
+	alg, key, err := crypto.ImportPrivateKey(privateKeyPEM, password)
+	if err != nil {
+		return err
+	}
+	if d.Algorithm != "" && string(d.Algorithm) != alg.Name {
+		return fmt.Errorf("private key is %s key but device algorithm is %s", alg.Name, d.Algorithm)
+	}
+	if requested.KeySize != 0 && requested.KeySize != key.Params.KeySize {
+		return fmt.Errorf("private key size is %d bits but %d was requested", key.Params.KeySize, requested.KeySize)
+	}
+	if requested.Curve != "" && requested.Curve != key.Params.Curve {
+		return fmt.Errorf("private key curve is %s but %s was requested", key.Params.Curve, requested.Curve)
+	}
+
+	d.Algorithm = AlgorithmType(alg.Name)
+	params := key.Params
+	params.Hash = requested.Hash
+	if err := d.ConfigureKeyParams(params, policy); err != nil {
+		return err
+	}
+	d.PublicKey = key.PublicKey
+	d.PrivateKey = key.PrivateKey
+	return nil
+}
+
+// KeyParams returns parameters of device key pair
+func (d *SignatureDevice) KeyParams() crypto.KeyParams {
+	return crypto.KeyParams{KeySize: d.KeySize, Curve: d.Curve, Hash: d.Hash}
+}
+
+// ConfigureKeyParams validates requested key parameters against key policy and
+// stores them on device, missing parameters are filled with algorithm defaults.
+// It has to be called before GenerateKeys.
+func (d *SignatureDevice) ConfigureKeyParams(params crypto.KeyParams, policy crypto.KeyPolicy) error {
+	alg, err := d.algorithm()
+	if err != nil {
+		return err
+	}
+	resolved, err := alg.ResolveParams(params, policy)
+	if err != nil {
+		return err
+	}
+	d.KeySize = resolved.KeySize
+	d.Curve = resolved.Curve
+	d.Hash = resolved.Hash
+	return nil
+}
+
+// ConfigurePadding sets RSA signature scheme, PKCS#1 v1.5 is used when
+// padding is empty. It has to be called after ConfigureKeyParams.
+func (d *SignatureDevice) ConfigurePadding(padding crypto.RSAPadding, saltLength int) error {
+	alg, err := d.algorithm()
+	if err != nil {
+		return err
+	}
+	resolved, salt, err := alg.ResolvePadding(padding, saltLength, d.KeyParams())
+	if err != nil {
+		return err
+	}
+	d.Padding = resolved
+	d.SaltLength = salt
 	return nil
 }
 
+// signatureOptions returns options used to sign and verify with device key
+func (d *SignatureDevice) signatureOptions(encoding crypto.SignatureEncoding) crypto.SignatureOptions {
+	return crypto.SignatureOptions{
+		Encoding:   encoding,
+		Hash:       d.Hash,
+		Padding:    d.Padding,
+		SaltLength: d.SaltLength,
+	}
+}
+
+// ConfigureSignatureEncoding sets how signatures are serialized, algorithm
+// default is used when encoding is empty. Algorithms with single signature
+// format don't accept any encoding.
+func (d *SignatureDevice) ConfigureSignatureEncoding(encoding crypto.SignatureEncoding) error {
+	alg, err := d.algorithm()
+	if err != nil {
+		return err
+	}
+	if len(alg.Encodings) == 0 {
+		if encoding != "" {
+			return errors.New("signature encoding is not supported for " + string(d.Algorithm) + " devices")
+		}
+		return nil
+	}
+	if encoding == "" {
+		encoding = alg.Encodings[0]
+	}
+	if !slices.Contains(alg.Encodings, encoding) {
+		return crypto.ErrUnsupportedEncoding
+	}
+	d.SignatureEncoding = encoding
+	return nil
+}
+
+// SigningEncoding returns encoding used for new signatures of the device
+func (d *SignatureDevice) SigningEncoding() crypto.SignatureEncoding {
+	alg, err := d.algorithm()
+	if err != nil || len(alg.Encodings) == 0 {
+		return ""
+	}
+	if d.SignatureEncoding == "" {
+		return alg.Encodings[0]
+	}
+	return d.SignatureEncoding
+}
+
 // IncrementCounter used to increment signed docs by device and record last signed time
 func (d *SignatureDevice) IncrementCounter(newLastSignature string) {
 	d.SignatureCounter++
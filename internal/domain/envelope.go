@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignedDataVersion is version of format in which signed data is assembled
+type SignedDataVersion int
+
+const (
+	// SignedDataV0 is legacy <counter>_<data>_<previous signature>, kept for
+	// devices created before signed data was versioned
+	SignedDataV0 SignedDataVersion = 0
+	// SignedDataV1 is JSON object with keys counter, data, device_id, mode
+	// (transaction records only), prev, timestamp and v in this order and
+	// without insignificant whitespace
+	SignedDataV1 SignedDataVersion = 1
+
+	// SignedDataCurrent is version used by newly created devices
+	SignedDataCurrent = SignedDataV1
+)
+
+// ErrMalformedSignedData is returned when signed data can't be parsed back
+var ErrMalformedSignedData = errors.New("malformed signed data")
+
+// SignedDataEnvelope is signed data split into its fields. Legacy v0 signed
+// data carries neither device ID, payload mode nor timestamp.
+type SignedDataEnvelope struct {
+	Version  SignedDataVersion `json:"v"`
+	Counter  uint64            `json:"counter"`
+	Data     string            `json:"data"`
+	Prev     string            `json:"prev"`
+	DeviceID string            `json:"device_id,omitempty"`
+	// Mode is payload mode of transaction data, empty for service records
+	Mode      PayloadMode `json:"mode,omitempty"`
+	Timestamp time.Time   `json:"timestamp,omitzero"`
+}
+
+// envelopeV1 is wire form of v1 envelope, fields are in lexicographic order
+// of their keys
+type envelopeV1 struct {
+	Counter   uint64            `json:"counter"`
+	Data      string            `json:"data"`
+	DeviceID  string            `json:"device_id"`
+	Mode      PayloadMode       `json:"mode,omitempty"`
+	Prev      string            `json:"prev"`
+	Timestamp string            `json:"timestamp"`
+	Version   SignedDataVersion `json:"v"`
+}
+
+// canonicalJSON serializes struct whose fields are in lexicographic order of
+// their keys without insignificant whitespace and HTML escaping
+func canonicalJSON(v any) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// encodeEnvelopeV1 serializes envelope in canonical v1 form, timestamp is
+// UTC with nanoseconds
+func encodeEnvelopeV1(e SignedDataEnvelope) (string, error) {
+	return canonicalJSON(envelopeV1{
+		Counter:   e.Counter,
+		Data:      e.Data,
+		DeviceID:  e.DeviceID,
+		Mode:      e.Mode,
+		Prev:      e.Prev,
+		Timestamp: e.Timestamp.UTC().Format(time.RFC3339Nano),
+		Version:   SignedDataV1,
+	})
+}
+
+// ParseSignedData splits signed data into envelope fields. Version is
+// recognized from data itself, v1 is JSON object while v0 starts with counter.
+func ParseSignedData(signedData string) (SignedDataEnvelope, error) {
+	if strings.HasPrefix(signedData, "{") {
+		return parseEnvelopeV1(signedData)
+	}
+
+	// neither counter nor base64 encoded previous signature contain underscore
+	counter, rest, ok := strings.Cut(signedData, "_")
+	end := strings.LastIndex(rest, "_")
+	if !ok || end < 0 {
+		return SignedDataEnvelope{}, fmt.Errorf("%w: expected <counter>_<data>_<previous signature>", ErrMalformedSignedData)
+	}
+	n, err := strconv.ParseUint(counter, 10, 64)
+	if err != nil {
+		return SignedDataEnvelope{}, fmt.Errorf("%w: invalid counter %q", ErrMalformedSignedData, counter)
+	}
+	return SignedDataEnvelope{Version: SignedDataV0, Counter: n, Data: rest[:end], Prev: rest[end+1:]}, nil
+}
+
+// parseEnvelopeV1 decodes v1 envelope, it has to be in canonical form, so
+// every envelope has exactly one accepted serialization
+func parseEnvelopeV1(signedData string) (SignedDataEnvelope, error) {
+	var wire envelopeV1
+	dec := json.NewDecoder(strings.NewReader(signedData))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&wire); err != nil {
+		return SignedDataEnvelope{}, fmt.Errorf("%w: %v", ErrMalformedSignedData, err)
+	}
+	if wire.Version != SignedDataV1 {
+		return SignedDataEnvelope{}, fmt.Errorf("%w: unsupported version %d", ErrMalformedSignedData, wire.Version)
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, wire.Timestamp)
+	if err != nil {
+		return SignedDataEnvelope{}, fmt.Errorf("%w: invalid timestamp %q", ErrMalformedSignedData, wire.Timestamp)
+	}
+
+	e := SignedDataEnvelope{
+		Version:   wire.Version,
+		Counter:   wire.Counter,
+		Data:      wire.Data,
+		Prev:      wire.Prev,
+		DeviceID:  wire.DeviceID,
+		Mode:      wire.Mode,
+		Timestamp: timestamp,
+	}
+	canonical, err := encodeEnvelopeV1(e)
+	if err != nil {
+		return SignedDataEnvelope{}, err
+	}
+	if canonical != signedData {
+		return SignedDataEnvelope{}, fmt.Errorf("%w: envelope isn't in canonical form", ErrMalformedSignedData)
+	}
+	return e, nil
+}
@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+// IdempotencyRecord remembers request made with idempotency key and, once it
+// succeeded, its response, so retried request gets the same response instead
+// of being executed again. Keys are unique within scope, e.g. request path.
+type IdempotencyRecord struct {
+	Scope string `json:"scope"`
+	Key   string `json:"key"`
+	// RequestHash identifies request, the same key can't be reused for
+	// other request
+	RequestHash string `json:"request_hash"`
+	// StatusCode is zero while request is in progress
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Completed reports whether response of request is stored
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
+
+// Reserves reports whether r is in progress reservation made by request of
+// rec, reservation is identified by request hash and creation time
+func (r *IdempotencyRecord) Reserves(rec *IdempotencyRecord) bool {
+	return !r.Completed() && r.RequestHash == rec.RequestHash && r.CreatedAt.Equal(rec.CreatedAt)
+}
+
+// Expired reports whether record no longer holds its key
+func (r *IdempotencyRecord) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
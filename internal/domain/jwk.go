@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"fmt"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// KeyID identifies device key pair version in published key sets
+func (d *SignatureDevice) KeyID() string {
+	return fmt.Sprintf("%s-v%d", d.ID, d.SigningKeyVersion)
+}
+
+// JWK returns device current public key as JSON Web Key. Algorithm is set
+// only when device signatures map onto JWS algorithm, verifiers otherwise
+// have to know device settings.
+func (d *SignatureDevice) JWK() (crypto.JWK, error) {
+	pub, err := d.ParsePublicKey()
+	if err != nil {
+		return crypto.JWK{}, err
+	}
+	jwk, err := crypto.NewJWK(pub)
+	if err != nil {
+		return crypto.JWK{}, err
+	}
+	jwk.Kid = d.KeyID()
+	jwk.Use = "sig"
+	if alg, err := crypto.JWSAlgorithm(pub, d.signatureOptions("")); err == nil {
+		jwk.Alg = alg
+	}
+	return jwk, nil
+}
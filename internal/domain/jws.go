@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// SignatureFormat selects how signatures are handed out to clients
+type SignatureFormat string
+
+const (
+	// SignatureFormatRaw is base64 signature of signed data, default format
+	SignatureFormatRaw SignatureFormat = "raw"
+	// SignatureFormatJWS is RFC 7515 compact JWS with signed data as payload
+	SignatureFormatJWS SignatureFormat = "jws"
+)
+
+// ErrJWSUnsupported is returned for devices whose signatures have no JWS algorithm
+var ErrJWSUnsupported = errors.New("device signatures can't be expressed as JWS")
+
+// JWSHeader is protected header of device JWS
+type JWSHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// Counter is signature counter of chain record carrying the same signed data
+	Counter uint64 `json:"counter"`
+}
+
+// JWSAlgorithm returns JWS algorithm of device current key
+func (d *SignatureDevice) JWSAlgorithm() (string, error) {
+	pub, err := d.ParsePublicKey()
+	if err != nil {
+		return "", err
+	}
+	alg, err := crypto.JWSAlgorithm(pub, d.signatureOptions(""))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrJWSUnsupported, err)
+	}
+	return alg, nil
+}
+
+// ConfigureSignatureFormat sets format used when sign request doesn't ask for
+// one, JWS is accepted only when device key and options map onto JWS algorithm
+func (d *SignatureDevice) ConfigureSignatureFormat(format SignatureFormat) error {
+	switch format {
+	case "", SignatureFormatRaw:
+		d.SignatureFormat = format
+		return nil
+	case SignatureFormatJWS:
+		if _, err := d.JWSAlgorithm(); err != nil {
+			return err
+		}
+		d.SignatureFormat = format
+		return nil
+	default:
+		return fmt.Errorf("unsupported signature format: %s", format)
+	}
+}
+
+// SignJWS signs payload as compact JWS with device current key. It's separate
+// signature from the chain one, because JWS signs encoded header and payload.
+func SignJWS(device *SignatureDevice, payload string, counter uint64) (string, error) {
+	if !device.Active() {
+		return "", ErrDeviceDeactivated
+	}
+	alg, err := device.JWSAlgorithm()
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(JWSHeader{Alg: alg, Kid: device.KeyID(), Counter: counter})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(payload))
+	// JWS ECDSA signatures are fixed size R || S
+	s, err := device.signer(device.signatureOptions(crypto.EncodingP1363))
+	if err != nil {
+		return "", err
+	}
+	signature, err := s.Sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
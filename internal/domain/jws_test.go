@@ -0,0 +1,149 @@
+package domain_test
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// verifyJWS checks compact JWS the way JOSE libraries do, using algorithm
+// from protected header
+func verifyJWS(t *testing.T, device *domain.SignatureDevice, jws string) (domain.JWSHeader, string) {
+	t.Helper()
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 JWS parts, got %d", len(parts))
+	}
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("decode JWS part: %v", err)
+		}
+		return b
+	}
+	var header domain.JWSHeader
+	if err := json.Unmarshal(decode(parts[0]), &header); err != nil {
+		t.Fatalf("decode header: %v", err)
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	signature := decode(parts[2])
+
+	hashes := map[string]stdcrypto.Hash{"256": stdcrypto.SHA256, "384": stdcrypto.SHA384, "512": stdcrypto.SHA512}
+	pub, _ := device.ParsePublicKey()
+	var err error
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		if header.Alg != "EdDSA" || !ed25519.Verify(key, signingInput, signature) {
+			err = errors.New("invalid EdDSA signature")
+		}
+	case *rsa.PublicKey:
+		hash := hashes[header.Alg[2:]]
+		h := hash.New()
+		h.Write(signingInput)
+		if strings.HasPrefix(header.Alg, "PS") {
+			err = rsa.VerifyPSS(key, hash, h.Sum(nil), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			err = rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature)
+		}
+	case *ecdsa.PublicKey:
+		h := hashes[header.Alg[2:]].New()
+		h.Write(signingInput)
+		size := len(signature) / 2
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, h.Sum(nil), r, s) {
+			err = errors.New("invalid ECDSA signature")
+		}
+	}
+	if err != nil {
+		t.Fatalf("JWS signature doesn't verify: %v", err)
+	}
+	return header, string(decode(parts[1]))
+}
+
+func TestSignJWS(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm domain.AlgorithmType
+		params    crypto.KeyParams
+		padding   crypto.RSAPadding
+		encoding  crypto.SignatureEncoding
+		wantAlg   string
+	}{
+		{name: "RS256", algorithm: domain.AlgorithmRSA, wantAlg: "RS256"},
+		{name: "PS256", algorithm: domain.AlgorithmRSA, padding: crypto.PaddingPSS, wantAlg: "PS256"},
+		{name: "ES256", algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Curve: crypto.CurveP256}, wantAlg: "ES256"},
+		// chain signatures stay DER, JWS one is always R || S
+		{name: "ES384 with DER device", algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Hash: crypto.HashSHA384}, encoding: crypto.EncodingASN1DER, wantAlg: "ES384"},
+		{name: "EdDSA", algorithm: domain.AlgorithmEd25519, wantAlg: "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "dev-1", Algorithm: tt.algorithm}
+			if err := device.ConfigureKeyParams(tt.params, crypto.DefaultKeyPolicy); err != nil {
+				t.Fatalf("configure params: %v", err)
+			}
+			if err := device.ConfigureSignatureEncoding(tt.encoding); err != nil {
+				t.Fatalf("configure encoding: %v", err)
+			}
+			if err := device.ConfigurePadding(tt.padding, 0); err != nil {
+				t.Fatalf("configure padding: %v", err)
+			}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+			if err := device.ConfigureSignatureFormat(domain.SignatureFormatJWS); err != nil {
+				t.Fatalf("configure format: %v", err)
+			}
+
+			signedData, _, err := domain.SignData(device, "tx-1")
+			if err != nil {
+				t.Fatalf("sign data: %v", err)
+			}
+			jws, err := domain.SignJWS(device, signedData, 7)
+			if err != nil {
+				t.Fatalf("sign JWS: %v", err)
+			}
+
+			header, payload := verifyJWS(t, device, jws)
+			if header.Alg != tt.wantAlg || header.Kid != "dev-1-v0" || header.Counter != 7 {
+				t.Errorf("unexpected header %+v", header)
+			}
+			if payload != signedData {
+				t.Errorf("expected payload %q, got %q", signedData, payload)
+			}
+		})
+	}
+}
+
+func TestSignatureDevice_ConfigureSignatureFormat(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.ConfigureKeyParams(crypto.KeyParams{Curve: crypto.CurveP384, Hash: crypto.HashSHA256}, crypto.DefaultKeyPolicy); err != nil {
+		t.Fatalf("configure params: %v", err)
+	}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+
+	if err := device.ConfigureSignatureFormat(domain.SignatureFormatJWS); !errors.Is(err, domain.ErrJWSUnsupported) {
+		t.Fatalf("expected P-384 with SHA-256 to have no JWS algorithm, got %v", err)
+	}
+	if _, err := domain.SignJWS(device, "data", 0); !errors.Is(err, domain.ErrJWSUnsupported) {
+		t.Fatalf("expected JWS signing to fail, got %v", err)
+	}
+	if err := device.ConfigureSignatureFormat("xml"); err == nil {
+		t.Fatalf("expected unknown format to be rejected")
+	}
+	if err := device.ConfigureSignatureFormat(domain.SignatureFormatRaw); err != nil || device.SignatureFormat != domain.SignatureFormatRaw {
+		t.Fatalf("expected raw format, got %v", err)
+	}
+}
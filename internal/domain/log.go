@@ -0,0 +1,185 @@
+package domain
+
+import (
+	stdcrypto "crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// ErrLogRewritten is returned when signed tree heads of signature log aren't
+// consistent, i.e. log history was changed
+var ErrLogRewritten = errors.New("signature log history was rewritten")
+
+// LogEntry is signature record sequenced into append-only signature log of
+// all devices. Leaf hash is fixed when record is sequenced.
+type LogEntry struct {
+	Index       uint64 `json:"index"`
+	SignatureID string `json:"signature_id"`
+	DeviceID    string `json:"device_id"`
+	LeafHash    []byte `json:"leaf_hash"`
+}
+
+// SequenceRecords returns entries of records which are not in log yet,
+// indexed after the last log entry. New records are ordered by creation
+// time, records of one device by chain order.
+func SequenceRecords(log []*LogEntry, records []*SignatureRecord) ([]*LogEntry, error) {
+	logged := make(map[string]bool, len(log))
+	for _, e := range log {
+		logged[e.SignatureID] = true
+	}
+	var pending []*SignatureRecord
+	for _, rec := range chainOrder(records) {
+		if !logged[rec.ID] {
+			pending = append(pending, rec)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+
+	entries := make([]*LogEntry, 0, len(pending))
+	for i, rec := range pending {
+		leaf, err := RecordLeaf(rec)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &LogEntry{
+			Index:       uint64(len(log) + i),
+			SignatureID: rec.ID,
+			DeviceID:    rec.DeviceID,
+			LeafHash:    crypto.MerkleLeafHash([]byte(leaf)),
+		})
+	}
+	return entries, nil
+}
+
+// logLeafHashes returns leaf hashes of log entries, entries have to be whole
+// log in index order
+func logLeafHashes(log []*LogEntry) ([][]byte, error) {
+	hashes := make([][]byte, len(log))
+	for i, e := range log {
+		if e.Index != uint64(i) {
+			return nil, fmt.Errorf("log entry %d found at position %d", e.Index, i)
+		}
+		hashes[i] = e.LeafHash
+	}
+	return hashes, nil
+}
+
+// SignedTreeHead is signed root of whole signature log (RFC 6962 STH)
+type SignedTreeHead struct {
+	TreeSize  uint64    `json:"tree_size"`
+	RootHash  []byte    `json:"root_hash"`
+	Timestamp time.Time `json:"timestamp"`
+	// KeyID is fingerprint of service key which signed tree head
+	KeyID     string `json:"key_id"`
+	Signature []byte `json:"signature"`
+}
+
+// signedTreeHeadV1 is signed form of log tree head, fields are in
+// lexicographic order of their keys. Log name keeps it apart from tree heads
+// of device chains.
+type signedTreeHeadV1 struct {
+	KeyID     string `json:"key_id"`
+	Log       string `json:"log"`
+	RootHash  string `json:"root_hash"`
+	Timestamp string `json:"timestamp"`
+	TreeSize  uint64 `json:"tree_size"`
+	Version   int    `json:"v"`
+}
+
+// SignedData returns canonical JSON covered by tree head signature
+func (h *SignedTreeHead) SignedData() (string, error) {
+	return canonicalJSON(signedTreeHeadV1{
+		KeyID:     h.KeyID,
+		Log:       "signatures",
+		RootHash:  base64.StdEncoding.EncodeToString(h.RootHash),
+		Timestamp: h.Timestamp.UTC().Format(time.RFC3339Nano),
+		TreeSize:  h.TreeSize,
+		Version:   1,
+	})
+}
+
+// BuildSignedTreeHead computes unsigned tree head over whole log
+func BuildSignedTreeHead(log []*LogEntry, timestamp time.Time) (*SignedTreeHead, error) {
+	leaves, err := logLeafHashes(log)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedTreeHead{
+		TreeSize:  uint64(len(leaves)),
+		RootHash:  crypto.MerkleRoot(leaves),
+		Timestamp: timestamp,
+	}, nil
+}
+
+// SignLogTreeHead signs log tree head with service key
+func SignLogTreeHead(head *SignedTreeHead, key stdcrypto.Signer) error {
+	keyID, signature, err := signServiceStatement(key, func(keyID string) (string, error) {
+		head.KeyID = keyID
+		return head.SignedData()
+	})
+	if err != nil {
+		return err
+	}
+	head.KeyID, head.Signature = keyID, signature
+	return nil
+}
+
+// VerifyLogTreeHead checks log tree head signature with service public key
+func VerifyLogTreeHead(head *SignedTreeHead, publicKey stdcrypto.PublicKey) error {
+	signedData, err := head.SignedData()
+	if err != nil {
+		return err
+	}
+	if err := verifyServiceStatement(publicKey, head.KeyID, signedData, head.Signature); err != nil {
+		return fmt.Errorf("invalid log tree head: %w", err)
+	}
+	return nil
+}
+
+// ConsistencyProof proves that log of first size is prefix of log of second
+// size
+type ConsistencyProof struct {
+	First  uint64   `json:"first"`
+	Second uint64   `json:"second"`
+	Proof  [][]byte `json:"consistency"`
+}
+
+// NewConsistencyProof proves consistency of log prefixes of first and second
+// size, log has to be whole log
+func NewConsistencyProof(log []*LogEntry, first, second uint64) (*ConsistencyProof, error) {
+	if first > second || second > uint64(len(log)) {
+		return nil, fmt.Errorf("invalid tree sizes %d and %d of log of size %d", first, second, len(log))
+	}
+	leaves, err := logLeafHashes(log[:second])
+	if err != nil {
+		return nil, err
+	}
+	proof, err := crypto.MerkleConsistencyProof(int(first), leaves)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsistencyProof{First: first, Second: second, Proof: proof}, nil
+}
+
+// VerifyConsistency checks that older tree head is prefix of newer one. Both
+// tree heads have to be verified already. Inconsistent heads are reported as
+// ErrLogRewritten.
+func VerifyConsistency(older, newer *SignedTreeHead, proof *ConsistencyProof) error {
+	if newer.TreeSize < older.TreeSize {
+		return fmt.Errorf("%w: log shrank from %d to %d entries", ErrLogRewritten, older.TreeSize, newer.TreeSize)
+	}
+	if proof.First != older.TreeSize || proof.Second != newer.TreeSize {
+		return fmt.Errorf("proof is between sizes %d and %d, not %d and %d", proof.First, proof.Second, older.TreeSize, newer.TreeSize)
+	}
+	if err := crypto.VerifyMerkleConsistency(older.TreeSize, newer.TreeSize, older.RootHash, newer.RootHash, proof.Proof); err != nil {
+		return fmt.Errorf("%w: %v", ErrLogRewritten, err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package domain_test
+
+import (
+	stdcrypto "crypto"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+)
+
+// signedHead builds and signs log tree head over log prefix
+func signedHead(t *testing.T, key stdcrypto.Signer, log []*domain.LogEntry) *domain.SignedTreeHead {
+	t.Helper()
+	head, err := domain.BuildSignedTreeHead(log, time.Now())
+	if err != nil {
+		t.Fatalf("build tree head: %v", err)
+	}
+	if err := domain.SignLogTreeHead(head, key); err != nil {
+		t.Fatalf("sign tree head: %v", err)
+	}
+	if err := domain.VerifyLogTreeHead(head, key.Public()); err != nil {
+		t.Fatalf("verify tree head: %v", err)
+	}
+	return head
+}
+
+func TestSequenceRecords(t *testing.T) {
+	first := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	second := &domain.SignatureDevice{ID: "dev-2", Algorithm: domain.AlgorithmEd25519}
+	for _, d := range []*domain.SignatureDevice{first, second} {
+		if err := d.GenerateKeys(); err != nil {
+			t.Fatalf("generate keys: %v", err)
+		}
+	}
+	records := buildChain(t, first, 3)
+	log, err := domain.SequenceRecords(nil, records)
+	if err != nil {
+		t.Fatalf("sequence: %v", err)
+	}
+	if len(log) != 3 || log[2].Index != 2 || log[2].SignatureID != records[2].ID {
+		t.Fatalf("expected chain sequenced in order, got %d entries", len(log))
+	}
+
+	// already logged records are skipped, new ones continue the log
+	more := buildChain(t, second, 2)
+	for _, rec := range more {
+		rec.ID = "dev-2-" + rec.ID
+	}
+	entries, err := domain.SequenceRecords(log, append(records, more...))
+	if err != nil {
+		t.Fatalf("sequence: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Index != 3 || entries[0].DeviceID != "dev-2" {
+		t.Fatalf("expected two entries of dev-2 from index 3, got %d", len(entries))
+	}
+}
+
+func TestConsistencyProof_AllTreeSizes(t *testing.T) {
+	key := newServiceKey(t)
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	log, err := domain.SequenceRecords(nil, buildChain(t, device, 9))
+	if err != nil {
+		t.Fatalf("sequence: %v", err)
+	}
+
+	heads := make([]*domain.SignedTreeHead, len(log)+1)
+	for size := range heads {
+		heads[size] = signedHead(t, key, log[:size])
+	}
+	for first := range heads {
+		for second := first; second < len(heads); second++ {
+			proof, err := domain.NewConsistencyProof(log, uint64(first), uint64(second))
+			if err != nil {
+				t.Fatalf("proof %d-%d: %v", first, second, err)
+			}
+			if err := domain.VerifyConsistency(heads[first], heads[second], proof); err != nil {
+				t.Fatalf("verify %d-%d: %v", first, second, err)
+			}
+		}
+	}
+	if _, err := domain.NewConsistencyProof(log, 3, 10); err == nil {
+		t.Errorf("expected error for tree size beyond log")
+	}
+}
+
+func TestVerifyConsistency_RewrittenLog(t *testing.T) {
+	key := newServiceKey(t)
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	log, err := domain.SequenceRecords(nil, buildChain(t, device, 7))
+	if err != nil {
+		t.Fatalf("sequence: %v", err)
+	}
+	older := signedHead(t, key, log[:3])
+
+	tests := []struct {
+		name    string
+		rewrite func(log []*domain.LogEntry) []*domain.LogEntry
+	}{
+		{name: "replaced entry", rewrite: func(log []*domain.LogEntry) []*domain.LogEntry {
+			forged := *log[1]
+			forged.LeafHash = log[5].LeafHash
+			log[1] = &forged
+			return log
+		}},
+		{name: "removed entry", rewrite: func(log []*domain.LogEntry) []*domain.LogEntry {
+			rewritten := append([]*domain.LogEntry{}, log[:1]...)
+			for i, e := range log[2:] {
+				moved := *e
+				moved.Index = uint64(i + 1)
+				rewritten = append(rewritten, &moved)
+			}
+			return rewritten
+		}},
+		{name: "shrunk log", rewrite: func(log []*domain.LogEntry) []*domain.LogEntry {
+			return log[:2]
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rewritten := tc.rewrite(append([]*domain.LogEntry{}, log...))
+			newer := signedHead(t, key, rewritten)
+			proof := &domain.ConsistencyProof{First: older.TreeSize, Second: newer.TreeSize}
+			if older.TreeSize <= newer.TreeSize {
+				p, err := domain.NewConsistencyProof(rewritten, older.TreeSize, newer.TreeSize)
+				if err != nil {
+					t.Fatalf("proof: %v", err)
+				}
+				proof = p
+			}
+			if err := domain.VerifyConsistency(older, newer, proof); !errors.Is(err, domain.ErrLogRewritten) {
+				t.Fatalf("expected ErrLogRewritten, got %v", err)
+			}
+		})
+	}
+}
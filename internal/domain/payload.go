@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// PayloadMode tells how transaction payload is represented in signed data
+type PayloadMode string
+
+const (
+	// PayloadModeText embeds data verbatim, records without mode carry text
+	PayloadModeText PayloadMode = "text"
+	// PayloadModeBase64 embeds arbitrary bytes as base64:<standard base64>
+	PayloadModeBase64 PayloadMode = "base64"
+	// PayloadModeDigest embeds digest of data hashed by client as
+	// digest:<hash>:<lowercase hex>
+	PayloadModeDigest PayloadMode = "digest"
+)
+
+// prefixes marking binary and digest payloads in signed data, text payloads
+// of legacy v0 devices can't start with them
+const (
+	base64PayloadPrefix = string(PayloadModeBase64) + ":"
+	digestPayloadPrefix = string(PayloadModeDigest) + ":"
+)
+
+// digestAlgorithms lists hashes accepted for client side hashing
+var digestAlgorithms = []crypto.HashAlgorithm{crypto.HashSHA256, crypto.HashSHA384, crypto.HashSHA512}
+
+// ErrInvalidPayload is returned for payloads which can't be signed or parsed
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// Payload is transaction data signed into device chain
+type Payload struct {
+	Mode PayloadMode `json:"mode"`
+	// Text is set for text payloads
+	Text string `json:"text,omitempty"`
+	// Data is set for binary payloads
+	Data []byte `json:"data,omitempty"`
+	// DigestAlgorithm and Digest are set for digest payloads, digest is
+	// lowercase hex
+	DigestAlgorithm crypto.HashAlgorithm `json:"digest_algorithm,omitempty"`
+	Digest          string               `json:"digest,omitempty"`
+}
+
+// NewTextPayload creates payload embedded verbatim
+func NewTextPayload(text string) Payload {
+	return Payload{Mode: PayloadModeText, Text: text}
+}
+
+// NewBinaryPayload creates payload carrying arbitrary bytes
+func NewBinaryPayload(data []byte) Payload {
+	return Payload{Mode: PayloadModeBase64, Data: data}
+}
+
+// NewDigestPayload creates payload of data hashed by client, digest is hex
+// encoded and has to match algorithm digest size
+func NewDigestPayload(algorithm crypto.HashAlgorithm, digest string) (Payload, error) {
+	if !slices.Contains(digestAlgorithms, algorithm) {
+		return Payload{}, fmt.Errorf("%w: unsupported digest algorithm %q", ErrInvalidPayload, algorithm)
+	}
+	raw, err := hex.DecodeString(digest)
+	if err != nil {
+		return Payload{}, fmt.Errorf("%w: digest must be hex encoded", ErrInvalidPayload)
+	}
+	size, err := algorithm.Size()
+	if err != nil {
+		return Payload{}, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if len(raw) != size {
+		return Payload{}, fmt.Errorf("%w: %s digest has %d bytes, got %d", ErrInvalidPayload, algorithm, size, len(raw))
+	}
+	return Payload{Mode: PayloadModeDigest, DigestAlgorithm: algorithm, Digest: hex.EncodeToString(raw)}, nil
+}
+
+// Statement returns payload representation placed between counter and
+// previous signature in signed data
+func (p Payload) Statement() string {
+	switch p.Mode {
+	case PayloadModeBase64:
+		return base64PayloadPrefix + base64.StdEncoding.EncodeToString(p.Data)
+	case PayloadModeDigest:
+		return fmt.Sprintf("%s%s:%s", digestPayloadPrefix, p.DigestAlgorithm, p.Digest)
+	default:
+		return p.Text
+	}
+}
+
+// ParsePayload reads payload of given mode back from statement, empty mode
+// is text
+func ParsePayload(mode PayloadMode, statement string) (Payload, error) {
+	switch mode {
+	case "", PayloadModeText:
+		return Payload{Mode: PayloadModeText, Text: statement}, nil
+	case PayloadModeBase64:
+		encoded, ok := strings.CutPrefix(statement, base64PayloadPrefix)
+		if !ok {
+			return Payload{}, fmt.Errorf("%w: binary payload doesn't start with %q", ErrInvalidPayload, base64PayloadPrefix)
+		}
+		data, err := base64.StdEncoding.Strict().DecodeString(encoded)
+		if err != nil {
+			return Payload{}, fmt.Errorf("%w: binary payload isn't valid base64", ErrInvalidPayload)
+		}
+		return NewBinaryPayload(data), nil
+	case PayloadModeDigest:
+		rest, ok := strings.CutPrefix(statement, digestPayloadPrefix)
+		algorithm, digest, found := strings.Cut(rest, ":")
+		if !ok || !found {
+			return Payload{}, fmt.Errorf("%w: digest payload must be %s<hash>:<hex>", ErrInvalidPayload, digestPayloadPrefix)
+		}
+		p, err := NewDigestPayload(crypto.HashAlgorithm(algorithm), digest)
+		if err != nil {
+			return Payload{}, err
+		}
+		// digest has to be in canonical lowercase form it was signed in
+		if p.Digest != digest {
+			return Payload{}, fmt.Errorf("%w: digest must be lowercase hex", ErrInvalidPayload)
+		}
+		return p, nil
+	default:
+		return Payload{}, fmt.Errorf("%w: unknown payload mode %q", ErrInvalidPayload, mode)
+	}
+}
+
+// detectPayload reads payload from statement when its mode isn't recorded in
+// signed data, statements which aren't valid binary or digest payloads are text
+func detectPayload(statement string) Payload {
+	for _, mode := range []PayloadMode{PayloadModeBase64, PayloadModeDigest} {
+		if strings.HasPrefix(statement, string(mode)+":") {
+			if p, err := ParsePayload(mode, statement); err == nil {
+				return p
+			}
+		}
+	}
+	return Payload{Mode: PayloadModeText, Text: statement}
+}
+
+// Covers reports whether signed payload stands for content. Digest payload
+// covers text and binary content hashing to the signed digest.
+func (p Payload) Covers(content Payload) bool {
+	if p.Mode == PayloadModeDigest && content.Mode != PayloadModeDigest {
+		sum, err := p.DigestAlgorithm.Digest(content.bytes())
+		return err == nil && hex.EncodeToString(sum) == p.Digest
+	}
+	if p.Mode == PayloadModeDigest {
+		return p.DigestAlgorithm == content.DigestAlgorithm && p.Digest == content.Digest
+	}
+	return content.Mode != PayloadModeDigest && bytes.Equal(p.bytes(), content.bytes())
+}
+
+// bytes returns data of text and binary payloads
+func (p Payload) bytes() []byte {
+	if p.Mode == PayloadModeBase64 {
+		return p.Data
+	}
+	return []byte(p.Text)
+}
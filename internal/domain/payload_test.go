@@ -0,0 +1,188 @@
+package domain_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+func TestPayload_StatementRoundTrip(t *testing.T) {
+	sum := sha256.Sum256([]byte("large document"))
+	digest, err := domain.NewDigestPayload(crypto.HashSHA256, strings.ToUpper(hex.EncodeToString(sum[:])))
+	if err != nil {
+		t.Fatalf("digest payload: %v", err)
+	}
+	text := domain.NewTextPayload("tx_1")
+
+	tests := []struct {
+		name          string
+		payload       domain.Payload
+		wantStatement string
+	}{
+		{"text", text, "tx_1"},
+		{"binary", domain.NewBinaryPayload([]byte{0x00, 0xff, '_'}), "base64:AP9f"},
+		{"empty binary", domain.NewBinaryPayload(nil), "base64:"},
+		{"digest", digest, "digest:SHA-256:" + hex.EncodeToString(sum[:])},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			statement := tc.payload.Statement()
+			if statement != tc.wantStatement {
+				t.Fatalf("expected statement %q, got %q", tc.wantStatement, statement)
+			}
+			parsed, err := domain.ParsePayload(tc.payload.Mode, statement)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if parsed.Statement() != statement || !parsed.Covers(tc.payload) {
+				t.Errorf("parsed payload %+v doesn't match %+v", parsed, tc.payload)
+			}
+		})
+	}
+}
+
+func TestPayload_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		make func() error
+	}{
+		{"unknown digest algorithm", func() error { _, err := domain.NewDigestPayload("MD5", strings.Repeat("00", 16)); return err }},
+		{"empty digest algorithm", func() error { _, err := domain.NewDigestPayload("", strings.Repeat("00", 32)); return err }},
+		{"digest size mismatch", func() error {
+			_, err := domain.NewDigestPayload(crypto.HashSHA384, strings.Repeat("00", 32))
+			return err
+		}},
+		{"digest not hex", func() error {
+			_, err := domain.NewDigestPayload(crypto.HashSHA256, strings.Repeat("zz", 32))
+			return err
+		}},
+		{"binary statement without prefix", func() error { _, err := domain.ParsePayload(domain.PayloadModeBase64, "AA=="); return err }},
+		{"binary statement not base64", func() error { _, err := domain.ParsePayload(domain.PayloadModeBase64, "base64:@@"); return err }},
+		{"uppercase digest statement", func() error {
+			_, err := domain.ParsePayload(domain.PayloadModeDigest, "digest:SHA-256:"+strings.Repeat("AB", 32))
+			return err
+		}},
+		{"unknown mode", func() error { _, err := domain.ParsePayload("xml", "<a/>"); return err }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.make(); !errors.Is(err, domain.ErrInvalidPayload) {
+				t.Errorf("expected ErrInvalidPayload, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPayload_Covers(t *testing.T) {
+	document := []byte("large document")
+	sum := sha256.Sum256(document)
+	digest, _ := domain.NewDigestPayload(crypto.HashSHA256, hex.EncodeToString(sum[:]))
+	text := domain.NewTextPayload(string(document))
+	other := domain.NewTextPayload("other document")
+
+	tests := []struct {
+		name    string
+		signed  domain.Payload
+		content domain.Payload
+		want    bool
+	}{
+		{"digest covers binary document", digest, domain.NewBinaryPayload(document), true},
+		{"digest covers text document", digest, text, true},
+		{"digest covers the same digest", digest, digest, true},
+		{"digest doesn't cover other document", digest, other, false},
+		{"binary covers text with the same bytes", domain.NewBinaryPayload(document), text, true},
+		{"text doesn't cover digest", text, digest, false},
+		{"text doesn't cover other text", text, other, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.signed.Covers(tc.content); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestVerifySignedData_ReportsPayload(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmEd25519}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	payload := domain.NewBinaryPayload([]byte{0xde, 0xad, 0xbe, 0xef})
+	signedData, signature, err := domain.SignData(device, payload.Statement())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	result := domain.VerifySignedData(device, signedData, signature, "")
+	if !result.Valid || result.Payload == nil || result.Payload.Mode != domain.PayloadModeBase64 {
+		t.Fatalf("expected valid binary payload, got %+v", result)
+	}
+	result.CheckPayload(payload)
+	if !result.Valid {
+		t.Errorf("expected signed payload to match, got %q", result.Reason)
+	}
+	result.CheckPayload(domain.NewBinaryPayload([]byte{0x00}))
+	if result.Valid {
+		t.Errorf("expected other payload to be rejected")
+	}
+}
+
+func TestSignPayload_TextWithReservedPrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		version domain.SignedDataVersion
+		wantErr bool
+	}{
+		{"legacy v0 rejects it", domain.SignedDataV0, true},
+		{"v1 records mode", domain.SignedDataV1, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmEd25519, SignedDataVersion: tc.version}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+			payload := domain.NewTextPayload("base64:AA==")
+			signedData, signature, err := domain.SignPayload(device, payload)
+			if tc.wantErr {
+				if !errors.Is(err, domain.ErrInvalidPayload) {
+					t.Fatalf("expected ErrInvalidPayload, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+
+			result := domain.VerifySignedData(device, signedData, signature, "")
+			if !result.Valid || result.Payload == nil || result.Payload.Mode != domain.PayloadModeText || result.Payload.Text != payload.Text {
+				t.Fatalf("expected valid text payload, got %+v", result.Payload)
+			}
+
+			record := &domain.SignatureRecord{
+				ID:                "sig-1",
+				DeviceID:          device.ID,
+				SignedData:        signedData,
+				Signature:         signature,
+				SignatureEncoding: device.SigningEncoding(),
+				PayloadMode:       domain.PayloadModeText,
+				SignedDataVersion: device.SignedDataVersion,
+			}
+			device.IncrementCounter(signature)
+			if report := domain.VerifyChain(device, []*domain.SignatureRecord{record}); !report.Valid {
+				t.Fatalf("expected valid chain, got %+v", report.Issues)
+			}
+			// record can't claim other mode than signed data
+			record.PayloadMode = domain.PayloadModeBase64
+			if report := domain.VerifyChain(device, []*domain.SignatureRecord{record}); report.Valid {
+				t.Fatalf("expected mode mismatch to be reported")
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+//go:build cgo
+
+package domain_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// softHSMModules are common install locations of SoftHSMv2 module
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib/aarch64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+// softHSMBackend initializes fresh SoftHSMv2 token in temporary directory and
+// registers PKCS#11 backend for it. Test is skipped when SoftHSM is missing,
+// SOFTHSM2_MODULE overrides module path.
+func softHSMBackend(t *testing.T) {
+	t.Helper()
+	if _, err := crypto.LookupKeyBackend(crypto.KeyBackendPKCS11); err == nil {
+		return
+	}
+
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		for _, path := range softHSMModules {
+			if _, err := os.Stat(path); err == nil {
+				module = path
+				break
+			}
+		}
+	}
+	util, err := exec.LookPath("softhsm2-util")
+	if module == "" || err != nil {
+		t.Skip("SoftHSMv2 is not installed")
+	}
+
+	// token directory outlives single test, backend stays registered for
+	// whole test binary
+	dir, err := os.MkdirTemp("", "softhsm")
+	if err != nil {
+		t.Fatalf("create token dir: %v", err)
+	}
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+dir+"\nobjectstore.backend = file\n"), 0o600); err != nil {
+		t.Fatalf("write softhsm config: %v", err)
+	}
+	os.Setenv("SOFTHSM2_CONF", conf)
+
+	out, err := exec.Command(util, "--init-token", "--free", "--label", "signing-test", "--pin", "1234", "--so-pin", "5678").CombinedOutput()
+	if err != nil {
+		t.Fatalf("init token: %v: %s", err, out)
+	}
+
+	backend, err := crypto.NewPKCS11Backend(crypto.PKCS11Config{ModulePath: module, TokenLabel: "signing-test", PIN: "1234"})
+	if err != nil {
+		t.Fatalf("open token: %v", err)
+	}
+	if err := crypto.RegisterKeyBackend(backend); err != nil {
+		t.Fatalf("register backend: %v", err)
+	}
+}
+
+func TestPKCS11Backend_SignAndRotate(t *testing.T) {
+	softHSMBackend(t)
+
+	tests := map[string]struct {
+		algorithm domain.AlgorithmType
+		params    crypto.KeyParams
+		padding   crypto.RSAPadding
+		encoding  crypto.SignatureEncoding
+	}{
+		"rsa pkcs1v15":  {algorithm: domain.AlgorithmRSA, params: crypto.KeyParams{KeySize: 2048, Hash: crypto.HashSHA256}},
+		"rsa pss":       {algorithm: domain.AlgorithmRSA, params: crypto.KeyParams{KeySize: 2048, Hash: crypto.HashSHA384}, padding: crypto.PaddingPSS},
+		"ecc p256 der":  {algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Curve: crypto.CurveP256}},
+		"ecc p384 1363": {algorithm: domain.AlgorithmECC, params: crypto.KeyParams{Curve: crypto.CurveP384}, encoding: crypto.EncodingP1363},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "hsm-" + name, Algorithm: tc.algorithm, KeyBackend: crypto.KeyBackendPKCS11}
+			if err := device.ConfigureKeyParams(tc.params, crypto.DefaultKeyPolicy); err != nil {
+				t.Fatalf("configure params: %v", err)
+			}
+			if tc.padding != "" {
+				if err := device.ConfigurePadding(tc.padding, 0); err != nil {
+					t.Fatalf("configure padding: %v", err)
+				}
+			}
+			if err := device.ConfigureSignatureEncoding(tc.encoding); err != nil {
+				t.Fatalf("configure encoding: %v", err)
+			}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+			if len(device.PrivateKey) != 0 || device.KeyLabel == "" {
+				t.Fatalf("device must keep only key label, got label %q", device.KeyLabel)
+			}
+
+			// token signatures verify with software verifier
+			records := withVersion(buildChain(t, device, 2), 0)
+			records = append(records, rotate(t, device))
+			records = append(records, withVersion(buildChain(t, device, 1), 1)...)
+			if device.KeyLabel != device.ID+"-v1" {
+				t.Fatalf("rotated key should get new label, got %q", device.KeyLabel)
+			}
+
+			if report := domain.VerifyChain(device, records); !report.Valid {
+				t.Fatalf("expected valid chain, got %+v", report.Issues)
+			}
+			result := domain.VerifySignedData(device, records[0].SignedData, records[0].Signature, "")
+			if !result.Valid || result.SigningKeyVersion != 0 {
+				t.Fatalf("expected signature of retired token key to verify, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestPKCS11Backend_RejectsImport(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "hsm-import", KeyBackend: crypto.KeyBackendPKCS11}
+	if err := device.ImportKeys([]byte(encryptedP256Key), []byte("secret"), crypto.KeyParams{}, crypto.DefaultKeyPolicy); err == nil {
+		t.Fatalf("expected import into token backend to fail")
+	}
+}
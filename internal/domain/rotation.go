@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// RecordKind distinguishes signature records written by service itself from
+// signed transactions
+type RecordKind string
+
+// RecordKindKeyRotation marks record in which outgoing key endorses its successor
+const RecordKindKeyRotation RecordKind = "KEY_ROTATION"
+
+// RetiredKey is public key replaced by key rotation
+type RetiredKey struct {
+	Version   int       `json:"version"`
+	PublicKey []byte    `json:"public_key"`
+	RetiredAt time.Time `json:"retired_at"`
+	// LegacyDigest marks RSA key of device created before hash became
+	// configurable, it signed bare SHA-256 digests without DigestInfo
+	LegacyDigest bool `json:"legacy_digest,omitempty"`
+}
+
+// PublicKeyVersion returns public key of given key pair version
+func (d *SignatureDevice) PublicKeyVersion(version int) ([]byte, error) {
+	key, err := d.keyVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	return key.PublicKey, nil
+}
+
+// keyVersion returns current or retired key of given key pair version
+func (d *SignatureDevice) keyVersion(version int) (RetiredKey, error) {
+	if version == d.SigningKeyVersion {
+		return d.currentKey(), nil
+	}
+	for _, k := range d.KeyHistory {
+		if k.Version == version {
+			return k, nil
+		}
+	}
+	return RetiredKey{}, fmt.Errorf("device has no key version %d", version)
+}
+
+// currentKey returns device current key in the form of retired keys
+func (d *SignatureDevice) currentKey() RetiredKey {
+	return RetiredKey{Version: d.SigningKeyVersion, PublicKey: d.PublicKey}
+}
+
+// keyOptions returns options of signatures made with given device key, legacy
+// RSA key retired by rotation keeps signatures without DigestInfo
+func (d *SignatureDevice) keyOptions(key RetiredKey, encoding crypto.SignatureEncoding) crypto.SignatureOptions {
+	opts := d.signatureOptions(encoding)
+	if key.LegacyDigest {
+		opts.Hash = ""
+	}
+	return opts
+}
+
+// rotationStatement is data signed by outgoing key, it binds next key version
+// to fingerprint of its public key
+func rotationStatement(version int, publicKey []byte) (string, error) {
+	fingerprint, err := crypto.Fingerprint(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d:%s", RecordKindKeyRotation, version, fingerprint), nil
+}
+
+// parseRotationStatement extracts endorsed key version and fingerprint from
+// signed data of rotation record
+func parseRotationStatement(signedData string) (int, string, error) {
+	statement, err := signedStatement(signedData)
+	if err != nil {
+		return 0, "", errors.New("malformed rotation record")
+	}
+	fields := strings.Split(statement, ":")
+	if len(fields) != 3 || fields[0] != string(RecordKindKeyRotation) {
+		return 0, "", errors.New("malformed rotation statement")
+	}
+	version, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, "", errors.New("malformed rotation key version")
+	}
+	return version, fields[2], nil
+}
+
+// RotateKey replaces device key pair with freshly generated one using the
+// same key parameters. Outgoing key signs rotation statement naming the new
+// key, returned signed data and signature have to be stored as chain record
+// of RecordKindKeyRotation kind signed with previous key version. Legacy RSA
+// device without hash moves to SHA-256 with DigestInfo for the new key.
+func RotateKey(device *SignatureDevice) (signedData string, signature string, err error) {
+	if !device.Active() {
+		return "", "", ErrDeviceDeactivated
+	}
+	nextVersion := device.SigningKeyVersion + 1
+	next := *device
+	next.SigningKeyVersion = nextVersion
+	legacyDigest := device.Algorithm == AlgorithmRSA && device.Hash == ""
+	if legacyDigest {
+		next.Hash = crypto.HashSHA256
+	}
+	if err := next.GenerateKeys(); err != nil {
+		return "", "", err
+	}
+
+	statement, err := rotationStatement(nextVersion, next.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	signedData, signature, err = SignData(device, statement)
+	if err != nil {
+		return "", "", err
+	}
+
+	device.KeyHistory = append(slices.Clone(device.KeyHistory), RetiredKey{
+		Version:      device.SigningKeyVersion,
+		PublicKey:    device.PublicKey,
+		RetiredAt:    time.Now(),
+		LegacyDigest: legacyDigest,
+	})
+	device.Hash = next.Hash
+	device.PublicKey = next.PublicKey
+	device.PrivateKey = next.PrivateKey
+	device.KeyLabel = next.KeyLabel
+	// certificate of retired key must not be handed out for the new one
+	device.CertificateChain = nil
+	device.SigningKeyVersion = nextVersion
+
+	return signedData, signature, nil
+}
@@ -0,0 +1,195 @@
+package domain_test
+
+import (
+	stdcrypto "crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// rotate rotates device key and returns rotation record as handlers store it
+func rotate(t *testing.T, device *domain.SignatureDevice) *domain.SignatureRecord {
+	t.Helper()
+	previous := device.SigningKeyVersion
+	signedData, signature, err := domain.RotateKey(device)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	record := &domain.SignatureRecord{
+		ID:         "rotation",
+		DeviceID:   device.ID,
+		Counter:    device.SignatureCounter,
+		SignedData: signedData,
+		Signature:  signature,
+		CreatedAt:  time.Now(),
+
+		SignatureEncoding: device.SigningEncoding(),
+		Kind:              domain.RecordKindKeyRotation,
+		SigningKeyVersion: previous,
+	}
+	device.IncrementCounter(signature)
+	return record
+}
+
+// withVersion stamps records with key version which signed them
+func withVersion(records []*domain.SignatureRecord, version int) []*domain.SignatureRecord {
+	for _, r := range records {
+		r.SigningKeyVersion = version
+	}
+	return records
+}
+
+func TestRotateKey_ChainContinuity(t *testing.T) {
+	for _, alg := range []domain.AlgorithmType{domain.AlgorithmRSA, domain.AlgorithmECC, domain.AlgorithmEd25519} {
+		t.Run(string(alg), func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "dev-1", Algorithm: alg}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+			oldPublic := device.PublicKey
+
+			records := withVersion(buildChain(t, device, 2), 0)
+			records = append(records, rotate(t, device))
+			after := buildChain(t, device, 2)
+			records = append(records, withVersion(after, 1)...)
+
+			if device.SigningKeyVersion != 1 || len(device.KeyHistory) != 1 {
+				t.Fatalf("expected version 1 with one retired key, got %d/%d", device.SigningKeyVersion, len(device.KeyHistory))
+			}
+			if string(device.KeyHistory[0].PublicKey) != string(oldPublic) {
+				t.Fatalf("retired key should be previous public key")
+			}
+
+			report := domain.VerifyChain(device, records)
+			if !report.Valid {
+				t.Fatalf("expected valid chain, got %+v", report.Issues)
+			}
+
+			// signatures made before rotation stay verifiable
+			result := domain.VerifySignedData(device, records[0].SignedData, records[0].Signature, "")
+			if !result.Valid || result.SigningKeyVersion != 0 {
+				t.Fatalf("expected old signature to verify with version 0, got %+v", result)
+			}
+			result = domain.VerifySignedData(device, records[3].SignedData, records[3].Signature, "")
+			if !result.Valid || result.SigningKeyVersion != 1 {
+				t.Fatalf("expected new signature to verify with version 1, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestRotateKey_LegacyRSAMovesToSHA256(t *testing.T) {
+	// device created before hash became configurable has no hash stored
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmRSA}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	if jwk, err := device.JWK(); err != nil || jwk.Alg != "" {
+		t.Fatalf("expected legacy RSA key without JWS algorithm, got %q (%v)", jwk.Alg, err)
+	}
+
+	records := withVersion(buildChain(t, device, 2), 0)
+	records = append(records, rotate(t, device))
+	records = append(records, withVersion(buildChain(t, device, 2), 1)...)
+
+	if device.Hash != crypto.HashSHA256 || !device.KeyHistory[0].LegacyDigest {
+		t.Fatalf("expected SHA-256 for new key and legacy digest for retired one, got %q/%v", device.Hash, device.KeyHistory[0].LegacyDigest)
+	}
+	if report := domain.VerifyChain(device, records); !report.Valid {
+		t.Fatalf("expected valid chain, got %+v", report.Issues)
+	}
+	for _, i := range []int{0, 2} {
+		if result := domain.VerifySignedData(device, records[i].SignedData, records[i].Signature, ""); !result.Valid || result.SigningKeyVersion != 0 {
+			t.Errorf("expected legacy signature %d to verify with version 0, got %+v", i, result)
+		}
+	}
+
+	// new key makes standard PKCS#1 v1.5 signatures with DigestInfo
+	pub, err := device.ParsePublicKey()
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(records[3].Signature)
+	if err != nil {
+		t.Fatalf("decode signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(records[3].SignedData))
+	if err := rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), stdcrypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("expected RS256 signature of new key: %v", err)
+	}
+	if jwk, err := device.JWK(); err != nil || jwk.Alg != "RS256" {
+		t.Errorf("expected RS256 JWK of new key, got %q (%v)", jwk.Alg, err)
+	}
+}
+
+func TestRotateKey_BrokenContinuity(t *testing.T) {
+	tests := []struct {
+		name           string
+		tamper         func(records []*domain.SignatureRecord)
+		wantFirstBreak uint64
+	}{
+		{
+			name: "record after rotation claims old key",
+			tamper: func(r []*domain.SignatureRecord) {
+				r[2].SigningKeyVersion = 0
+			},
+			wantFirstBreak: 2,
+		},
+		{
+			name: "rotation record not marked",
+			tamper: func(r []*domain.SignatureRecord) {
+				r[1].Kind = ""
+			},
+			wantFirstBreak: 2,
+		},
+		{
+			name: "rotation endorses other key",
+			tamper: func(r []*domain.SignatureRecord) {
+				r[1].SigningKeyVersion = 1
+			},
+			wantFirstBreak: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+			records := withVersion(buildChain(t, device, 1), 0)
+			records = append(records, rotate(t, device))
+			records = append(records, withVersion(buildChain(t, device, 2), 1)...)
+
+			tc.tamper(records)
+			report := domain.VerifyChain(device, records)
+			if report.Valid {
+				t.Fatalf("expected invalid chain")
+			}
+			if report.FirstBrokenLink.Counter != tc.wantFirstBreak {
+				t.Errorf("expected first break at %d, got %+v", tc.wantFirstBreak, report.FirstBrokenLink)
+			}
+		})
+	}
+}
+
+func TestRotateKey_DeactivatedDevice(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC, Status: domain.DeviceStatusDeactivated}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	publicKey := device.PublicKey
+
+	if _, _, err := domain.RotateKey(device); !errors.Is(err, domain.ErrDeviceDeactivated) {
+		t.Fatalf("expected deactivated error, got %v", err)
+	}
+	if device.SigningKeyVersion != 0 || string(device.PublicKey) != string(publicKey) {
+		t.Fatalf("deactivated device key must stay unchanged")
+	}
+}
@@ -1,26 +1,92 @@
 package domain
 
 import (
-	"encoding/base64"
 	"fmt"
 	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
 )
 
 // SignatureRecord represents single signature generated by device
 type SignatureRecord struct {
 	ID         string    `json:"id"`
 	DeviceID   string    `json:"device_id"`
+	Counter    uint64    `json:"counter"`
 	SignedData string    `json:"signed_data"`
 	Signature  string    `json:"signature"`
 	CreatedAt  time.Time `json:"created_at"`
+
+	// SignatureEncoding is empty for ECC signatures created before encodings were recorded
+	SignatureEncoding crypto.SignatureEncoding `json:"signature_encoding,omitempty"`
+	// Kind is empty for signed transactions, records written by service itself carry their kind
+	Kind RecordKind `json:"kind,omitempty"`
+	// SigningKeyVersion is version of device key pair which produced signature
+	SigningKeyVersion int `json:"signing_key_version"`
+	// PayloadMode is set for signed transactions, empty for records written
+	// before modes were introduced, which carry text
+	PayloadMode PayloadMode `json:"payload_mode,omitempty"`
+	// SignedDataVersion is format of SignedData
+	SignedDataVersion SignedDataVersion `json:"signed_data_version"`
+	// TimeStampToken is RFC 3161 token over signature, empty when record was
+	// signed without time-stamping
+	TimeStampToken []byte `json:"timestamp_token,omitempty"`
+}
+
+// PrepareSignedData creates signed string in device signed data version,
+// <counter>_<data>_<last_signature> for legacy v0 devices and canonical JSON
+// envelope stamped with current time for v1
+func PrepareSignedData(device *SignatureDevice, data string) (string, error) {
+	return prepareSignedData(device, data, "")
+}
+
+// prepareSignedData creates signed string, payload mode is recorded in v1
+// envelope only
+func prepareSignedData(device *SignatureDevice, data string, mode PayloadMode) (string, error) {
+	switch device.SignedDataVersion {
+	case SignedDataV0:
+		return fmt.Sprintf("%d_%s_%s", device.SignatureCounter, data, previousLinkReference(device)), nil
+	case SignedDataV1:
+		return encodeEnvelopeV1(SignedDataEnvelope{
+			Counter:   device.SignatureCounter,
+			Data:      data,
+			DeviceID:  device.ID,
+			Mode:      mode,
+			Prev:      previousLinkReference(device),
+			Timestamp: time.Now(),
+		})
+	default:
+		return "", fmt.Errorf("unsupported signed data version %d", device.SignedDataVersion)
+	}
 }
 
-// PrepareSignedData creates signed string <counter>_<data>_<last_signature>
-func PrepareSignedData(device *SignatureDevice, data string) string {
-	lastSignature := device.LastSignature
+// previousLinkReference returns value chained into next signature, base64 of
+// device ID for the first signature and last signature afterwards
+func previousLinkReference(device *SignatureDevice) string {
 	if device.SignatureCounter == 0 {
-		// base64(device.id) return if first signature
-		lastSignature = base64.StdEncoding.EncodeToString([]byte(device.ID))
+		return firstLinkReference(device)
+	}
+	return device.LastSignature
+}
+
+// signedPayload reads transaction payload back from signed data. Mode
+// recorded in v1 envelope is used, v0 and service statements are detected
+// from their prefix.
+func signedPayload(signedData string) (Payload, error) {
+	envelope, err := ParseSignedData(signedData)
+	if err != nil {
+		return Payload{}, err
+	}
+	if envelope.Mode != "" {
+		return ParsePayload(envelope.Mode, envelope.Data)
+	}
+	return detectPayload(envelope.Data), nil
+}
+
+// signedStatement extracts data signed between chain fields
+func signedStatement(signedData string) (string, error) {
+	envelope, err := ParseSignedData(signedData)
+	if err != nil {
+		return "", err
 	}
-	return fmt.Sprintf("%d_%s_%s", device.SignatureCounter, data, lastSignature)
+	return envelope.Data, nil
 }
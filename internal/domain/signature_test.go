@@ -2,7 +2,10 @@ package domain_test
 
 import (
 	"encoding/base64"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
 )
@@ -72,10 +75,106 @@ func TestPrepareSignedData(t *testing.T) {
 	for _, tc := range tests {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			got := domain.PrepareSignedData(&tc.device, tc.data)
+			got, err := domain.PrepareSignedData(&tc.device, tc.data)
+			if err != nil {
+				t.Fatalf("PrepareSignedData() error: %v", err)
+			}
 			if got != tc.want {
 				t.Fatalf("PrepareSignedData() = %q, want %q", got, tc.want)
 			}
 		})
 	}
 }
+
+func TestPrepareSignedData_V1(t *testing.T) {
+	device := &domain.SignatureDevice{
+		ID:                "dev123",
+		SignatureCounter:  5,
+		LastSignature:     "prevSigB64",
+		SignedDataVersion: domain.SignedDataV1,
+	}
+	// data containing separators of legacy format and JSON syntax
+	data := `a_b_c","prev":"x" <&>`
+
+	before := time.Now()
+	signedData, err := domain.PrepareSignedData(device, data)
+	if err != nil {
+		t.Fatalf("PrepareSignedData() error: %v", err)
+	}
+	want := `{"counter":5,"data":"a_b_c\",\"prev\":\"x\" <&>","device_id":"dev123","prev":"prevSigB64","timestamp":"`
+	if !strings.HasPrefix(signedData, want) || !strings.HasSuffix(signedData, `Z","v":1}`) {
+		t.Fatalf("unexpected envelope %s", signedData)
+	}
+
+	envelope, err := domain.ParseSignedData(signedData)
+	if err != nil {
+		t.Fatalf("ParseSignedData() error: %v", err)
+	}
+	if envelope.Version != domain.SignedDataV1 || envelope.Counter != 5 || envelope.Data != data ||
+		envelope.Prev != "prevSigB64" || envelope.DeviceID != "dev123" {
+		t.Errorf("unexpected envelope fields %+v", envelope)
+	}
+	if envelope.Timestamp.Before(before.Add(-time.Second)) || envelope.Timestamp.After(time.Now().Add(time.Second)) {
+		t.Errorf("unexpected envelope timestamp %v", envelope.Timestamp)
+	}
+}
+
+func TestPrepareSignedData_UnsupportedVersion(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "dev123", SignedDataVersion: 7}
+	if _, err := domain.PrepareSignedData(device, "payload"); err == nil {
+		t.Fatalf("expected error for unsupported version")
+	}
+}
+
+func TestParseSignedData(t *testing.T) {
+	tests := []struct {
+		name       string
+		signedData string
+		want       domain.SignedDataEnvelope
+		wantErr    bool
+	}{
+		{
+			name:       "legacy data with underscores",
+			signedData: "5_a_b_c_prevSigB64",
+			want:       domain.SignedDataEnvelope{Version: domain.SignedDataV0, Counter: 5, Data: "a_b_c", Prev: "prevSigB64"},
+		},
+		{
+			name:       "legacy empty data",
+			signedData: "0__ZGV2MTIz",
+			want:       domain.SignedDataEnvelope{Version: domain.SignedDataV0, Counter: 0, Data: "", Prev: "ZGV2MTIz"},
+		},
+		{
+			name:       "v1 envelope",
+			signedData: `{"counter":1,"data":"x","device_id":"dev123","prev":"abc==","timestamp":"2026-01-02T03:04:05.5Z","v":1}`,
+			want: domain.SignedDataEnvelope{
+				Version: domain.SignedDataV1, Counter: 1, Data: "x", Prev: "abc==", DeviceID: "dev123",
+				Timestamp: time.Date(2026, 1, 2, 3, 4, 5, 500000000, time.UTC),
+			},
+		},
+		{name: "legacy without previous signature", signedData: "5_payload", wantErr: true},
+		{name: "legacy with invalid counter", signedData: "x_payload_abc", wantErr: true},
+		{name: "v1 with whitespace", signedData: `{"counter":1, "data":"x","device_id":"dev123","prev":"abc==","timestamp":"2026-01-02T03:04:05Z","v":1}`, wantErr: true},
+		{name: "v1 with reordered keys", signedData: `{"data":"x","counter":1,"device_id":"dev123","prev":"abc==","timestamp":"2026-01-02T03:04:05Z","v":1}`, wantErr: true},
+		{name: "v1 with unknown field", signedData: `{"counter":1,"data":"x","device_id":"dev123","extra":1,"prev":"abc==","timestamp":"2026-01-02T03:04:05Z","v":1}`, wantErr: true},
+		{name: "v1 with non UTC timestamp", signedData: `{"counter":1,"data":"x","device_id":"dev123","prev":"abc==","timestamp":"2026-01-02T05:04:05+02:00","v":1}`, wantErr: true},
+		{name: "unknown version", signedData: `{"counter":1,"data":"x","device_id":"dev123","prev":"abc==","timestamp":"2026-01-02T03:04:05Z","v":2}`, wantErr: true},
+		{name: "v1 with trailing data", signedData: `{"counter":1,"data":"x","device_id":"dev123","prev":"abc==","timestamp":"2026-01-02T03:04:05Z","v":1}{}`, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := domain.ParseSignedData(tc.signedData)
+			if tc.wantErr {
+				if !errors.Is(err, domain.ErrMalformedSignedData) {
+					t.Fatalf("expected ErrMalformedSignedData, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -2,24 +2,41 @@ package domain
 
 import (
 	"encoding/base64"
-	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
 )
 
 // SignData business logic for signing data
 func SignData(device *SignatureDevice, data string) (signedData string, signature string, err error) {
-	signedData = PrepareSignedData(device, data)
+	return signStatement(device, data, "")
+}
+
+// SignPayload signs transaction payload. V1 envelope records payload mode, so
+// text is read back as text whatever it starts with. Legacy v0 signed data
+// has no room for mode, text starting with binary or digest prefix is
+// rejected there as it would be read back as other mode.
+func SignPayload(device *SignatureDevice, payload Payload) (signedData string, signature string, err error) {
+	if device.SignedDataVersion == SignedDataV0 && payload.Mode == PayloadModeText &&
+		(strings.HasPrefix(payload.Text, base64PayloadPrefix) || strings.HasPrefix(payload.Text, digestPayloadPrefix)) {
+		return "", "", fmt.Errorf("%w: text data of legacy v0 device can't start with %q or %q, send it as data_base64",
+			ErrInvalidPayload, base64PayloadPrefix, digestPayloadPrefix)
+	}
+	return signStatement(device, payload.Statement(), payload.Mode)
+}
 
-	var s crypto.Signer
-	switch device.Algorithm {
-	case AlgorithmRSA:
-		s, err = crypto.NewRSASigner(device.PrivateKey)
-	case AlgorithmECC:
-		s, err = crypto.NewECCSigner(device.PrivateKey)
-	default:
-		return "", "", errors.New("unsupported algorithm")
+// signStatement signs statement with device current key
+func signStatement(device *SignatureDevice, data string, mode PayloadMode) (signedData string, signature string, err error) {
+	if !device.Active() {
+		return "", "", ErrDeviceDeactivated
 	}
+	signedData, err = prepareSignedData(device, data, mode)
+	if err != nil {
+		return "", "", err
+	}
+
+	s, err := device.signer(device.signatureOptions(device.SigningEncoding()))
 	if err != nil {
 		return "", "", err
 	}
@@ -34,3 +51,41 @@ func SignData(device *SignatureDevice, data string) (signedData string, signatur
 
 	return signedData, signature, nil
 }
+
+// VerifySignature checks base64 encoded signature of signed data against device public key.
+// Empty encoding means signature was stored before encodings were recorded.
+func VerifySignature(device *SignatureDevice, signedData string, signature string, encoding crypto.SignatureEncoding) error {
+	return verifyWithKey(device, device.currentKey(), signedData, signature, encoding)
+}
+
+// verifyRecord checks record signature against key version which produced it
+func verifyRecord(device *SignatureDevice, rec *SignatureRecord) error {
+	key, err := device.keyVersion(rec.SigningKeyVersion)
+	if err != nil {
+		return err
+	}
+	return verifyWithKey(device, key, rec.SignedData, rec.Signature, rec.SignatureEncoding)
+}
+
+// verifyWithKey checks signature with given device key, device only provides
+// algorithm and signature options
+func verifyWithKey(device *SignatureDevice, key RetiredKey, signedData string, signature string, encoding crypto.SignatureEncoding) error {
+	sigBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+
+	alg, err := device.algorithm()
+	if err != nil {
+		return err
+	}
+	if encoding == "" {
+		encoding = alg.LegacyEncoding
+	}
+	v, err := alg.NewVerifier(key.PublicKey, device.keyOptions(key, encoding))
+	if err != nil {
+		return err
+	}
+
+	return v.Verify([]byte(signedData), sigBytes)
+}
@@ -1,6 +1,7 @@
 package domain_test
 
 import (
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
@@ -39,13 +40,26 @@ func TestSignData_Table(t *testing.T) {
 		t.Fatalf("ecc encode: %v", err)
 	}
 
+	// ed25519
+	edGen := crypto.Ed25519Generator{}
+	edMar := crypto.NewEd25519Marshaler()
+	edKP, err := edGen.Generate()
+	if err != nil {
+		t.Fatalf("ed25519 generate: %v", err)
+	}
+	_, edPrivPEM, err := edMar.Encode(*edKP)
+	if err != nil {
+		t.Fatalf("ed25519 encode: %v", err)
+	}
+
 	tests := []struct {
-		name      string
-		device    domain.SignatureDevice
-		data      string
-		wantData  string
-		wantErr   bool
-		verifyRSA bool
+		name          string
+		device        domain.SignatureDevice
+		data          string
+		wantData      string
+		wantErr       bool
+		verifyRSA     bool
+		verifyEd25519 bool
 	}{
 		{
 			name: "RSA success - first signature uses base64(device.id)",
@@ -89,6 +103,20 @@ func TestSignData_Table(t *testing.T) {
 			wantErr:   false,
 			verifyRSA: false,
 		},
+		{
+			name: "Ed25519 success - first signature",
+			device: domain.SignatureDevice{
+				ID:               deviceID,
+				Algorithm:        domain.AlgorithmEd25519,
+				PrivateKey:       edPrivPEM,
+				SignatureCounter: 0,
+				LastSignature:    "",
+			},
+			data:          "invoice",
+			wantData:      fmt.Sprintf("0_%s_%s", "invoice", idB64),
+			wantErr:       false,
+			verifyEd25519: true,
+		},
 		{
 			name: "unsupported algorithm",
 			device: domain.SignatureDevice{
@@ -133,6 +161,16 @@ func TestSignData_Table(t *testing.T) {
 					t.Fatalf("rsa verify failed: %v", verr)
 				}
 			}
+
+			if tc.verifyEd25519 {
+				rawSig, decErr := base64.StdEncoding.DecodeString(signature)
+				if decErr != nil {
+					t.Fatalf("decode signature: %v", decErr)
+				}
+				if !ed25519.Verify(edKP.Public, []byte(signedData), rawSig) {
+					t.Fatalf("ed25519 verify failed")
+				}
+			}
 		})
 	}
 }
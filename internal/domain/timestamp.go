@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// TimestampHash is hash of signature value sent to time-stamping authority
+const TimestampHash = stdcrypto.SHA256
+
+// ErrTimestampUnavailable is returned when signature can't be time-stamped
+var ErrTimestampUnavailable = errors.New("time-stamping authority unavailable")
+
+// SignatureImprint returns digest of signature value covered by its RFC 3161
+// time-stamp token, signature is hashed as raw bytes, not base64
+func SignatureImprint(signature string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("signature isn't valid base64: %w", err)
+	}
+	h := TimestampHash.New()
+	h.Write(raw)
+	return h.Sum(nil), nil
+}
+
+// TimestampSignature obtains time-stamp token over signature value
+func TimestampSignature(ctx context.Context, ts crypto.Timestamper, signature string) ([]byte, error) {
+	imprint, err := SignatureImprint(signature)
+	if err != nil {
+		return nil, err
+	}
+	token, err := ts.Timestamp(ctx, imprint, TimestampHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTimestampUnavailable, err)
+	}
+	return token, nil
+}
+
+// TimestampVerification is a verdict of checking time-stamp token of signature
+type TimestampVerification struct {
+	// Token is DER encoded RFC 3161 TimeStampToken
+	Token        []byte    `json:"token"`
+	Valid        bool      `json:"valid"`
+	GenTime      time.Time `json:"gen_time,omitzero"`
+	SerialNumber string    `json:"serial_number,omitempty"`
+	Policy       string    `json:"policy,omitempty"`
+	// TSA is subject of certificate which signed token
+	TSA    string `json:"tsa,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// VerifyTimestamp checks that token covers signature and is issued by TSA
+// chaining to roots. Without roots token content is reported, but it can't be
+// trusted, so it's not valid.
+func VerifyTimestamp(signature string, token []byte, roots *x509.CertPool) TimestampVerification {
+	result := TimestampVerification{Token: token}
+	info, err := crypto.ParseTimeStampToken(token)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	result.describe(info)
+
+	imprint, err := SignatureImprint(signature)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	if roots == nil {
+		result.Reason = "no trusted TSA roots configured"
+		return result
+	}
+	if info, err = crypto.VerifyTimeStampToken(token, imprint, roots); err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	result.TSA = info.TSA.Subject.String()
+	result.Valid = true
+	return result
+}
+
+// describe copies token content into verdict
+func (v *TimestampVerification) describe(info *crypto.TimeStampInfo) {
+	v.GenTime = info.GenTime
+	v.Policy = info.Policy.String()
+	if info.SerialNumber != nil {
+		v.SerialNumber = info.SerialNumber.Text(16)
+	}
+}
+
+// RecordTimestamp is time-stamp verdict of single chain record
+type RecordTimestamp struct {
+	Counter     uint64 `json:"counter"`
+	SignatureID string `json:"signature_id"`
+	TimestampVerification
+}
+
+// AddTimestamps verifies time-stamp tokens of records and reports invalid
+// ones as chain issues. Records without token are skipped, they were signed
+// while time-stamping was off. When roots are nil tokens are only described.
+func (r *ChainReport) AddTimestamps(records []*SignatureRecord, roots *x509.CertPool) {
+	for _, rec := range records {
+		if len(rec.TimeStampToken) == 0 {
+			continue
+		}
+		verdict := VerifyTimestamp(rec.Signature, rec.TimeStampToken, roots)
+		r.Timestamps = append(r.Timestamps, RecordTimestamp{Counter: rec.Counter, SignatureID: rec.ID, TimestampVerification: verdict})
+		if !verdict.Valid && roots != nil {
+			r.Issues = append(r.Issues, ChainIssue{Counter: rec.Counter, SignatureID: rec.ID, Reason: "invalid time-stamp token: " + verdict.Reason})
+		}
+	}
+	sort.SliceStable(r.Timestamps, func(i, j int) bool { return r.Timestamps[i].Counter < r.Timestamps[j].Counter })
+	sort.SliceStable(r.Issues, func(i, j int) bool { return r.Issues[i].Counter < r.Issues[j].Counter })
+	r.conclude()
+}
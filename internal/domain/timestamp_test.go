@@ -0,0 +1,153 @@
+package domain_test
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// newTSA creates embedded time-stamping authority in temporary directory,
+// path of its root certificate is returned as well
+func newTSA(t *testing.T, name string) (*crypto.TimeStampAuthority, string) {
+	t.Helper()
+	material, err := crypto.GenerateTimeStampAuthority(name, time.Hour)
+	if err != nil {
+		t.Fatalf("generate TSA: %v", err)
+	}
+	dir := t.TempDir()
+	rootFile, certFile, keyFile := filepath.Join(dir, "tsa-root.pem"), filepath.Join(dir, "tsa.pem"), filepath.Join(dir, "tsa-key.pem")
+	if err := os.WriteFile(rootFile, material.RootCert, 0o644); err != nil {
+		t.Fatalf("write root: %v", err)
+	}
+	if err := os.WriteFile(certFile, material.Chain, 0o644); err != nil {
+		t.Fatalf("write chain: %v", err)
+	}
+	if err := os.WriteFile(keyFile, material.Key, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	tsa, err := crypto.LoadTimeStampAuthority(certFile, keyFile, "1.3.6.1.4.1.99999.1")
+	if err != nil {
+		t.Fatalf("load TSA: %v", err)
+	}
+	return tsa, rootFile
+}
+
+// failingTimestamper stands for unreachable TSA
+type failingTimestamper struct{}
+
+func (failingTimestamper) Timestamp(context.Context, []byte, stdcrypto.Hash) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestTimestampSignature(t *testing.T) {
+	tsa, _ := newTSA(t, "Test")
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	records := buildChain(t, device, 2)
+
+	token, err := domain.TimestampSignature(context.Background(), tsa, records[0].Signature)
+	if err != nil {
+		t.Fatalf("timestamp: %v", err)
+	}
+
+	verdict := domain.VerifyTimestamp(records[0].Signature, token, tsa.Roots())
+	if !verdict.Valid || verdict.Policy != "1.3.6.1.4.1.99999.1" || verdict.TSA != "CN=Test TSA" || verdict.SerialNumber == "" {
+		t.Fatalf("expected valid verdict describing token, got %+v", verdict)
+	}
+	if time.Since(verdict.GenTime) > time.Minute {
+		t.Errorf("unexpected token time %v", verdict.GenTime)
+	}
+
+	if verdict := domain.VerifyTimestamp(records[1].Signature, token, tsa.Roots()); verdict.Valid {
+		t.Errorf("token mustn't cover other signature")
+	}
+	other, _ := newTSA(t, "Other")
+	if verdict := domain.VerifyTimestamp(records[0].Signature, token, other.Roots()); verdict.Valid {
+		t.Errorf("token mustn't be trusted under other root")
+	}
+	verdict = domain.VerifyTimestamp(records[0].Signature, token, nil)
+	if verdict.Valid || verdict.GenTime.IsZero() || verdict.Reason == "" {
+		t.Errorf("token without roots has to be described, but not valid, got %+v", verdict)
+	}
+
+	if _, err := domain.TimestampSignature(context.Background(), failingTimestamper{}, records[0].Signature); !errors.Is(err, domain.ErrTimestampUnavailable) {
+		t.Errorf("expected ErrTimestampUnavailable, got %v", err)
+	}
+}
+
+func TestTimestampSignature_OpenSSLInterop(t *testing.T) {
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl is not installed")
+	}
+	tsa, rootFile := newTSA(t, "Test")
+	signature := base64.StdEncoding.EncodeToString([]byte("signature"))
+	token, err := domain.TimestampSignature(context.Background(), tsa, signature)
+	if err != nil {
+		t.Fatalf("timestamp: %v", err)
+	}
+	imprint, err := domain.SignatureImprint(signature)
+	if err != nil {
+		t.Fatalf("imprint: %v", err)
+	}
+
+	tokenFile := filepath.Join(t.TempDir(), "token.der")
+	if err := os.WriteFile(tokenFile, token, 0o644); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	out, err := exec.Command(openssl, "ts", "-verify", "-token_in", "-in", tokenFile,
+		"-digest", hex.EncodeToString(imprint), "-CAfile", rootFile).CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "Verification: OK") {
+		t.Fatalf("openssl rejected token: %v\n%s", err, out)
+	}
+}
+
+func TestChainReport_AddTimestamps(t *testing.T) {
+	tsa, _ := newTSA(t, "Test")
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	records := buildChain(t, device, 4)
+	for _, rec := range records[1:] {
+		token, err := domain.TimestampSignature(context.Background(), tsa, rec.Signature)
+		if err != nil {
+			t.Fatalf("timestamp: %v", err)
+		}
+		rec.TimeStampToken = token
+	}
+
+	report := domain.VerifyChain(device, records)
+	report.AddTimestamps(records, tsa.Roots())
+	if !report.Valid || len(report.Timestamps) != 3 || report.Timestamps[0].Counter != 1 {
+		t.Fatalf("expected valid report with 3 timestamps, got %+v", report)
+	}
+
+	// token of other record doesn't cover signature
+	records[2].TimeStampToken = records[3].TimeStampToken
+	report = domain.VerifyChain(device, records)
+	report.AddTimestamps(records, tsa.Roots())
+	if report.Valid || report.FirstBrokenLink == nil || report.FirstBrokenLink.Counter != 2 {
+		t.Fatalf("expected broken link at 2, got %+v", report)
+	}
+
+	// without roots tokens are described only
+	report = domain.VerifyChain(device, records)
+	report.AddTimestamps(records, nil)
+	if !report.Valid || len(report.Timestamps) != 3 {
+		t.Fatalf("expected valid report without trusted roots, got %+v", report)
+	}
+}
@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"slices"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// VerificationResult is a verdict of checking signature against device key
+type VerificationResult struct {
+	Valid             bool                     `json:"valid"`
+	DeviceID          string                   `json:"device_id"`
+	Algorithm         AlgorithmType            `json:"algorithm"`
+	SignatureEncoding crypto.SignatureEncoding `json:"signature_encoding,omitempty"`
+	KeyFingerprint    string                   `json:"key_fingerprint"`
+	SigningKeyVersion int                      `json:"signing_key_version"`
+	Reason            string                   `json:"reason,omitempty"`
+	// SignedData is set when it's carried by verified message, e.g. COSE_Sign1
+	SignedData string `json:"signed_data,omitempty"`
+	// Payload is transaction payload read from verified signed data
+	Payload *Payload `json:"payload,omitempty"`
+	// Timestamp is verdict of time-stamp token over signature, when known
+	Timestamp *TimestampVerification `json:"timestamp,omitempty"`
+}
+
+// setPayload describes payload of verified signed data, statements of
+// service records are reported as text
+func (r *VerificationResult) setPayload(signedData string) {
+	payload, err := signedPayload(signedData)
+	if err != nil {
+		return
+	}
+	r.Payload = &payload
+}
+
+// CheckPayload marks valid result invalid when verified signed data doesn't
+// stand for content presented by caller
+func (r *VerificationResult) CheckPayload(content Payload) {
+	if !r.Valid {
+		return
+	}
+	if r.Payload == nil || !r.Payload.Covers(content) {
+		r.Valid = false
+		r.Reason = "signed data doesn't carry given payload"
+	}
+}
+
+// candidateEncodings returns encodings tried when caller doesn't know how
+// signature was serialized, device's current encoding goes first
+func candidateEncodings(device *SignatureDevice) []crypto.SignatureEncoding {
+	alg, err := device.algorithm()
+	if err != nil || len(alg.Encodings) == 0 {
+		return []crypto.SignatureEncoding{""}
+	}
+	candidates := []crypto.SignatureEncoding{device.SigningEncoding()}
+	for _, enc := range append(slices.Clone(alg.Encodings), alg.LegacyEncoding) {
+		if enc != "" && !slices.Contains(candidates, enc) {
+			candidates = append(candidates, enc)
+		}
+	}
+	return candidates
+}
+
+// VerifySignedData checks signature of signed data using device public key
+// and describes which key, algorithm and encoding were used. When encoding is
+// empty all encodings supported by device algorithm are tried. Keys retired by
+// rotation are tried after current key, newest first.
+func VerifySignedData(device *SignatureDevice, signedData string, signature string, encoding crypto.SignatureEncoding) VerificationResult {
+	result := VerificationResult{
+		DeviceID:          device.ID,
+		Algorithm:         device.Algorithm,
+		SigningKeyVersion: device.SigningKeyVersion,
+	}
+
+	fingerprint, err := crypto.Fingerprint(device.PublicKey)
+	if err != nil {
+		result.Reason = "device public key is invalid: " + err.Error()
+		return result
+	}
+	result.KeyFingerprint = fingerprint
+
+	candidates := []crypto.SignatureEncoding{encoding}
+	if encoding == "" {
+		candidates = candidateEncodings(device)
+	}
+
+	keys := []RetiredKey{device.currentKey()}
+	for i := len(device.KeyHistory) - 1; i >= 0; i-- {
+		keys = append(keys, device.KeyHistory[i])
+	}
+
+	var currentKeyErr error
+	for _, key := range keys {
+		for _, enc := range candidates {
+			err = verifyWithKey(device, key, signedData, signature, enc)
+			if err == nil {
+				result.Valid = true
+				result.SignatureEncoding = enc
+				result.SigningKeyVersion = key.Version
+				if key.Version != device.SigningKeyVersion {
+					result.KeyFingerprint, _ = crypto.Fingerprint(key.PublicKey)
+				}
+				result.setPayload(signedData)
+				return result
+			}
+			if key.Version == device.SigningKeyVersion {
+				currentKeyErr = err
+			}
+		}
+	}
+
+	// reason reported for current key, it's the one caller most likely expects
+	result.Reason = currentKeyErr.Error()
+	return result
+}
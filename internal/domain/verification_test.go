@@ -0,0 +1,192 @@
+package domain_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// legacySign produces unpadded r||s signature, same as first version of ECCSigner
+func legacySign(t *testing.T, device *domain.SignatureDevice, signedData string) string {
+	t.Helper()
+	m := crypto.NewECCMarshaler()
+	kp, err := m.Decode(device.PrivateKey)
+	if err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	hash := sha256.Sum256([]byte(signedData))
+	r, s, err := ecdsa.Sign(rand.Reader, kp.Private, hash[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(append(r.Bytes(), s.Bytes()...))
+}
+
+func TestVerifySignedData(t *testing.T) {
+	tests := []struct {
+		name         string
+		algorithm    domain.AlgorithmType
+		deviceEnc    crypto.SignatureEncoding
+		verifyEnc    crypto.SignatureEncoding
+		tamper       func(t *testing.T, device *domain.SignatureDevice, signedData, signature string) (string, string)
+		wantValid    bool
+		wantEncoding crypto.SignatureEncoding
+	}{
+		{
+			name:      "RSA valid signature",
+			algorithm: domain.AlgorithmRSA,
+			wantValid: true,
+		},
+		{
+			name:         "ECC valid DER signature",
+			algorithm:    domain.AlgorithmECC,
+			wantValid:    true,
+			wantEncoding: crypto.EncodingASN1DER,
+		},
+		{
+			name:         "ECC valid P1363 signature",
+			algorithm:    domain.AlgorithmECC,
+			deviceEnc:    crypto.EncodingP1363,
+			wantValid:    true,
+			wantEncoding: crypto.EncodingP1363,
+		},
+		{
+			name:      "ECC P1363 signature verified as DER",
+			algorithm: domain.AlgorithmECC,
+			deviceEnc: crypto.EncodingP1363,
+			verifyEnc: crypto.EncodingASN1DER,
+		},
+		{
+			name:      "ECC legacy signature is detected",
+			algorithm: domain.AlgorithmECC,
+			tamper: func(t *testing.T, d *domain.SignatureDevice, signedData, _ string) (string, string) {
+				return signedData, legacySign(t, d, signedData)
+			},
+			// full width legacy signature is indistinguishable from P1363
+			wantValid: true,
+		},
+		{
+			name:      "Ed25519 valid signature",
+			algorithm: domain.AlgorithmEd25519,
+			wantValid: true,
+		},
+		{
+			name:      "Ed25519 modified data",
+			algorithm: domain.AlgorithmEd25519,
+			tamper: func(_ *testing.T, _ *domain.SignatureDevice, signedData, signature string) (string, string) {
+				return signedData + "x", signature
+			},
+		},
+		{
+			name:      "RSA modified data",
+			algorithm: domain.AlgorithmRSA,
+			tamper: func(_ *testing.T, _ *domain.SignatureDevice, signedData, signature string) (string, string) {
+				return signedData + "x", signature
+			},
+		},
+		{
+			name:      "ECC modified data",
+			algorithm: domain.AlgorithmECC,
+			tamper: func(_ *testing.T, _ *domain.SignatureDevice, signedData, signature string) (string, string) {
+				return signedData + "x", signature
+			},
+		},
+		{
+			name:      "signature not base64",
+			algorithm: domain.AlgorithmECC,
+			tamper: func(_ *testing.T, _ *domain.SignatureDevice, signedData, _ string) (string, string) {
+				return signedData, "%%%"
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			device := &domain.SignatureDevice{ID: "dev-1", Algorithm: tc.algorithm}
+			if err := device.ConfigureSignatureEncoding(tc.deviceEnc); err != nil {
+				t.Fatalf("configure encoding: %v", err)
+			}
+			if err := device.GenerateKeys(); err != nil {
+				t.Fatalf("generate keys: %v", err)
+			}
+			signedData, signature, err := domain.SignData(device, "payload")
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			if tc.tamper != nil {
+				signedData, signature = tc.tamper(t, device, signedData, signature)
+			}
+
+			result := domain.VerifySignedData(device, signedData, signature, tc.verifyEnc)
+
+			if result.Valid != tc.wantValid {
+				t.Fatalf("expected valid=%v, got %v (%s)", tc.wantValid, result.Valid, result.Reason)
+			}
+			if tc.wantEncoding != "" && result.SignatureEncoding != tc.wantEncoding {
+				t.Errorf("expected encoding %q, got %q", tc.wantEncoding, result.SignatureEncoding)
+			}
+			if result.DeviceID != device.ID || result.Algorithm != tc.algorithm {
+				t.Errorf("expected verdict to describe device key, got %+v", result)
+			}
+			if result.KeyFingerprint == "" {
+				t.Errorf("expected key fingerprint to be set")
+			}
+		})
+	}
+}
+
+func TestSignData_P1363IsFixedWidth(t *testing.T) {
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.ConfigureSignatureEncoding(crypto.EncodingP1363); err != nil {
+		t.Fatalf("configure encoding: %v", err)
+	}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+
+	// P-384 components are 48 bytes each
+	for i := 0; i < 20; i++ {
+		_, signature, err := domain.SignData(device, "payload")
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		raw, _ := base64.StdEncoding.DecodeString(signature)
+		if len(raw) != 96 {
+			t.Fatalf("expected 96 byte signature, got %d", len(raw))
+		}
+	}
+}
+
+func TestSignatureDevice_ConfigureSignatureEncoding(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm domain.AlgorithmType
+		encoding  crypto.SignatureEncoding
+		want      crypto.SignatureEncoding
+		wantErr   bool
+	}{
+		{name: "ECC defaults to DER", algorithm: domain.AlgorithmECC, want: crypto.EncodingASN1DER},
+		{name: "ECC P1363", algorithm: domain.AlgorithmECC, encoding: crypto.EncodingP1363, want: crypto.EncodingP1363},
+		{name: "ECC legacy can't be selected", algorithm: domain.AlgorithmECC, encoding: crypto.EncodingLegacyRaw, wantErr: true},
+		{name: "RSA without encoding", algorithm: domain.AlgorithmRSA},
+		{name: "RSA rejects encoding", algorithm: domain.AlgorithmRSA, encoding: crypto.EncodingP1363, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			device := &domain.SignatureDevice{Algorithm: tc.algorithm}
+			err := device.ConfigureSignatureEncoding(tc.encoding)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("expected error=%v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && device.SignatureEncoding != tc.want {
+				t.Errorf("expected encoding %q, got %q", tc.want, device.SignatureEncoding)
+			}
+		})
+	}
+}
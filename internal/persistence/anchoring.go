@@ -0,0 +1,132 @@
+package persistence
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+)
+
+// AnchorResult summarises one anchoring run
+type AnchorResult struct {
+	Anchored int
+	Skipped  int
+}
+
+// AnchorChains signs new Merkle tree head for every device whose chain grew
+// since its latest tree head. Devices without new signatures are skipped.
+func AnchorChains(
+	ctx context.Context,
+	devices DeviceRepository,
+	signatures SignatureRepository,
+	heads TreeHeadRepository,
+	key stdcrypto.Signer,
+	now time.Time,
+) (AnchorResult, error) {
+	var result AnchorResult
+
+	list, err := devices.List(ctx)
+	if err != nil {
+		return result, err
+	}
+	for _, d := range list {
+		records, err := signatures.ListByDevice(ctx, d.ID)
+		if err != nil {
+			return result, fmt.Errorf("failed to list signatures of device %s: %w", d.ID, err)
+		}
+		anchored, err := heads.ListByDevice(ctx, d.ID)
+		if err != nil {
+			return result, fmt.Errorf("failed to list tree heads of device %s: %w", d.ID, err)
+		}
+		if len(records) == 0 || (len(anchored) > 0 && anchored[len(anchored)-1].TreeSize >= uint64(len(records))) {
+			result.Skipped++
+			continue
+		}
+
+		head, err := domain.BuildTreeHead(d.ID, records, now)
+		if err != nil {
+			return result, fmt.Errorf("failed to build tree head of device %s: %w", d.ID, err)
+		}
+		head.ID = uuid.NewString()
+		if err := domain.SignTreeHead(head, key); err != nil {
+			return result, fmt.Errorf("failed to sign tree head of device %s: %w", d.ID, err)
+		}
+		if err := heads.Create(ctx, head); err != nil {
+			return result, fmt.Errorf("failed to store tree head of device %s: %w", d.ID, err)
+		}
+		result.Anchored++
+	}
+	return result, nil
+}
+
+// LogResult summarises one run of signature log sequencing
+type LogResult struct {
+	Appended int
+	TreeSize uint64
+}
+
+// SequenceLog appends signatures of all devices which are not logged yet to
+// signature log and signs tree head of log when it grew since the latest one.
+// The first run signs tree head also for empty log, so monitors have a start.
+func SequenceLog(
+	ctx context.Context,
+	devices DeviceRepository,
+	signatures SignatureRepository,
+	log LogRepository,
+	key stdcrypto.Signer,
+	now time.Time,
+) (LogResult, error) {
+	var result LogResult
+
+	entries, err := log.List(ctx)
+	if err != nil {
+		return result, err
+	}
+	list, err := devices.List(ctx)
+	if err != nil {
+		return result, err
+	}
+	var records []*domain.SignatureRecord
+	for _, d := range list {
+		deviceRecords, err := signatures.ListByDevice(ctx, d.ID)
+		if err != nil {
+			return result, fmt.Errorf("failed to list signatures of device %s: %w", d.ID, err)
+		}
+		records = append(records, deviceRecords...)
+	}
+
+	pending, err := domain.SequenceRecords(entries, records)
+	if err != nil {
+		return result, err
+	}
+	if len(pending) > 0 {
+		if err := log.Append(ctx, pending); err != nil {
+			return result, fmt.Errorf("failed to append to signature log: %w", err)
+		}
+		// listed entries may share array with repository, it's never written
+		entries = append(entries[:len(entries):len(entries)], pending...)
+	}
+	result.Appended, result.TreeSize = len(pending), uint64(len(entries))
+
+	latest, err := log.LatestTreeHead(ctx)
+	if err != nil {
+		return result, err
+	}
+	if latest != nil && latest.TreeSize >= uint64(len(entries)) {
+		return result, nil
+	}
+	head, err := domain.BuildSignedTreeHead(entries, now)
+	if err != nil {
+		return result, err
+	}
+	if err := domain.SignLogTreeHead(head, key); err != nil {
+		return result, fmt.Errorf("failed to sign log tree head: %w", err)
+	}
+	if err := log.CreateTreeHead(ctx, head); err != nil {
+		return result, fmt.Errorf("failed to store log tree head: %w", err)
+	}
+	return result, nil
+}
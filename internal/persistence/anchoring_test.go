@@ -0,0 +1,145 @@
+package persistence_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/inmemory"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+func TestAnchorChains(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	keyPEM, _, err := crypto.GenerateServiceKey()
+	if err != nil {
+		t.Fatalf("generate service key: %v", err)
+	}
+	key, err := crypto.ParseCAKey(keyPEM)
+	if err != nil {
+		t.Fatalf("parse service key: %v", err)
+	}
+	device, idle := newDevice(t), newDevice(t)
+	for _, d := range []*domain.SignatureDevice{device, idle} {
+		if err := store.DeviceRepo.Create(ctx, d); err != nil {
+			t.Fatalf("create device: %v", err)
+		}
+	}
+	anchorChains := func() persistence.AnchorResult {
+		result, err := persistence.AnchorChains(ctx, store.DeviceRepo, store.SignatureRepo, store.TreeHeadRepo, key, time.Now())
+		if err != nil {
+			t.Fatalf("anchor: %v", err)
+		}
+		return result
+	}
+	sign := func(n int) {
+		for i := 0; i < n; i++ {
+			if _, err := store.SigningStore.SignAtomically(ctx, device.ID, signOnce); err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+		}
+	}
+
+	sign(3)
+	if result := anchorChains(); result.Anchored != 1 || result.Skipped != 1 {
+		t.Fatalf("expected one anchored and one skipped device, got %+v", result)
+	}
+	// nothing new to anchor
+	if result := anchorChains(); result.Anchored != 0 || result.Skipped != 2 {
+		t.Fatalf("expected both devices skipped, got %+v", result)
+	}
+	sign(2)
+	if result := anchorChains(); result.Anchored != 1 {
+		t.Fatalf("expected grown chain to be anchored, got %+v", result)
+	}
+
+	heads, _ := store.TreeHeadRepo.ListByDevice(ctx, device.ID)
+	if len(heads) != 2 || heads[0].TreeSize != 3 || heads[1].TreeSize != 5 {
+		t.Fatalf("expected tree heads of size 3 and 5, got %d heads", len(heads))
+	}
+	records, _ := store.SignatureRepo.ListByDevice(ctx, device.ID)
+	for _, rec := range records {
+		proof, err := domain.NewInclusionProof(rec.ID, records, heads)
+		if err != nil {
+			t.Fatalf("proof of %d: %v", rec.Counter, err)
+		}
+		if err := domain.VerifyInclusionProof(proof, key.Public()); err != nil {
+			t.Fatalf("verify proof of %d: %v", rec.Counter, err)
+		}
+	}
+}
+
+func TestSequenceLog(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	keyPEM, _, err := crypto.GenerateServiceKey()
+	if err != nil {
+		t.Fatalf("generate service key: %v", err)
+	}
+	key, err := crypto.ParseCAKey(keyPEM)
+	if err != nil {
+		t.Fatalf("parse service key: %v", err)
+	}
+	devices := []*domain.SignatureDevice{newDevice(t), newDevice(t)}
+	for _, d := range devices {
+		if err := store.DeviceRepo.Create(ctx, d); err != nil {
+			t.Fatalf("create device: %v", err)
+		}
+	}
+	sequence := func() (persistence.LogResult, *domain.SignedTreeHead) {
+		result, err := persistence.SequenceLog(ctx, store.DeviceRepo, store.SignatureRepo, store.LogRepo, key, time.Now())
+		if err != nil {
+			t.Fatalf("sequence: %v", err)
+		}
+		head, _ := store.LogRepo.LatestTreeHead(ctx)
+		if err := domain.VerifyLogTreeHead(head, key.Public()); err != nil {
+			t.Fatalf("verify tree head: %v", err)
+		}
+		return result, head
+	}
+
+	// empty log gets tree head too
+	if result, head := sequence(); result.Appended != 0 || head.TreeSize != 0 {
+		t.Fatalf("expected signed empty log, got %+v", result)
+	}
+	for _, d := range devices {
+		if _, err := store.SigningStore.SignAtomically(ctx, d.ID, signOnce); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+	}
+	result, older := sequence()
+	if result.Appended != 2 || older.TreeSize != 2 {
+		t.Fatalf("expected both signatures logged, got %+v", result)
+	}
+	if result, head := sequence(); result.Appended != 0 || head != older {
+		t.Fatalf("expected no new tree head, got %+v", result)
+	}
+
+	if _, err := store.SigningStore.SignAtomically(ctx, devices[0].ID, signOnce); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	_, newer := sequence()
+	log, _ := store.LogRepo.List(ctx)
+	proof, err := domain.NewConsistencyProof(log, older.TreeSize, newer.TreeSize)
+	if err != nil {
+		t.Fatalf("proof: %v", err)
+	}
+	if err := domain.VerifyConsistency(older, newer, proof); err != nil {
+		t.Fatalf("expected grown log to be consistent: %v", err)
+	}
+
+	// entry can't be appended at other than the next index
+	if err := store.LogRepo.Append(ctx, []*domain.LogEntry{{Index: 1, SignatureID: "forged"}}); !errors.Is(err, persistence.ErrLogConflict) {
+		t.Fatalf("expected ErrLogConflict, got %v", err)
+	}
+}
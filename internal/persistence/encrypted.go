@@ -0,0 +1,196 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// encryptedDeviceRepo seals device private keys before they reach underlying
+// repository and opens them on the way back, so callers always work with
+// plaintext keys while storage only ever sees ciphertext
+type encryptedDeviceRepo struct {
+	next      DeviceRepository
+	encryptor crypto.KeyEncryptor
+}
+
+// NewEncryptedDeviceRepository wraps device repository with private key encryption
+func NewEncryptedDeviceRepository(next DeviceRepository, encryptor crypto.KeyEncryptor) DeviceRepository {
+	return &encryptedDeviceRepo{next: next, encryptor: encryptor}
+}
+
+func (r *encryptedDeviceRepo) Create(ctx context.Context, d *domain.SignatureDevice) error {
+	sealed, err := sealDevice(r.encryptor, d)
+	if err != nil {
+		return err
+	}
+	return r.next.Create(ctx, sealed)
+}
+
+func (r *encryptedDeviceRepo) GetByID(ctx context.Context, id string) (*domain.SignatureDevice, error) {
+	d, err := r.next.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return openDevice(r.encryptor, d)
+}
+
+func (r *encryptedDeviceRepo) List(ctx context.Context) ([]*domain.SignatureDevice, error) {
+	devices, err := r.next.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opened := make([]*domain.SignatureDevice, 0, len(devices))
+	for _, d := range devices {
+		o, err := openDevice(r.encryptor, d)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, o)
+	}
+	return opened, nil
+}
+
+func (r *encryptedDeviceRepo) Update(ctx context.Context, d *domain.SignatureDevice) error {
+	sealed, err := sealDevice(r.encryptor, d)
+	if err != nil {
+		return err
+	}
+	return r.next.Update(ctx, sealed)
+}
+
+// encryptedSigningStore opens device private key only for duration of SignFunc
+type encryptedSigningStore struct {
+	next      SigningStore
+	encryptor crypto.KeyEncryptor
+}
+
+// NewEncryptedSigningStore wraps signing store with private key encryption
+func NewEncryptedSigningStore(next SigningStore, encryptor crypto.KeyEncryptor) SigningStore {
+	return &encryptedSigningStore{next: next, encryptor: encryptor}
+}
+
+func (s *encryptedSigningStore) SignAtomically(ctx context.Context, deviceID string, fn SignFunc) (*domain.SignatureRecord, error) {
+	return s.next.SignAtomically(ctx, deviceID, func(device *domain.SignatureDevice) (record *domain.SignatureRecord, err error) {
+		err = s.withOpenKey(device, func() error {
+			record, err = fn(device)
+			return err
+		})
+		return record, err
+	})
+}
+
+// SignBatchAtomically opens private key once for whole batch
+func (s *encryptedSigningStore) SignBatchAtomically(ctx context.Context, deviceID string, fn BatchSignFunc) ([]*domain.SignatureRecord, error) {
+	return s.next.SignBatchAtomically(ctx, deviceID, func(device *domain.SignatureDevice) (records []*domain.SignatureRecord, err error) {
+		err = s.withOpenKey(device, func() error {
+			records, err = fn(device)
+			return err
+		})
+		return records, err
+	})
+}
+
+// withOpenKey runs sign with decrypted private key of device and seals key
+// again afterwards
+func (s *encryptedSigningStore) withOpenKey(device *domain.SignatureDevice, sign func() error) error {
+	sealed, version := device.PrivateKey, device.KeyVersion
+	plaintext, err := s.encryptor.Decrypt(sealed, version, []byte(device.ID))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt private key of device %s: %w", device.ID, err)
+	}
+
+	device.PrivateKey = plaintext
+	if err := sign(); err != nil {
+		return err
+	}
+
+	// device is written back by underlying store, it has to carry sealed
+	// key, new one when fn replaced key pair
+	if bytes.Equal(device.PrivateKey, plaintext) {
+		device.PrivateKey, device.KeyVersion = sealed, version
+		return nil
+	}
+	device.PrivateKey, device.KeyVersion, err = s.encryptor.Encrypt(device.PrivateKey, []byte(device.ID))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt private key of device %s: %w", device.ID, err)
+	}
+	return nil
+}
+
+// UpdateCertificate doesn't touch private key, it's passed through
+func (s *encryptedSigningStore) UpdateCertificate(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+	return s.next.UpdateCertificate(ctx, deviceID, keyVersion, chain)
+}
+
+// UpdateStatus doesn't touch private key, it's passed through
+func (s *encryptedSigningStore) UpdateStatus(ctx context.Context, deviceID string, status domain.DeviceStatus) error {
+	return s.next.UpdateStatus(ctx, deviceID, status)
+}
+
+// sealDevice returns copy of device with encrypted private key bound to
+// device ID, devices without private key are passed as they are
+func sealDevice(encryptor crypto.KeyEncryptor, d *domain.SignatureDevice) (*domain.SignatureDevice, error) {
+	sealed := *d
+	if len(d.PrivateKey) == 0 {
+		return &sealed, nil
+	}
+	key, version, err := encryptor.Encrypt(d.PrivateKey, []byte(d.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt private key of device %s: %w", d.ID, err)
+	}
+	sealed.PrivateKey, sealed.KeyVersion = key, version
+	return &sealed, nil
+}
+
+// openDevice returns copy of device with decrypted private key, stored device
+// is never modified as some repositories hand out shared pointers
+func openDevice(encryptor crypto.KeyEncryptor, d *domain.SignatureDevice) (*domain.SignatureDevice, error) {
+	opened := *d
+	key, err := encryptor.Decrypt(d.PrivateKey, d.KeyVersion, []byte(d.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key of device %s: %w", d.ID, err)
+	}
+	opened.PrivateKey = key
+	return &opened, nil
+}
+
+// RewrapResult summarises master key rotation
+type RewrapResult struct {
+	Rewrapped int
+	Skipped   int
+}
+
+// RewrapKeys moves private keys of all devices under current master key.
+// It works on raw (not encrypted) repository, key material is never
+// decrypted beyond data key level. Devices already using current master key
+// and devices without private key are skipped.
+func RewrapKeys(ctx context.Context, repo DeviceRepository, encryptor crypto.KeyEncryptor) (RewrapResult, error) {
+	var result RewrapResult
+
+	devices, err := repo.List(ctx)
+	if err != nil {
+		return result, err
+	}
+	current := encryptor.CurrentVersion()
+	for _, d := range devices {
+		if len(d.PrivateKey) == 0 || d.KeyVersion == current {
+			result.Skipped++
+			continue
+		}
+		key, version, err := encryptor.Rewrap(d.PrivateKey, d.KeyVersion, []byte(d.ID))
+		if err != nil {
+			return result, fmt.Errorf("failed to rewrap private key of device %s: %w", d.ID, err)
+		}
+		updated := *d
+		updated.PrivateKey, updated.KeyVersion = key, version
+		if err := repo.Update(ctx, &updated); err != nil {
+			return result, fmt.Errorf("failed to store private key of device %s: %w", d.ID, err)
+		}
+		result.Rewrapped++
+	}
+	return result, nil
+}
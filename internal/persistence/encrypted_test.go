@@ -0,0 +1,252 @@
+package persistence_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/inmemory"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+func masterKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func newDevice(t *testing.T) *domain.SignatureDevice {
+	t.Helper()
+	device := &domain.SignatureDevice{
+		ID:        uuid.NewString(),
+		UserID:    uuid.NewString(),
+		Algorithm: domain.AlgorithmECC,
+	}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	return device
+}
+
+func signOnce(device *domain.SignatureDevice) (*domain.SignatureRecord, error) {
+	signedData, signature, err := domain.SignData(device, "payload")
+	if err != nil {
+		return nil, err
+	}
+	record := &domain.SignatureRecord{
+		ID:         uuid.NewString(),
+		DeviceID:   device.ID,
+		Counter:    device.SignatureCounter,
+		SignedData: signedData,
+		Signature:  signature,
+		CreatedAt:  time.Now(),
+	}
+	device.IncrementCounter(signature)
+	return record, nil
+}
+
+func TestEncryptedRepository_KeysAreSealedAtRest(t *testing.T) {
+	ctx := context.Background()
+	dbFile := filepath.Join(t.TempDir(), "db.json")
+	store, err := inmemory.NewMemoryStore(dbFile)
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	encryptor, err := crypto.ParseKeyRing("1:"+masterKey(1), "")
+	if err != nil {
+		t.Fatalf("parse key ring: %v", err)
+	}
+	devices := persistence.NewEncryptedDeviceRepository(store.DeviceRepo, encryptor)
+	signing := persistence.NewEncryptedSigningStore(store.SigningStore, encryptor)
+
+	device := newDevice(t)
+	plaintext := device.PrivateKey
+	if err := devices.Create(ctx, device); err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if !bytes.Equal(device.PrivateKey, plaintext) {
+		t.Fatalf("caller's device must keep plaintext key")
+	}
+
+	raw, _ := store.DeviceRepo.GetByID(ctx, device.ID)
+	if raw.KeyVersion != "1" || bytes.Contains(raw.PrivateKey, []byte("PRIVATE KEY")) {
+		t.Fatalf("expected sealed key with version 1, got version %q", raw.KeyVersion)
+	}
+
+	got, err := devices.GetByID(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("get device: %v", err)
+	}
+	if !bytes.Equal(got.PrivateKey, plaintext) {
+		t.Fatalf("expected decrypted private key")
+	}
+
+	if _, err := signing.SignAtomically(ctx, device.ID, signOnce); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	raw, _ = store.DeviceRepo.GetByID(ctx, device.ID)
+	if raw.SignatureCounter != 1 || bytes.Contains(raw.PrivateKey, []byte("PRIVATE KEY")) {
+		t.Fatalf("signing must advance counter and keep key sealed")
+	}
+
+	// key rotation inside signing unit of work stores new key sealed
+	var rotated []byte
+	if _, err := signing.SignAtomically(ctx, device.ID, func(d *domain.SignatureDevice) (*domain.SignatureRecord, error) {
+		rec, err := signOnce(d)
+		if err == nil {
+			_, _, err = domain.RotateKey(d)
+			rotated = d.PrivateKey
+		}
+		return rec, err
+	}); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	raw, _ = store.DeviceRepo.GetByID(ctx, device.ID)
+	if bytes.Contains(raw.PrivateKey, []byte("PRIVATE KEY")) {
+		t.Fatalf("rotated key must be stored sealed")
+	}
+	if got, _ = devices.GetByID(ctx, device.ID); !bytes.Equal(got.PrivateKey, rotated) {
+		t.Fatalf("expected rotated private key")
+	}
+	plaintext = rotated
+
+	// dump file contains only sealed key and survives reload
+	if err := store.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	reloaded, err := inmemory.NewMemoryStore(dbFile)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	got, err = persistence.NewEncryptedDeviceRepository(reloaded.DeviceRepo, encryptor).GetByID(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("get reloaded device: %v", err)
+	}
+	if !bytes.Equal(got.PrivateKey, plaintext) {
+		t.Fatalf("expected private key to survive dump")
+	}
+}
+
+func TestEncryptedRepository_KeyIsBoundToDevice(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	encryptor, _ := crypto.ParseKeyRing("1:"+masterKey(1), "")
+	devices := persistence.NewEncryptedDeviceRepository(store.DeviceRepo, encryptor)
+
+	victim, attacker := newDevice(t), newDevice(t)
+	for _, d := range []*domain.SignatureDevice{victim, attacker} {
+		if err := devices.Create(ctx, d); err != nil {
+			t.Fatalf("create device: %v", err)
+		}
+	}
+
+	// sealed key copied to other device record at rest doesn't open there
+	raw, _ := store.DeviceRepo.GetByID(ctx, victim.ID)
+	swapped, _ := store.DeviceRepo.GetByID(ctx, attacker.ID)
+	moved := *swapped
+	moved.PrivateKey, moved.KeyVersion = raw.PrivateKey, raw.KeyVersion
+	if err := store.DeviceRepo.Update(ctx, &moved); err != nil {
+		t.Fatalf("update device: %v", err)
+	}
+	if _, err := devices.GetByID(ctx, attacker.ID); err == nil {
+		t.Fatalf("expected key sealed for other device to be rejected")
+	}
+
+	// rewrap keeps binding
+	newRing, _ := crypto.ParseKeyRing("1:"+masterKey(1)+"\n2:"+masterKey(2), "")
+	if _, err := persistence.RewrapKeys(ctx, store.DeviceRepo, newRing); err != nil {
+		t.Fatalf("rewrap: %v", err)
+	}
+	repo := persistence.NewEncryptedDeviceRepository(store.DeviceRepo, newRing)
+	if got, err := repo.GetByID(ctx, victim.ID); err != nil || !bytes.Equal(got.PrivateKey, victim.PrivateKey) {
+		t.Fatalf("expected rewrapped key to open for its device, got %v", err)
+	}
+	if _, err := repo.GetByID(ctx, attacker.ID); err == nil {
+		t.Fatalf("expected rewrapped key to stay bound to its device")
+	}
+}
+
+func TestRewrapKeys(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	oldRing, _ := crypto.ParseKeyRing("1:"+masterKey(1), "")
+
+	// one legacy plaintext device and one sealed with old master key
+	legacy := newDevice(t)
+	if err := store.DeviceRepo.Create(ctx, legacy); err != nil {
+		t.Fatalf("create legacy device: %v", err)
+	}
+	sealed := newDevice(t)
+	plaintext := sealed.PrivateKey
+	if err := persistence.NewEncryptedDeviceRepository(store.DeviceRepo, oldRing).Create(ctx, sealed); err != nil {
+		t.Fatalf("create sealed device: %v", err)
+	}
+
+	newRing, err := crypto.ParseKeyRing("1:"+masterKey(1)+"\n2:"+masterKey(2), "")
+	if err != nil {
+		t.Fatalf("parse key ring: %v", err)
+	}
+	result, err := persistence.RewrapKeys(ctx, store.DeviceRepo, newRing)
+	if err != nil {
+		t.Fatalf("rewrap: %v", err)
+	}
+	if result.Rewrapped != 2 || result.Skipped != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// old master key can be dropped after rewrap
+	onlyNew, _ := crypto.ParseKeyRing("2:"+masterKey(2), "")
+	repo := persistence.NewEncryptedDeviceRepository(store.DeviceRepo, onlyNew)
+	got, err := repo.GetByID(ctx, sealed.ID)
+	if err != nil {
+		t.Fatalf("get rewrapped device: %v", err)
+	}
+	if got.KeyVersion != "2" || !bytes.Equal(got.PrivateKey, plaintext) {
+		t.Fatalf("expected key under version 2")
+	}
+	if _, err := repo.GetByID(ctx, legacy.ID); err != nil {
+		t.Fatalf("legacy device should be encrypted: %v", err)
+	}
+
+	result, _ = persistence.RewrapKeys(ctx, store.DeviceRepo, newRing)
+	if result.Rewrapped != 0 || result.Skipped != 2 {
+		t.Fatalf("second run should be no-op, got %+v", result)
+	}
+
+	_, err = persistence.NewEncryptedDeviceRepository(store.DeviceRepo, oldRing).GetByID(ctx, sealed.ID)
+	if !errors.Is(err, crypto.ErrUnknownKeyVersion) {
+		t.Fatalf("expected unknown key version error, got %v", err)
+	}
+}
+
+func TestParseKeyRing_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		spec    string
+		current string
+	}{
+		"missing version": {spec: masterKey(1)},
+		"short key":       {spec: "1:" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		"duplicated":      {spec: "1:" + masterKey(1) + ",1:" + masterKey(2)},
+		"unknown current": {spec: "1:" + masterKey(1), current: "2"},
+		"invalid base64":  {spec: "1:???"},
+		"empty spec":      {spec: ""},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := crypto.ParseKeyRing(tc.spec, tc.current); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package inmemory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+)
+
+type idempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*domain.IdempotencyRecord // scope + key -> record
+}
+
+// NewIdempotencyStore create store of idempotency keys
+func NewIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{records: make(map[string]*domain.IdempotencyRecord)}
+}
+
+// idempotencyID joins scope and key, NUL can't appear in header value
+func idempotencyID(scope, key string) string {
+	return scope + "\x00" + key
+}
+
+// Reserve takes key unless it's held by not expired record, record creation
+// time is the time expiry is checked at
+func (s *idempotencyStore) Reserve(ctx context.Context, rec *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := idempotencyID(rec.Scope, rec.Key)
+	if existing, ok := s.records[id]; ok && !existing.Expired(rec.CreatedAt) {
+		stored := *existing
+		return &stored, persistence.ErrIdempotencyKeyExists
+	}
+	stored := *rec
+	s.records[id] = &stored
+	return nil, nil
+}
+
+// Extend moves expiry of reservation owned by rec
+func (s *idempotencyStore) Extend(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.records[idempotencyID(rec.Scope, rec.Key)]
+	if !ok || !existing.Reserves(rec) {
+		return persistence.ErrIdempotencyReservationLost
+	}
+	// stored records are copied out, replace instead of modifying
+	extended := *existing
+	extended.ExpiresAt = rec.ExpiresAt
+	s.records[idempotencyID(rec.Scope, rec.Key)] = &extended
+	return nil
+}
+
+// Complete stores response of request owning reservation
+func (s *idempotencyStore) Complete(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := idempotencyID(rec.Scope, rec.Key)
+	if existing, ok := s.records[id]; !ok || !existing.Reserves(rec) {
+		return persistence.ErrIdempotencyReservationLost
+	}
+	stored := *rec
+	s.records[id] = &stored
+	return nil
+}
+
+// Release removes reservation owned by rec
+func (s *idempotencyStore) Release(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := idempotencyID(rec.Scope, rec.Key)
+	if existing, ok := s.records[id]; ok && existing.Reserves(rec) {
+		delete(s.records, id)
+	}
+	return nil
+}
+
+// DeleteExpired removes records expired at given time
+func (s *idempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for id, rec := range s.records {
+		if rec.Expired(now) {
+			delete(s.records, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
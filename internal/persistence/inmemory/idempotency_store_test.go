@@ -0,0 +1,95 @@
+package inmemory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/inmemory"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	store := inmemory.NewIdempotencyStore()
+	now := time.Now()
+	reservation := func(at time.Time) *domain.IdempotencyRecord {
+		return &domain.IdempotencyRecord{
+			Scope: "/sign", Key: "key-1", RequestHash: "hash", CreatedAt: at, ExpiresAt: at.Add(time.Minute),
+		}
+	}
+
+	first := reservation(now)
+	if _, err := store.Reserve(ctx, first); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	existing, err := store.Reserve(ctx, reservation(now))
+	if !errors.Is(err, persistence.ErrIdempotencyKeyExists) || existing.Completed() {
+		t.Fatalf("expected key in progress, got %v", err)
+	}
+
+	// released key can be taken again
+	if err := store.Release(ctx, first); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	second := reservation(now.Add(time.Second))
+	if _, err := store.Reserve(ctx, second); err != nil {
+		t.Fatalf("reserve released key: %v", err)
+	}
+	// stale owner can't touch reservation of other request
+	if err := store.Release(ctx, first); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if err := store.Extend(ctx, first); !errors.Is(err, persistence.ErrIdempotencyReservationLost) {
+		t.Fatalf("expected lost reservation on extend, got %v", err)
+	}
+	if _, err := store.Reserve(ctx, reservation(now.Add(2*time.Second))); !errors.Is(err, persistence.ErrIdempotencyKeyExists) {
+		t.Fatalf("expected reservation kept, got %v", err)
+	}
+
+	// extended reservation outlives original lease
+	extended := *second
+	extended.ExpiresAt = now.Add(10 * time.Minute)
+	if err := store.Extend(ctx, &extended); err != nil {
+		t.Fatalf("extend: %v", err)
+	}
+	if _, err := store.Reserve(ctx, reservation(now.Add(5*time.Minute))); !errors.Is(err, persistence.ErrIdempotencyKeyExists) {
+		t.Fatalf("expected extended reservation kept, got %v", err)
+	}
+
+	done := *second
+	done.StatusCode, done.Body, done.ExpiresAt = 201, []byte("{}"), now.Add(time.Hour)
+	if err := store.Complete(ctx, &done); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	// completed key can't be completed again nor released
+	if err := store.Complete(ctx, &done); !errors.Is(err, persistence.ErrIdempotencyReservationLost) {
+		t.Fatalf("expected lost reservation on second complete, got %v", err)
+	}
+	if err := store.Release(ctx, second); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	existing, err = store.Reserve(ctx, reservation(now.Add(30*time.Minute)))
+	if !errors.Is(err, persistence.ErrIdempotencyKeyExists) || existing.StatusCode != 201 {
+		t.Fatalf("expected completed record, got %v", err)
+	}
+	// the same key in other scope is independent
+	if _, err := store.Reserve(ctx, &domain.IdempotencyRecord{Scope: "/other", Key: "key-1", CreatedAt: now, ExpiresAt: now.Add(time.Minute)}); err != nil {
+		t.Fatalf("reserve in other scope: %v", err)
+	}
+
+	// expired key is taken over, its former owner can't complete it
+	takeover := reservation(now.Add(2 * time.Hour))
+	if _, err := store.Reserve(ctx, takeover); err != nil {
+		t.Fatalf("reserve expired key: %v", err)
+	}
+	if err := store.Complete(ctx, &done); !errors.Is(err, persistence.ErrIdempotencyReservationLost) {
+		t.Fatalf("expected lost reservation after takeover, got %v", err)
+	}
+	deleted, err := store.DeleteExpired(ctx, now.Add(3*time.Hour))
+	if err != nil || deleted != 2 {
+		t.Fatalf("expected 2 expired records deleted, got %d: %v", deleted, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
@@ -15,19 +16,37 @@ type MemoryStore struct {
 	UserRepo      *userRepo
 	DeviceRepo    *deviceRepo
 	SignatureRepo *signatureRepo
+	SigningStore  *signingStore
+	TreeHeadRepo  *treeHeadRepo
+	LogRepo       *logRepo
+	// Idempotency keeps responses of retried requests
+	Idempotency *idempotencyStore
 
 	mu     sync.RWMutex
 	dbFile string
 }
 
+// storedDevice is device representation in dump file, domain model hides
+// private key from JSON so it's added here explicitly. Devices go through
+// encrypted repository, so dumped key is sealed when master key is configured,
+// otherwise it's plaintext and dump file is readable by owner only.
+type storedDevice struct {
+	*domain.SignatureDevice
+	PrivateKey []byte `json:"private_key,omitempty"`
+}
+
 // NewMemoryStore create a new inmemory layer, if previous dbfile exist loads data
 func NewMemoryStore(dbFile string) (*MemoryStore, error) {
 	store := &MemoryStore{
 		UserRepo:      NewUserRepo(),
 		DeviceRepo:    NewDeviceRepo(),
 		SignatureRepo: NewSignatureRepo(),
+		TreeHeadRepo:  NewTreeHeadRepo(),
+		LogRepo:       NewLogRepo(),
+		Idempotency:   NewIdempotencyStore(),
 		dbFile:        dbFile,
 	}
+	store.SigningStore = NewSigningStore(store.DeviceRepo, store.SignatureRepo)
 
 	if dbFile != "" {
 		if err := store.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
@@ -45,20 +64,66 @@ func (s *MemoryStore) Save() error {
 
 	dump := struct {
 		Users      map[string]*domain.User              `json:"users"`
-		Devices    map[string]*domain.SignatureDevice   `json:"devices"`
+		Devices    map[string]storedDevice              `json:"devices"`
 		Signatures map[string][]*domain.SignatureRecord `json:"signatures"`
+		TreeHeads  map[string][]*domain.TreeHead        `json:"tree_heads"`
+		Log        []*domain.LogEntry                   `json:"log"`
+		LogHeads   []*domain.SignedTreeHead             `json:"log_tree_heads"`
+		// idempotency keys survive restart, clients retry across it
+		IdempotencyKeys map[string]*domain.IdempotencyRecord `json:"idempotency_keys"`
 	}{
 		Users:      s.UserRepo.userData,
-		Devices:    s.DeviceRepo.deviceData,
+		Devices:    make(map[string]storedDevice, len(s.DeviceRepo.deviceData)),
 		Signatures: s.SignatureRepo.signaturesData,
+		TreeHeads:  s.TreeHeadRepo.headsData,
+		Log:        s.LogRepo.entries,
+		LogHeads:   s.LogRepo.heads,
+
+		IdempotencyKeys: make(map[string]*domain.IdempotencyRecord),
+	}
+
+	s.Idempotency.mu.Lock()
+	for id, rec := range s.Idempotency.records {
+		dump.IdempotencyKeys[id] = rec
+	}
+	s.Idempotency.mu.Unlock()
+
+	s.DeviceRepo.mu.RLock()
+	for id, d := range s.DeviceRepo.deviceData {
+		dump.Devices[id] = storedDevice{SignatureDevice: d, PrivateKey: d.PrivateKey}
 	}
+	s.DeviceRepo.mu.RUnlock()
 
 	data, err := json.MarshalIndent(dump, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(s.dbFile, data, 0644)
+	return writePrivateFile(s.dbFile, data)
+}
+
+// writePrivateFile replaces file with data readable by owner only. Data is
+// written to temporary file renamed over target, so permissions of file
+// created with older, looser mode are tightened as well.
+func writePrivateFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
 }
 
 // Load dumped data into inmemory layer
@@ -73,16 +138,36 @@ func (s *MemoryStore) Load() error {
 
 	var dump struct {
 		Users      map[string]*domain.User              `json:"users"`
-		Devices    map[string]*domain.SignatureDevice   `json:"devices"`
+		Devices    map[string]storedDevice              `json:"devices"`
 		Signatures map[string][]*domain.SignatureRecord `json:"signatures"`
+		TreeHeads  map[string][]*domain.TreeHead        `json:"tree_heads"`
+		Log        []*domain.LogEntry                   `json:"log"`
+		LogHeads   []*domain.SignedTreeHead             `json:"log_tree_heads"`
+
+		IdempotencyKeys map[string]*domain.IdempotencyRecord `json:"idempotency_keys"`
 	}
 	if err := json.Unmarshal(data, &dump); err != nil {
 		return err
 	}
 
 	s.UserRepo.userData = dump.Users
-	s.DeviceRepo.deviceData = dump.Devices
+	s.DeviceRepo.deviceData = make(map[string]*domain.SignatureDevice, len(dump.Devices))
+	for id, d := range dump.Devices {
+		if d.SignatureDevice == nil {
+			continue
+		}
+		d.SignatureDevice.PrivateKey = d.PrivateKey
+		s.DeviceRepo.deviceData[id] = d.SignatureDevice
+	}
 	s.SignatureRepo.signaturesData = dump.Signatures
+	// dumps written before anchoring have no tree heads
+	if dump.TreeHeads != nil {
+		s.TreeHeadRepo.headsData = dump.TreeHeads
+	}
+	s.LogRepo.entries, s.LogRepo.heads = dump.Log, dump.LogHeads
+	if dump.IdempotencyKeys != nil {
+		s.Idempotency.records = dump.IdempotencyKeys
+	}
 
 	return nil
 }
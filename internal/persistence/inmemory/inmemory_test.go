@@ -0,0 +1,57 @@
+package inmemory_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/inmemory"
+)
+
+func TestMemoryStore_DumpIsPrivate(t *testing.T) {
+	ctx := context.Background()
+	dbFile := filepath.Join(t.TempDir(), "db.json")
+	// dump written by older version with world readable mode
+	if err := os.WriteFile(dbFile, []byte(`{}`), 0o644); err != nil {
+		t.Fatalf("write old dump: %v", err)
+	}
+	store, err := inmemory.NewMemoryStore(dbFile)
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+
+	device := &domain.SignatureDevice{ID: uuid.NewString(), Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	if err := store.DeviceRepo.Create(ctx, device); err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	info, err := os.Stat(dbFile)
+	if err != nil {
+		t.Fatalf("stat dump: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Fatalf("expected dump with plaintext key to be owner only, got %v", mode)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dbFile)); len(entries) != 1 {
+		t.Fatalf("expected temporary file to be renamed, got %d files", len(entries))
+	}
+
+	reloaded, err := inmemory.NewMemoryStore(dbFile)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	got, err := reloaded.DeviceRepo.GetByID(ctx, device.ID)
+	if err != nil || !bytes.Equal(got.PrivateKey, device.PrivateKey) {
+		t.Fatalf("expected private key to survive dump, got %v", err)
+	}
+}
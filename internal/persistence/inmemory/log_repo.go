@@ -0,0 +1,60 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+)
+
+type logRepo struct {
+	mu      sync.RWMutex
+	entries []*domain.LogEntry
+	heads   []*domain.SignedTreeHead
+}
+
+func NewLogRepo() *logRepo {
+	return &logRepo{}
+}
+
+func (r *logRepo) Append(ctx context.Context, entries []*domain.LogEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range entries {
+		if e.Index != uint64(len(r.entries)+i) {
+			return persistence.ErrLogConflict
+		}
+	}
+	r.entries = append(r.entries, entries...)
+	return nil
+}
+
+func (r *logRepo) List(ctx context.Context) ([]*domain.LogEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.entries, nil
+}
+
+func (r *logRepo) CreateTreeHead(ctx context.Context, h *domain.SignedTreeHead) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h.TreeSize > uint64(len(r.entries)) {
+		return errors.New("tree head is larger than log")
+	}
+	if len(r.heads) > 0 && r.heads[len(r.heads)-1].TreeSize >= h.TreeSize {
+		return errors.New("tree head must grow log")
+	}
+	r.heads = append(r.heads, h)
+	return nil
+}
+
+func (r *logRepo) LatestTreeHead(ctx context.Context) (*domain.SignedTreeHead, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.heads) == 0 {
+		return nil, nil
+	}
+	return r.heads[len(r.heads)-1], nil
+}
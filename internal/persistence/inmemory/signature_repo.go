@@ -27,8 +27,32 @@ func (r *signatureRepo) Create(ctx context.Context, s *domain.SignatureRecord) e
 	return nil
 }
 
+func (r *signatureRepo) GetByID(ctx context.Context, id string) (*domain.SignatureRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, records := range r.signaturesData {
+		for _, s := range records {
+			if s.ID == id {
+				return s, nil
+			}
+		}
+	}
+	return nil, errors.New("signature not found")
+}
+
 func (r *signatureRepo) ListByDevice(ctx context.Context, deviceID string) ([]*domain.SignatureRecord, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return r.signaturesData[deviceID], nil
 }
+
+func (r *signatureRepo) GetBySignature(ctx context.Context, deviceID, signature string) (*domain.SignatureRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, s := range r.signaturesData[deviceID] {
+		if s.Signature == signature {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
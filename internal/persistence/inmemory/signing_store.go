@@ -0,0 +1,126 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+)
+
+type signingStore struct {
+	mu            sync.Mutex
+	deviceLocks   map[string]*sync.Mutex
+	deviceRepo    *deviceRepo
+	signatureRepo *signatureRepo
+}
+
+// NewSigningStore creates signing unit of work on top of inmemory repositories
+func NewSigningStore(deviceRepo *deviceRepo, signatureRepo *signatureRepo) *signingStore {
+	return &signingStore{
+		deviceLocks:   make(map[string]*sync.Mutex),
+		deviceRepo:    deviceRepo,
+		signatureRepo: signatureRepo,
+	}
+}
+
+// lockFor returns mutex dedicated to single device, so signing on different
+// devices doesn't block each other
+func (s *signingStore) lockFor(deviceID string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.deviceLocks[deviceID]
+	if !ok {
+		l = &sync.Mutex{}
+		s.deviceLocks[deviceID] = l
+	}
+	return l
+}
+
+// SignAtomically holds device lock during whole read-sign-write cycle
+func (s *signingStore) SignAtomically(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+	return persistence.SignOne(ctx, s.SignBatchAtomically, deviceID, fn)
+}
+
+// SignBatchAtomically holds device lock while all records are signed
+func (s *signingStore) SignBatchAtomically(ctx context.Context, deviceID string, fn persistence.BatchSignFunc) ([]*domain.SignatureRecord, error) {
+	lock := s.lockFor(deviceID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	current, err := s.deviceRepo.GetByID(ctx, deviceID)
+	if err != nil {
+		return nil, persistence.ErrDeviceNotFound
+	}
+
+	// work on copy, stored device stays untouched when fn fails
+	device := *current
+	records, err := fn(&device)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.DeviceID != deviceID {
+			return nil, errors.New("signature record doesn't belong to device")
+		}
+	}
+
+	// write signatures and device state under both repository locks so
+	// readers never observe one without the other
+	s.deviceRepo.mu.Lock()
+	defer s.deviceRepo.mu.Unlock()
+	s.signatureRepo.mu.Lock()
+	defer s.signatureRepo.mu.Unlock()
+
+	s.signatureRepo.signaturesData[deviceID] = append(s.signatureRepo.signaturesData[deviceID], records...)
+	s.deviceRepo.deviceData[deviceID] = &device
+
+	return records, nil
+}
+
+// UpdateCertificate holds device lock, so certificate can't be overwritten by
+// device copy of concurrent signing
+func (s *signingStore) UpdateCertificate(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+	lock := s.lockFor(deviceID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.deviceRepo.mu.Lock()
+	defer s.deviceRepo.mu.Unlock()
+	current, ok := s.deviceRepo.deviceData[deviceID]
+	if !ok {
+		return persistence.ErrDeviceNotFound
+	}
+	if current.SigningKeyVersion != keyVersion {
+		return persistence.ErrKeyVersionChanged
+	}
+
+	// stored devices are shared with readers, replace instead of modifying
+	device := *current
+	device.CertificateChain = chain
+	device.UpdatedAt = time.Now()
+	s.deviceRepo.deviceData[deviceID] = &device
+	return nil
+}
+
+// UpdateStatus holds device lock the same way as UpdateCertificate
+func (s *signingStore) UpdateStatus(ctx context.Context, deviceID string, status domain.DeviceStatus) error {
+	lock := s.lockFor(deviceID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.deviceRepo.mu.Lock()
+	defer s.deviceRepo.mu.Unlock()
+	current, ok := s.deviceRepo.deviceData[deviceID]
+	if !ok {
+		return persistence.ErrDeviceNotFound
+	}
+
+	device := *current
+	device.Status = status
+	device.UpdatedAt = time.Now()
+	s.deviceRepo.deviceData[deviceID] = &device
+	return nil
+}
@@ -0,0 +1,265 @@
+package inmemory_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/inmemory"
+)
+
+func signNext(data string) func(device *domain.SignatureDevice) (*domain.SignatureRecord, error) {
+	return func(device *domain.SignatureDevice) (*domain.SignatureRecord, error) {
+		signedData, signature, err := domain.SignData(device, data)
+		if err != nil {
+			return nil, err
+		}
+		record := &domain.SignatureRecord{
+			ID:         uuid.NewString(),
+			DeviceID:   device.ID,
+			Counter:    device.SignatureCounter,
+			SignedData: signedData,
+			Signature:  signature,
+			CreatedAt:  time.Now(),
+		}
+		device.IncrementCounter(signature)
+		return record, nil
+	}
+}
+
+func TestSigningStore_ConcurrentSigningIsGapFree(t *testing.T) {
+	const (
+		workers         = 32
+		signsPerWorker  = 20
+		totalSignatures = workers * signsPerWorker
+	)
+
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+
+	ctx := context.Background()
+	device := &domain.SignatureDevice{
+		ID:        uuid.NewString(),
+		UserID:    uuid.NewString(),
+		Algorithm: domain.AlgorithmECC,
+	}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	if err := store.DeviceRepo.Create(ctx, device); err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, totalSignatures)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < signsPerWorker; i++ {
+				_, err := store.SigningStore.SignAtomically(ctx, device.ID, signNext(fmt.Sprintf("w%d-tx%d", w, i)))
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	stored, err := store.DeviceRepo.GetByID(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("get device: %v", err)
+	}
+	if stored.SignatureCounter != totalSignatures {
+		t.Fatalf("expected counter %d, got %d", totalSignatures, stored.SignatureCounter)
+	}
+
+	records, err := store.SignatureRepo.ListByDevice(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("list signatures: %v", err)
+	}
+	if len(records) != totalSignatures {
+		t.Fatalf("expected %d records, got %d", totalSignatures, len(records))
+	}
+
+	prev := base64.StdEncoding.EncodeToString([]byte(device.ID))
+	for i, rec := range records {
+		if rec.Counter != uint64(i) {
+			t.Fatalf("record %d has counter %d, chain has gap or duplicate", i, rec.Counter)
+		}
+		wantSuffix := "_" + prev
+		if got := rec.SignedData[len(rec.SignedData)-len(wantSuffix):]; got != wantSuffix {
+			t.Fatalf("record %d doesn't reference previous signature", i)
+		}
+		prev = rec.Signature
+	}
+	if stored.LastSignature != prev {
+		t.Fatalf("device last signature doesn't match last record")
+	}
+}
+
+func TestSigningStore_DeviceNotFound(t *testing.T) {
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+
+	_, err = store.SigningStore.SignAtomically(context.Background(), "missing", signNext("x"))
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestSigningStore_FailedSignLeavesDeviceUntouched(t *testing.T) {
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	ctx := context.Background()
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: "FOO", SignatureCounter: 3}
+	if err := store.DeviceRepo.Create(ctx, device); err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+
+	if _, err := store.SigningStore.SignAtomically(ctx, device.ID, signNext("x")); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	stored, _ := store.DeviceRepo.GetByID(ctx, device.ID)
+	if stored.SignatureCounter != 3 {
+		t.Fatalf("expected counter to stay 3, got %d", stored.SignatureCounter)
+	}
+	records, _ := store.SignatureRepo.ListByDevice(ctx, device.ID)
+	if len(records) != 0 {
+		t.Fatalf("expected no records, got %d", len(records))
+	}
+}
+
+func TestSigningStore_BatchIsAllOrNothing(t *testing.T) {
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	ctx := context.Background()
+	device := &domain.SignatureDevice{ID: uuid.NewString(), Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	if err := store.DeviceRepo.Create(ctx, device); err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	signBatch := func(items []string, failAt int) ([]*domain.SignatureRecord, error) {
+		return store.SigningStore.SignBatchAtomically(ctx, device.ID, func(d *domain.SignatureDevice) ([]*domain.SignatureRecord, error) {
+			var records []*domain.SignatureRecord
+			for i, item := range items {
+				if i == failAt {
+					return nil, errors.New("signing failed")
+				}
+				record, err := signNext(item)(d)
+				if err != nil {
+					return nil, err
+				}
+				records = append(records, record)
+			}
+			return records, nil
+		})
+	}
+
+	if _, err := signBatch([]string{"tx-1", "tx-2", "tx-3"}, 2); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	stored, _ := store.DeviceRepo.GetByID(ctx, device.ID)
+	records, _ := store.SignatureRepo.ListByDevice(ctx, device.ID)
+	if stored.SignatureCounter != 0 || len(records) != 0 {
+		t.Fatalf("expected failed batch to store nothing, got counter %d and %d records", stored.SignatureCounter, len(records))
+	}
+
+	batch, err := signBatch([]string{"tx-1", "tx-2", "tx-3"}, -1)
+	if err != nil {
+		t.Fatalf("sign batch: %v", err)
+	}
+	stored, _ = store.DeviceRepo.GetByID(ctx, device.ID)
+	records, _ = store.SignatureRepo.ListByDevice(ctx, device.ID)
+	if stored.SignatureCounter != 3 || len(records) != 3 || stored.LastSignature != batch[2].Signature {
+		t.Fatalf("expected device to move over whole batch, got counter %d and %d records", stored.SignatureCounter, len(records))
+	}
+	for i, rec := range records {
+		if rec.Counter != uint64(i) || rec.ID != batch[i].ID {
+			t.Fatalf("record %d stored out of batch order", i)
+		}
+	}
+}
+
+func TestSigningStore_UpdateCertificate(t *testing.T) {
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	ctx := context.Background()
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC, SigningKeyVersion: 2}
+	if err := store.DeviceRepo.Create(ctx, device); err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+	chain := [][]byte{[]byte("leaf"), []byte("ca")}
+
+	if err := store.SigningStore.UpdateCertificate(ctx, device.ID, 1, chain); !errors.Is(err, persistence.ErrKeyVersionChanged) {
+		t.Fatalf("expected key version error, got %v", err)
+	}
+	if err := store.SigningStore.UpdateCertificate(ctx, "missing", 2, chain); !errors.Is(err, persistence.ErrDeviceNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if err := store.SigningStore.UpdateCertificate(ctx, device.ID, 2, chain); err != nil {
+		t.Fatalf("update certificate: %v", err)
+	}
+
+	stored, _ := store.DeviceRepo.GetByID(ctx, device.ID)
+	if len(stored.CertificateChain) != 2 {
+		t.Fatalf("expected stored chain, got %d certificates", len(stored.CertificateChain))
+	}
+	if device.CertificateChain != nil {
+		t.Fatalf("device handed out before update must not change")
+	}
+}
+
+func TestSigningStore_UpdateStatus(t *testing.T) {
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	ctx := context.Background()
+	device := &domain.SignatureDevice{ID: "dev-1", Algorithm: domain.AlgorithmECC}
+	if err := device.GenerateKeys(); err != nil {
+		t.Fatalf("generate keys: %v", err)
+	}
+	if err := store.DeviceRepo.Create(ctx, device); err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+
+	if err := store.SigningStore.UpdateStatus(ctx, "missing", domain.DeviceStatusDeactivated); !errors.Is(err, persistence.ErrDeviceNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if err := store.SigningStore.UpdateStatus(ctx, device.ID, domain.DeviceStatusDeactivated); err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+
+	if _, err := store.SigningStore.SignAtomically(ctx, device.ID, signNext("tx")); !errors.Is(err, domain.ErrDeviceDeactivated) {
+		t.Fatalf("expected deactivated device to refuse signing, got %v", err)
+	}
+	stored, _ := store.DeviceRepo.GetByID(ctx, device.ID)
+	if stored.Active() || stored.SignatureCounter != 0 {
+		t.Fatalf("expected deactivated device without signatures, got %+v", stored)
+	}
+}
@@ -0,0 +1,38 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+)
+
+type treeHeadRepo struct {
+	mu        sync.RWMutex
+	headsData map[string][]*domain.TreeHead // deviceID -> tree heads ordered by size
+}
+
+func NewTreeHeadRepo() *treeHeadRepo {
+	return &treeHeadRepo{headsData: make(map[string][]*domain.TreeHead)}
+}
+
+func (r *treeHeadRepo) Create(ctx context.Context, h *domain.TreeHead) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h.DeviceID == "" {
+		return errors.New("tree head must have device id")
+	}
+	heads := r.headsData[h.DeviceID]
+	if len(heads) > 0 && heads[len(heads)-1].TreeSize >= h.TreeSize {
+		return errors.New("tree head must grow device tree")
+	}
+	r.headsData[h.DeviceID] = append(heads, h)
+	return nil
+}
+
+func (r *treeHeadRepo) ListByDevice(ctx context.Context, deviceID string) ([]*domain.TreeHead, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.headsData[deviceID], nil
+}
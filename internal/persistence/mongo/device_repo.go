@@ -2,9 +2,11 @@ package mongo
 
 import (
 	"context"
+	"errors"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 const deviceCollectioName = "device"
@@ -15,8 +17,8 @@ type deviceRepo struct {
 }
 
 func NewDeviceRepo(sess *mgo.Session, databaseName string) (*deviceRepo, error) {
-	c := sess.DB(databaseName).C(userCollectioName)
-	key := "device_uuid"
+	c := sess.DB(databaseName).C(deviceCollectioName)
+	key := "id"
 	index := mgo.Index{
 		Key:        []string{key},
 		Unique:     true,
@@ -34,14 +36,51 @@ func NewDeviceRepo(sess *mgo.Session, databaseName string) (*deviceRepo, error)
 }
 
 func (r *deviceRepo) Create(ctx context.Context, d *domain.SignatureDevice) error {
-	panic("implement me")
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	err := sess.DB(r.databaseName).C(deviceCollectioName).Insert(d)
+	if mgo.IsDup(err) {
+		return errors.New("device already exists")
+	}
+	return err
 }
+
 func (r *deviceRepo) GetByID(ctx context.Context, id string) (*domain.SignatureDevice, error) {
-	panic("implement me")
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	var d domain.SignatureDevice
+	err := sess.DB(r.databaseName).C(deviceCollectioName).Find(bson.M{"id": id}).One(&d)
+	if errors.Is(err, mgo.ErrNotFound) {
+		return nil, errors.New("device not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
 }
+
 func (r *deviceRepo) List(ctx context.Context) ([]*domain.SignatureDevice, error) {
-	panic("implement me")
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	var devices []*domain.SignatureDevice
+	if err := sess.DB(r.databaseName).C(deviceCollectioName).Find(nil).Sort("-createdat").All(&devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
 }
+
+// Update replaces whole device document, signing store is used for changes
+// racing with signatures
 func (r *deviceRepo) Update(ctx context.Context, d *domain.SignatureDevice) error {
-	panic("implement me")
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	err := sess.DB(r.databaseName).C(deviceCollectioName).Update(bson.M{"id": d.ID}, d)
+	if errors.Is(err, mgo.ErrNotFound) {
+		return errors.New("device not found")
+	}
+	return err
 }
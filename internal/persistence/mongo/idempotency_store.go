@@ -0,0 +1,119 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const idempotencyCollectioName = "idempotency_key"
+
+type idempotencyStore struct {
+	sess         *mgo.Session
+	databaseName string
+}
+
+// NewIdempotencyStore creates idempotency key store, unique index makes
+// insert fail when key is already held
+func NewIdempotencyStore(sess *mgo.Session, databaseName string) (*idempotencyStore, error) {
+	c := sess.DB(databaseName).C(idempotencyCollectioName)
+	index := mgo.Index{
+		Key:        []string{"scope", "key"},
+		Unique:     true,
+		Background: true,
+	}
+	if err := c.EnsureIndex(index); err != nil {
+		return nil, err
+	}
+	return &idempotencyStore{
+		sess:         sess,
+		databaseName: databaseName,
+	}, nil
+}
+
+// Reserve inserts record, expired record holding the key is replaced only if
+// it's still expired (compare-and-set), so two requests can't both get the key
+func (s *idempotencyStore) Reserve(ctx context.Context, rec *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	sess := s.sess.Copy()
+	defer sess.Close()
+	c := sess.DB(s.databaseName).C(idempotencyCollectioName)
+
+	err := c.Insert(rec)
+	if err == nil {
+		return nil, nil
+	}
+	if !mgo.IsDup(err) {
+		return nil, err
+	}
+
+	err = c.Update(bson.M{"scope": rec.Scope, "key": rec.Key, "expiresat": bson.M{"$lte": rec.CreatedAt}}, rec)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, mgo.ErrNotFound) {
+		return nil, err
+	}
+	var existing domain.IdempotencyRecord
+	if err := c.Find(bson.M{"scope": rec.Scope, "key": rec.Key}).One(&existing); err != nil {
+		return nil, err
+	}
+	return &existing, persistence.ErrIdempotencyKeyExists
+}
+
+// reservation matches in progress reservation owned by rec
+func reservation(rec *domain.IdempotencyRecord) bson.M {
+	return bson.M{"scope": rec.Scope, "key": rec.Key, "requesthash": rec.RequestHash, "createdat": rec.CreatedAt, "statuscode": 0}
+}
+
+// Extend moves expiry of reservation owned by rec
+func (s *idempotencyStore) Extend(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	sess := s.sess.Copy()
+	defer sess.Close()
+
+	err := sess.DB(s.databaseName).C(idempotencyCollectioName).Update(reservation(rec), bson.M{"$set": bson.M{"expiresat": rec.ExpiresAt}})
+	if errors.Is(err, mgo.ErrNotFound) {
+		return persistence.ErrIdempotencyReservationLost
+	}
+	return err
+}
+
+// Complete stores response of request owning reservation
+func (s *idempotencyStore) Complete(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	sess := s.sess.Copy()
+	defer sess.Close()
+
+	err := sess.DB(s.databaseName).C(idempotencyCollectioName).Update(reservation(rec), rec)
+	if errors.Is(err, mgo.ErrNotFound) {
+		return persistence.ErrIdempotencyReservationLost
+	}
+	return err
+}
+
+// Release removes reservation owned by rec
+func (s *idempotencyStore) Release(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	sess := s.sess.Copy()
+	defer sess.Close()
+
+	err := sess.DB(s.databaseName).C(idempotencyCollectioName).Remove(reservation(rec))
+	if errors.Is(err, mgo.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// DeleteExpired removes records expired at given time
+func (s *idempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	sess := s.sess.Copy()
+	defer sess.Close()
+
+	info, err := sess.DB(s.databaseName).C(idempotencyCollectioName).RemoveAll(bson.M{"expiresat": bson.M{"$lte": now}})
+	if err != nil {
+		return 0, err
+	}
+	return info.Removed, nil
+}
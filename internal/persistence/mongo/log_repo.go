@@ -0,0 +1,142 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const logCollectioName = "log"
+const logTreeHeadCollectioName = "log_tree_head"
+
+var errLogTreeHeadNotGrowing = errors.New("tree head must grow log")
+
+type logRepo struct {
+	sess         *mgo.Session
+	databaseName string
+}
+
+func NewLogRepo(sess *mgo.Session, databaseName string) (*logRepo, error) {
+	indexes := []struct {
+		collection string
+		index      mgo.Index
+	}{
+		{logCollectioName, mgo.Index{Key: []string{"index"}, Unique: true, Background: true}},
+		{logCollectioName, mgo.Index{Key: []string{"signatureid"}, Unique: true, Background: true}},
+		{logTreeHeadCollectioName, mgo.Index{Key: []string{"treesize"}, Unique: true, Background: true}},
+	}
+	for _, i := range indexes {
+		if err := sess.DB(databaseName).C(i.collection).EnsureIndex(i.index); err != nil {
+			return nil, err
+		}
+	}
+	return &logRepo{
+		sess:         sess,
+		databaseName: databaseName,
+	}, nil
+}
+
+// Append adds entries to the end of signature log. Log only grows, so entries
+// starting at current log size either follow the last entry or collide on
+// unique index with entries of concurrent appender, which is ErrLogConflict.
+// Entries are inserted in order, failed insert leaves valid prefix of them.
+func (r *logRepo) Append(ctx context.Context, entries []*domain.LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	sess := r.sess.Copy()
+	defer sess.Close()
+	c := sess.DB(r.databaseName).C(logCollectioName)
+
+	size, err := c.Count()
+	if err != nil {
+		return err
+	}
+	docs := make([]interface{}, len(entries))
+	for i, e := range entries {
+		if e.Index != uint64(size+i) {
+			return persistence.ErrLogConflict
+		}
+		docs[i] = e
+	}
+	if err := c.Insert(docs...); err != nil {
+		if mgo.IsDup(err) {
+			return persistence.ErrLogConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// List returns whole signature log
+func (r *logRepo) List(ctx context.Context) ([]*domain.LogEntry, error) {
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	var entries []*domain.LogEntry
+	if err := sess.DB(r.databaseName).C(logCollectioName).Find(nil).Sort("index").All(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// CreateTreeHead stores tree head only when it's not larger than log and grows
+// it. Head is checked again after insert, head stored meanwhile by other
+// writer with larger tree wins and this one is removed, so heads never shrink
+// in insertion order.
+func (r *logRepo) CreateTreeHead(ctx context.Context, h *domain.SignedTreeHead) error {
+	sess := r.sess.Copy()
+	defer sess.Close()
+	heads := sess.DB(r.databaseName).C(logTreeHeadCollectioName)
+
+	size, err := sess.DB(r.databaseName).C(logCollectioName).Count()
+	if err != nil {
+		return err
+	}
+	if h.TreeSize > uint64(size) {
+		return errors.New("tree head is larger than log")
+	}
+	n, err := heads.Find(bson.M{"treesize": bson.M{"$gte": h.TreeSize}}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errLogTreeHeadNotGrowing
+	}
+	if err := heads.Insert(h); err != nil {
+		if mgo.IsDup(err) {
+			return errLogTreeHeadNotGrowing
+		}
+		return err
+	}
+
+	n, err = heads.Find(bson.M{"treesize": bson.M{"$gt": h.TreeSize}}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		_ = heads.Remove(bson.M{"treesize": h.TreeSize})
+		return errLogTreeHeadNotGrowing
+	}
+	return nil
+}
+
+// LatestTreeHead returns the largest signed tree head of signature log
+func (r *logRepo) LatestTreeHead(ctx context.Context) (*domain.SignedTreeHead, error) {
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	var h domain.SignedTreeHead
+	err := sess.DB(r.databaseName).C(logTreeHeadCollectioName).Find(nil).Sort("-treesize").One(&h)
+	if errors.Is(err, mgo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
@@ -27,34 +27,59 @@ func NewStore(dbUri string) (*MongoStore, error) {
 }
 
 func (s *MongoStore) Close() error {
-	return s.Close()
+	s.session.Close()
+	return nil
 }
 
 func NewRepositories(dbUri, databaseName string) (
 	persistence.DeviceRepository,
 	persistence.SignatureRepository,
 	persistence.UserRepository,
+	persistence.SigningStore,
+	persistence.TreeHeadRepository,
+	persistence.LogRepository,
+	persistence.IdempotencyStore,
 	error) {
 
 	store, err := NewStore(dbUri)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 
 	device, err := NewDeviceRepo(store.session, databaseName)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error while creating device repository for mongo driver :%v\n", err)
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("error while creating device repository for mongo driver :%v\n", err)
 	}
 
 	user, err := NewUserRepo(store.session, databaseName)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error while creating user repository for mongo driver :%v\n", err)
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("error while creating user repository for mongo driver :%v\n", err)
 	}
 
 	signature, err := NewSignatureRepo(store.session, databaseName)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("error while creating signature repository for mongo driver :%v\n", err)
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("error while creating signature repository for mongo driver :%v\n", err)
 	}
 
-	return device, signature, user, nil
+	signing, err := NewSigningStore(store.session, databaseName)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("error while creating signing store for mongo driver :%v\n", err)
+	}
+
+	treeHeads, err := NewTreeHeadRepo(store.session, databaseName)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("error while creating tree head repository for mongo driver :%v\n", err)
+	}
+
+	log, err := NewLogRepo(store.session, databaseName)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("error while creating log repository for mongo driver :%v\n", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(store.session, databaseName)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, fmt.Errorf("error while creating idempotency store for mongo driver :%v\n", err)
+	}
+
+	return device, signature, user, signing, treeHeads, log, idempotency, nil
 }
@@ -2,9 +2,11 @@ package mongo
 
 import (
 	"context"
+	"errors"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 const signatureCollectioName = "signature"
@@ -15,8 +17,8 @@ type signatureRepo struct {
 }
 
 func NewSignatureRepo(sess *mgo.Session, databaseName string) (*signatureRepo, error) {
-	c := sess.DB(databaseName).C(userCollectioName)
-	key := "signature_uuid"
+	c := sess.DB(databaseName).C(signatureCollectioName)
+	key := "id"
 	index := mgo.Index{
 		Key:        []string{key},
 		Unique:     true,
@@ -34,9 +36,57 @@ func NewSignatureRepo(sess *mgo.Session, databaseName string) (*signatureRepo, e
 }
 
 func (r *signatureRepo) Create(ctx context.Context, s *domain.SignatureRecord) error {
-	panic("implement me")
+	if s.DeviceID == "" {
+		return errors.New("signature must have device id")
+	}
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	return sess.DB(r.databaseName).C(signatureCollectioName).Insert(s)
 }
 
+func (r *signatureRepo) GetByID(ctx context.Context, id string) (*domain.SignatureRecord, error) {
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	var s domain.SignatureRecord
+	err := sess.DB(r.databaseName).C(signatureCollectioName).Find(bson.M{"id": id}).One(&s)
+	if errors.Is(err, mgo.ErrNotFound) {
+		return nil, errors.New("signature not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListByDevice returns device signature records in chain order
 func (r *signatureRepo) ListByDevice(ctx context.Context, deviceID string) ([]*domain.SignatureRecord, error) {
-	panic("implement me")
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	var records []*domain.SignatureRecord
+	if err := sess.DB(r.databaseName).C(signatureCollectioName).
+		Find(bson.M{"deviceid": deviceID}).Sort("counter", "createdat").All(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// GetBySignature returns device signature record by signature value, records
+// are written by signing store
+func (r *signatureRepo) GetBySignature(ctx context.Context, deviceID, signature string) (*domain.SignatureRecord, error) {
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	var s domain.SignatureRecord
+	err := sess.DB(r.databaseName).C(signatureCollectioName).
+		Find(bson.M{"deviceid": deviceID, "signature": signature}).One(&s)
+	if errors.Is(err, mgo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
 }
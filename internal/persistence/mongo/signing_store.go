@@ -0,0 +1,225 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// maxSignAttempts limits optimistic retries when other writer moved device counter
+const maxSignAttempts = 10
+
+var errSigningConflict = errors.New("device was modified concurrently, signing aborted")
+
+type signingStore struct {
+	sess         *mgo.Session
+	databaseName string
+}
+
+// NewSigningStore creates signing unit of work based on conditional updates
+func NewSigningStore(sess *mgo.Session, databaseName string) (*signingStore, error) {
+	c := sess.DB(databaseName).C(signatureCollectioName)
+	index := mgo.Index{
+		Key:        []string{"deviceid", "counter"},
+		Unique:     true,
+		Background: true,
+	}
+	if err := c.EnsureIndex(index); err != nil {
+		return nil, err
+	}
+	return &signingStore{
+		sess:         sess,
+		databaseName: databaseName,
+	}, nil
+}
+
+// SignAtomically reads device, signs and moves device forward only if its
+// counter is still the one used for signing (compare-and-set). Lost races are
+// retried with fresh device state.
+func (s *signingStore) SignAtomically(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+	return persistence.SignOne(ctx, s.SignBatchAtomically, deviceID, fn)
+}
+
+// SignBatchAtomically inserts records first and then moves device over all of
+// them with single compare-and-set, so device never points to signature which
+// isn't stored. Unique (deviceid, counter) index lets only one writer claim
+// chain position, records of writer which lost the race are removed again.
+func (s *signingStore) SignBatchAtomically(ctx context.Context, deviceID string, fn persistence.BatchSignFunc) ([]*domain.SignatureRecord, error) {
+	sess := s.sess.Copy()
+	defer sess.Close()
+
+	return signBatch(&mgoSigningCollections{
+		devices:    sess.DB(s.databaseName).C(deviceCollectioName),
+		signatures: sess.DB(s.databaseName).C(signatureCollectioName),
+	}, deviceID, fn)
+}
+
+// signingCollections are reads and writes of signing unit of work, tests
+// replace them to inject failures
+type signingCollections interface {
+	// findDevice returns mgo.ErrNotFound when device doesn't exist
+	findDevice(deviceID string) (*domain.SignatureDevice, error)
+	insertSignatures(docs []interface{}) error
+	removeSignatures(ids []string) error
+	// updateDevice replaces device still in prev state, it returns
+	// mgo.ErrNotFound when device was changed meanwhile
+	updateDevice(prev, d *domain.SignatureDevice) error
+	// removeOrphans removes records of chain positions device didn't move
+	// over which were inserted before given time
+	removeOrphans(deviceID string, insertedBefore time.Time) error
+}
+
+func signBatch(c signingCollections, deviceID string, fn persistence.BatchSignFunc) ([]*domain.SignatureRecord, error) {
+	for attempt := 0; attempt < maxSignAttempts; attempt++ {
+		d, err := c.findDevice(deviceID)
+		if err != nil {
+			if errors.Is(err, mgo.ErrNotFound) {
+				return nil, persistence.ErrDeviceNotFound
+			}
+			return nil, err
+		}
+		prev := *d
+
+		records, err := fn(d)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		docs := make([]interface{}, len(records))
+		ids := make([]string, len(records))
+		for i, record := range records {
+			docs[i], ids[i] = signatureDoc{SignatureRecord: *record, InsertedAt: now}, record.ID
+		}
+		if err := c.insertSignatures(docs); err != nil {
+			// records inserted before failed one are removed again
+			if rmErr := c.removeSignatures(ids); rmErr != nil {
+				return nil, errors.Join(err, fmt.Errorf("failed to remove inserted signatures: %w", rmErr))
+			}
+			if !mgo.IsDup(err) {
+				return nil, err
+			}
+			// other writer claimed chain position, try again on top of its
+			// signature once it moves device
+			if err := c.removeOrphans(deviceID, now.Add(-orphanAge)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// whole document is replaced, fn may also rotate device key pair.
+		// updated_at guards against overwriting certificate stored meanwhile.
+		err = c.updateDevice(&prev, d)
+		if err == nil {
+			return records, nil
+		}
+		if rmErr := c.removeSignatures(ids); rmErr != nil {
+			return nil, errors.Join(err, fmt.Errorf("failed to remove inserted signatures: %w", rmErr))
+		}
+		if !errors.Is(err, mgo.ErrNotFound) {
+			return nil, err
+		}
+		// device was changed meanwhile, e.g. its certificate, sign again
+		// with fresh state
+	}
+
+	return nil, errSigningConflict
+}
+
+// orphanAge is age of inserted record not followed by device after which
+// writer which inserted it is considered gone. Device is moved right after
+// insert, so only crashed writer leaves record that long.
+const orphanAge = time.Minute
+
+// signatureDoc is signature record stored with time of insert, which tells
+// records left behind by crashed writer
+type signatureDoc struct {
+	domain.SignatureRecord `bson:",inline"`
+	InsertedAt             time.Time
+}
+
+// mgoSigningCollections are signing reads and writes of mongo collections
+type mgoSigningCollections struct {
+	devices    *mgo.Collection
+	signatures *mgo.Collection
+}
+
+func (c *mgoSigningCollections) findDevice(deviceID string) (*domain.SignatureDevice, error) {
+	var d domain.SignatureDevice
+	if err := c.devices.Find(bson.M{"id": deviceID}).One(&d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (c *mgoSigningCollections) insertSignatures(docs []interface{}) error {
+	return c.signatures.Insert(docs...)
+}
+
+func (c *mgoSigningCollections) removeSignatures(ids []string) error {
+	_, err := c.signatures.RemoveAll(bson.M{"id": bson.M{"$in": ids}})
+	return err
+}
+
+func (c *mgoSigningCollections) updateDevice(prev, d *domain.SignatureDevice) error {
+	return c.devices.Update(bson.M{"id": d.ID, "signaturecounter": prev.SignatureCounter, "updatedat": prev.UpdatedAt}, d)
+}
+
+func (c *mgoSigningCollections) removeOrphans(deviceID string, insertedBefore time.Time) error {
+	var d domain.SignatureDevice
+	if err := c.devices.Find(bson.M{"id": deviceID}).Select(bson.M{"signaturecounter": 1}).One(&d); err != nil {
+		return err
+	}
+	_, err := c.signatures.RemoveAll(bson.M{
+		"deviceid":   deviceID,
+		"counter":    bson.M{"$gte": d.SignatureCounter},
+		"insertedat": bson.M{"$lt": insertedBefore},
+	})
+	return err
+}
+
+// UpdateCertificate sets certificate chain only on given key version, moving
+// updated_at makes concurrent signing retry with fresh document
+func (s *signingStore) UpdateCertificate(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+	sess := s.sess.Copy()
+	defer sess.Close()
+
+	devices := sess.DB(s.databaseName).C(deviceCollectioName)
+	err := devices.Update(
+		bson.M{"id": deviceID, "signingkeyversion": keyVersion},
+		bson.M{"$set": bson.M{"certificatechain": chain, "updatedat": time.Now()}},
+	)
+	if !errors.Is(err, mgo.ErrNotFound) {
+		return err
+	}
+	n, err := devices.Find(bson.M{"id": deviceID}).Count()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return persistence.ErrDeviceNotFound
+	}
+	return persistence.ErrKeyVersionChanged
+}
+
+// UpdateStatus sets device status, moving updated_at makes concurrent signing
+// retry with fresh document and see new status
+func (s *signingStore) UpdateStatus(ctx context.Context, deviceID string, status domain.DeviceStatus) error {
+	sess := s.sess.Copy()
+	defer sess.Close()
+
+	err := sess.DB(s.databaseName).C(deviceCollectioName).Update(
+		bson.M{"id": deviceID},
+		bson.M{"$set": bson.M{"status": status, "updatedat": time.Now()}},
+	)
+	if errors.Is(err, mgo.ErrNotFound) {
+		return persistence.ErrDeviceNotFound
+	}
+	return err
+}
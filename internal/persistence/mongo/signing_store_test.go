@@ -0,0 +1,214 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"gopkg.in/mgo.v2"
+)
+
+// fakeCollections keeps device and signatures in memory and fails writes on
+// demand, unique (deviceid, counter) index is enforced like in mongo
+type fakeCollections struct {
+	device     domain.SignatureDevice
+	signatures map[string]domain.SignatureRecord
+
+	// insertFailAt is position of document insert fails at with insertErr,
+	// documents before it stay inserted
+	insertFailAt int
+	insertErr    error
+	// updateErrs are returned by consecutive device updates, nil entry
+	// updates device
+	updateErrs []error
+	removeErr  error
+	orphans    int
+}
+
+func newFakeCollections() *fakeCollections {
+	return &fakeCollections{
+		device:       domain.SignatureDevice{ID: uuid.NewString(), UpdatedAt: time.Now()},
+		signatures:   make(map[string]domain.SignatureRecord),
+		insertFailAt: -1,
+	}
+}
+
+func (c *fakeCollections) findDevice(deviceID string) (*domain.SignatureDevice, error) {
+	if deviceID != c.device.ID {
+		return nil, mgo.ErrNotFound
+	}
+	d := c.device
+	return &d, nil
+}
+
+func (c *fakeCollections) insertSignatures(docs []interface{}) error {
+	for i, doc := range docs {
+		if i == c.insertFailAt {
+			return c.insertErr
+		}
+		record := doc.(signatureDoc).SignatureRecord
+		for _, s := range c.signatures {
+			if s.DeviceID == record.DeviceID && s.Counter == record.Counter {
+				return &mgo.LastError{Code: 11000, Err: "duplicate key"}
+			}
+		}
+		c.signatures[record.ID] = record
+	}
+	return nil
+}
+
+func (c *fakeCollections) removeSignatures(ids []string) error {
+	if c.removeErr != nil {
+		return c.removeErr
+	}
+	for _, id := range ids {
+		delete(c.signatures, id)
+	}
+	return nil
+}
+
+func (c *fakeCollections) updateDevice(prev, d *domain.SignatureDevice) error {
+	if len(c.updateErrs) > 0 {
+		err := c.updateErrs[0]
+		c.updateErrs = c.updateErrs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	if c.device.SignatureCounter != prev.SignatureCounter || !c.device.UpdatedAt.Equal(prev.UpdatedAt) {
+		return mgo.ErrNotFound
+	}
+	c.device = *d
+	return nil
+}
+
+func (c *fakeCollections) removeOrphans(deviceID string, insertedBefore time.Time) error {
+	c.orphans++
+	return nil
+}
+
+// signN signs n consecutive records and counts its calls
+func signN(n int, calls *int) func(device *domain.SignatureDevice) ([]*domain.SignatureRecord, error) {
+	return func(device *domain.SignatureDevice) ([]*domain.SignatureRecord, error) {
+		*calls++
+		records := make([]*domain.SignatureRecord, n)
+		for i := range records {
+			records[i] = &domain.SignatureRecord{
+				ID:        uuid.NewString(),
+				DeviceID:  device.ID,
+				Counter:   device.SignatureCounter,
+				Signature: fmt.Sprintf("sig-%d-%d", *calls, device.SignatureCounter),
+			}
+			device.IncrementCounter(records[i].Signature)
+		}
+		return records, nil
+	}
+}
+
+func TestSignBatch_Stored(t *testing.T) {
+	c := newFakeCollections()
+	var calls int
+	records, err := signBatch(c, c.device.ID, signN(3, &calls))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if c.device.SignatureCounter != 3 || c.device.LastSignature != records[2].Signature {
+		t.Errorf("expected device moved over batch, got counter %d", c.device.SignatureCounter)
+	}
+	if len(c.signatures) != 3 {
+		t.Errorf("expected 3 stored signatures, got %d", len(c.signatures))
+	}
+
+	if _, err := signBatch(c, "missing", signN(1, &calls)); !errors.Is(err, persistence.ErrDeviceNotFound) {
+		t.Errorf("expected device not found, got %v", err)
+	}
+}
+
+func TestSignBatch_FailedWrites(t *testing.T) {
+	errWrite := errors.New("write failed")
+	errRemove := errors.New("remove failed")
+	tests := map[string]struct {
+		setup func(c *fakeCollections)
+		want  []error
+	}{
+		"insert fails in the middle": {
+			setup: func(c *fakeCollections) { c.insertFailAt, c.insertErr = 2, errWrite },
+			want:  []error{errWrite},
+		},
+		"device update fails": {
+			setup: func(c *fakeCollections) { c.updateErrs = []error{errWrite} },
+			want:  []error{errWrite},
+		},
+		"insert and removal fail": {
+			setup: func(c *fakeCollections) { c.insertFailAt, c.insertErr, c.removeErr = 2, errWrite, errRemove },
+			want:  []error{errWrite, errRemove},
+		},
+		"device update and removal fail": {
+			setup: func(c *fakeCollections) { c.updateErrs, c.removeErr = []error{errWrite}, errRemove },
+			want:  []error{errWrite, errRemove},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := newFakeCollections()
+			tt.setup(c)
+			before := c.device
+			var calls int
+			_, err := signBatch(c, c.device.ID, signN(5, &calls))
+			for _, want := range tt.want {
+				if !errors.Is(err, want) {
+					t.Errorf("expected %v in error, got %v", want, err)
+				}
+			}
+			if c.device.SignatureCounter != before.SignatureCounter || c.device.LastSignature != before.LastSignature {
+				t.Errorf("expected device not to move, got counter %d", c.device.SignatureCounter)
+			}
+			if c.removeErr == nil && len(c.signatures) != 0 {
+				t.Errorf("expected inserted signatures removed, %d left", len(c.signatures))
+			}
+		})
+	}
+}
+
+func TestSignBatch_LostRaceIsRetried(t *testing.T) {
+	c := newFakeCollections()
+	// other writer moved device between read and compare-and-set
+	c.updateErrs = []error{mgo.ErrNotFound}
+	var calls int
+	records, err := signBatch(c, c.device.ID, signN(2, &calls))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected batch signed again, signed %d times", calls)
+	}
+	if len(c.signatures) != 2 {
+		t.Fatalf("expected only records of successful attempt, got %d", len(c.signatures))
+	}
+	for _, record := range records {
+		if _, ok := c.signatures[record.ID]; !ok {
+			t.Errorf("expected record %d stored", record.Counter)
+		}
+	}
+}
+
+func TestSignBatch_ClaimedPositionIsRetried(t *testing.T) {
+	c := newFakeCollections()
+	// record of writer which didn't move device yet, or crashed
+	c.signatures["other"] = domain.SignatureRecord{ID: "other", DeviceID: c.device.ID, Counter: 1}
+	var calls int
+	_, err := signBatch(c, c.device.ID, signN(3, &calls))
+	if !errors.Is(err, errSigningConflict) {
+		t.Fatalf("expected signing conflict, got %v", err)
+	}
+	if calls != maxSignAttempts || c.orphans != maxSignAttempts {
+		t.Errorf("expected %d attempts with orphan removal, got %d and %d", maxSignAttempts, calls, c.orphans)
+	}
+	if len(c.signatures) != 1 || c.device.SignatureCounter != 0 {
+		t.Errorf("expected only claimed position stored and device not moved")
+	}
+}
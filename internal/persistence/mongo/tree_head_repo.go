@@ -0,0 +1,84 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const treeHeadCollectioName = "tree_head"
+
+var errTreeHeadNotGrowing = errors.New("tree head must grow device tree")
+
+type treeHeadRepo struct {
+	sess         *mgo.Session
+	databaseName string
+}
+
+func NewTreeHeadRepo(sess *mgo.Session, databaseName string) (*treeHeadRepo, error) {
+	c := sess.DB(databaseName).C(treeHeadCollectioName)
+	index := mgo.Index{
+		Key:        []string{"deviceid", "treesize"},
+		Unique:     true,
+		Background: true,
+	}
+	if err := c.EnsureIndex(index); err != nil {
+		return nil, err
+	}
+	return &treeHeadRepo{
+		sess:         sess,
+		databaseName: databaseName,
+	}, nil
+}
+
+// Create stores tree head only when it grows device tree. Head is checked
+// again after insert, head stored meanwhile by other writer with larger tree
+// wins and this one is removed, so heads never shrink in insertion order.
+func (r *treeHeadRepo) Create(ctx context.Context, h *domain.TreeHead) error {
+	if h.DeviceID == "" {
+		return errors.New("tree head must have device id")
+	}
+	sess := r.sess.Copy()
+	defer sess.Close()
+	c := sess.DB(r.databaseName).C(treeHeadCollectioName)
+
+	n, err := c.Find(bson.M{"deviceid": h.DeviceID, "treesize": bson.M{"$gte": h.TreeSize}}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errTreeHeadNotGrowing
+	}
+	if err := c.Insert(h); err != nil {
+		if mgo.IsDup(err) {
+			return errTreeHeadNotGrowing
+		}
+		return err
+	}
+
+	n, err = c.Find(bson.M{"deviceid": h.DeviceID, "treesize": bson.M{"$gt": h.TreeSize}}).Count()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		_ = c.Remove(bson.M{"deviceid": h.DeviceID, "treesize": h.TreeSize})
+		return errTreeHeadNotGrowing
+	}
+	return nil
+}
+
+// ListByDevice returns all tree heads of device by tree size
+func (r *treeHeadRepo) ListByDevice(ctx context.Context, deviceID string) ([]*domain.TreeHead, error) {
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	var heads []*domain.TreeHead
+	if err := sess.DB(r.databaseName).C(treeHeadCollectioName).
+		Find(bson.M{"deviceid": deviceID}).Sort("treesize").All(&heads); err != nil {
+		return nil, err
+	}
+	return heads, nil
+}
@@ -2,9 +2,11 @@ package mongo
 
 import (
 	"context"
+	"errors"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 const userCollectioName = "user"
@@ -16,7 +18,7 @@ type userRepo struct {
 
 func NewUserRepo(sess *mgo.Session, databaseName string) (*userRepo, error) {
 	c := sess.DB(databaseName).C(userCollectioName)
-	key := "user_uuid"
+	key := "id"
 	index := mgo.Index{
 		Key:        []string{key},
 		Unique:     true,
@@ -34,17 +36,47 @@ func NewUserRepo(sess *mgo.Session, databaseName string) (*userRepo, error) {
 }
 
 func (r *userRepo) Create(ctx context.Context, u *domain.User) error {
-	panic("implement me")
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	err := sess.DB(r.databaseName).C(userCollectioName).Insert(u)
+	if mgo.IsDup(err) {
+		return errors.New("user already exists")
+	}
+	return err
 }
 
 func (r *userRepo) GetByID(ctx context.Context, id string) (*domain.User, error) {
-	panic("implement me")
+	return r.findOne(bson.M{"id": id})
 }
 
 func (r *userRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	panic("implement me")
+	return r.findOne(bson.M{"email": email})
+}
+
+// findOne returns the first user matching query
+func (r *userRepo) findOne(query bson.M) (*domain.User, error) {
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	var u domain.User
+	err := sess.DB(r.databaseName).C(userCollectioName).Find(query).One(&u)
+	if errors.Is(err, mgo.ErrNotFound) {
+		return nil, errors.New("user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
 }
 
 func (r *userRepo) List(ctx context.Context) ([]*domain.User, error) {
-	panic("implement me")
+	sess := r.sess.Copy()
+	defer sess.Close()
+
+	var users []*domain.User
+	if err := sess.DB(r.databaseName).C(userCollectioName).Find(nil).Sort("-createdat").All(&users); err != nil {
+		return nil, err
+	}
+	return users, nil
 }
@@ -3,10 +3,71 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
 )
 
+// deviceColumns lists signature_devices columns in order expected by scanDevice
+const deviceColumns = `id, user_id, algorithm, label, public_key, private_key,
+                signature_counter, last_signature, created_at, updated_at,
+                signature_encoding, key_size, curve, hash, padding, salt_length,
+                key_version, signing_key_version, key_history,
+                key_backend, key_label, certificate_chain, status, signature_format,
+                signed_data_version`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDevice(row rowScanner) (*domain.SignatureDevice, error) {
+	var (
+		d       domain.SignatureDevice
+		history []byte
+		chain   []byte
+	)
+	if err := row.Scan(
+		&d.ID, &d.UserID, &d.Algorithm, &d.Label, &d.PublicKey, &d.PrivateKey,
+		&d.SignatureCounter, &d.LastSignature, &d.CreatedAt, &d.UpdatedAt,
+		&d.SignatureEncoding, &d.KeySize, &d.Curve, &d.Hash, &d.Padding, &d.SaltLength,
+		&d.KeyVersion, &d.SigningKeyVersion, &history,
+		&d.KeyBackend, &d.KeyLabel, &chain, &d.Status, &d.SignatureFormat,
+		&d.SignedDataVersion,
+	); err != nil {
+		return nil, err
+	}
+	if len(history) > 0 {
+		if err := json.Unmarshal(history, &d.KeyHistory); err != nil {
+			return nil, err
+		}
+	}
+	if len(chain) > 0 {
+		if err := json.Unmarshal(chain, &d.CertificateChain); err != nil {
+			return nil, err
+		}
+	}
+	return &d, nil
+}
+
+// marshalKeyHistory encodes retired keys for jsonb column
+func marshalKeyHistory(d *domain.SignatureDevice) (string, error) {
+	return marshalJSONList(d.KeyHistory)
+}
+
+// marshalJSONList encodes list for jsonb column, passed as string because
+// binary jsonb parameters need version prefix
+func marshalJSONList[T any](list []T) (string, error) {
+	if len(list) == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 type deviceRepo struct {
 	db *sql.DB
 }
@@ -16,38 +77,36 @@ func NewDeviceRepo(db *sql.DB) *deviceRepo {
 }
 
 func (r *deviceRepo) Create(ctx context.Context, d *domain.SignatureDevice) error {
-	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO signature_devices
-        (id, user_id, algorithm, label, public_key, private_key,
-         signature_counter, last_signature, created_at, updated_at)
-         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`,
+	history, err := marshalKeyHistory(d)
+	if err != nil {
+		return err
+	}
+	chain, err := marshalJSONList(d.CertificateChain)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO signature_devices (`+deviceColumns+`)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25)`,
 		d.ID, d.UserID, d.Algorithm, d.Label, d.PublicKey, d.PrivateKey,
 		d.SignatureCounter, d.LastSignature, d.CreatedAt, d.UpdatedAt,
+		d.SignatureEncoding, d.KeySize, d.Curve, d.Hash, d.Padding, d.SaltLength,
+		d.KeyVersion, d.SigningKeyVersion, history,
+		d.KeyBackend, d.KeyLabel, chain, d.Status, d.SignatureFormat,
+		d.SignedDataVersion,
 	)
 	return err
 }
 
 func (r *deviceRepo) GetByID(ctx context.Context, id string) (*domain.SignatureDevice, error) {
 	row := r.db.QueryRowContext(ctx,
-		`SELECT id, user_id, algorithm, label, public_key, private_key,
-                signature_counter, last_signature, created_at, updated_at
-         FROM signature_devices WHERE id=$1`, id)
-
-	var d domain.SignatureDevice
-	if err := row.Scan(
-		&d.ID, &d.UserID, &d.Algorithm, &d.Label, &d.PublicKey, &d.PrivateKey,
-		&d.SignatureCounter, &d.LastSignature, &d.CreatedAt, &d.UpdatedAt,
-	); err != nil {
-		return nil, err
-	}
-	return &d, nil
+		`SELECT `+deviceColumns+` FROM signature_devices WHERE id=$1`, id)
+	return scanDevice(row)
 }
 
 func (r *deviceRepo) List(ctx context.Context) ([]*domain.SignatureDevice, error) {
 	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, user_id, algorithm, label, public_key, private_key,
-                signature_counter, last_signature, created_at, updated_at
-         FROM signature_devices ORDER BY created_at DESC`)
+		`SELECT `+deviceColumns+` FROM signature_devices ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -55,26 +114,40 @@ func (r *deviceRepo) List(ctx context.Context) ([]*domain.SignatureDevice, error
 
 	var devices []*domain.SignatureDevice
 	for rows.Next() {
-		var d domain.SignatureDevice
-		if err := rows.Scan(
-			&d.ID, &d.UserID, &d.Algorithm, &d.Label, &d.PublicKey, &d.PrivateKey,
-			&d.SignatureCounter, &d.LastSignature, &d.CreatedAt, &d.UpdatedAt,
-		); err != nil {
+		d, err := scanDevice(rows)
+		if err != nil {
 			return nil, err
 		}
-		devices = append(devices, &d)
+		devices = append(devices, d)
 	}
 	return devices, nil
 }
 
 func (r *deviceRepo) Update(ctx context.Context, d *domain.SignatureDevice) error {
-	_, err := r.db.ExecContext(ctx,
+	history, err := marshalKeyHistory(d)
+	if err != nil {
+		return err
+	}
+	chain, err := marshalJSONList(d.CertificateChain)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
 		`UPDATE signature_devices
          SET algorithm=$2, label=$3, public_key=$4, private_key=$5,
-             signature_counter=$6, last_signature=$7, updated_at=$8
+             signature_counter=$6, last_signature=$7, updated_at=$8,
+             signature_encoding=$9, key_size=$10, curve=$11, hash=$12,
+             padding=$13, salt_length=$14, key_version=$15,
+             signing_key_version=$16, key_history=$17,
+             key_backend=$18, key_label=$19, certificate_chain=$20,
+             status=$21, signature_format=$22, signed_data_version=$23
          WHERE id=$1`,
 		d.ID, d.Algorithm, d.Label, d.PublicKey, d.PrivateKey,
 		d.SignatureCounter, d.LastSignature, d.UpdatedAt,
+		d.SignatureEncoding, d.KeySize, d.Curve, d.Hash, d.Padding, d.SaltLength,
+		d.KeyVersion, d.SigningKeyVersion, history,
+		d.KeyBackend, d.KeyLabel, chain, d.Status, d.SignatureFormat,
+		d.SignedDataVersion,
 	)
 	return err
 }
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+)
+
+// idempotencyColumns lists idempotency_keys columns in order expected by scanIdempotencyRecord
+const idempotencyColumns = `scope, key, request_hash, status_code, content_type, body, created_at, expires_at`
+
+func scanIdempotencyRecord(row rowScanner) (*domain.IdempotencyRecord, error) {
+	var rec domain.IdempotencyRecord
+	if err := row.Scan(
+		&rec.Scope, &rec.Key, &rec.RequestHash, &rec.StatusCode, &rec.ContentType, &rec.Body,
+		&rec.CreatedAt, &rec.ExpiresAt,
+	); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+type idempotencyStore struct {
+	db *sql.DB
+}
+
+// NewIdempotencyStore create interface for idempotency keys database
+func NewIdempotencyStore(db *sql.DB) *idempotencyStore {
+	return &idempotencyStore{db: db}
+}
+
+// Reserve inserts record or takes over expired one in single statement, so
+// two requests can't both get the key. Record creation time is the time
+// expiry is checked at.
+func (s *idempotencyStore) Reserve(ctx context.Context, rec *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	row := s.db.QueryRowContext(ctx,
+		`INSERT INTO idempotency_keys (`+idempotencyColumns+`)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+         ON CONFLICT (scope, key) DO UPDATE
+         SET request_hash=EXCLUDED.request_hash, status_code=EXCLUDED.status_code,
+             content_type=EXCLUDED.content_type, body=EXCLUDED.body,
+             created_at=EXCLUDED.created_at, expires_at=EXCLUDED.expires_at
+         WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+         RETURNING key`,
+		rec.Scope, rec.Key, rec.RequestHash, rec.StatusCode, rec.ContentType, rec.Body,
+		rec.CreatedAt, rec.ExpiresAt,
+	)
+	var key string
+	err := row.Scan(&key)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	existing, err := scanIdempotencyRecord(s.db.QueryRowContext(ctx,
+		`SELECT `+idempotencyColumns+` FROM idempotency_keys WHERE scope=$1 AND key=$2`,
+		rec.Scope, rec.Key))
+	if err != nil {
+		return nil, err
+	}
+	return existing, persistence.ErrIdempotencyKeyExists
+}
+
+// reservationCondition matches in progress reservation of request, $1-$4
+// are scope, key, request hash and creation time
+const reservationCondition = `scope=$1 AND key=$2 AND request_hash=$3 AND created_at=$4 AND status_code=0`
+
+// Extend used to move expiry of reservation owned by rec
+func (s *idempotencyStore) Extend(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET expires_at=$5 WHERE `+reservationCondition,
+		rec.Scope, rec.Key, rec.RequestHash, rec.CreatedAt, rec.ExpiresAt,
+	)
+	return reservationUpdated(res, err)
+}
+
+// Complete used to store response of request owning reservation
+func (s *idempotencyStore) Complete(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status_code=$5, content_type=$6, body=$7, expires_at=$8
+         WHERE `+reservationCondition,
+		rec.Scope, rec.Key, rec.RequestHash, rec.CreatedAt, rec.StatusCode, rec.ContentType, rec.Body, rec.ExpiresAt,
+	)
+	return reservationUpdated(res, err)
+}
+
+// reservationUpdated reports lost reservation when update matched no row
+func reservationUpdated(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return persistence.ErrIdempotencyReservationLost
+	}
+	return nil
+}
+
+// Release used to remove reservation owned by rec
+func (s *idempotencyStore) Release(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE `+reservationCondition,
+		rec.Scope, rec.Key, rec.RequestHash, rec.CreatedAt)
+	return err
+}
+
+// DeleteExpired used to remove records expired at given time
+func (s *idempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+)
+
+// logTreeHeadColumns lists log_tree_heads columns in order expected by scanLogTreeHead
+const logTreeHeadColumns = `tree_size, root_hash, timestamp, key_id, signature`
+
+func scanLogTreeHead(row rowScanner) (*domain.SignedTreeHead, error) {
+	var h domain.SignedTreeHead
+	if err := row.Scan(&h.TreeSize, &h.RootHash, &h.Timestamp, &h.KeyID, &h.Signature); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+type logRepo struct {
+	db *sql.DB
+}
+
+// NewLogRepo create interface for signature log database
+func NewLogRepo(db *sql.DB) *logRepo {
+	return &logRepo{db: db}
+}
+
+// Append used to add entries to the end of signature log, table lock makes
+// concurrent appenders wait, so log size can't change between check and insert
+func (r *logRepo) Append(ctx context.Context, entries []*domain.LogEntry) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE log_entries IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	var size uint64
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM log_entries`).Scan(&size); err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if e.Index != size+uint64(i) {
+			return persistence.ErrLogConflict
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO log_entries (log_index, signature_id, device_id, leaf_hash)
+             VALUES ($1,$2,$3,$4)`,
+			e.Index, e.SignatureID, e.DeviceID, e.LeafHash,
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit log transaction: %w", err)
+	}
+	return nil
+}
+
+// List used to return whole signature log
+func (r *logRepo) List(ctx context.Context) ([]*domain.LogEntry, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT log_index, signature_id, device_id, leaf_hash
+         FROM log_entries ORDER BY log_index ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*domain.LogEntry
+	for rows.Next() {
+		var e domain.LogEntry
+		if err := rows.Scan(&e.Index, &e.SignatureID, &e.DeviceID, &e.LeafHash); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, nil
+}
+
+// CreateTreeHead used to store signed tree head of signature log, it's stored
+// only when it's not larger than log and grows it. Table lock makes concurrent
+// writers wait, so heads never shrink in insertion order.
+func (r *logRepo) CreateTreeHead(ctx context.Context, h *domain.SignedTreeHead) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE log_tree_heads IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	var size, latest uint64
+	var hasHead bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM log_entries),
+                COALESCE((SELECT MAX(tree_size) FROM log_tree_heads), 0),
+                EXISTS (SELECT 1 FROM log_tree_heads)`,
+	).Scan(&size, &latest, &hasHead); err != nil {
+		return err
+	}
+	if h.TreeSize > size {
+		return errors.New("tree head is larger than log")
+	}
+	if hasHead && latest >= h.TreeSize {
+		return errors.New("tree head must grow log")
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO log_tree_heads (`+logTreeHeadColumns+`)
+         VALUES ($1,$2,$3,$4,$5)`,
+		h.TreeSize, h.RootHash, h.Timestamp, h.KeyID, h.Signature,
+	); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit log tree head transaction: %w", err)
+	}
+	return nil
+}
+
+// LatestTreeHead used to return the largest signed tree head of signature log
+func (r *logRepo) LatestTreeHead(ctx context.Context) (*domain.SignedTreeHead, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT `+logTreeHeadColumns+` FROM log_tree_heads ORDER BY tree_size DESC LIMIT 1`)
+	h, err := scanLogTreeHead(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return h, err
+}
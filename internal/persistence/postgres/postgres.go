@@ -38,18 +38,26 @@ func NewRepositories(dsn string) (
 	persistence.DeviceRepository,
 	persistence.SignatureRepository,
 	persistence.UserRepository,
+	persistence.SigningStore,
+	persistence.TreeHeadRepository,
+	persistence.LogRepository,
+	persistence.IdempotencyStore,
 	error,
 ) {
 	store, err := NewStore(dsn)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 
 	deviceRepo := NewDeviceRepo(store.db)
 	signatureRepo := NewSignatureRepo(store.db)
 	userRepo := NewUserRepo(store.db)
+	signingStore := NewSigningStore(store.db)
+	treeHeadRepo := NewTreeHeadRepo(store.db)
+	logRepo := NewLogRepo(store.db)
+	idempotencyStore := NewIdempotencyStore(store.db)
 
-	return deviceRepo, signatureRepo, userRepo, nil
+	return deviceRepo, signatureRepo, userRepo, signingStore, treeHeadRepo, logRepo, idempotencyStore, nil
 }
 
 // TODO move into migrations to use golang migration tool
@@ -90,6 +98,109 @@ func RunMigrations(dsn string) error {
 			signature TEXT NOT NULL,
 			created_at TIMESTAMP NOT NULL
 		);`,
+
+		`ALTER TABLE signatures ADD COLUMN IF NOT EXISTS counter BIGINT;`,
+
+		// backfill counters of signatures created before the column existed
+		`UPDATE signatures s SET counter = o.rn - 1
+		FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY device_id ORDER BY created_at) AS rn
+			FROM signatures) o
+		WHERE s.id = o.id AND s.counter IS NULL;`,
+
+		`ALTER TABLE signatures ALTER COLUMN counter SET NOT NULL;`,
+
+		// guards signature chain against forks even if two writers bypass row lock
+		`CREATE UNIQUE INDEX IF NOT EXISTS signatures_device_counter_idx
+			ON signatures (device_id, counter);`,
+
+		// empty encoding marks ECC signatures created before encodings were recorded
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS signature_encoding TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE signatures ADD COLUMN IF NOT EXISTS signature_encoding TEXT NOT NULL DEFAULT '';`,
+
+		// empty key params mark devices created before params became configurable
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS key_size INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS curve TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS hash TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS padding TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS salt_length INTEGER NOT NULL DEFAULT 0;`,
+
+		// empty key version marks private keys stored before envelope encryption
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS key_version TEXT NOT NULL DEFAULT '';`,
+
+		// key rotation, version 0 is key pair generated with device
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS signing_key_version INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS key_history JSONB NOT NULL DEFAULT '[]';`,
+		`ALTER TABLE signatures ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE signatures ADD COLUMN IF NOT EXISTS signing_key_version INTEGER NOT NULL DEFAULT 0;`,
+
+		// token held keys, empty backend is software key stored in private_key
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS key_backend TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS key_label TEXT NOT NULL DEFAULT '';`,
+
+		// DER certificates of current device key, leaf first
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS certificate_chain JSONB NOT NULL DEFAULT '[]';`,
+
+		// devices created before statuses were introduced are active
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';`,
+
+		// default output format of sign endpoint, empty is raw signature
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS signature_format TEXT NOT NULL DEFAULT '';`,
+
+		// signatures created before payload modes were introduced carry text data
+		`ALTER TABLE signatures ADD COLUMN IF NOT EXISTS payload_mode TEXT NOT NULL DEFAULT '';`,
+
+		// existing devices and signatures keep legacy signed data format v0
+		`ALTER TABLE signature_devices ADD COLUMN IF NOT EXISTS signed_data_version INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE signatures ADD COLUMN IF NOT EXISTS signed_data_version INTEGER NOT NULL DEFAULT 0;`,
+
+		// RFC 3161 token over signature, empty for signatures made without time-stamping
+		`ALTER TABLE signatures ADD COLUMN IF NOT EXISTS timestamp_token BYTEA NOT NULL DEFAULT '';`,
+
+		// signed Merkle tree heads over device chains, a tree size is anchored once
+		`CREATE TABLE IF NOT EXISTS tree_heads (
+			id UUID PRIMARY KEY,
+			device_id UUID NOT NULL REFERENCES signature_devices(id) ON DELETE CASCADE,
+			tree_size BIGINT NOT NULL,
+			root_hash BYTEA NOT NULL,
+			timestamp TIMESTAMP NOT NULL,
+			key_id TEXT NOT NULL,
+			signature BYTEA NOT NULL,
+			UNIQUE (device_id, tree_size)
+		);`,
+
+		// append-only log of signatures of all devices, entries are never
+		// updated or deleted, also when their device is
+		`CREATE TABLE IF NOT EXISTS log_entries (
+			log_index BIGINT PRIMARY KEY,
+			signature_id UUID UNIQUE NOT NULL,
+			device_id UUID NOT NULL,
+			leaf_hash BYTEA NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS log_tree_heads (
+			tree_size BIGINT PRIMARY KEY,
+			root_hash BYTEA NOT NULL,
+			timestamp TIMESTAMP NOT NULL,
+			key_id TEXT NOT NULL,
+			signature BYTEA NOT NULL
+		);`,
+
+		// verification looks signatures up by value
+		`CREATE INDEX IF NOT EXISTS signatures_device_signature_idx
+			ON signatures (device_id, signature);`,
+
+		// responses of requests made with Idempotency-Key, status 0 marks
+		// request in progress
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			scope TEXT NOT NULL,
+			key TEXT NOT NULL,
+			request_hash TEXT NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			content_type TEXT NOT NULL DEFAULT '',
+			body BYTEA,
+			created_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (scope, key)
+		);`,
 	}
 
 	for _, q := range queries {
@@ -3,10 +3,28 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
 )
 
+// signatureColumns lists signatures columns in order expected by scanSignature
+const signatureColumns = `id, device_id, counter, signed_data, signature, created_at,
+                signature_encoding, kind, signing_key_version, payload_mode,
+                signed_data_version, timestamp_token`
+
+func scanSignature(row rowScanner) (*domain.SignatureRecord, error) {
+	var s domain.SignatureRecord
+	if err := row.Scan(
+		&s.ID, &s.DeviceID, &s.Counter, &s.SignedData, &s.Signature, &s.CreatedAt,
+		&s.SignatureEncoding, &s.Kind, &s.SigningKeyVersion, &s.PayloadMode,
+		&s.SignedDataVersion, &s.TimeStampToken,
+	); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
 type signatureRepo struct {
 	db *sql.DB
 }
@@ -19,18 +37,27 @@ func NewSignatureRepo(db *sql.DB) *signatureRepo {
 // Create used to create new signature record
 func (r *signatureRepo) Create(ctx context.Context, s *domain.SignatureRecord) error {
 	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO signatures (id, device_id, signed_data, signature, created_at)
-         VALUES ($1,$2,$3,$4,$5)`,
-		s.ID, s.DeviceID, s.SignedData, s.Signature, s.CreatedAt,
+		`INSERT INTO signatures (`+signatureColumns+`)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`,
+		s.ID, s.DeviceID, s.Counter, s.SignedData, s.Signature, s.CreatedAt,
+		s.SignatureEncoding, s.Kind, s.SigningKeyVersion, s.PayloadMode,
+		s.SignedDataVersion, s.TimeStampToken,
 	)
 	return err
 }
 
+// GetByID used to return signature record by ID
+func (r *signatureRepo) GetByID(ctx context.Context, id string) (*domain.SignatureRecord, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT `+signatureColumns+` FROM signatures WHERE id=$1`, id)
+	return scanSignature(row)
+}
+
 // ListByDevice used to return all signature record by deviceID
 func (r *signatureRepo) ListByDevice(ctx context.Context, deviceID string) ([]*domain.SignatureRecord, error) {
 	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, device_id, signed_data, signature, created_at
-         FROM signatures WHERE device_id=$1 ORDER BY created_at ASC`, deviceID)
+		`SELECT `+signatureColumns+`
+         FROM signatures WHERE device_id=$1 ORDER BY counter ASC, created_at ASC`, deviceID)
 	if err != nil {
 		return nil, err
 	}
@@ -38,11 +65,23 @@ func (r *signatureRepo) ListByDevice(ctx context.Context, deviceID string) ([]*d
 
 	var records []*domain.SignatureRecord
 	for rows.Next() {
-		var s domain.SignatureRecord
-		if err := rows.Scan(&s.ID, &s.DeviceID, &s.SignedData, &s.Signature, &s.CreatedAt); err != nil {
+		s, err := scanSignature(rows)
+		if err != nil {
 			return nil, err
 		}
-		records = append(records, &s)
+		records = append(records, s)
 	}
 	return records, nil
 }
+
+// GetBySignature used to return device signature record by signature value
+func (r *signatureRepo) GetBySignature(ctx context.Context, deviceID, signature string) (*domain.SignatureRecord, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT `+signatureColumns+` FROM signatures WHERE device_id=$1 AND signature=$2 LIMIT 1`,
+		deviceID, signature)
+	s, err := scanSignature(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return s, err
+}
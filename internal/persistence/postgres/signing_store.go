@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+)
+
+type signingStore struct {
+	db *sql.DB
+}
+
+// NewSigningStore create signing unit of work backed by single transaction
+func NewSigningStore(db *sql.DB) *signingStore {
+	return &signingStore{db: db}
+}
+
+// SignAtomically locks device row with SELECT ... FOR UPDATE, so concurrent
+// transactions for the same device wait until previous signature is committed
+func (s *signingStore) SignAtomically(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+	return persistence.SignOne(ctx, s.SignBatchAtomically, deviceID, fn)
+}
+
+// SignBatchAtomically stores all records in transaction holding device row lock
+func (s *signingStore) SignBatchAtomically(ctx context.Context, deviceID string, fn persistence.BatchSignFunc) ([]*domain.SignatureRecord, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx,
+		`SELECT `+deviceColumns+` FROM signature_devices WHERE id=$1 FOR UPDATE`, deviceID)
+
+	d, err := scanDevice(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, persistence.ErrDeviceNotFound
+		}
+		return nil, err
+	}
+
+	records, err := fn(d)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO signatures (`+signatureColumns+`)
+             VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`,
+			record.ID, record.DeviceID, record.Counter, record.SignedData, record.Signature, record.CreatedAt,
+			record.SignatureEncoding, record.Kind, record.SigningKeyVersion, record.PayloadMode,
+			record.SignedDataVersion, record.TimeStampToken,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	// key columns change only on key rotation, writing them always keeps
+	// statement the same for every sign
+	history, err := marshalKeyHistory(d)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := marshalJSONList(d.CertificateChain)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE signature_devices
+         SET signature_counter=$2, last_signature=$3, updated_at=$4,
+             public_key=$5, private_key=$6, key_version=$7,
+             signing_key_version=$8, key_history=$9, key_label=$10,
+             certificate_chain=$11, hash=$12
+         WHERE id=$1`,
+		d.ID, d.SignatureCounter, d.LastSignature, d.UpdatedAt,
+		d.PublicKey, d.PrivateKey, d.KeyVersion,
+		d.SigningKeyVersion, history, d.KeyLabel, chain, d.Hash,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit signing transaction: %w", err)
+	}
+	return records, nil
+}
+
+// UpdateCertificate only writes certificate when device is still on given key
+// version, row lock taken by signing makes it wait for running signature
+func (s *signingStore) UpdateCertificate(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+	encoded, err := marshalJSONList(chain)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE signature_devices SET certificate_chain=$3, updated_at=$4
+         WHERE id=$1 AND signing_key_version=$2`,
+		deviceID, keyVersion, encoded, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM signature_devices WHERE id=$1)`, deviceID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return persistence.ErrDeviceNotFound
+	}
+	return persistence.ErrKeyVersionChanged
+}
+
+// UpdateStatus waits for row lock of running signature, signing never writes
+// status column, so it can't bring deactivated device back
+func (s *signingStore) UpdateStatus(ctx context.Context, deviceID string, status domain.DeviceStatus) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE signature_devices SET status=$2, updated_at=$3 WHERE id=$1`,
+		deviceID, status, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return persistence.ErrDeviceNotFound
+	}
+	return nil
+}
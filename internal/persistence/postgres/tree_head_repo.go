@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+)
+
+// treeHeadColumns lists tree_heads columns in order expected by scanTreeHead
+const treeHeadColumns = `id, device_id, tree_size, root_hash, timestamp, key_id, signature`
+
+func scanTreeHead(row rowScanner) (*domain.TreeHead, error) {
+	var h domain.TreeHead
+	if err := row.Scan(
+		&h.ID, &h.DeviceID, &h.TreeSize, &h.RootHash, &h.Timestamp, &h.KeyID, &h.Signature,
+	); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+type treeHeadRepo struct {
+	db *sql.DB
+}
+
+// NewTreeHeadRepo create interface for tree heads database
+func NewTreeHeadRepo(db *sql.DB) *treeHeadRepo {
+	return &treeHeadRepo{db: db}
+}
+
+// Create used to store signed tree head, it's stored only when it grows
+// device tree. Table lock makes concurrent writers wait, so heads never shrink
+// in insertion order.
+func (r *treeHeadRepo) Create(ctx context.Context, h *domain.TreeHead) error {
+	if h.DeviceID == "" {
+		return errors.New("tree head must have device id")
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE tree_heads IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO tree_heads (`+treeHeadColumns+`)
+         SELECT $1,$2,$3,$4,$5,$6,$7
+         WHERE NOT EXISTS (SELECT 1 FROM tree_heads WHERE device_id=$2 AND tree_size >= $3)`,
+		h.ID, h.DeviceID, h.TreeSize, h.RootHash, h.Timestamp, h.KeyID, h.Signature,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("tree head must grow device tree")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tree head transaction: %w", err)
+	}
+	return nil
+}
+
+// ListByDevice used to return all tree heads of device by tree size
+func (r *treeHeadRepo) ListByDevice(ctx context.Context, deviceID string) ([]*domain.TreeHead, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+treeHeadColumns+`
+         FROM tree_heads WHERE device_id=$1 ORDER BY tree_size ASC`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var heads []*domain.TreeHead
+	for rows.Next() {
+		h, err := scanTreeHead(rows)
+		if err != nil {
+			return nil, err
+		}
+		heads = append(heads, h)
+	}
+	return heads, nil
+}
@@ -2,10 +2,27 @@ package persistence
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
 )
 
+var (
+	// ErrDeviceNotFound is returned by stores when requested device doesn't exist
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrKeyVersionChanged is returned when device key was rotated meanwhile
+	ErrKeyVersionChanged = errors.New("device key version changed")
+	// ErrLogConflict is returned when signature log was appended meanwhile
+	ErrLogConflict = errors.New("signature log was appended concurrently")
+	// ErrIdempotencyKeyExists is returned when idempotency key is held by
+	// other not expired request
+	ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+	// ErrIdempotencyReservationLost is returned when reservation of request
+	// expired and key was taken by other request or released
+	ErrIdempotencyReservationLost = errors.New("idempotency key reservation lost")
+)
+
 type UserRepository interface {
 	Create(ctx context.Context, u *domain.User) error
 	GetByID(ctx context.Context, id string) (*domain.User, error)
@@ -22,5 +39,94 @@ type DeviceRepository interface {
 
 type SignatureRepository interface {
 	Create(ctx context.Context, s *domain.SignatureRecord) error
+	GetByID(ctx context.Context, id string) (*domain.SignatureRecord, error)
 	ListByDevice(ctx context.Context, deviceID string) ([]*domain.SignatureRecord, error)
+	// GetBySignature returns device signature record with given signature
+	// value, nil when device made no such signature
+	GetBySignature(ctx context.Context, deviceID, signature string) (*domain.SignatureRecord, error)
+}
+
+// TreeHeadRepository stores signed Merkle tree heads of device chains
+type TreeHeadRepository interface {
+	Create(ctx context.Context, h *domain.TreeHead) error
+	// ListByDevice returns device tree heads ordered by tree size
+	ListByDevice(ctx context.Context, deviceID string) ([]*domain.TreeHead, error)
+}
+
+// LogRepository stores append-only signature log and its signed tree heads
+type LogRepository interface {
+	// Append adds entries to the end of log, index of the first one has to
+	// be current log size, otherwise ErrLogConflict is returned
+	Append(ctx context.Context, entries []*domain.LogEntry) error
+	// List returns whole log in index order
+	List(ctx context.Context) ([]*domain.LogEntry, error)
+	CreateTreeHead(ctx context.Context, h *domain.SignedTreeHead) error
+	// LatestTreeHead returns nil when no tree head was signed yet
+	LatestTreeHead(ctx context.Context) (*domain.SignedTreeHead, error)
+}
+
+// IdempotencyStore keeps requests made with idempotency key and their
+// responses for retention window
+type IdempotencyStore interface {
+	// Reserve stores record of new request. When key is held by not expired
+	// record, that record is returned with ErrIdempotencyKeyExists.
+	Reserve(ctx context.Context, rec *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error)
+	// Extend moves expiry of reservation, so it's kept while request runs.
+	// Reservation is owned by record of the same request hash and creation
+	// time, ErrIdempotencyReservationLost is returned when it's not anymore.
+	Extend(ctx context.Context, rec *domain.IdempotencyRecord) error
+	// Complete stores response and expiry of reserved request, it fails with
+	// ErrIdempotencyReservationLost the same way as Extend
+	Complete(ctx context.Context, rec *domain.IdempotencyRecord) error
+	// Release removes reservation of request which didn't complete, so key
+	// can be used again. Reservation owned by other request is kept.
+	Release(ctx context.Context, rec *domain.IdempotencyRecord) error
+	// DeleteExpired removes records expired at given time
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// SignFunc is executed inside signing unit of work. It receives locked device,
+// is expected to move device state forward (counter, last signature) and
+// return signature record which should be stored together with the device.
+type SignFunc func(device *domain.SignatureDevice) (*domain.SignatureRecord, error)
+
+// BatchSignFunc is SignFunc producing consecutive chain records, records are
+// expected in chain order
+type BatchSignFunc func(device *domain.SignatureDevice) ([]*domain.SignatureRecord, error)
+
+// SignOne runs single record SignFunc as batch of one, so stores implement
+// signing unit of work once
+func SignOne(
+	ctx context.Context,
+	signBatch func(ctx context.Context, deviceID string, fn BatchSignFunc) ([]*domain.SignatureRecord, error),
+	deviceID string,
+	fn SignFunc,
+) (*domain.SignatureRecord, error) {
+	records, err := signBatch(ctx, deviceID, func(device *domain.SignatureDevice) ([]*domain.SignatureRecord, error) {
+		record, err := fn(device)
+		if err != nil {
+			return nil, err
+		}
+		return []*domain.SignatureRecord{record}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// SigningStore runs read-sign-write cycle for single device as one atomic
+// operation, so concurrent sign calls can't fork signature chain
+type SigningStore interface {
+	SignAtomically(ctx context.Context, deviceID string, fn SignFunc) (*domain.SignatureRecord, error)
+	// SignBatchAtomically stores all records of fn and device state as one
+	// unit of work, nothing is stored when fn or any write fails
+	SignBatchAtomically(ctx context.Context, deviceID string, fn BatchSignFunc) ([]*domain.SignatureRecord, error)
+	// UpdateCertificate stores certificate chain of device key version. It's
+	// serialized with signing, so neither write loses the other, and fails
+	// with ErrKeyVersionChanged when key was rotated since chain was issued.
+	UpdateCertificate(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error
+	// UpdateStatus changes device status, it waits for running signature so
+	// no signature is made after device was deactivated
+	UpdateStatus(ctx context.Context, deviceID string, status domain.DeviceStatus) error
 }
@@ -0,0 +1,64 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// timestampingSigningStore attaches RFC 3161 time-stamp token to every
+// signature record before it's stored
+type timestampingSigningStore struct {
+	next        SigningStore
+	timestamper crypto.Timestamper
+}
+
+// NewTimestampingSigningStore wraps signing store with time-stamping. Token is
+// obtained inside signing unit of work, so signature which can't be
+// time-stamped is not stored and device chain doesn't move.
+func NewTimestampingSigningStore(next SigningStore, timestamper crypto.Timestamper) SigningStore {
+	return &timestampingSigningStore{next: next, timestamper: timestamper}
+}
+
+func (s *timestampingSigningStore) SignAtomically(ctx context.Context, deviceID string, fn SignFunc) (*domain.SignatureRecord, error) {
+	return s.next.SignAtomically(ctx, deviceID, func(device *domain.SignatureDevice) (*domain.SignatureRecord, error) {
+		record, err := fn(device)
+		if err != nil {
+			return nil, err
+		}
+		record.TimeStampToken, err = domain.TimestampSignature(ctx, s.timestamper, record.Signature)
+		if err != nil {
+			return nil, err
+		}
+		return record, nil
+	})
+}
+
+// SignBatchAtomically time-stamps every record of batch, batch with any
+// record which can't be time-stamped is not stored
+func (s *timestampingSigningStore) SignBatchAtomically(ctx context.Context, deviceID string, fn BatchSignFunc) ([]*domain.SignatureRecord, error) {
+	return s.next.SignBatchAtomically(ctx, deviceID, func(device *domain.SignatureDevice) ([]*domain.SignatureRecord, error) {
+		records, err := fn(device)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			record.TimeStampToken, err = domain.TimestampSignature(ctx, s.timestamper, record.Signature)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return records, nil
+	})
+}
+
+// UpdateCertificate doesn't create signature, it's passed through
+func (s *timestampingSigningStore) UpdateCertificate(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+	return s.next.UpdateCertificate(ctx, deviceID, keyVersion, chain)
+}
+
+// UpdateStatus doesn't create signature, it's passed through
+func (s *timestampingSigningStore) UpdateStatus(ctx context.Context, deviceID string, status domain.DeviceStatus) error {
+	return s.next.UpdateStatus(ctx, deviceID, status)
+}
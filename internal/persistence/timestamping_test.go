@@ -0,0 +1,62 @@
+package persistence_test
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"errors"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence/inmemory"
+)
+
+// stubTimestamper returns fixed token or error and remembers digests
+type stubTimestamper struct {
+	token   []byte
+	err     error
+	digests [][]byte
+}
+
+func (s *stubTimestamper) Timestamp(_ context.Context, digest []byte, _ stdcrypto.Hash) ([]byte, error) {
+	s.digests = append(s.digests, digest)
+	return s.token, s.err
+}
+
+func TestTimestampingSigningStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := inmemory.NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	device := newDevice(t)
+	if err := store.DeviceRepo.Create(ctx, device); err != nil {
+		t.Fatalf("create device: %v", err)
+	}
+
+	tsa := &stubTimestamper{token: []byte("token")}
+	signing := persistence.NewTimestampingSigningStore(store.SigningStore, tsa)
+	record, err := signing.SignAtomically(ctx, device.ID, signOnce)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	imprint, _ := domain.SignatureImprint(record.Signature)
+	if string(record.TimeStampToken) != "token" || len(tsa.digests) != 1 || string(tsa.digests[0]) != string(imprint) {
+		t.Fatalf("expected token over signature imprint, got %q", record.TimeStampToken)
+	}
+	stored, _ := store.SignatureRepo.ListByDevice(ctx, device.ID)
+	if len(stored) != 1 || string(stored[0].TimeStampToken) != "token" {
+		t.Fatalf("token has to be stored with record")
+	}
+
+	// signature which can't be time-stamped is dropped together with device state
+	tsa.err = errors.New("connection refused")
+	if _, err := signing.SignAtomically(ctx, device.ID, signOnce); !errors.Is(err, domain.ErrTimestampUnavailable) {
+		t.Fatalf("expected ErrTimestampUnavailable, got %v", err)
+	}
+	current, _ := store.DeviceRepo.GetByID(ctx, device.ID)
+	stored, _ = store.SignatureRepo.ListByDevice(ctx, device.ID)
+	if current.SignatureCounter != 1 || len(stored) != 1 {
+		t.Fatalf("failed time-stamping mustn't move chain, counter %d, records %d", current.SignatureCounter, len(stored))
+	}
+}
@@ -0,0 +1,200 @@
+package cbor_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/cbor"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decode hex %q: %v", s, err)
+	}
+	return b
+}
+
+// appendixA are examples of RFC 8949 Appendix A within supported subset,
+// value is what Unmarshal returns
+var appendixA = []struct {
+	value   any
+	encoded string
+}{
+	{int64(0), "00"},
+	{int64(1), "01"},
+	{int64(10), "0a"},
+	{int64(23), "17"},
+	{int64(24), "1818"},
+	{int64(25), "1819"},
+	{int64(100), "1864"},
+	{int64(1000), "1903e8"},
+	{int64(1000000), "1a000f4240"},
+	{int64(1000000000000), "1b000000e8d4a51000"},
+	{int64(-1), "20"},
+	{int64(-10), "29"},
+	{int64(-100), "3863"},
+	{int64(-1000), "3903e7"},
+	{false, "f4"},
+	{true, "f5"},
+	{nil, "f6"},
+	{cbor.Tag{Number: 0, Content: "2013-03-21T20:04:00Z"}, "c074323031332d30332d32315432303a30343a30305a"},
+	{cbor.Tag{Number: 1, Content: int64(1363896240)}, "c11a514b67b0"},
+	{cbor.Tag{Number: 23, Content: []byte{0x01, 0x02, 0x03, 0x04}}, "d74401020304"},
+	{cbor.Tag{Number: 24, Content: []byte{0x64, 0x49, 0x45, 0x54, 0x46}}, "d818456449455446"},
+	{cbor.Tag{Number: 32, Content: "http://www.example.com"}, "d82076687474703a2f2f7777772e6578616d706c652e636f6d"},
+	{[]byte{}, "40"},
+	{[]byte{0x01, 0x02, 0x03, 0x04}, "4401020304"},
+	{"", "60"},
+	{"a", "6161"},
+	{"IETF", "6449455446"},
+	{"\"\\", "62225c"},
+	{"ü", "62c3bc"},
+	{"水", "63e6b0b4"},
+	{"\U00010151", "64f0908591"},
+	{[]any{}, "80"},
+	{[]any{int64(1), int64(2), int64(3)}, "83010203"},
+	{[]any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}, "8301820203820405"},
+	{
+		[]any{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(7), int64(8), int64(9), int64(10),
+			int64(11), int64(12), int64(13), int64(14), int64(15), int64(16), int64(17), int64(18), int64(19), int64(20),
+			int64(21), int64(22), int64(23), int64(24), int64(25)},
+		"98190102030405060708090a0b0c0d0e0f101112131415161718181819",
+	},
+	{map[any]any{}, "a0"},
+	{map[any]any{int64(1): int64(2), int64(3): int64(4)}, "a201020304"},
+	{map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}, "a26161016162820203"},
+	{[]any{"a", map[any]any{"b": "c"}}, "826161a161626163"},
+	{map[any]any{"a": "A", "b": "B", "c": "C", "d": "D", "e": "E"}, "a56161614161626142616361436164614461656145"},
+}
+
+func TestMarshal_AppendixA(t *testing.T) {
+	for _, tt := range appendixA {
+		got, err := cbor.Marshal(tt.value)
+		if err != nil {
+			t.Fatalf("marshal %#v: %v", tt.value, err)
+		}
+		if hex.EncodeToString(got) != tt.encoded {
+			t.Errorf("marshal %#v: expected %s, got %x", tt.value, tt.encoded, got)
+		}
+	}
+}
+
+func TestUnmarshal_AppendixA(t *testing.T) {
+	for _, tt := range appendixA {
+		got, err := cbor.Unmarshal(mustHex(t, tt.encoded))
+		if err != nil {
+			t.Fatalf("unmarshal %s: %v", tt.encoded, err)
+		}
+		if !reflect.DeepEqual(got, tt.value) {
+			t.Errorf("unmarshal %s: expected %#v, got %#v", tt.encoded, tt.value, got)
+		}
+	}
+}
+
+func TestMarshal_GoTypes(t *testing.T) {
+	tests := []struct {
+		value   any
+		encoded string
+	}{
+		{1, "01"},
+		{-500, "3901f3"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{int64(-9223372036854775808), "3b7fffffffffffffff"},
+		{int64(4294967295), "1affffffff"},
+		{int64(4294967296), "1b0000000100000000"},
+		{int64(65535), "19ffff"},
+		{int64(65536), "1a00010000"},
+	}
+	for _, tt := range tests {
+		got, err := cbor.Marshal(tt.value)
+		if err != nil {
+			t.Fatalf("marshal %#v: %v", tt.value, err)
+		}
+		if hex.EncodeToString(got) != tt.encoded {
+			t.Errorf("marshal %#v: expected %s, got %x", tt.value, tt.encoded, got)
+		}
+	}
+
+	if _, err := cbor.Marshal(1.5); err == nil {
+		t.Error("expected float to fail")
+	}
+	if _, err := cbor.Marshal([]any{"a", struct{}{}}); err == nil {
+		t.Error("expected nested unsupported type to fail")
+	}
+}
+
+// TestMarshal_Deterministic checks core deterministic encoding (RFC 8949
+// section 4.2.1), map keys are sorted by their encoded bytes
+func TestMarshal_Deterministic(t *testing.T) {
+	m := map[any]any{"aa": 5, 100: 2, "z": 4, -1: 3, 10: 1}
+	want := "a50a011864022003617a0462616105"
+	for range 10 {
+		got, err := cbor.Marshal(m)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		if hex.EncodeToString(got) != want {
+			t.Fatalf("expected %s, got %x", want, got)
+		}
+	}
+}
+
+func TestUnmarshal_Malformed(t *testing.T) {
+	tests := map[string]struct {
+		encoded string
+		wantErr string
+	}{
+		"empty":                {encoded: "", wantErr: "unexpected end"},
+		"truncated head":       {encoded: "19e8", wantErr: "unexpected end"},
+		"truncated bytes":      {encoded: "4401020304"[:6], wantErr: "unexpected end"},
+		"truncated array":      {encoded: "830102", wantErr: "unexpected end"},
+		"array too long":       {encoded: "9affffffff00", wantErr: "unexpected end"},
+		"map too long":         {encoded: "bbffffffffffffffff00", wantErr: "unexpected end"},
+		"trailing data":        {encoded: "0000", wantErr: "trailing data"},
+		"reserved info":        {encoded: "1c", wantErr: "indefinite length"},
+		"indefinite bytes":     {encoded: "5f42010243030405ff", wantErr: "indefinite length"},
+		"indefinite array":     {encoded: "9f018202039f0405ffff", wantErr: "indefinite length"},
+		"half float":           {encoded: "f93c00", wantErr: "floats"},
+		"double float":         {encoded: "fb3ff199999999999a", wantErr: "floats"},
+		"undefined":            {encoded: "f7", wantErr: "unsupported simple value"},
+		"simple value":         {encoded: "f0", wantErr: "unsupported simple value"},
+		"unsigned overflow":    {encoded: "1bffffffffffffffff", wantErr: "overflow"},
+		"negative overflow":    {encoded: "3b8000000000000000", wantErr: "overflow"},
+		"invalid UTF-8":        {encoded: "62c328", wantErr: "UTF-8"},
+		"duplicate key":        {encoded: "a201010102", wantErr: "duplicate map key"},
+		"byte string key":      {encoded: "a14001", wantErr: "map key type"},
+		"array key":            {encoded: "a18001", wantErr: "map key type"},
+		"nesting too deep":     {encoded: strings.Repeat("81", 17) + "00", wantErr: "too deep"},
+		"tag without content":  {encoded: "d2", wantErr: "unexpected end"},
+		"map without value":    {encoded: "a101", wantErr: "unexpected end"},
+		"text length overflow": {encoded: "7bffffffffffffffff", wantErr: "unexpected end"},
+	}
+	for name, tt := range tests {
+		_, err := cbor.Unmarshal(mustHex(t, tt.encoded))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error with %q, got %v", name, tt.wantErr, err)
+		}
+	}
+
+	// nesting up to limit is accepted
+	if _, err := cbor.Unmarshal(mustHex(t, strings.Repeat("81", 16)+"00")); err != nil {
+		t.Errorf("expected 16 nested arrays to decode: %v", err)
+	}
+}
+
+func TestUnmarshal_CopiesBytes(t *testing.T) {
+	data := mustHex(t, "4401020304")
+	v, err := cbor.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	data[1] = 0xff
+	if !bytes.Equal(v.([]byte), []byte{0x01, 0x02, 0x03, 0x04}) {
+		t.Error("expected decoded bytes not to alias input")
+	}
+}
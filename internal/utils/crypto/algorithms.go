@@ -0,0 +1,91 @@
+package crypto
+
+import stdcrypto "crypto"
+
+// built-in algorithms, names are part of public API and stored with devices
+func init() {
+	mustRegister(Algorithm{
+		Name:          "RSA",
+		DefaultParams: KeyParams{KeySize: defaultRSAKeySize, Hash: HashSHA256},
+		Hashes:        supportedHashes,
+		Paddings:      supportedPaddings,
+		GenerateKeys: func(params KeyParams) ([]byte, []byte, error) {
+			gen := RSAGenerator{Bits: params.KeySize}
+			marshaler := NewRSAMarshaler()
+			keyPair, err := gen.Generate()
+			if err != nil {
+				return nil, nil, err
+			}
+			return marshaler.Marshal(*keyPair)
+		},
+		NewSigner: func(privateKey []byte, opts SignatureOptions) (Signer, error) {
+			return NewRSASigner(privateKey, opts)
+		},
+		NewVerifier: func(publicKey []byte, opts SignatureOptions) (Verifier, error) {
+			return NewRSAVerifier(publicKey, opts)
+		},
+		ParsePublicKey: func(publicKey []byte) (stdcrypto.PublicKey, error) {
+			m := NewRSAMarshaler()
+			return m.UnmarshalPublic(publicKey)
+		},
+		ImportKey: importRSAKey,
+	})
+
+	mustRegister(Algorithm{
+		Name:           "ECC",
+		Encodings:      SigningEncodings,
+		LegacyEncoding: EncodingLegacyRaw,
+		DefaultParams:  KeyParams{Curve: CurveP384, Hash: HashSHA256},
+		Curves:         supportedCurves,
+		Hashes:         supportedHashes,
+		GenerateKeys: func(params KeyParams) ([]byte, []byte, error) {
+			gen := ECCGenerator{Curve: params.Curve}
+			marshaler := NewECCMarshaler()
+			keyPair, err := gen.Generate()
+			if err != nil {
+				return nil, nil, err
+			}
+			return marshaler.Encode(*keyPair)
+		},
+		NewSigner: func(privateKey []byte, opts SignatureOptions) (Signer, error) {
+			return NewECCSigner(privateKey, opts)
+		},
+		NewVerifier: func(publicKey []byte, opts SignatureOptions) (Verifier, error) {
+			return NewECCVerifier(publicKey, opts)
+		},
+		ParsePublicKey: func(publicKey []byte) (stdcrypto.PublicKey, error) {
+			return NewECCMarshaler().DecodePublic(publicKey)
+		},
+		ImportKey: importECCKey,
+	})
+
+	// Ed25519 signs message directly, so there is no hash to select
+	mustRegister(Algorithm{
+		Name: "ED25519",
+		GenerateKeys: func(_ KeyParams) ([]byte, []byte, error) {
+			gen := Ed25519Generator{}
+			marshaler := NewEd25519Marshaler()
+			keyPair, err := gen.Generate()
+			if err != nil {
+				return nil, nil, err
+			}
+			return marshaler.Encode(*keyPair)
+		},
+		NewSigner: func(privateKey []byte, _ SignatureOptions) (Signer, error) {
+			return NewEd25519Signer(privateKey)
+		},
+		NewVerifier: func(publicKey []byte, _ SignatureOptions) (Verifier, error) {
+			return NewEd25519Verifier(publicKey)
+		},
+		ParsePublicKey: func(publicKey []byte) (stdcrypto.PublicKey, error) {
+			return NewEd25519Marshaler().DecodePublic(publicKey)
+		},
+		ImportKey: importEd25519Key,
+	})
+}
+
+func mustRegister(a Algorithm) {
+	if err := RegisterAlgorithm(a); err != nil {
+		panic(err)
+	}
+}
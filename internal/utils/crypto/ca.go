@@ -0,0 +1,261 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"os"
+	"time"
+)
+
+// DefaultCertificateValidity is lifetime of device certificates
+const DefaultCertificateValidity = 365 * 24 * time.Hour
+
+// oidDescription is X.520 description attribute, it carries device label
+var oidDescription = asn1.ObjectIdentifier{2, 5, 4, 13}
+
+// CertificateSubject is device identity bound to public key by certificate
+type CertificateSubject struct {
+	DeviceID string
+	UserID   string
+	Label    string
+}
+
+// DeviceURI is subject alternative name identifying device in certificates
+func DeviceURI(id string) *url.URL {
+	return &url.URL{Scheme: "urn", Opaque: "signing-device:" + id}
+}
+
+// UserURI is subject alternative name identifying device owner in certificates
+func UserURI(id string) *url.URL {
+	return &url.URL{Scheme: "urn", Opaque: "signing-user:" + id}
+}
+
+// CertificateAuthority issues device certificates with intermediate key, the
+// self-signed root only completes returned chain
+type CertificateAuthority struct {
+	root         *x509.Certificate
+	intermediate *x509.Certificate
+	key          stdcrypto.Signer
+	validity     time.Duration
+}
+
+// NewCertificateAuthority validates that intermediate is CA certificate issued
+// by root and that key belongs to intermediate
+func NewCertificateAuthority(root, intermediate *x509.Certificate, key stdcrypto.Signer, validity time.Duration) (*CertificateAuthority, error) {
+	if err := root.CheckSignatureFrom(root); err != nil {
+		return nil, fmt.Errorf("root certificate is not self-signed: %w", err)
+	}
+	if !intermediate.IsCA {
+		return nil, errors.New("intermediate certificate is not CA certificate")
+	}
+	if err := intermediate.CheckSignatureFrom(root); err != nil {
+		return nil, fmt.Errorf("intermediate certificate is not issued by root: %w", err)
+	}
+	if !SamePublicKey(key.Public(), intermediate.PublicKey) {
+		return nil, errors.New("intermediate key doesn't match intermediate certificate")
+	}
+	if validity <= 0 {
+		validity = DefaultCertificateValidity
+	}
+	return &CertificateAuthority{root: root, intermediate: intermediate, key: key, validity: validity}, nil
+}
+
+// LoadCertificateAuthority reads PEM encoded root certificate, intermediate
+// certificate and intermediate private key from files
+func LoadCertificateAuthority(rootCertFile, intermediateCertFile, intermediateKeyFile string, validity time.Duration) (*CertificateAuthority, error) {
+	root, err := readCertificate(rootCertFile)
+	if err != nil {
+		return nil, err
+	}
+	intermediate, err := readCertificate(intermediateCertFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(intermediateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseCAKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", intermediateKeyFile, err)
+	}
+	return NewCertificateAuthority(root, intermediate, key, validity)
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no PEM certificate found", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParseCAKey decodes PEM private key of CA in PKCS#8, SEC 1 or PKCS#1 form
+func ParseCAKey(data []byte) (stdcrypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(stdcrypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported CA key type")
+	}
+	return signer, nil
+}
+
+// Issue creates certificate for device public key. It returns DER encoded
+// chain, device certificate first, followed by intermediate and root.
+func (ca *CertificateAuthority) Issue(subject CertificateSubject, publicKey stdcrypto.PublicKey) ([][]byte, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(ca.validity)
+	if notAfter.After(ca.intermediate.NotAfter) {
+		notAfter = ca.intermediate.NotAfter
+	}
+
+	name := pkix.Name{CommonName: subject.DeviceID}
+	if subject.Label != "" {
+		name.ExtraNames = []pkix.AttributeTypeAndValue{{Type: oidDescription, Value: subject.Label}}
+	}
+	uris := []*url.URL{DeviceURI(subject.DeviceID)}
+	if subject.UserID != "" {
+		uris = append(uris, UserURI(subject.UserID))
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               name,
+		URIs:                  uris,
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.intermediate, publicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue certificate: %w", err)
+	}
+	return [][]byte{der, ca.intermediate.Raw, ca.root.Raw}, nil
+}
+
+// Issued reports whether certificate was signed by CA intermediate
+func (ca *CertificateAuthority) Issued(cert *x509.Certificate) bool {
+	return cert.CheckSignatureFrom(ca.intermediate) == nil
+}
+
+// Roots returns pool with CA root, used to verify issued chains
+func (ca *CertificateAuthority) Roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.root)
+	return pool
+}
+
+// CAMaterial is PEM encoded output of GenerateCertificateAuthority
+type CAMaterial struct {
+	RootCert         []byte
+	RootKey          []byte
+	IntermediateCert []byte
+	IntermediateKey  []byte
+}
+
+// GenerateCertificateAuthority creates self-signed root and intermediate
+// signed by it, both with P-384 keys. Intermediate may only issue end entity
+// certificates.
+func GenerateCertificateAuthority(name string, validity time.Duration) (*CAMaterial, error) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rootTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name + " Root CA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(2 * validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	intermediateTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name + " Device CA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	if rootTemplate.SerialNumber, err = randomSerial(); err != nil {
+		return nil, err
+	}
+	if intermediateTemplate.SerialNumber, err = randomSerial(); err != nil {
+		return nil, err
+	}
+
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		return nil, err
+	}
+	intermediateDER, err := x509.CreateCertificate(rand.Reader, intermediateTemplate, root, &intermediateKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	rootKeyDER, err := x509.MarshalPKCS8PrivateKey(rootKey)
+	if err != nil {
+		return nil, err
+	}
+	intermediateKeyDER, err := x509.MarshalPKCS8PrivateKey(intermediateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &CAMaterial{
+		RootCert:         pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER}),
+		RootKey:          pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rootKeyDER}),
+		IntermediateCert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediateDER}),
+		IntermediateKey:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: intermediateKeyDER}),
+	}, nil
+}
+
+// randomSerial returns positive 128 bit certificate serial number
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,450 @@
+package crypto
+
+import (
+	"bytes"
+	stdcrypto "crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// CMS object identifiers (RFC 5652, RFC 8419, RFC 4055)
+var (
+	oidData                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttrContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidRSAEncryption       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSASSAPSS           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidECDSAWithSHA256     = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384     = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512     = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519             = asn1.ObjectIdentifier{1, 3, 101, 112}
+	asn1Null               = asn1.RawValue{Tag: asn1.TagNull}
+	digestAlgorithmsByHash = map[stdcrypto.Hash]asn1.ObjectIdentifier{
+		stdcrypto.SHA256: oidSHA256,
+		stdcrypto.SHA384: oidSHA384,
+		stdcrypto.SHA512: oidSHA512,
+	}
+)
+
+// CMSHash returns digest used for CMS message digest of x509 signature
+// algorithm, Ed25519 uses SHA-512 as required by RFC 8419
+func CMSHash(algorithm x509.SignatureAlgorithm) (stdcrypto.Hash, error) {
+	switch algorithm {
+	case x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.ECDSAWithSHA256:
+		return stdcrypto.SHA256, nil
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+		return stdcrypto.SHA384, nil
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512, x509.PureEd25519:
+		return stdcrypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("signature algorithm %v is not supported in CMS", algorithm)
+	}
+}
+
+// cmsSignatureAlgorithm returns CMS signatureAlgorithm identifier
+func cmsSignatureAlgorithm(algorithm x509.SignatureAlgorithm, hash stdcrypto.Hash) (pkix.AlgorithmIdentifier, error) {
+	switch algorithm {
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1Null}, nil
+	case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		params, err := pssParameters(hash)
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, err
+		}
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSASSAPSS, Parameters: asn1.RawValue{FullBytes: params}}, nil
+	case x509.ECDSAWithSHA256:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	case x509.ECDSAWithSHA384:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA384}, nil
+	case x509.ECDSAWithSHA512:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA512}, nil
+	case x509.PureEd25519:
+		return pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("signature algorithm %v is not supported in CMS", algorithm)
+	}
+}
+
+// pssParameters encodes RSASSA-PSS-params with MGF1 over the same hash and
+// salt as long as hash, the only PSS variant X.509 signatures are made with
+func pssParameters(hash stdcrypto.Hash) ([]byte, error) {
+	hashAlg := pkix.AlgorithmIdentifier{Algorithm: digestAlgorithmsByHash[hash], Parameters: asn1Null}
+	mgfParams, err := asn1.Marshal(hashAlg)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(struct {
+		Hash       pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+		MGF        pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+		SaltLength int                      `asn1:"explicit,tag:2"`
+	}{
+		Hash:       hashAlg,
+		MGF:        pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgfParams}},
+		SaltLength: hash.Size(),
+	})
+}
+
+// x509AlgorithmFromCMS maps CMS signature and digest algorithms back to x509
+// signature algorithm used to check signature with signer certificate
+func x509AlgorithmFromCMS(signature asn1.ObjectIdentifier, hash stdcrypto.Hash) (x509.SignatureAlgorithm, error) {
+	byHash := func(sha256, sha384, sha512 x509.SignatureAlgorithm) x509.SignatureAlgorithm {
+		return map[stdcrypto.Hash]x509.SignatureAlgorithm{
+			stdcrypto.SHA256: sha256, stdcrypto.SHA384: sha384, stdcrypto.SHA512: sha512,
+		}[hash]
+	}
+	switch {
+	case signature.Equal(oidRSAEncryption):
+		return byHash(x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA), nil
+	case signature.Equal(oidRSASSAPSS):
+		return byHash(x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS), nil
+	case signature.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, nil
+	case signature.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, nil
+	case signature.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, nil
+	case signature.Equal(oidEd25519):
+		return x509.PureEd25519, nil
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported CMS signature algorithm %v", signature)
+	}
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type cmsIssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                cmsIssuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsEncapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	// EContent is [0] EXPLICIT OCTET STRING, asn1 doesn't apply explicit
+	// tagging to RawValue, so it holds the wrapper
+	EContent asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// content returns encapsulated content, nil when it's detached
+func (e cmsEncapsulatedContentInfo) content() ([]byte, error) {
+	if len(e.EContent.FullBytes) == 0 {
+		return nil, nil
+	}
+	var content []byte
+	if rest, err := asn1.Unmarshal(e.EContent.Bytes, &content); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed encapsulated content: %v", err)
+	}
+	if content == nil {
+		content = []byte{}
+	}
+	return content, nil
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo cmsEncapsulatedContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// derSet encodes DER SET OF already encoded elements, DER requires them sorted
+func derSet(elements [][]byte) []byte {
+	sorted := slices.Clone(elements)
+	slices.SortFunc(sorted, bytes.Compare)
+	set, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(sorted, nil)})
+	return set
+}
+
+func attribute(oid asn1.ObjectIdentifier, value any) ([]byte, error) {
+	encoded, err := asn1.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(cmsAttribute{Type: oid, Values: asn1.RawValue{FullBytes: derSet([][]byte{encoded})}})
+}
+
+// SignDetachedCMS creates DER CMS SignedData (RFC 5652) over content digest,
+// content itself is not included. Signed attributes carry content type,
+// signing time and message digest, signer is identified by issuer and serial
+// of certificate, first one in chain. Signer hashes signed attributes itself
+// and has to sign with algorithm; ECDSA signatures have to be ASN.1 DER.
+func SignDetachedCMS(digest []byte, chain [][]byte, signingTime time.Time, signer Signer, algorithm x509.SignatureAlgorithm) ([]byte, error) {
+	signingTimeAttr, err := attribute(oidAttrSigningTime, signingTime.UTC().Truncate(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	return signCMS(oidData, nil, digest, [][]byte{signingTimeAttr}, chain, signer, algorithm)
+}
+
+// signCMS creates DER CMS SignedData with single signer. Signed attributes
+// carry content type, message digest and extra attributes. Content is
+// encapsulated unless it's nil, digest is always digest of content.
+func signCMS(contentType asn1.ObjectIdentifier, content, digest []byte, extraAttrs [][]byte, chain [][]byte, signer Signer, algorithm x509.SignatureAlgorithm) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("signer certificate is required")
+	}
+	cert, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, err
+	}
+	hash, err := CMSHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(digest) != hash.Size() {
+		return nil, fmt.Errorf("digest has %d bytes, %v needs %d", len(digest), hash, hash.Size())
+	}
+	sigAlg, err := cmsSignatureAlgorithm(algorithm, hash)
+	if err != nil {
+		return nil, err
+	}
+	digestAlg := pkix.AlgorithmIdentifier{Algorithm: digestAlgorithmsByHash[hash]}
+
+	attrs := slices.Clone(extraAttrs)
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidAttrContentType, contentType},
+		{oidAttrMessageDigest, digest},
+	} {
+		encoded, err := attribute(a.oid, a.value)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, encoded)
+	}
+	// signature covers attributes encoded as SET OF, in SignerInfo they
+	// are [0] IMPLICIT
+	signedAttrs := derSet(attrs)
+	signature, err := signer.Sign(signedAttrs)
+	if err != nil {
+		return nil, err
+	}
+	var implicitAttrs asn1.RawValue
+	if _, err := asn1.Unmarshal(signedAttrs, &implicitAttrs); err != nil {
+		return nil, err
+	}
+	implicitAttrs = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: implicitAttrs.Bytes}
+
+	digestAlgDER, err := asn1.Marshal(digestAlg)
+	if err != nil {
+		return nil, err
+	}
+	// version 3 is required when encapsulated content is not id-data
+	version := 1
+	encap := cmsEncapsulatedContentInfo{EContentType: contentType}
+	if !contentType.Equal(oidData) {
+		version = 3
+	}
+	if content != nil {
+		// asn1 ignores tagging of RawValue when marshaling, [0] EXPLICIT
+		// wrapper around OCTET STRING is built here
+		octets, err := asn1.Marshal(content)
+		if err != nil {
+			return nil, err
+		}
+		encap.EContent = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets}
+	}
+	signedData, err := asn1.Marshal(cmsSignedData{
+		Version:          version,
+		DigestAlgorithms: asn1.RawValue{FullBytes: derSet([][]byte{digestAlgDER})},
+		EncapContentInfo: encap,
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: bytes.Join(chain, nil)},
+		SignerInfos: []cmsSignerInfo{{
+			Version:            1,
+			SID:                cmsIssuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: cert.SerialNumber},
+			DigestAlgorithm:    digestAlg,
+			SignedAttrs:        implicitAttrs,
+			SignatureAlgorithm: sigAlg,
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// CMSVerification describes verified detached CMS signature
+type CMSVerification struct {
+	// Signer is certificate which signed, it chains to one of trusted roots
+	Signer      *x509.Certificate
+	SigningTime time.Time
+	Digest      stdcrypto.Hash
+}
+
+// VerifyDetachedCMS checks detached CMS SignedData with single signer over
+// content. Signer certificate has to be included in signature and chain to
+// roots, it's checked at signing time when present.
+func VerifyDetachedCMS(der []byte, content io.Reader, roots *x509.CertPool) (*CMSVerification, error) {
+	sc, err := parseSignedCMS(der)
+	if err != nil {
+		return nil, err
+	}
+	if sc.content != nil {
+		return nil, errors.New("CMS signature is not detached")
+	}
+	if !sc.contentType.Equal(oidData) {
+		return nil, errors.New("content type attribute must be id-data")
+	}
+
+	h := sc.hash.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(h.Sum(nil), sc.messageDigest) {
+		return nil, errors.New("message digest doesn't match content")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: sc.intermediates,
+		CurrentTime:   sc.signingTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if _, err := sc.signer.Verify(opts); err != nil {
+		return nil, fmt.Errorf("signer certificate is not trusted: %w", err)
+	}
+	return &CMSVerification{Signer: sc.signer, SigningTime: sc.signingTime, Digest: sc.hash}, nil
+}
+
+// signedCMS is CMS SignedData whose signature over signed attributes was
+// checked with included signer certificate, trust in certificate is not
+// established yet
+type signedCMS struct {
+	contentType asn1.ObjectIdentifier
+	// content is nil for detached signatures
+	content       []byte
+	signer        *x509.Certificate
+	intermediates *x509.CertPool
+	hash          stdcrypto.Hash
+	messageDigest []byte
+	signingTime   time.Time
+	// attrs are all signed attributes, including the ones decoded above
+	attrs []cmsAttribute
+}
+
+// parseSignedCMS decodes CMS SignedData with single signer identified by
+// issuer and serial and checks signature over its signed attributes
+func parseSignedCMS(der []byte) (*signedCMS, error) {
+	var ci cmsContentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed CMS content info: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("CMS content is not SignedData")
+	}
+	var sd cmsSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("malformed CMS SignedData: %w", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("expected single signer, got %d", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+	sc := &signedCMS{intermediates: x509.NewCertPool()}
+	var err error
+	if sc.content, err = sd.EncapContentInfo.content(); err != nil {
+		return nil, err
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("malformed certificates: %w", err)
+	}
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, si.SID.Issuer.FullBytes) && c.SerialNumber.Cmp(si.SID.Serial) == 0 {
+			sc.signer = c
+			continue
+		}
+		sc.intermediates.AddCert(c)
+	}
+	if sc.signer == nil {
+		return nil, errors.New("signer certificate is not included")
+	}
+
+	for h, oid := range digestAlgorithmsByHash {
+		if si.DigestAlgorithm.Algorithm.Equal(oid) {
+			sc.hash = h
+		}
+	}
+	if sc.hash == 0 {
+		return nil, fmt.Errorf("unsupported digest algorithm %v", si.DigestAlgorithm.Algorithm)
+	}
+
+	if len(si.SignedAttrs.Bytes) == 0 {
+		return nil, errors.New("signed attributes are required")
+	}
+	if _, err := asn1.UnmarshalWithParams(si.SignedAttrs.FullBytes, &sc.attrs, "set,tag:0"); err != nil {
+		return nil, fmt.Errorf("malformed signed attributes: %w", err)
+	}
+	for _, a := range sc.attrs {
+		var value asn1.RawValue
+		rest, err := asn1.Unmarshal(a.Values.FullBytes, &value)
+		if err == nil {
+			// SET OF with single value
+			switch {
+			case a.Type.Equal(oidAttrContentType):
+				rest, err = asn1.Unmarshal(value.Bytes, &sc.contentType)
+			case a.Type.Equal(oidAttrMessageDigest):
+				rest, err = asn1.Unmarshal(value.Bytes, &sc.messageDigest)
+			case a.Type.Equal(oidAttrSigningTime):
+				rest, err = asn1.Unmarshal(value.Bytes, &sc.signingTime)
+			}
+		}
+		if err != nil || len(rest) > 0 {
+			return nil, fmt.Errorf("malformed attribute %v", a.Type)
+		}
+	}
+	if !sc.contentType.Equal(sd.EncapContentInfo.EContentType) {
+		return nil, errors.New("content type attribute doesn't match encapsulated content type")
+	}
+
+	algorithm, err := x509AlgorithmFromCMS(si.SignatureAlgorithm.Algorithm, sc.hash)
+	if err != nil {
+		return nil, err
+	}
+	// signature covers attributes with universal SET tag
+	signedAttrs := slices.Clone(si.SignedAttrs.FullBytes)
+	signedAttrs[0] = 0x31
+	if err := sc.signer.CheckSignature(algorithm, signedAttrs, si.Signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return sc, nil
+}
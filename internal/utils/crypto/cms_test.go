@@ -0,0 +1,269 @@
+package crypto_test
+
+import (
+	"bytes"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// testCA returns freshly generated CA with its root certificate
+func testCA(t *testing.T) (*crypto.CertificateAuthority, *x509.Certificate) {
+	t.Helper()
+	material, err := crypto.GenerateCertificateAuthority("Test", time.Hour)
+	if err != nil {
+		t.Fatalf("generate CA: %v", err)
+	}
+	parse := func(data []byte) *x509.Certificate {
+		block, _ := pem.Decode(data)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("parse CA certificate: %v", err)
+		}
+		return cert
+	}
+	key, err := crypto.ParseCAKey(material.IntermediateKey)
+	if err != nil {
+		t.Fatalf("parse CA key: %v", err)
+	}
+	root := parse(material.RootCert)
+	ca, err := crypto.NewCertificateAuthority(root, parse(material.IntermediateCert), key, time.Hour)
+	if err != nil {
+		t.Fatalf("load CA: %v", err)
+	}
+	return ca, root
+}
+
+// cmsSigner is key with matching signer and x509 signature algorithm
+type cmsSigner struct {
+	name      string
+	public    stdcrypto.PublicKey
+	signer    crypto.Signer
+	algorithm x509.SignatureAlgorithm
+}
+
+func cmsSigners(t *testing.T) []cmsSigner {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate P-256 key: %v", err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate P-384 key: %v", err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	return []cmsSigner{
+		{"RSA PKCS1v15 SHA-256", &rsaKey.PublicKey,
+			&crypto.RSASigner{PrivateKey: rsaKey, Hash: crypto.HashSHA256, Padding: crypto.PaddingPKCS1v15}, x509.SHA256WithRSA},
+		{"RSA PSS SHA-384", &rsaKey.PublicKey,
+			&crypto.RSASigner{PrivateKey: rsaKey, Hash: crypto.HashSHA384, Padding: crypto.PaddingPSS}, x509.SHA384WithRSAPSS},
+		{"ECDSA P-256 SHA-256", &p256.PublicKey,
+			&crypto.ECCSigner{PrivateKey: p256, Encoding: crypto.EncodingASN1DER, Hash: crypto.HashSHA256}, x509.ECDSAWithSHA256},
+		{"ECDSA P-384 SHA-384", &p384.PublicKey,
+			&crypto.ECCSigner{PrivateKey: p384, Encoding: crypto.EncodingASN1DER, Hash: crypto.HashSHA384}, x509.ECDSAWithSHA384},
+		{"Ed25519", edPublic, &crypto.Ed25519Signer{PrivateKey: edPrivate}, x509.PureEd25519},
+	}
+}
+
+// signDetached signs content with certificate issued by CA for signer key
+func signDetached(t *testing.T, ca *crypto.CertificateAuthority, s cmsSigner, content []byte, signingTime time.Time) []byte {
+	t.Helper()
+	chain, err := ca.Issue(crypto.CertificateSubject{DeviceID: "dev-1"}, s.public)
+	if err != nil {
+		t.Fatalf("issue certificate: %v", err)
+	}
+	hash, err := crypto.CMSHash(s.algorithm)
+	if err != nil {
+		t.Fatalf("CMS hash: %v", err)
+	}
+	h := hash.New()
+	h.Write(content)
+	der, err := crypto.SignDetachedCMS(h.Sum(nil), chain, signingTime, s.signer, s.algorithm)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return der
+}
+
+func TestDetachedCMS_RoundTrip(t *testing.T) {
+	ca, _ := testCA(t)
+	content := []byte("document to be signed")
+	signingTime := time.Now().Add(-time.Second).Truncate(time.Second)
+	for _, s := range cmsSigners(t) {
+		t.Run(s.name, func(t *testing.T) {
+			der := signDetached(t, ca, s, content, signingTime)
+			v, err := crypto.VerifyDetachedCMS(der, bytes.NewReader(content), ca.Roots())
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if !v.SigningTime.Equal(signingTime) {
+				t.Errorf("expected signing time %v, got %v", signingTime, v.SigningTime)
+			}
+			if v.Signer.Subject.CommonName != "dev-1" {
+				t.Errorf("expected signer dev-1, got %q", v.Signer.Subject.CommonName)
+			}
+
+			if _, err := crypto.VerifyDetachedCMS(der, bytes.NewReader([]byte("other document")), ca.Roots()); err == nil {
+				t.Error("expected other content to fail")
+			}
+			other, _ := testCA(t)
+			if _, err := crypto.VerifyDetachedCMS(der, bytes.NewReader(content), other.Roots()); err == nil {
+				t.Error("expected untrusted chain to fail")
+			}
+			tampered := bytes.Clone(der)
+			tampered[len(tampered)-1] ^= 0x01
+			if _, err := crypto.VerifyDetachedCMS(tampered, bytes.NewReader(content), ca.Roots()); err == nil {
+				t.Error("expected tampered signature to fail")
+			}
+		})
+	}
+}
+
+func TestSignDetachedCMS_Errors(t *testing.T) {
+	ca, _ := testCA(t)
+	s := cmsSigners(t)[2]
+	chain, err := ca.Issue(crypto.CertificateSubject{DeviceID: "dev-1"}, s.public)
+	if err != nil {
+		t.Fatalf("issue certificate: %v", err)
+	}
+	tests := map[string]struct {
+		digest    []byte
+		chain     [][]byte
+		algorithm x509.SignatureAlgorithm
+	}{
+		"no chain":              {digest: make([]byte, 32), algorithm: s.algorithm},
+		"malformed certificate": {digest: make([]byte, 32), chain: [][]byte{{0x30, 0x00}}, algorithm: s.algorithm},
+		"short digest":          {digest: make([]byte, 20), chain: chain, algorithm: s.algorithm},
+		"unsupported algorithm": {digest: make([]byte, 32), chain: chain, algorithm: x509.SHA1WithRSA},
+	}
+	for name, tt := range tests {
+		if _, err := crypto.SignDetachedCMS(tt.digest, tt.chain, time.Now(), s.signer, tt.algorithm); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// opensslCMS runs openssl cms in dir, test is skipped without openssl and
+// for Ed25519 with OpenSSL releases before 3.2, which can't use it in CMS
+func opensslCMS(t *testing.T, dir string, args ...string) ([]byte, error) {
+	t.Helper()
+	path, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl is not installed")
+	}
+	cmd := exec.Command(path, append([]string{"cms"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil && strings.Contains(string(out), "eddsa_digest_signverify_init") {
+		t.Skip("openssl doesn't support Ed25519 in CMS")
+	}
+	return out, err
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+// TestDetachedCMS_OpenSSLVerify checks signatures with independent CMS
+// implementation, openssl cms -verify
+func TestDetachedCMS_OpenSSLVerify(t *testing.T) {
+	ca, root := testCA(t)
+	dir := t.TempDir()
+	content := []byte("document to be signed\n")
+	writeFile(t, filepath.Join(dir, "content"), content)
+	writeFile(t, filepath.Join(dir, "other"), []byte("other document\n"))
+	writeFile(t, filepath.Join(dir, "root.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))
+
+	for _, s := range cmsSigners(t) {
+		t.Run(s.name, func(t *testing.T) {
+			writeFile(t, filepath.Join(dir, "sig.der"), signDetached(t, ca, s, content, time.Now()))
+			verify := []string{"-verify", "-binary", "-inform", "DER", "-in", "sig.der", "-CAfile", "root.pem", "-purpose", "any", "-out", os.DevNull}
+			if out, err := opensslCMS(t, dir, append(verify, "-content", "content")...); err != nil {
+				t.Fatalf("openssl cms -verify: %v\n%s", err, out)
+			}
+			if out, err := opensslCMS(t, dir, append(verify, "-content", "other")...); err == nil {
+				t.Fatalf("expected openssl to reject other content\n%s", out)
+			}
+		})
+	}
+}
+
+// TestVerifyDetachedCMS_OpenSSLSigned checks signatures made by openssl cms
+// -sign, which adds signed attributes of its own
+func TestVerifyDetachedCMS_OpenSSLSigned(t *testing.T) {
+	ca, _ := testCA(t)
+	dir := t.TempDir()
+	content := []byte("document to be signed\n")
+	writeFile(t, filepath.Join(dir, "content"), content)
+
+	for _, s := range cmsSigners(t) {
+		t.Run(s.name, func(t *testing.T) {
+			var key stdcrypto.Signer
+			var keyOpts []string
+			switch signer := s.signer.(type) {
+			case *crypto.RSASigner:
+				key = signer.PrivateKey
+				if signer.Padding == crypto.PaddingPSS {
+					keyOpts = []string{"-keyopt", "rsa_padding_mode:pss", "-keyopt", "rsa_pss_saltlen:digest"}
+				}
+			case *crypto.ECCSigner:
+				key = signer.PrivateKey
+			case *crypto.Ed25519Signer:
+				key = signer.PrivateKey
+			}
+			keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+			if err != nil {
+				t.Fatalf("marshal key: %v", err)
+			}
+			chain, err := ca.Issue(crypto.CertificateSubject{DeviceID: "dev-1"}, s.public)
+			if err != nil {
+				t.Fatalf("issue certificate: %v", err)
+			}
+			writeFile(t, filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+			writeFile(t, filepath.Join(dir, "cert.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain[0]}))
+			writeFile(t, filepath.Join(dir, "chain.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain[1]}))
+
+			hash, err := crypto.CMSHash(s.algorithm)
+			if err != nil {
+				t.Fatalf("CMS hash: %v", err)
+			}
+			md := map[stdcrypto.Hash]string{stdcrypto.SHA256: "sha256", stdcrypto.SHA384: "sha384", stdcrypto.SHA512: "sha512"}[hash]
+			sign := []string{"-sign", "-binary", "-md", md, "-in", "content", "-signer", "cert.pem",
+				"-inkey", "key.pem", "-certfile", "chain.pem", "-outform", "DER", "-out", "sig.der"}
+			if out, err := opensslCMS(t, dir, append(sign, keyOpts...)...); err != nil {
+				t.Fatalf("openssl cms -sign: %v\n%s", err, out)
+			}
+			der, err := os.ReadFile(filepath.Join(dir, "sig.der"))
+			if err != nil {
+				t.Fatalf("read signature: %v", err)
+			}
+			if _, err := crypto.VerifyDetachedCMS(der, bytes.NewReader(content), ca.Roots()); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/cbor"
+)
+
+// COSE header labels (RFC 9052)
+const (
+	COSEHeaderAlg int64 = 1
+	COSEHeaderKid int64 = 4
+)
+
+// coseSign1Tag is CBOR tag of COSE_Sign1 message
+const coseSign1Tag = 18
+
+// coseAlgorithms maps JWS algorithm names to COSE algorithm identifiers
+// (RFC 9053, RFC 8812), both registries describe the same signatures
+var coseAlgorithms = map[string]int64{
+	"ES256": -7,
+	"ES384": -35,
+	"ES512": -36,
+	"EdDSA": -8,
+	"PS256": -37,
+	"PS384": -38,
+	"PS512": -39,
+	"RS256": -257,
+	"RS384": -258,
+	"RS512": -259,
+}
+
+// COSEAlgorithm returns COSE algorithm identifier of JWS algorithm
+func COSEAlgorithm(jwsAlgorithm string) (int64, error) {
+	alg, ok := coseAlgorithms[jwsAlgorithm]
+	if !ok {
+		return 0, fmt.Errorf("algorithm %q has no COSE identifier", jwsAlgorithm)
+	}
+	return alg, nil
+}
+
+// COSESign1 is decoded COSE_Sign1 message
+type COSESign1 struct {
+	Protected   map[any]any
+	Unprotected map[any]any
+	Payload     []byte
+	Signature   []byte
+	// protectedRaw is serialized protected header covered by signature
+	protectedRaw []byte
+}
+
+// SignCOSESign1 creates tagged COSE_Sign1 message with attached payload.
+// ECDSA signer has to produce IEEE P1363 signatures.
+func SignCOSESign1(protected map[any]any, payload []byte, signer Signer) ([]byte, error) {
+	protectedRaw, err := cbor.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	toBeSigned, err := sigStructure(protectedRaw, payload)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(toBeSigned)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(cbor.Tag{Number: coseSign1Tag, Content: []any{
+		protectedRaw, map[any]any{}, payload, signature,
+	}})
+}
+
+// ParseCOSESign1 decodes COSE_Sign1 message, tag is optional
+func ParseCOSESign1(data []byte) (*COSESign1, error) {
+	v, err := cbor.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if tag, ok := v.(cbor.Tag); ok {
+		if tag.Number != coseSign1Tag {
+			return nil, fmt.Errorf("unexpected CBOR tag %d, expected COSE_Sign1", tag.Number)
+		}
+		v = tag.Content
+	}
+	parts, ok := v.([]any)
+	if !ok || len(parts) != 4 {
+		return nil, errors.New("COSE_Sign1 must be array of 4 items")
+	}
+
+	msg := &COSESign1{}
+	var okProtected, okUnprotected, okPayload, okSignature bool
+	msg.protectedRaw, okProtected = parts[0].([]byte)
+	msg.Unprotected, okUnprotected = parts[1].(map[any]any)
+	msg.Payload, okPayload = parts[2].([]byte)
+	msg.Signature, okSignature = parts[3].([]byte)
+	if !okProtected || !okUnprotected || !okPayload || !okSignature {
+		return nil, errors.New("malformed COSE_Sign1, detached payloads are not supported")
+	}
+
+	msg.Protected = map[any]any{}
+	if len(msg.protectedRaw) > 0 {
+		header, err := cbor.Unmarshal(msg.protectedRaw)
+		if err != nil {
+			return nil, fmt.Errorf("protected header: %w", err)
+		}
+		if msg.Protected, ok = header.(map[any]any); !ok {
+			return nil, errors.New("protected header must be map")
+		}
+	}
+	return msg, nil
+}
+
+// Marshal encodes message as tagged COSE_Sign1, protected header keeps bytes
+// covered by signature
+func (m *COSESign1) Marshal() ([]byte, error) {
+	unprotected := m.Unprotected
+	if unprotected == nil {
+		unprotected = map[any]any{}
+	}
+	return cbor.Marshal(cbor.Tag{Number: coseSign1Tag, Content: []any{
+		m.protectedRaw, unprotected, m.Payload, m.Signature,
+	}})
+}
+
+// Verify checks message signature, verifier has to accept IEEE P1363 ECDSA
+// signatures
+func (m *COSESign1) Verify(verifier Verifier) error {
+	toBeSigned, err := sigStructure(m.protectedRaw, m.Payload)
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(toBeSigned, m.Signature)
+}
+
+// sigStructure encodes Sig_structure signed by COSE_Sign1, external AAD is empty
+func sigStructure(protectedRaw, payload []byte) ([]byte, error) {
+	return cbor.Marshal([]any{"Signature1", protectedRaw, []byte{}, payload})
+}
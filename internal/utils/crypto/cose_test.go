@@ -0,0 +1,235 @@
+package crypto_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/cbor"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// RFC 9052 Appendix C.2.1, single ES256 signature with key "11"
+const (
+	rfc9052Sign1 = "d28443a10126a10442313154546869732069732074686520636f6e74656e742e" +
+		"58408eb33e4ca31d1c465ab05aac34cc6b23d58fef5c083106c4d25a91aef0b0117e" +
+		"2af9a291aa32e14ab834dc56ed2a223444547e01f11d3b0916e5a4c345cacb36"
+	rfc9052ToBeSigned = "846a5369676e61747572653143a101264054546869732069732074686520636f6e74656e742e"
+	rfc9052KeyX       = "bac5b11cad8f99f9c72b05cf4b9e26d244dc189f745228255a219a86d6a09eff"
+	rfc9052KeyY       = "20138bf82dc1b6d562be0fa54ab7804a3a64b6d72ccfed6b6fb6ed28bbfc117e"
+)
+
+func rfc9052Verifier(t *testing.T) *crypto.ECCVerifier {
+	t.Helper()
+	return &crypto.ECCVerifier{
+		PublicKey: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(mustHex(t, rfc9052KeyX)),
+			Y:     new(big.Int).SetBytes(mustHex(t, rfc9052KeyY)),
+		},
+		Encoding: crypto.EncodingP1363,
+		Hash:     crypto.HashSHA256,
+	}
+}
+
+// recordingSigner returns fixed signature and keeps data it was asked to sign
+type recordingSigner struct {
+	signed    []byte
+	signature []byte
+}
+
+func (s *recordingSigner) Sign(data []byte) ([]byte, error) {
+	s.signed = data
+	return s.signature, nil
+}
+
+func TestParseCOSESign1_RFC9052(t *testing.T) {
+	msg, err := crypto.ParseCOSESign1(mustHex(t, rfc9052Sign1))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if alg := msg.Protected[crypto.COSEHeaderAlg]; alg != int64(-7) {
+		t.Errorf("expected ES256 in protected header, got %v", alg)
+	}
+	if kid, _ := msg.Unprotected[crypto.COSEHeaderKid].([]byte); string(kid) != "11" {
+		t.Errorf("expected kid 11 in unprotected header, got %v", msg.Unprotected[crypto.COSEHeaderKid])
+	}
+	if string(msg.Payload) != "This is the content." {
+		t.Errorf("unexpected payload %q", msg.Payload)
+	}
+	if err := msg.Verify(rfc9052Verifier(t)); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	msg.Payload = []byte("This is other content.")
+	if err := msg.Verify(rfc9052Verifier(t)); err == nil {
+		t.Error("expected changed payload to fail")
+	}
+}
+
+func TestSignCOSESign1_RFC9052(t *testing.T) {
+	want, err := crypto.ParseCOSESign1(mustHex(t, rfc9052Sign1))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	signer := &recordingSigner{signature: want.Signature}
+	signed, err := crypto.SignCOSESign1(map[any]any{crypto.COSEHeaderAlg: -7}, want.Payload, signer)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if !bytes.Equal(signer.signed, mustHex(t, rfc9052ToBeSigned)) {
+		t.Errorf("expected Sig_structure %s, got %x", rfc9052ToBeSigned, signer.signed)
+	}
+
+	// message differs from example only by empty unprotected header
+	msg, err := crypto.ParseCOSESign1(signed)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(msg.Unprotected) != 0 {
+		t.Errorf("expected empty unprotected header, got %v", msg.Unprotected)
+	}
+	if err := msg.Verify(rfc9052Verifier(t)); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+}
+
+func TestCOSESign1_MarshalKeepsSignature(t *testing.T) {
+	msg, err := crypto.ParseCOSESign1(mustHex(t, rfc9052Sign1))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	// unprotected header isn't covered by signature
+	msg.Unprotected["note"] = []byte{0x01, 0x02}
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if msg, err = crypto.ParseCOSESign1(data); err != nil {
+		t.Fatalf("parse marshaled: %v", err)
+	}
+	if note, _ := msg.Unprotected["note"].([]byte); !bytes.Equal(note, []byte{0x01, 0x02}) {
+		t.Errorf("expected unprotected header to round trip, got %v", msg.Unprotected)
+	}
+	if err := msg.Verify(rfc9052Verifier(t)); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	// message without changes encodes to the same bytes
+	msg, _ = crypto.ParseCOSESign1(mustHex(t, rfc9052Sign1))
+	if data, err = msg.Marshal(); err != nil || !bytes.Equal(data, mustHex(t, rfc9052Sign1)) {
+		t.Errorf("expected RFC 9052 example to encode back, got %x (%v)", data, err)
+	}
+}
+
+func TestCOSESign1_RoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate P-384 key: %v", err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	tests := map[string]struct {
+		jws      string
+		signer   crypto.Signer
+		verifier crypto.Verifier
+	}{
+		"PS256": {
+			jws:      "PS256",
+			signer:   &crypto.RSASigner{PrivateKey: rsaKey, Hash: crypto.HashSHA256, Padding: crypto.PaddingPSS},
+			verifier: &crypto.RSAVerifier{PublicKey: &rsaKey.PublicKey, Hash: crypto.HashSHA256, Padding: crypto.PaddingPSS},
+		},
+		"ES384": {
+			jws:      "ES384",
+			signer:   &crypto.ECCSigner{PrivateKey: p384, Encoding: crypto.EncodingP1363, Hash: crypto.HashSHA384},
+			verifier: &crypto.ECCVerifier{PublicKey: &p384.PublicKey, Encoding: crypto.EncodingP1363, Hash: crypto.HashSHA384},
+		},
+		"EdDSA": {
+			jws:      "EdDSA",
+			signer:   &crypto.Ed25519Signer{PrivateKey: edPrivate},
+			verifier: &crypto.Ed25519Verifier{PublicKey: edPublic},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			alg, err := crypto.COSEAlgorithm(tt.jws)
+			if err != nil {
+				t.Fatalf("algorithm: %v", err)
+			}
+			payload := []byte{0x00, 0xff, 'd', 'a', 't', 'a'}
+			signed, err := crypto.SignCOSESign1(map[any]any{crypto.COSEHeaderAlg: alg, crypto.COSEHeaderKid: []byte("dev-1")}, payload, tt.signer)
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			msg, err := crypto.ParseCOSESign1(signed)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if msg.Protected[crypto.COSEHeaderAlg] != alg || !bytes.Equal(msg.Payload, payload) {
+				t.Fatal("expected protected header and payload to round trip")
+			}
+			if err := msg.Verify(tt.verifier); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+
+			// protected header is covered by signature
+			tampered := bytes.Clone(signed)
+			tampered[bytes.Index(signed, []byte("dev-1"))] = 'x'
+			if msg, err = crypto.ParseCOSESign1(tampered); err != nil {
+				t.Fatalf("parse tampered: %v", err)
+			}
+			if err := msg.Verify(tt.verifier); err == nil {
+				t.Error("expected tampered protected header to fail")
+			}
+		})
+	}
+
+	if _, err := crypto.COSEAlgorithm("HS256"); err == nil {
+		t.Error("expected HS256 to have no COSE identifier")
+	}
+}
+
+func TestParseCOSESign1_Malformed(t *testing.T) {
+	marshal := func(v any) []byte {
+		data, err := cbor.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		return data
+	}
+	header := marshal(map[any]any{crypto.COSEHeaderAlg: -7})
+	tests := map[string][]byte{
+		"not CBOR":          {0xff},
+		"other tag":         marshal(cbor.Tag{Number: 98, Content: []any{header, map[any]any{}, []byte{}, []byte{}}}),
+		"not array":         marshal(map[any]any{}),
+		"three items":       marshal([]any{header, map[any]any{}, []byte{}}),
+		"detached payload":  marshal([]any{header, map[any]any{}, nil, []byte{}}),
+		"text payload":      marshal([]any{header, map[any]any{}, "payload", []byte{}}),
+		"header not bytes":  marshal([]any{map[any]any{}, map[any]any{}, []byte{}, []byte{}}),
+		"header not map":    marshal([]any{marshal([]any{}), map[any]any{}, []byte{}, []byte{}}),
+		"header not CBOR":   marshal([]any{[]byte{0xff}, map[any]any{}, []byte{}, []byte{}}),
+		"unprotected array": marshal([]any{header, []any{}, []byte{}, []byte{}}),
+		"signature missing": marshal([]any{header, map[any]any{}, []byte{}, nil}),
+	}
+	for name, data := range tests {
+		if _, err := crypto.ParseCOSESign1(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	// untagged message and empty protected header are valid
+	if _, err := crypto.ParseCOSESign1(marshal([]any{[]byte{}, map[any]any{}, []byte{}, []byte{}})); err != nil {
+		t.Errorf("expected untagged message to parse: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package crypto
+
+import (
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// SignatureEncoding describes how ECDSA (r, s) pair is serialized
+type SignatureEncoding string
+
+const (
+	// EncodingASN1DER is ASN.1 DER encoded ECDSA-Sig-Value, default encoding
+	EncodingASN1DER SignatureEncoding = "ASN1_DER"
+	// EncodingP1363 is IEEE P1363 fixed-width r||s, each padded to curve size
+	EncodingP1363 SignatureEncoding = "P1363"
+	// EncodingLegacyRaw is unpadded r||s produced by first version of ECCSigner,
+	// supported only for verification of already stored signatures
+	EncodingLegacyRaw SignatureEncoding = "LEGACY_RAW"
+)
+
+// SigningEncodings lists encodings which can be selected for new signatures
+var SigningEncodings = []SignatureEncoding{EncodingASN1DER, EncodingP1363}
+
+// ErrUnsupportedEncoding is returned for unknown signature encoding
+var ErrUnsupportedEncoding = errors.New("unsupported signature encoding")
+
+// encodeP1363 serializes r and s as fixed-width big endian integers
+func encodeP1363(r, s *big.Int, size int) []byte {
+	out := make([]byte, 2*size)
+	r.FillBytes(out[:size])
+	s.FillBytes(out[size:])
+	return out
+}
+
+// decodeP1363 splits fixed-width signature into r and s
+func decodeP1363(signature []byte, size int) (*big.Int, *big.Int, error) {
+	if len(signature) != 2*size {
+		return nil, nil, ErrInvalidSignature
+	}
+	return new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:]), nil
+}
+
+// ecdsaSignature is ASN.1 ECDSA-Sig-Value
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// p1363ToASN1 converts fixed-width r||s into ASN.1 DER, used for signatures
+// produced outside of Go crypto (e.g. by PKCS#11 tokens)
+func p1363ToASN1(signature []byte, size int) ([]byte, error) {
+	r, s, err := decodeP1363(signature, size)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(ecdsaSignature{R: r, S: s})
+}
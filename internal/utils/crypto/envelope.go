@@ -0,0 +1,254 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// masterKeySize is size of key-encryption key and per device data keys (AES-256)
+const masterKeySize = 32
+
+var (
+	// ErrUnknownKeyVersion is returned when private key was wrapped with master
+	// key which isn't present in configured key ring
+	ErrUnknownKeyVersion = errors.New("unknown master key version")
+	// ErrEncryptionDisabled is returned by plaintext encryptor for keys which
+	// were already wrapped with master key
+	ErrEncryptionDisabled = errors.New("private key is encrypted but no master key is configured")
+)
+
+// KeyEncryptor protects device private keys at rest. Sealed key is stored
+// together with version of master key used to wrap it; empty version means
+// key was stored in plaintext before encryption was enabled. Associated data
+// (device ID) binds sealed key to its owner, key moved to other record can't
+// be opened.
+type KeyEncryptor interface {
+	// Encrypt seals private key with current master key
+	Encrypt(plaintext, associatedData []byte) (sealed []byte, keyVersion string, err error)
+	// Decrypt opens private key sealed with given master key version
+	Decrypt(sealed []byte, keyVersion string, associatedData []byte) ([]byte, error)
+	// Rewrap moves sealed private key under current master key
+	Rewrap(sealed []byte, keyVersion string, associatedData []byte) ([]byte, string, error)
+	// CurrentVersion returns version of master key used for new keys
+	CurrentVersion() string
+}
+
+// keyEnvelope is persisted form of encrypted private key. Private key is
+// encrypted with random data key and only data key is wrapped with master
+// key, so master key rotation doesn't have to touch key material.
+type keyEnvelope struct {
+	DataKey    []byte `json:"dek"`
+	Ciphertext []byte `json:"data"`
+}
+
+// EnvelopeEncryptor implements KeyEncryptor with AES-256-GCM key ring
+type EnvelopeEncryptor struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewEnvelopeEncryptor creates encryptor from master keys indexed by version,
+// new keys are always wrapped with current version
+func NewEnvelopeEncryptor(keys map[string][]byte, current string) (*EnvelopeEncryptor, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one master key is required")
+	}
+	for version, key := range keys {
+		if version == "" || strings.ContainsAny(version, ":, \t\r\n") {
+			return nil, fmt.Errorf("invalid master key version %q", version)
+		}
+		if len(key) != masterKeySize {
+			return nil, fmt.Errorf("master key %s must be %d bytes long, got %d", version, masterKeySize, len(key))
+		}
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: current version %q", ErrUnknownKeyVersion, current)
+	}
+	return &EnvelopeEncryptor{current: current, keys: keys}, nil
+}
+
+// ParseKeyRing builds encryptor from key ring spec. Spec lists entries in
+// "version:base64key" form separated by commas or new lines. When current is
+// empty the last listed version is used for new keys.
+func ParseKeyRing(spec, current string) (*EnvelopeEncryptor, error) {
+	keys := make(map[string][]byte)
+	last := ""
+	for _, entry := range strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		version, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid key ring entry, expected version:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key %s: %v", version, err)
+		}
+		version = strings.TrimSpace(version)
+		if _, dup := keys[version]; dup {
+			return nil, fmt.Errorf("duplicated master key version %q", version)
+		}
+		keys[version] = key
+		last = version
+	}
+	if current == "" {
+		current = last
+	}
+	return NewEnvelopeEncryptor(keys, current)
+}
+
+// CurrentVersion returns version of master key used for new keys
+func (e *EnvelopeEncryptor) CurrentVersion() string {
+	return e.current
+}
+
+// Encrypt seals private key with fresh data key wrapped by current master key,
+// associated data is authenticated with key ciphertext
+func (e *EnvelopeEncryptor) Encrypt(plaintext, associatedData []byte) ([]byte, string, error) {
+	dataKey := make([]byte, masterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, "", err
+	}
+	ciphertext, err := seal(dataKey, plaintext, associatedData)
+	if err != nil {
+		return nil, "", err
+	}
+	wrapped, err := seal(e.keys[e.current], dataKey, []byte(e.current))
+	if err != nil {
+		return nil, "", err
+	}
+	sealed, err := json.Marshal(keyEnvelope{DataKey: wrapped, Ciphertext: ciphertext})
+	if err != nil {
+		return nil, "", err
+	}
+	return sealed, e.current, nil
+}
+
+// Decrypt opens sealed private key, keys without version are returned as is.
+// Associated data has to be the one key was sealed with.
+func (e *EnvelopeEncryptor) Decrypt(sealed []byte, keyVersion string, associatedData []byte) ([]byte, error) {
+	if keyVersion == "" {
+		return sealed, nil
+	}
+	env, dataKey, err := e.unwrap(sealed, keyVersion)
+	if err != nil {
+		return nil, err
+	}
+	return open(dataKey, env.Ciphertext, associatedData)
+}
+
+// Rewrap re-wraps data key with current master key, plaintext keys are
+// encrypted with associated data. Key ciphertext isn't touched, so it stays
+// bound to associated data it was sealed with.
+func (e *EnvelopeEncryptor) Rewrap(sealed []byte, keyVersion string, associatedData []byte) ([]byte, string, error) {
+	if keyVersion == "" {
+		return e.Encrypt(sealed, associatedData)
+	}
+	env, dataKey, err := e.unwrap(sealed, keyVersion)
+	if err != nil {
+		return nil, "", err
+	}
+	if keyVersion == e.current {
+		return sealed, keyVersion, nil
+	}
+	env.DataKey, err = seal(e.keys[e.current], dataKey, []byte(e.current))
+	if err != nil {
+		return nil, "", err
+	}
+	rewrapped, err := json.Marshal(env)
+	if err != nil {
+		return nil, "", err
+	}
+	return rewrapped, e.current, nil
+}
+
+// unwrap decodes envelope and opens its data key with given master key version
+func (e *EnvelopeEncryptor) unwrap(sealed []byte, keyVersion string) (keyEnvelope, []byte, error) {
+	var env keyEnvelope
+	kek, ok := e.keys[keyVersion]
+	if !ok {
+		return env, nil, fmt.Errorf("%w: %q", ErrUnknownKeyVersion, keyVersion)
+	}
+	if err := json.Unmarshal(sealed, &env); err != nil {
+		return env, nil, fmt.Errorf("malformed key envelope: %v", err)
+	}
+	dataKey, err := open(kek, env.DataKey, []byte(keyVersion))
+	if err != nil {
+		return env, nil, fmt.Errorf("failed to unwrap data key: %v", err)
+	}
+	return env, dataKey, nil
+}
+
+// PlaintextEncryptor keeps private keys unencrypted, used when no master key
+// is configured
+type PlaintextEncryptor struct{}
+
+// Encrypt returns private key as is
+func (PlaintextEncryptor) Encrypt(plaintext, associatedData []byte) ([]byte, string, error) {
+	return plaintext, "", nil
+}
+
+// Decrypt returns private key as is, encrypted keys can't be opened
+func (PlaintextEncryptor) Decrypt(sealed []byte, keyVersion string, associatedData []byte) ([]byte, error) {
+	if keyVersion != "" {
+		return nil, ErrEncryptionDisabled
+	}
+	return sealed, nil
+}
+
+// Rewrap is no-op for plaintext keys
+func (p PlaintextEncryptor) Rewrap(sealed []byte, keyVersion string, associatedData []byte) ([]byte, string, error) {
+	if keyVersion != "" {
+		return nil, "", ErrEncryptionDisabled
+	}
+	return sealed, "", nil
+}
+
+// CurrentVersion is empty, keys are not wrapped
+func (PlaintextEncryptor) CurrentVersion() string {
+	return ""
+}
+
+// seal encrypts data with AES-GCM, random nonce is prepended to ciphertext
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open reverses seal
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, data := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,28 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+)
+
+// Fingerprint returns hex encoded SHA-256 digest of DER encoded public key,
+// it identifies key used for signing without exposing whole key.
+func Fingerprint(publicKey []byte) (string, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return "", errors.New("invalid PEM public key")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SamePublicKey reports whether both standard library public keys are equal
+func SamePublicKey(a, b stdcrypto.PublicKey) bool {
+	k, ok := a.(interface {
+		Equal(stdcrypto.PublicKey) bool
+	})
+	return ok && k.Equal(b)
+}
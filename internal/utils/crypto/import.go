@@ -0,0 +1,194 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrKeyTypeMismatch is returned by Algorithm.ImportKey for keys of other algorithms
+	ErrKeyTypeMismatch = errors.New("private key belongs to other algorithm")
+	// ErrMalformedKey is returned for imported keys which aren't valid PEM,
+	// PKCS#1, SEC 1 or PKCS#8 structures
+	ErrMalformedKey = errors.New("private key is malformed")
+	// ErrUnsupportedKey is returned for well formed keys of types, curves or
+	// encryption schemes no registered algorithm accepts
+	ErrUnsupportedKey = errors.New("private key type is not supported")
+)
+
+var (
+	oidKeyRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidKeyECDSA   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidKeyEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+	// named curves known to crypto/x509, keys on other curves can't be parsed
+	oidCurveP224 = asn1.ObjectIdentifier{1, 3, 132, 0, 33}
+	oidCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidCurveP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidCurveP521 = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// pkcs8Header is PKCS#8 PrivateKeyInfo (RFC 5208) with key left encoded
+type pkcs8Header struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// sec1Header is SEC 1 ECPrivateKey (RFC 5915) with curve of the key
+type sec1Header struct {
+	Version    int
+	PrivateKey []byte
+	Curve      asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey  asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// minRSAPublicExponent rejects keys with small exponents, anything below
+// F4 is considered weak by current guidelines
+const minRSAPublicExponent = 65537
+
+// ImportedKey is externally generated key pair re-encoded the same way as
+// keys generated by service, with parameters detected from the key itself
+type ImportedKey struct {
+	PublicKey  []byte
+	PrivateKey []byte
+	Params     KeyParams
+}
+
+// ImportPrivateKey detects algorithm of PEM encoded private key and imports
+// it. PKCS#1, SEC 1 and PKCS#8 keys are accepted, PKCS#8 keys may be
+// encrypted with password.
+func ImportPrivateKey(privateKeyPEM []byte, password []byte) (Algorithm, ImportedKey, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return Algorithm{}, ImportedKey{}, fmt.Errorf("%w: private key must be PEM encoded", ErrMalformedKey)
+	}
+
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		if len(password) == 0 {
+			return Algorithm{}, ImportedKey{}, errors.New("private key is encrypted, password is required")
+		}
+		der, err := decryptPKCS8(block.Bytes, password)
+		if err != nil {
+			return Algorithm{}, ImportedKey{}, err
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	case x509.IsEncryptedPEMBlock(block):
+		// legacy OpenSSL encryption is unauthenticated, it's only detected to give clear error
+		return Algorithm{}, ImportedKey{}, fmt.Errorf("%w: legacy PEM encryption, convert key to encrypted PKCS#8", ErrUnsupportedKey)
+	case len(password) > 0:
+		return Algorithm{}, ImportedKey{}, errors.New("password provided but private key is not encrypted")
+	}
+	encoded := pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})
+
+	for _, alg := range Algorithms() {
+		if alg.ImportKey == nil {
+			continue
+		}
+		key, err := alg.ImportKey(encoded)
+		if errors.Is(err, ErrKeyTypeMismatch) {
+			continue
+		}
+		if err != nil {
+			return Algorithm{}, ImportedKey{}, fmt.Errorf("invalid %s private key: %w", alg.Name, err)
+		}
+		return alg, key, nil
+	}
+	return Algorithm{}, ImportedKey{}, rejectedKeyError(block)
+}
+
+// rejectedKeyError tells why no algorithm accepted key. Structures of key
+// types service knows that didn't parse are malformed, keys of other types
+// or on curves crypto/x509 doesn't know are unsupported.
+func rejectedKeyError(block *pem.Block) error {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return fmt.Errorf("%w: invalid PKCS#1 structure", ErrMalformedKey)
+	case "EC PRIVATE KEY":
+		var key sec1Header
+		if rest, err := asn1.Unmarshal(block.Bytes, &key); err != nil || len(rest) > 0 {
+			return fmt.Errorf("%w: invalid SEC 1 structure", ErrMalformedKey)
+		}
+		return curveError(key.Curve)
+	case "PRIVATE KEY":
+		var key pkcs8Header
+		if rest, err := asn1.Unmarshal(block.Bytes, &key); err != nil || len(rest) > 0 {
+			return fmt.Errorf("%w: invalid PKCS#8 structure", ErrMalformedKey)
+		}
+		switch alg := key.Algorithm.Algorithm; {
+		case alg.Equal(oidKeyRSA), alg.Equal(oidKeyEd25519):
+			return fmt.Errorf("%w: invalid PKCS#8 %v key", ErrMalformedKey, alg)
+		case alg.Equal(oidKeyECDSA):
+			var curve asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(key.Algorithm.Parameters.FullBytes, &curve); err != nil {
+				return fmt.Errorf("%w: invalid PKCS#8 EC parameters", ErrMalformedKey)
+			}
+			return curveError(curve)
+		default:
+			return fmt.Errorf("%w: key algorithm %v", ErrUnsupportedKey, alg)
+		}
+	default:
+		return fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type)
+	}
+}
+
+// curveError describes rejected EC key on given named curve
+func curveError(curve asn1.ObjectIdentifier) error {
+	for _, known := range []asn1.ObjectIdentifier{oidCurveP224, oidCurveP256, oidCurveP384, oidCurveP521} {
+		if curve.Equal(known) {
+			return fmt.Errorf("%w: invalid EC key", ErrMalformedKey)
+		}
+	}
+	return fmt.Errorf("%w: curve %v", ErrUnsupportedKey, curve)
+}
+
+func importRSAKey(privateKey []byte) (ImportedKey, error) {
+	marshaler := NewRSAMarshaler()
+	keyPair, err := marshaler.Unmarshal(privateKey)
+	if err != nil {
+		return ImportedKey{}, ErrKeyTypeMismatch
+	}
+	if keyPair.Public.E < minRSAPublicExponent {
+		return ImportedKey{}, fmt.Errorf("public exponent %d is too small", keyPair.Public.E)
+	}
+	pub, priv, err := marshaler.Marshal(*keyPair)
+	if err != nil {
+		return ImportedKey{}, err
+	}
+	return ImportedKey{PublicKey: pub, PrivateKey: priv, Params: KeyParams{KeySize: keyPair.Public.N.BitLen()}}, nil
+}
+
+func importECCKey(privateKey []byte) (ImportedKey, error) {
+	marshaler := NewECCMarshaler()
+	keyPair, err := marshaler.Decode(privateKey)
+	if err != nil {
+		return ImportedKey{}, ErrKeyTypeMismatch
+	}
+	curve := keyPair.Public.Curve.Params().Name
+	if _, err := ellipticCurve(curve); err != nil || curve == "" {
+		return ImportedKey{}, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, curve)
+	}
+	pub, priv, err := marshaler.Encode(*keyPair)
+	if err != nil {
+		return ImportedKey{}, err
+	}
+	return ImportedKey{PublicKey: pub, PrivateKey: priv, Params: KeyParams{Curve: curve}}, nil
+}
+
+func importEd25519Key(privateKey []byte) (ImportedKey, error) {
+	marshaler := NewEd25519Marshaler()
+	keyPair, err := marshaler.Decode(privateKey)
+	if err != nil {
+		return ImportedKey{}, ErrKeyTypeMismatch
+	}
+	pub, priv, err := marshaler.Encode(*keyPair)
+	if err != nil {
+		return ImportedKey{}, err
+	}
+	return ImportedKey{PublicKey: pub, PrivateKey: priv}, nil
+}
@@ -0,0 +1,103 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK is public key in JSON Web Key format (RFC 7517), RSA and EC keys
+// follow RFC 7518 and Ed25519 keys RFC 8037
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is JSON Web Key Set document
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK encodes standard library public key as JWK
+func NewJWK(publicKey stdcrypto.PublicKey) (JWK, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64URL(key.N.Bytes()),
+			E:   base64URL(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := curveSize(key)
+		// point is uncompressed 0x04 || X || Y with fixed size coordinates
+		point, err := key.Bytes()
+		if err != nil {
+			return JWK{}, err
+		}
+		return JWK{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   base64URL(point[1 : 1+size]),
+			Y:   base64URL(point[1+size:]),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64URL(key)}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+// JWSAlgorithm returns JWS "alg" (RFC 7518) of signatures made by key with
+// given options. ECDSA signatures have to be IEEE P1363 encoded to be valid
+// JWS signatures, options can't express it so it's up to caller.
+func JWSAlgorithm(publicKey stdcrypto.PublicKey, opts SignatureOptions) (string, error) {
+	if _, ok := publicKey.(ed25519.PublicKey); ok {
+		return "EdDSA", nil
+	}
+	hash, err := opts.Hash.cryptoHash()
+	if err != nil {
+		return "", err
+	}
+	bits := hash.Size() * 8
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if opts.Hash == "" {
+			return "", errors.New("legacy RSA signatures without digest info have no JWS algorithm")
+		}
+		if opts.Padding != PaddingPSS {
+			return fmt.Sprintf("RS%d", bits), nil
+		}
+		if opts.SaltLength != 0 && opts.SaltLength != hash.Size() {
+			return "", fmt.Errorf("PSS salt length %d has no JWS algorithm, only hash size", opts.SaltLength)
+		}
+		return fmt.Sprintf("PS%d", bits), nil
+	case *ecdsa.PublicKey:
+		// JWS pairs every curve with single hash
+		curveBits := map[string]int{CurveP256: 256, CurveP384: 384, CurveP521: 512}[key.Curve.Params().Name]
+		if curveBits != bits {
+			return "", fmt.Errorf("curve %s with hash %s has no JWS algorithm", key.Curve.Params().Name, opts.Hash)
+		}
+		return fmt.Sprintf("ES%d", bits), nil
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+func base64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
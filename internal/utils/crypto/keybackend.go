@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// KeyBackendSoftware keeps private keys as encoded key material stored with device
+	KeyBackendSoftware = "software"
+	// KeyBackendPKCS11 keeps non-exportable private keys inside PKCS#11 token (HSM)
+	KeyBackendPKCS11 = "pkcs11"
+)
+
+// PKCS11Config selects PKCS#11 module and token used by PKCS#11 key backend
+type PKCS11Config struct {
+	ModulePath string
+	TokenLabel string
+	PIN        string
+}
+
+// KeyHandle points to device private key. Software keys carry key material,
+// keys living in token carry only label under which token stores them.
+type KeyHandle struct {
+	PrivateKey []byte
+	Label      string
+}
+
+// KeyBackend creates device private keys and signs with them
+type KeyBackend interface {
+	Name() string
+	// GenerateKeys creates key pair for algorithm, label names key inside backend
+	GenerateKeys(alg Algorithm, params KeyParams, label string) (publicKey []byte, handle KeyHandle, err error)
+	NewSigner(alg Algorithm, handle KeyHandle, opts SignatureOptions) (Signer, error)
+}
+
+// softwareBackend generates and uses keys in process memory
+type softwareBackend struct{}
+
+func (softwareBackend) Name() string {
+	return KeyBackendSoftware
+}
+
+func (softwareBackend) GenerateKeys(alg Algorithm, params KeyParams, _ string) ([]byte, KeyHandle, error) {
+	pub, priv, err := alg.GenerateKeys(params)
+	if err != nil {
+		return nil, KeyHandle{}, err
+	}
+	return pub, KeyHandle{PrivateKey: priv}, nil
+}
+
+func (softwareBackend) NewSigner(alg Algorithm, handle KeyHandle, opts SignatureOptions) (Signer, error) {
+	return alg.NewSigner(handle.PrivateKey, opts)
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]KeyBackend{KeyBackendSoftware: softwareBackend{}}
+)
+
+// RegisterKeyBackend makes key backend available under its name, backends
+// needing configuration are registered during service start
+func RegisterKeyBackend(b KeyBackend) error {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if _, exists := backends[b.Name()]; exists {
+		return fmt.Errorf("key backend %q already registered", b.Name())
+	}
+	backends[b.Name()] = b
+	return nil
+}
+
+// LookupKeyBackend returns backend registered under name, empty name means
+// software backend used by devices created before backends were selectable
+func LookupKeyBackend(name string) (KeyBackend, error) {
+	if name == "" {
+		name = KeyBackendSoftware
+	}
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	b, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("key backend %q is not configured", name)
+	}
+	return b, nil
+}
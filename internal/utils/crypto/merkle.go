@@ -0,0 +1,188 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Merkle tree hashing follows RFC 9162 section 2.1 with SHA-256, leaves and
+// interior nodes are domain separated, so leaf can't be passed off as node
+
+// MerkleLeafHash returns hash of leaf data
+func MerkleLeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// merkleNodeHash returns hash of interior node
+func merkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// splitPoint returns the largest power of two smaller than n, n > 1
+func splitPoint(n int) int {
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
+
+// MerkleRoot returns root hash of tree over leaf hashes, empty tree hashes
+// to SHA-256 of empty string
+func MerkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return merkleNodeHash(MerkleRoot(leaves[:k]), MerkleRoot(leaves[k:]))
+}
+
+// MerkleAuditPath returns inclusion proof of leaf at index in tree over leaf
+// hashes, nodes are ordered from leaf level up
+func MerkleAuditPath(index int, leaves [][]byte) ([][]byte, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf index %d out of tree of size %d", index, len(leaves))
+	}
+	if len(leaves) == 1 {
+		return nil, nil
+	}
+	k := splitPoint(len(leaves))
+	if index < k {
+		path, err := MerkleAuditPath(index, leaves[:k])
+		return append(path, MerkleRoot(leaves[k:])), err
+	}
+	path, err := MerkleAuditPath(index-k, leaves[k:])
+	return append(path, MerkleRoot(leaves[:k])), err
+}
+
+// VerifyMerkleInclusion checks that audit path leads from leaf hash at index
+// to root of tree of given size (RFC 9162 section 2.1.3.2)
+func VerifyMerkleInclusion(index, size uint64, leafHash []byte, path [][]byte, root []byte) error {
+	if index >= size {
+		return fmt.Errorf("leaf index %d out of tree of size %d", index, size)
+	}
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range path {
+		if sn == 0 {
+			return errors.New("audit path is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("audit path is too short")
+	}
+	if !bytes.Equal(r, root) {
+		return errors.New("audit path doesn't lead to root hash")
+	}
+	return nil
+}
+
+// MerkleConsistencyProof returns proof that tree over first size leaves is
+// prefix of tree over all leaf hashes (RFC 9162 section 2.1.4), proof between
+// equal or empty trees is empty
+func MerkleConsistencyProof(size int, leaves [][]byte) ([][]byte, error) {
+	if size < 0 || size > len(leaves) {
+		return nil, fmt.Errorf("tree size %d out of tree of size %d", size, len(leaves))
+	}
+	if size == 0 || size == len(leaves) {
+		return nil, nil
+	}
+	return merkleSubproof(size, leaves, true), nil
+}
+
+// merkleSubproof is SUBPROOF of RFC 9162, complete tells whether subtree of
+// size m is known to verifier
+func merkleSubproof(m int, leaves [][]byte, complete bool) [][]byte {
+	n := len(leaves)
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{MerkleRoot(leaves)}
+	}
+	k := splitPoint(n)
+	if m <= k {
+		return append(merkleSubproof(m, leaves[:k], complete), MerkleRoot(leaves[k:]))
+	}
+	return append(merkleSubproof(m-k, leaves[k:], false), MerkleRoot(leaves[:k]))
+}
+
+// VerifyMerkleConsistency checks that tree of first size with first root is
+// prefix of tree of second size with second root (RFC 9162 section 2.1.4.2)
+func VerifyMerkleConsistency(first, second uint64, firstRoot, secondRoot []byte, proof [][]byte) error {
+	switch {
+	case first > second:
+		return fmt.Errorf("tree size %d is larger than %d", first, second)
+	case first == second:
+		if len(proof) != 0 {
+			return errors.New("consistency proof between equal trees has to be empty")
+		}
+		if !bytes.Equal(firstRoot, secondRoot) {
+			return errors.New("trees of equal size have different root hashes")
+		}
+		return nil
+	case first == 0:
+		// empty tree is prefix of every tree
+		if len(proof) != 0 {
+			return errors.New("consistency proof from empty tree has to be empty")
+		}
+		return nil
+	case len(proof) == 0:
+		return errors.New("consistency proof is empty")
+	}
+
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return errors.New("consistency proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = merkleNodeHash(c, fr)
+			sr = merkleNodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = merkleNodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("consistency proof is too short")
+	}
+	if !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+		return errors.New("consistency proof doesn't lead to root hashes")
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package crypto_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// merkleTestLeaves are leaf inputs of RFC 6962 reference test data, which
+// RFC 9162 hashing keeps unchanged
+var merkleTestLeaves = [][]byte{
+	{},
+	{0x00},
+	{0x10},
+	{0x20, 0x21},
+	{0x30, 0x31},
+	{0x40, 0x41, 0x42, 0x43},
+	{0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57},
+	{0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f},
+}
+
+// merkleLeafHashes returns leaf hashes of n leaves, reference leaves come
+// first and are followed by generated ones
+func merkleLeafHashes(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		if i < len(merkleTestLeaves) {
+			leaves[i] = crypto.MerkleLeafHash(merkleTestLeaves[i])
+			continue
+		}
+		leaves[i] = crypto.MerkleLeafHash([]byte{byte(i), byte(i >> 8)})
+	}
+	return leaves
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decode hex %q: %v", s, err)
+	}
+	return b
+}
+
+func hexPath(t *testing.T, nodes ...string) [][]byte {
+	t.Helper()
+	path := make([][]byte, len(nodes))
+	for i, n := range nodes {
+		path[i] = mustHex(t, n)
+	}
+	return path
+}
+
+func equalPaths(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// tamper returns copy of proof with one bit of node i flipped
+func tamper(proof [][]byte, i int) [][]byte {
+	out := make([][]byte, len(proof))
+	for j, p := range proof {
+		out[j] = bytes.Clone(p)
+	}
+	out[i][0] ^= 0x01
+	return out
+}
+
+func TestMerkleRoot_KnownAnswers(t *testing.T) {
+	roots := []string{
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	}
+	leaves := merkleLeafHashes(len(merkleTestLeaves))
+	for size, want := range roots {
+		if got := hex.EncodeToString(crypto.MerkleRoot(leaves[:size])); got != want {
+			t.Errorf("size %d: expected root %s, got %s", size, want, got)
+		}
+	}
+}
+
+func TestMerkleAuditPath_KnownAnswers(t *testing.T) {
+	tests := []struct {
+		index, size int
+		path        [][]byte
+	}{
+		{index: 0, size: 1},
+		{index: 0, size: 8, path: hexPath(t,
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4")},
+		{index: 5, size: 8, path: hexPath(t,
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7")},
+		{index: 2, size: 3, path: hexPath(t,
+			"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125")},
+		{index: 1, size: 5, path: hexPath(t,
+			"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b")},
+	}
+	leaves := merkleLeafHashes(len(merkleTestLeaves))
+	for _, tt := range tests {
+		path, err := crypto.MerkleAuditPath(tt.index, leaves[:tt.size])
+		if err != nil {
+			t.Fatalf("path %d/%d: %v", tt.index, tt.size, err)
+		}
+		if !equalPaths(path, tt.path) {
+			t.Errorf("path %d/%d: unexpected audit path", tt.index, tt.size)
+		}
+	}
+}
+
+func TestMerkleConsistencyProof_KnownAnswers(t *testing.T) {
+	tests := []struct {
+		first, second int
+		proof         [][]byte
+	}{
+		{first: 1, second: 1},
+		{first: 1, second: 8, proof: hexPath(t,
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4")},
+		{first: 6, second: 8, proof: hexPath(t,
+			"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7")},
+		{first: 2, second: 5, proof: hexPath(t,
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b")},
+	}
+	leaves := merkleLeafHashes(len(merkleTestLeaves))
+	for _, tt := range tests {
+		proof, err := crypto.MerkleConsistencyProof(tt.first, leaves[:tt.second])
+		if err != nil {
+			t.Fatalf("proof %d-%d: %v", tt.first, tt.second, err)
+		}
+		if !equalPaths(proof, tt.proof) {
+			t.Errorf("proof %d-%d: unexpected consistency proof", tt.first, tt.second)
+		}
+	}
+}
+
+func TestMerkleInclusion_AllTreeSizes(t *testing.T) {
+	const maxSize = 20
+	leaves := merkleLeafHashes(maxSize)
+	for size := 1; size <= maxSize; size++ {
+		tree := leaves[:size]
+		root := crypto.MerkleRoot(tree)
+		for index := 0; index < size; index++ {
+			path, err := crypto.MerkleAuditPath(index, tree)
+			if err != nil {
+				t.Fatalf("path %d/%d: %v", index, size, err)
+			}
+			if err := crypto.VerifyMerkleInclusion(uint64(index), uint64(size), tree[index], path, root); err != nil {
+				t.Fatalf("verify %d/%d: %v", index, size, err)
+			}
+
+			// proof must not hold for other leaf, index, tree height or root
+			other := leaves[(index+1)%maxSize]
+			if err := crypto.VerifyMerkleInclusion(uint64(index), uint64(size), other, path, root); err == nil {
+				t.Errorf("%d/%d: expected other leaf to fail", index, size)
+			}
+			if size > 1 {
+				wrong := uint64((index + 1) % size)
+				if err := crypto.VerifyMerkleInclusion(wrong, uint64(size), tree[index], path, root); err == nil {
+					t.Errorf("%d/%d: expected index %d to fail", index, size, wrong)
+				}
+			}
+			if err := crypto.VerifyMerkleInclusion(uint64(index), uint64(2*size+1), tree[index], path, root); err == nil {
+				t.Errorf("%d/%d: expected path of smaller tree to fail", index, size)
+			}
+			if err := crypto.VerifyMerkleInclusion(uint64(index), uint64(size), tree[index], path, leaves[0][:16]); err == nil {
+				t.Errorf("%d/%d: expected wrong root to fail", index, size)
+			}
+			for i := range path {
+				if err := crypto.VerifyMerkleInclusion(uint64(index), uint64(size), tree[index], tamper(path, i), root); err == nil {
+					t.Errorf("%d/%d: expected tampered node %d to fail", index, size, i)
+				}
+			}
+			if len(path) > 0 {
+				if err := crypto.VerifyMerkleInclusion(uint64(index), uint64(size), tree[index], path[:len(path)-1], root); err == nil {
+					t.Errorf("%d/%d: expected truncated path to fail", index, size)
+				}
+			}
+			if err := crypto.VerifyMerkleInclusion(uint64(index), uint64(size), tree[index], append(path, root), root); err == nil {
+				t.Errorf("%d/%d: expected extended path to fail", index, size)
+			}
+		}
+		if _, err := crypto.MerkleAuditPath(size, tree); err == nil {
+			t.Errorf("size %d: expected index out of tree to fail", size)
+		}
+	}
+}
+
+func TestMerkleConsistency_AllTreeSizes(t *testing.T) {
+	const maxSize = 20
+	leaves := merkleLeafHashes(maxSize)
+	roots := make([][]byte, maxSize+1)
+	for size := range roots {
+		roots[size] = crypto.MerkleRoot(leaves[:size])
+	}
+	for second := 0; second <= maxSize; second++ {
+		for first := 0; first <= second; first++ {
+			proof, err := crypto.MerkleConsistencyProof(first, leaves[:second])
+			if err != nil {
+				t.Fatalf("proof %d-%d: %v", first, second, err)
+			}
+			if err := crypto.VerifyMerkleConsistency(uint64(first), uint64(second), roots[first], roots[second], proof); err != nil {
+				t.Fatalf("verify %d-%d: %v", first, second, err)
+			}
+			if first == 0 || first == second {
+				if len(proof) != 0 {
+					t.Errorf("%d-%d: expected empty proof, got %d nodes", first, second, len(proof))
+				}
+				continue
+			}
+
+			// proof must not hold for other roots or sizes
+			if err := crypto.VerifyMerkleConsistency(uint64(first), uint64(second), roots[first-1], roots[second], proof); err == nil {
+				t.Errorf("%d-%d: expected wrong first root to fail", first, second)
+			}
+			if err := crypto.VerifyMerkleConsistency(uint64(first), uint64(second), roots[first], roots[second-1], proof); err == nil {
+				t.Errorf("%d-%d: expected wrong second root to fail", first, second)
+			}
+			if second < maxSize {
+				if err := crypto.VerifyMerkleConsistency(uint64(first), uint64(second+1), roots[first], roots[second+1], proof); err == nil {
+					t.Errorf("%d-%d: expected larger second tree to fail", first, second)
+				}
+			}
+			for i := range proof {
+				if err := crypto.VerifyMerkleConsistency(uint64(first), uint64(second), roots[first], roots[second], tamper(proof, i)); err == nil {
+					t.Errorf("%d-%d: expected tampered node %d to fail", first, second, i)
+				}
+			}
+			if err := crypto.VerifyMerkleConsistency(uint64(first), uint64(second), roots[first], roots[second], proof[:len(proof)-1]); err == nil {
+				t.Errorf("%d-%d: expected truncated proof to fail", first, second)
+			}
+			if err := crypto.VerifyMerkleConsistency(uint64(first), uint64(second), roots[first], roots[second], append(proof, roots[first])); err == nil {
+				t.Errorf("%d-%d: expected extended proof to fail", first, second)
+			}
+		}
+	}
+
+	if err := crypto.VerifyMerkleConsistency(3, 2, roots[3], roots[2], nil); err == nil {
+		t.Error("expected first tree larger than second to fail")
+	}
+	if _, err := crypto.MerkleConsistencyProof(maxSize+1, leaves); err == nil {
+		t.Error("expected size out of tree to fail")
+	}
+}
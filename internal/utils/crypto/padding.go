@@ -0,0 +1,61 @@
+package crypto
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"slices"
+)
+
+// RSAPadding describes RSA signature scheme
+type RSAPadding string
+
+const (
+	// PaddingPKCS1v15 is RSASSA-PKCS1-v1_5, default scheme
+	PaddingPKCS1v15 RSAPadding = "PKCS1v15"
+	// PaddingPSS is RSASSA-PSS with MGF1 using signing hash
+	PaddingPSS RSAPadding = "PSS"
+)
+
+var supportedPaddings = []RSAPadding{PaddingPKCS1v15, PaddingPSS}
+
+// pssOptions returns PSS options for salt length, zero salt length means
+// salt as long as hash output which is what most verifiers expect
+func pssOptions(saltLength int) *rsa.PSSOptions {
+	if saltLength == 0 {
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+	}
+	return &rsa.PSSOptions{SaltLength: saltLength}
+}
+
+// ResolvePadding validates requested padding scheme against algorithm
+// capabilities and key params, empty padding means algorithm default
+func (a Algorithm) ResolvePadding(padding RSAPadding, saltLength int, params KeyParams) (RSAPadding, int, error) {
+	if len(a.Paddings) == 0 {
+		if padding != "" || saltLength != 0 {
+			return "", 0, fmt.Errorf("padding is not supported for %s keys", a.Name)
+		}
+		return "", 0, nil
+	}
+	if padding == "" {
+		padding = a.Paddings[0]
+	}
+	if !slices.Contains(a.Paddings, padding) {
+		return "", 0, fmt.Errorf("padding %s is not supported for %s keys", padding, a.Name)
+	}
+	if saltLength == 0 {
+		return padding, 0, nil
+	}
+	if padding != PaddingPSS {
+		return "", 0, fmt.Errorf("salt length is supported only for %s padding", PaddingPSS)
+	}
+
+	hash, err := params.Hash.cryptoHash()
+	if err != nil {
+		return "", 0, err
+	}
+	maxSalt := (params.KeySize+7)/8 - hash.Size() - 2
+	if saltLength < 0 || saltLength > maxSalt {
+		return "", 0, fmt.Errorf("salt length must be between 1 and %d bytes", maxSalt)
+	}
+	return padding, saltLength, nil
+}
@@ -0,0 +1,162 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/elliptic"
+	"fmt"
+	"slices"
+)
+
+// HashAlgorithm names digest used before signing
+type HashAlgorithm string
+
+const (
+	HashSHA256 HashAlgorithm = "SHA-256"
+	HashSHA384 HashAlgorithm = "SHA-384"
+	HashSHA512 HashAlgorithm = "SHA-512"
+)
+
+// supportedHashes lists digests which can be selected for RSA and ECC keys
+var supportedHashes = []HashAlgorithm{HashSHA256, HashSHA384, HashSHA512}
+
+// cryptoHash maps hash name into standard library hash, empty name means
+// SHA-256 which was the only digest before it became configurable
+func (h HashAlgorithm) cryptoHash() (stdcrypto.Hash, error) {
+	switch h {
+	case "", HashSHA256:
+		return stdcrypto.SHA256, nil
+	case HashSHA384:
+		return stdcrypto.SHA384, nil
+	case HashSHA512:
+		return stdcrypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported hash: %s", h)
+	}
+}
+
+// digest hashes data with selected hash algorithm
+func (h HashAlgorithm) digest(data []byte) (stdcrypto.Hash, []byte, error) {
+	hash, err := h.cryptoHash()
+	if err != nil {
+		return 0, nil, err
+	}
+	hasher := hash.New()
+	hasher.Write(data)
+	return hash, hasher.Sum(nil), nil
+}
+
+// Size returns length of digest in bytes
+func (h HashAlgorithm) Size() (int, error) {
+	hash, err := h.cryptoHash()
+	if err != nil {
+		return 0, err
+	}
+	return hash.Size(), nil
+}
+
+// Digest hashes data with selected hash algorithm
+func (h HashAlgorithm) Digest(data []byte) ([]byte, error) {
+	_, sum, err := h.digest(data)
+	return sum, err
+}
+
+// Curve names supported by ECC keys
+const (
+	CurveP256 = "P-256"
+	CurveP384 = "P-384"
+	CurveP521 = "P-521"
+)
+
+var supportedCurves = []string{CurveP256, CurveP384, CurveP521}
+
+// ellipticCurve maps curve name into curve implementation, empty name means
+// P-384 which was the only curve before it became configurable
+func ellipticCurve(name string) (elliptic.Curve, error) {
+	switch name {
+	case "", CurveP384:
+		return elliptic.P384(), nil
+	case CurveP256:
+		return elliptic.P256(), nil
+	case CurveP521:
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported curve: %s", name)
+	}
+}
+
+// maxRSAKeySize protects service from very expensive key generation
+const maxRSAKeySize = 8192
+
+// KeyParams describes key pair which should be generated for device.
+// Zero values mean algorithm defaults.
+type KeyParams struct {
+	KeySize int           `json:"key_size,omitempty"`
+	Curve   string        `json:"curve,omitempty"`
+	Hash    HashAlgorithm `json:"hash,omitempty"`
+}
+
+// KeyPolicy limits which key parameters may be used by new devices
+type KeyPolicy struct {
+	MinRSAKeySize int
+	// AllowedCurves and AllowedHashes restrict choice further when not empty
+	AllowedCurves []string
+	AllowedHashes []HashAlgorithm
+	// Backend holds keys of new devices, software when empty. Imported keys
+	// always stay in software backend.
+	Backend string
+}
+
+// DefaultKeyPolicy is used when service configuration doesn't provide one
+var DefaultKeyPolicy = KeyPolicy{MinRSAKeySize: 2048}
+
+// ResolveParams validates requested key params against algorithm capabilities
+// and policy, then fills missing values with algorithm defaults
+func (a Algorithm) ResolveParams(p KeyParams, policy KeyPolicy) (KeyParams, error) {
+	resolved := a.DefaultParams
+
+	if p.KeySize != 0 {
+		if a.DefaultParams.KeySize == 0 {
+			return KeyParams{}, fmt.Errorf("key size is not supported for %s keys", a.Name)
+		}
+		resolved.KeySize = p.KeySize
+	}
+	if resolved.KeySize != 0 {
+		if resolved.KeySize < policy.MinRSAKeySize {
+			return KeyParams{}, fmt.Errorf("key size %d is below minimum of %d bits", resolved.KeySize, policy.MinRSAKeySize)
+		}
+		if resolved.KeySize > maxRSAKeySize {
+			return KeyParams{}, fmt.Errorf("key size %d exceeds maximum of %d bits", resolved.KeySize, maxRSAKeySize)
+		}
+	}
+
+	if p.Curve != "" {
+		if !slices.Contains(a.Curves, p.Curve) {
+			return KeyParams{}, fmt.Errorf("curve %s is not supported for %s keys", p.Curve, a.Name)
+		}
+		resolved.Curve = p.Curve
+	}
+	if resolved.Curve != "" && len(policy.AllowedCurves) > 0 && !slices.Contains(policy.AllowedCurves, resolved.Curve) {
+		return KeyParams{}, fmt.Errorf("curve %s is not allowed by key policy", resolved.Curve)
+	}
+
+	if p.Hash != "" {
+		if !slices.Contains(a.Hashes, p.Hash) {
+			return KeyParams{}, fmt.Errorf("hash %s is not supported for %s keys", p.Hash, a.Name)
+		}
+		resolved.Hash = p.Hash
+	}
+	if resolved.Hash != "" && len(policy.AllowedHashes) > 0 && !slices.Contains(policy.AllowedHashes, resolved.Hash) {
+		return KeyParams{}, fmt.Errorf("hash %s is not allowed by key policy", resolved.Hash)
+	}
+
+	return resolved, nil
+}
+
+// SignatureOptions configures how Signer and Verifier produce and check signatures
+type SignatureOptions struct {
+	Encoding SignatureEncoding
+	Hash     HashAlgorithm
+	// Padding and SaltLength apply only to RSA, empty padding means PKCS#1 v1.5
+	Padding    RSAPadding
+	SaltLength int
+}
@@ -0,0 +1,361 @@
+//go:build cgo
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/miekg/pkcs11"
+)
+
+// curveOIDs are named curve identifiers used as CKA_EC_PARAMS
+var curveOIDs = map[string]asn1.ObjectIdentifier{
+	CurveP256: {1, 2, 840, 10045, 3, 1, 7},
+	CurveP384: {1, 3, 132, 0, 34},
+	CurveP521: {1, 3, 132, 0, 35},
+}
+
+// rsaPublicExponent is F4, the only exponent used for generated keys
+var rsaPublicExponent = []byte{0x01, 0x00, 0x01}
+
+// PKCS11Backend generates and uses keys inside PKCS#11 token. Private keys
+// are created as sensitive and non-extractable, device only stores label.
+type PKCS11Backend struct {
+	ctx  *pkcs11.Ctx
+	slot uint
+	// login session keeps user logged in, PKCS#11 login state is shared by
+	// all sessions of application and ends with the last closed session
+	login pkcs11.SessionHandle
+}
+
+// NewPKCS11Backend loads PKCS#11 module, finds token by label and logs in
+func NewPKCS11Backend(cfg PKCS11Config) (*PKCS11Backend, error) {
+	ctx := pkcs11.New(cfg.ModulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %s", cfg.ModulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("failed to initialize PKCS#11 module: %w", err)
+	}
+
+	b := &PKCS11Backend{ctx: ctx}
+	slot, err := b.findSlot(cfg.TokenLabel)
+	if err != nil {
+		b.finalize()
+		return nil, err
+	}
+	b.slot = slot
+
+	b.login, err = ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		b.finalize()
+		return nil, fmt.Errorf("failed to open PKCS#11 session: %w", err)
+	}
+	if err := ctx.Login(b.login, pkcs11.CKU_USER, cfg.PIN); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		_ = ctx.CloseSession(b.login)
+		b.finalize()
+		return nil, fmt.Errorf("failed to log into token %s: %w", cfg.TokenLabel, err)
+	}
+	return b, nil
+}
+
+func (b *PKCS11Backend) Name() string {
+	return KeyBackendPKCS11
+}
+
+// Close logs out and unloads PKCS#11 module
+func (b *PKCS11Backend) Close() error {
+	_ = b.ctx.Logout(b.login)
+	_ = b.ctx.CloseSession(b.login)
+	b.finalize()
+	return nil
+}
+
+func (b *PKCS11Backend) finalize() {
+	_ = b.ctx.Finalize()
+	b.ctx.Destroy()
+}
+
+// findSlot returns slot holding token with given label
+func (b *PKCS11Backend) findSlot(tokenLabel string) (uint, error) {
+	slots, err := b.ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list PKCS#11 slots: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := b.ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		// token labels are blank padded to 32 characters
+		if strings.TrimRight(info.Label, " \x00") == tokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("PKCS#11 token %q not found", tokenLabel)
+}
+
+// withSession runs fn in fresh session, sessions can't be shared between
+// concurrent sign operations
+func (b *PKCS11Backend) withSession(fn func(sh pkcs11.SessionHandle) error) error {
+	sh, err := b.ctx.OpenSession(b.slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return fmt.Errorf("failed to open PKCS#11 session: %w", err)
+	}
+	defer b.ctx.CloseSession(sh)
+	return fn(sh)
+}
+
+// GenerateKeys creates key pair inside token, only public key leaves it
+func (b *PKCS11Backend) GenerateKeys(alg Algorithm, params KeyParams, label string) ([]byte, KeyHandle, error) {
+	public := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(label)),
+	}
+	private := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(label)),
+	}
+
+	var mechanism uint
+	switch alg.Name {
+	case "RSA":
+		bits := params.KeySize
+		if bits == 0 {
+			bits = defaultRSAKeySize
+		}
+		mechanism = pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN
+		public = append(public,
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, bits),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, rsaPublicExponent),
+		)
+	case "ECC":
+		curve := params.Curve
+		if curve == "" {
+			curve = CurveP384
+		}
+		oid, ok := curveOIDs[curve]
+		if !ok {
+			return nil, KeyHandle{}, fmt.Errorf("unsupported curve: %s", curve)
+		}
+		ecParams, err := asn1.Marshal(oid)
+		if err != nil {
+			return nil, KeyHandle{}, err
+		}
+		mechanism = pkcs11.CKM_EC_KEY_PAIR_GEN
+		public = append(public,
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, ecParams),
+		)
+	default:
+		return nil, KeyHandle{}, fmt.Errorf("%s keys are not supported by PKCS#11 key backend", alg.Name)
+	}
+
+	var publicKey []byte
+	err := b.withSession(func(sh pkcs11.SessionHandle) error {
+		pubHandle, _, err := b.ctx.GenerateKeyPair(sh, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, public, private)
+		if err != nil {
+			return fmt.Errorf("failed to generate key in token: %w", err)
+		}
+		if alg.Name == "RSA" {
+			publicKey, err = b.rsaPublicKey(sh, pubHandle)
+		} else {
+			publicKey, err = b.ecPublicKey(sh, pubHandle, params.Curve)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, KeyHandle{}, err
+	}
+	return publicKey, KeyHandle{Label: label}, nil
+}
+
+// rsaPublicKey reads RSA public key from token and encodes it like software keys
+func (b *PKCS11Backend) rsaPublicKey(sh pkcs11.SessionHandle, key pkcs11.ObjectHandle) ([]byte, error) {
+	attrs, err := b.ctx.GetAttributeValue(sh, key, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key from token: %w", err)
+	}
+	pub := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attrs[0].Value),
+		E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+	}
+	m := NewRSAMarshaler()
+	return m.MarshalPublic(pub), nil
+}
+
+// ecPublicKey reads EC point from token and encodes it like software keys
+func (b *PKCS11Backend) ecPublicKey(sh pkcs11.SessionHandle, key pkcs11.ObjectHandle, curveName string) ([]byte, error) {
+	attrs, err := b.ctx.GetAttributeValue(sh, key, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key from token: %w", err)
+	}
+	// CKA_EC_POINT is DER OCTET STRING, some tokens return bare point
+	point := attrs[0].Value
+	var wrapped []byte
+	if rest, err := asn1.Unmarshal(point, &wrapped); err == nil && len(rest) == 0 {
+		point = wrapped
+	}
+	curve, err := ellipticCurve(curveName)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EC point returned by token: %w", err)
+	}
+	return NewECCMarshaler().EncodePublic(pub)
+}
+
+// findPrivateKey looks up private key by label
+func (b *PKCS11Backend) findPrivateKey(sh pkcs11.SessionHandle, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := b.ctx.FindObjectsInit(sh, template); err != nil {
+		return 0, err
+	}
+	defer b.ctx.FindObjectsFinal(sh)
+
+	objects, _, err := b.ctx.FindObjects(sh, 2)
+	if err != nil {
+		return 0, err
+	}
+	switch len(objects) {
+	case 0:
+		return 0, fmt.Errorf("private key %q not found in token", label)
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, fmt.Errorf("private key label %q is not unique in token", label)
+	}
+}
+
+// NewSigner creates signer which signs inside token
+func (b *PKCS11Backend) NewSigner(alg Algorithm, handle KeyHandle, opts SignatureOptions) (Signer, error) {
+	if handle.Label == "" {
+		return nil, errors.New("device has no PKCS#11 key label")
+	}
+	// token keys are always created with explicit hash, legacy hash-less
+	// RSA signatures only exist for software keys
+	if opts.Hash == "" {
+		return nil, errors.New("PKCS#11 keys require explicit hash")
+	}
+	if _, err := opts.Hash.cryptoHash(); err != nil {
+		return nil, err
+	}
+	switch alg.Name {
+	case "RSA":
+		if opts.Padding != "" && opts.Padding != PaddingPKCS1v15 && opts.Padding != PaddingPSS {
+			return nil, fmt.Errorf("unsupported padding: %s", opts.Padding)
+		}
+	case "ECC":
+		if opts.Encoding == "" {
+			opts.Encoding = EncodingASN1DER
+		}
+		if opts.Encoding != EncodingASN1DER && opts.Encoding != EncodingP1363 {
+			return nil, ErrUnsupportedEncoding
+		}
+	default:
+		return nil, fmt.Errorf("%s keys are not supported by PKCS#11 key backend", alg.Name)
+	}
+	return &PKCS11Signer{backend: b, label: handle.Label, algorithm: alg.Name, opts: opts}, nil
+}
+
+// PKCS11Signer signs with private key which never leaves token
+type PKCS11Signer struct {
+	backend   *PKCS11Backend
+	label     string
+	algorithm string
+	opts      SignatureOptions
+}
+
+// Sign provided data inside token, output matches software signers
+func (s *PKCS11Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	mechanism, input, err := s.mechanism(dataToBeSigned)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature []byte
+	err = s.backend.withSession(func(sh pkcs11.SessionHandle) error {
+		key, err := s.backend.findPrivateKey(sh, s.label)
+		if err != nil {
+			return err
+		}
+		if err := s.backend.ctx.SignInit(sh, []*pkcs11.Mechanism{mechanism}, key); err != nil {
+			return fmt.Errorf("failed to start signing in token: %w", err)
+		}
+		signature, err = s.backend.ctx.Sign(sh, input)
+		if err != nil {
+			return fmt.Errorf("failed to sign in token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// CKM_ECDSA returns fixed-width r||s
+	if s.algorithm == "ECC" && s.opts.Encoding == EncodingASN1DER {
+		return p1363ToASN1(signature, len(signature)/2)
+	}
+	return signature, nil
+}
+
+// mechanism selects PKCS#11 mechanism and its input for signer options.
+// RSA mechanisms hash inside token, ECDSA gets digest computed here.
+func (s *PKCS11Signer) mechanism(data []byte) (*pkcs11.Mechanism, []byte, error) {
+	if s.algorithm == "ECC" {
+		_, digest, err := s.opts.Hash.digest(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil), digest, nil
+	}
+
+	var pkcs1, pss, hashMech, mgf uint
+	switch s.opts.Hash {
+	case HashSHA256:
+		pkcs1, pss, hashMech, mgf = pkcs11.CKM_SHA256_RSA_PKCS, pkcs11.CKM_SHA256_RSA_PKCS_PSS, pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256
+	case HashSHA384:
+		pkcs1, pss, hashMech, mgf = pkcs11.CKM_SHA384_RSA_PKCS, pkcs11.CKM_SHA384_RSA_PKCS_PSS, pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384
+	case HashSHA512:
+		pkcs1, pss, hashMech, mgf = pkcs11.CKM_SHA512_RSA_PKCS, pkcs11.CKM_SHA512_RSA_PKCS_PSS, pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512
+	default:
+		return nil, nil, fmt.Errorf("unsupported hash: %s", s.opts.Hash)
+	}
+
+	if s.opts.Padding == PaddingPSS {
+		salt := s.opts.SaltLength
+		if salt == 0 {
+			hash, _ := s.opts.Hash.cryptoHash()
+			salt = hash.Size()
+		}
+		return pkcs11.NewMechanism(pss, pkcs11.NewPSSParams(hashMech, mgf, uint(salt))), data, nil
+	}
+	return pkcs11.NewMechanism(pkcs1, nil), data, nil
+}
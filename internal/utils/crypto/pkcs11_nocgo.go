@@ -0,0 +1,30 @@
+//go:build !cgo
+
+package crypto
+
+import "errors"
+
+// PKCS11Backend is not available in binaries built without cgo
+type PKCS11Backend struct{}
+
+// NewPKCS11Backend always fails, PKCS#11 modules can only be loaded with cgo
+func NewPKCS11Backend(cfg PKCS11Config) (*PKCS11Backend, error) {
+	return nil, errors.New("PKCS#11 key backend requires binary built with cgo")
+}
+
+func (b *PKCS11Backend) Name() string {
+	return KeyBackendPKCS11
+}
+
+func (b *PKCS11Backend) GenerateKeys(Algorithm, KeyParams, string) ([]byte, KeyHandle, error) {
+	return nil, KeyHandle{}, errors.New("PKCS#11 key backend is not available")
+}
+
+func (b *PKCS11Backend) NewSigner(Algorithm, KeyHandle, SignatureOptions) (Signer, error) {
+	return nil, errors.New("PKCS#11 key backend is not available")
+}
+
+// Close is no-op
+func (b *PKCS11Backend) Close() error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Algorithm bundles everything needed to create keys, sign and verify with
+// single signing algorithm. New algorithms become available in the whole
+// service once registered with RegisterAlgorithm.
+type Algorithm struct {
+	Name string
+	// Encodings lists selectable signature encodings, first one is default.
+	// Empty when algorithm has single, fixed signature format.
+	Encodings []SignatureEncoding
+	// LegacyEncoding is assumed for stored signatures without recorded encoding
+	LegacyEncoding SignatureEncoding
+	// DefaultParams are used for params not requested explicitly, zero
+	// KeySize means key size can't be selected
+	DefaultParams KeyParams
+	Curves        []string
+	Hashes        []HashAlgorithm
+	// Paddings lists selectable signature schemes, first one is default
+	Paddings []RSAPadding
+
+	// GenerateKeys generates new key pair (generator) and encodes it to be
+	// stored (marshaler). It returns the public and the private key.
+	GenerateKeys func(params KeyParams) (publicKey []byte, privateKey []byte, err error)
+	NewSigner    func(privateKey []byte, opts SignatureOptions) (Signer, error)
+	NewVerifier  func(publicKey []byte, opts SignatureOptions) (Verifier, error)
+	// ParsePublicKey decodes stored public key into standard library key,
+	// it's used where key has to be embedded into certificates and documents
+	ParsePublicKey func(publicKey []byte) (stdcrypto.PublicKey, error)
+	// ImportKey decodes externally generated PEM private key, it returns
+	// ErrKeyTypeMismatch for keys of other algorithms. Optional, algorithms
+	// without it don't accept imported keys.
+	ImportKey func(privateKey []byte) (ImportedKey, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Algorithm{}
+)
+
+// RegisterAlgorithm makes algorithm available under its name
+func RegisterAlgorithm(a Algorithm) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if a.Name == "" || a.GenerateKeys == nil || a.NewSigner == nil || a.NewVerifier == nil || a.ParsePublicKey == nil {
+		return fmt.Errorf("algorithm %q is incomplete", a.Name)
+	}
+	if _, exists := registry[a.Name]; exists {
+		return fmt.Errorf("algorithm %q already registered", a.Name)
+	}
+	registry[a.Name] = a
+	return nil
+}
+
+// LookupAlgorithm returns algorithm registered under name
+func LookupAlgorithm(name string) (Algorithm, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	a, ok := registry[name]
+	return a, ok
+}
+
+// Algorithms returns all registered algorithms sorted by name
+func Algorithms() []Algorithm {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	list := make([]Algorithm, 0, len(registry))
+	for _, a := range registry {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
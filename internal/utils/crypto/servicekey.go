@@ -0,0 +1,91 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Service keys sign statements of service itself, e.g. Merkle tree heads.
+// They are standard library keys in PEM files, RSA, ECDSA or Ed25519.
+
+// LoadServiceKey reads PEM private key from file
+func LoadServiceKey(path string) (stdcrypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseCAKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := keySignatureAlgorithm(key.Public()); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// NewKeySigner returns Signer of service key, ECDSA signatures are ASN.1 DER
+func NewKeySigner(key stdcrypto.Signer) (Signer, error) {
+	algorithm, err := keySignatureAlgorithm(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	hash, err := CMSHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return keySigner{key: key, hash: hash}, nil
+}
+
+// VerifyKeySignature checks signature made by NewKeySigner
+func VerifyKeySignature(publicKey stdcrypto.PublicKey, data, signature []byte) error {
+	algorithm, err := keySignatureAlgorithm(publicKey)
+	if err != nil {
+		return err
+	}
+	// certificate only carries key, CheckSignature doesn't look at the rest
+	return (&x509.Certificate{PublicKey: publicKey}).CheckSignature(algorithm, data, signature)
+}
+
+// ParsePublicKeyPEM decodes PEM PKIX public key
+func ParsePublicKeyPEM(data []byte) (stdcrypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("invalid PEM public key")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// EncodePublicKeyPEM encodes public key as PEM PKIX public key
+func EncodePublicKeyPEM(publicKey stdcrypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// GenerateServiceKey creates P-256 service key and returns PEM private and
+// public key
+func GenerateServiceKey() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	public, err := EncodePublicKeyPEM(key.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), public, nil
+}
@@ -1,10 +1,13 @@
 package crypto
 
 import (
+	stdcrypto "crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
+	"fmt"
+	"slices"
 )
 
 // Signer defines a contract for different types of signing implementations.
@@ -15,48 +18,121 @@ type Signer interface {
 // RSASigner represents signer object
 type RSASigner struct {
 	PrivateKey *rsa.PrivateKey
+	Hash       HashAlgorithm
+	Padding    RSAPadding
+	SaltLength int
 }
 
 // NewRSASigner creates new signer based on private key
-func NewRSASigner(privateKey []byte) (*RSASigner, error) {
+func NewRSASigner(privateKey []byte, opts SignatureOptions) (*RSASigner, error) {
+	if _, err := opts.Hash.cryptoHash(); err != nil {
+		return nil, err
+	}
+	if opts.Padding != "" && !slices.Contains(supportedPaddings, opts.Padding) {
+		return nil, fmt.Errorf("unsupported padding: %s", opts.Padding)
+	}
 	m := NewRSAMarshaler()
 	keyPair, err := m.Unmarshal(privateKey)
 	if err != nil {
 		return nil, err
 	}
-	return &RSASigner{PrivateKey: keyPair.Private}, nil
+	return &RSASigner{
+		PrivateKey: keyPair.Private,
+		Hash:       opts.Hash,
+		Padding:    opts.Padding,
+		SaltLength: opts.SaltLength,
+	}, nil
 }
 
 // Sign provided data using RSA algorithm and return signed data
 func (s *RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
-	hash := sha256.Sum256(dataToBeSigned)
-	return rsa.SignPKCS1v15(rand.Reader, s.PrivateKey, 0, hash[:])
+	hash, digest, err := s.Hash.digest(dataToBeSigned)
+	if err != nil {
+		return nil, err
+	}
+	if s.Padding == PaddingPSS {
+		return rsa.SignPSS(rand.Reader, s.PrivateKey, hash, digest, pssOptions(s.SaltLength))
+	}
+	return rsa.SignPKCS1v15(rand.Reader, s.PrivateKey, pkcs1DigestInfo(s.Hash, hash), digest)
+}
+
+// pkcs1DigestInfo returns hash identifier embedded into PKCS#1 v1.5 signature.
+// Devices created before hash became configurable have no hash stored and
+// sign bare SHA-256 digest without DigestInfo prefix, which is kept for them.
+func pkcs1DigestInfo(name HashAlgorithm, hash stdcrypto.Hash) stdcrypto.Hash {
+	if name == "" {
+		return 0
+	}
+	return hash
 }
 
 // ECCSigner represents signer object
 type ECCSigner struct {
 	PrivateKey *ecdsa.PrivateKey
+	Encoding   SignatureEncoding
+	Hash       HashAlgorithm
 }
 
-// NewECCSigner creates new signer based on private key
-func NewECCSigner(privateKey []byte) (*ECCSigner, error) {
+// NewECCSigner creates new signer based on private key, empty encoding
+// means ASN.1 DER
+func NewECCSigner(privateKey []byte, opts SignatureOptions) (*ECCSigner, error) {
+	encoding := opts.Encoding
+	if encoding == "" {
+		encoding = EncodingASN1DER
+	}
+	if encoding != EncodingASN1DER && encoding != EncodingP1363 {
+		return nil, ErrUnsupportedEncoding
+	}
+	if _, err := opts.Hash.cryptoHash(); err != nil {
+		return nil, err
+	}
 	m := NewECCMarshaler()
 	keyPair, err := m.Decode(privateKey)
 	if err != nil {
 		return nil, err
 	}
-	return &ECCSigner{PrivateKey: keyPair.Private}, nil
+	return &ECCSigner{PrivateKey: keyPair.Private, Encoding: encoding, Hash: opts.Hash}, nil
 }
 
 // Sign provided data using ECC algorithm and return signed data
 func (s *ECCSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
-	hash := sha256.Sum256(dataToBeSigned)
+	_, digest, err := s.Hash.digest(dataToBeSigned)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Encoding == EncodingP1363 {
+		r, sigS, err := ecdsa.Sign(rand.Reader, s.PrivateKey, digest)
+		if err != nil {
+			return nil, err
+		}
+		return encodeP1363(r, sigS, curveSize(&s.PrivateKey.PublicKey)), nil
+	}
+
+	return ecdsa.SignASN1(rand.Reader, s.PrivateKey, digest)
+}
 
-	r, sigS, err := ecdsa.Sign(rand.Reader, s.PrivateKey, hash[:])
+// curveSize returns byte length of single signature component for key curve
+func curveSize(key *ecdsa.PublicKey) int {
+	return (key.Curve.Params().BitSize + 7) / 8
+}
+
+// Ed25519Signer represents signer object
+type Ed25519Signer struct {
+	PrivateKey ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates new signer based on private key
+func NewEd25519Signer(privateKey []byte) (*Ed25519Signer, error) {
+	m := NewEd25519Marshaler()
+	keyPair, err := m.Decode(privateKey)
 	if err != nil {
 		return nil, err
 	}
+	return &Ed25519Signer{PrivateKey: keyPair.Private}, nil
+}
 
-	signature := append(r.Bytes(), sigS.Bytes()...)
-	return signature, nil
+// Sign provided data using pure Ed25519, message is not pre-hashed
+func (s *Ed25519Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	return ed25519.Sign(s.PrivateKey, dataToBeSigned), nil
 }
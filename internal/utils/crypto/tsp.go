@@ -0,0 +1,679 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time-stamp protocol object identifiers (RFC 3161, RFC 5816)
+var (
+	oidTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttrSigningCertV2    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidExtKeyUsage          = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidKeyPurposeTimeStamp  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+	timeStampHashAlgorithms = []stdcrypto.Hash{stdcrypto.SHA256, stdcrypto.SHA384, stdcrypto.SHA512}
+)
+
+// DefaultTimeStampPolicy is anyPolicy, used when TSA has no policy of its own
+var DefaultTimeStampPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+
+// Media types of time-stamp requests and responses (RFC 3161 section 3.4)
+const (
+	TimeStampQueryContentType = "application/timestamp-query"
+	TimeStampReplyContentType = "application/timestamp-reply"
+)
+
+// maxTimeStampResponseSize limits response read from remote TSA
+const maxTimeStampResponseSize = 1 << 20
+
+// PKIStatus values of time-stamp response
+const (
+	tspStatusGranted         = 0
+	tspStatusGrantedWithMods = 1
+	tspStatusRejection       = 2
+)
+
+// PKIFailureInfo bits of rejected time-stamp request
+const (
+	tspFailBadAlg              = 0
+	tspFailBadRequest          = 2
+	tspFailBadDataFormat       = 5
+	tspFailUnacceptedPolicy    = 15
+	tspFailUnacceptedExtension = 16
+	tspFailSystemFailure       = 25
+)
+
+// Timestamper obtains RFC 3161 time-stamp tokens over message digests
+type Timestamper interface {
+	Timestamp(ctx context.Context, digest []byte, hash stdcrypto.Hash) ([]byte, error)
+}
+
+type tspMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tspRequest struct {
+	Version        int
+	MessageImprint tspMessageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     asn1.RawValue         `asn1:"optional,tag:0"`
+}
+
+type tspAccuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tspInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint tspMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       tspAccuracy   `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type tspStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type tspResponse struct {
+	Status         tspStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// essCertIDv2 identifies signing certificate by SHA-256 hash, the default
+// hash algorithm, which is therefore omitted
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// TimeStampInfo is content of time-stamp token
+type TimeStampInfo struct {
+	GenTime       time.Time
+	SerialNumber  *big.Int
+	Policy        asn1.ObjectIdentifier
+	Nonce         *big.Int
+	HashAlgorithm stdcrypto.Hash
+	HashedMessage []byte
+	// TSA is certificate which signed token, set by VerifyTimeStampToken
+	TSA *x509.Certificate
+}
+
+// messageImprint encodes digest together with its hash algorithm
+func messageImprint(digest []byte, hash stdcrypto.Hash) (tspMessageImprint, error) {
+	oid, ok := digestAlgorithmsByHash[hash]
+	if !ok || !slices.Contains(timeStampHashAlgorithms, hash) {
+		return tspMessageImprint{}, fmt.Errorf("hash %v is not supported in time-stamps", hash)
+	}
+	if len(digest) != hash.Size() {
+		return tspMessageImprint{}, fmt.Errorf("digest has %d bytes, %v needs %d", len(digest), hash, hash.Size())
+	}
+	return tspMessageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1Null}, HashedMessage: digest}, nil
+}
+
+// imprintHash returns hash of message imprint
+func imprintHash(imprint tspMessageImprint) (stdcrypto.Hash, error) {
+	for _, h := range timeStampHashAlgorithms {
+		if imprint.HashAlgorithm.Algorithm.Equal(digestAlgorithmsByHash[h]) {
+			if len(imprint.HashedMessage) != h.Size() {
+				return 0, fmt.Errorf("hashed message has %d bytes, %v needs %d", len(imprint.HashedMessage), h, h.Size())
+			}
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported message imprint algorithm %v", imprint.HashAlgorithm.Algorithm)
+}
+
+// NewTimeStampRequest encodes DER time-stamp request asking for TSA
+// certificate to be included in token. Nonce is optional.
+func NewTimeStampRequest(digest []byte, hash stdcrypto.Hash, nonce *big.Int) ([]byte, error) {
+	imprint, err := messageImprint(digest, hash)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(tspRequest{Version: 1, MessageImprint: imprint, Nonce: nonce, CertReq: true})
+}
+
+// ParseTimeStampResponse returns token of granted time-stamp response
+func ParseTimeStampResponse(der []byte) ([]byte, error) {
+	var resp tspResponse
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed time-stamp response: %v", err)
+	}
+	if resp.Status.Status != tspStatusGranted && resp.Status.Status != tspStatusGrantedWithMods {
+		var reasons []string
+		for _, s := range resp.Status.StatusString {
+			reasons = append(reasons, string(s.Bytes))
+		}
+		return nil, fmt.Errorf("time-stamp request rejected with status %d: %q", resp.Status.Status, reasons)
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("time-stamp response carries no token")
+	}
+	return resp.TimeStampToken.FullBytes, nil
+}
+
+// ParseTimeStampToken decodes token content without checking its signature
+func ParseTimeStampToken(token []byte) (*TimeStampInfo, error) {
+	var ci cmsContentInfo
+	if rest, err := asn1.Unmarshal(token, &ci); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed time-stamp token: %v", err)
+	}
+	var sd cmsSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("malformed time-stamp token: %w", err)
+	}
+	content, err := sd.EncapContentInfo.content()
+	if err != nil {
+		return nil, err
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) || content == nil {
+		return nil, errors.New("token doesn't carry TSTInfo")
+	}
+	return parseTSTInfo(content)
+}
+
+func parseTSTInfo(der []byte) (*TimeStampInfo, error) {
+	var tst tspInfo
+	if rest, err := asn1.Unmarshal(der, &tst); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("malformed TSTInfo: %v", err)
+	}
+	if tst.Version != 1 {
+		return nil, fmt.Errorf("unsupported TSTInfo version %d", tst.Version)
+	}
+	hash, err := imprintHash(tst.MessageImprint)
+	if err != nil {
+		return nil, err
+	}
+	return &TimeStampInfo{
+		GenTime:       tst.GenTime,
+		SerialNumber:  tst.SerialNumber,
+		Policy:        tst.Policy,
+		Nonce:         tst.Nonce,
+		HashAlgorithm: hash,
+		HashedMessage: tst.MessageImprint.HashedMessage,
+	}, nil
+}
+
+// VerifyTimeStampToken checks that token covers digest, is signed by TSA
+// certificate included in token and that certificate is valid for
+// time-stamping at token time and chains to roots
+func VerifyTimeStampToken(token []byte, digest []byte, roots *x509.CertPool) (*TimeStampInfo, error) {
+	if roots == nil {
+		return nil, errors.New("no trusted TSA roots")
+	}
+	sc, err := parseSignedCMS(token)
+	if err != nil {
+		return nil, err
+	}
+	if !sc.contentType.Equal(oidTSTInfo) || sc.content == nil {
+		return nil, errors.New("token doesn't carry TSTInfo")
+	}
+	h := sc.hash.New()
+	h.Write(sc.content)
+	if !bytes.Equal(h.Sum(nil), sc.messageDigest) {
+		return nil, errors.New("message digest doesn't match TSTInfo")
+	}
+	if err := checkSigningCertificate(sc); err != nil {
+		return nil, err
+	}
+
+	info, err := parseTSTInfo(sc.content)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(info.HashedMessage, digest) {
+		return nil, errors.New("token doesn't cover given digest")
+	}
+
+	if !slices.Contains(sc.signer.ExtKeyUsage, x509.ExtKeyUsageTimeStamping) {
+		return nil, errors.New("signer certificate is not time-stamping certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: sc.intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	if _, err := sc.signer.Verify(opts); err != nil {
+		return nil, fmt.Errorf("TSA certificate is not trusted: %w", err)
+	}
+	info.TSA = sc.signer
+	return info, nil
+}
+
+// checkSigningCertificate compares ESSCertIDv2 signed attribute, when
+// present, with certificate which signed token
+func checkSigningCertificate(sc *signedCMS) error {
+	for _, a := range sc.attrs {
+		if !a.Type.Equal(oidAttrSigningCertV2) {
+			continue
+		}
+		var value asn1.RawValue
+		var signingCert signingCertificateV2
+		if _, err := asn1.Unmarshal(a.Values.FullBytes, &value); err != nil {
+			return errors.New("malformed signing certificate attribute")
+		}
+		if _, err := asn1.Unmarshal(value.Bytes, &signingCert); err != nil || len(signingCert.Certs) == 0 {
+			return errors.New("malformed signing certificate attribute")
+		}
+		sum := sha256.Sum256(sc.signer.Raw)
+		if !bytes.Equal(signingCert.Certs[0].CertHash, sum[:]) {
+			return errors.New("signing certificate attribute doesn't match TSA certificate")
+		}
+	}
+	return nil
+}
+
+// TimeStampAuthority issues time-stamp tokens with its own key, it makes
+// time-stamping work without external TSA
+type TimeStampAuthority struct {
+	chain     []*x509.Certificate
+	key       stdcrypto.Signer
+	policy    asn1.ObjectIdentifier
+	algorithm x509.SignatureAlgorithm
+	now       func() time.Time
+}
+
+// NewTimeStampAuthority validates that first certificate of chain is
+// time-stamping certificate of key. Last certificate of chain is trust
+// anchor returned by Roots.
+func NewTimeStampAuthority(chain []*x509.Certificate, key stdcrypto.Signer, policy asn1.ObjectIdentifier) (*TimeStampAuthority, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("TSA certificate is required")
+	}
+	if !slices.Contains(chain[0].ExtKeyUsage, x509.ExtKeyUsageTimeStamping) {
+		return nil, errors.New("TSA certificate doesn't allow time-stamping")
+	}
+	if !SamePublicKey(key.Public(), chain[0].PublicKey) {
+		return nil, errors.New("TSA key doesn't match TSA certificate")
+	}
+	algorithm, err := keySignatureAlgorithm(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	if len(policy) == 0 {
+		policy = DefaultTimeStampPolicy
+	}
+	return &TimeStampAuthority{chain: chain, key: key, policy: policy, algorithm: algorithm, now: time.Now}, nil
+}
+
+// LoadTimeStampAuthority reads PEM certificate chain, TSA certificate first,
+// and PEM private key from files. Empty policy selects DefaultTimeStampPolicy.
+func LoadTimeStampAuthority(certFile, keyFile, policy string) (*TimeStampAuthority, error) {
+	chain, err := ReadCertificates(certFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseCAKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyFile, err)
+	}
+	var oid asn1.ObjectIdentifier
+	if policy != "" {
+		if oid, err = parseOID(policy); err != nil {
+			return nil, fmt.Errorf("invalid TSA policy: %w", err)
+		}
+	}
+	return NewTimeStampAuthority(chain, key, oid)
+}
+
+// ReadCertificates reads all PEM certificates from file
+func ReadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no PEM certificate found", path)
+	}
+	return certs, nil
+}
+
+// parseOID parses dotted object identifier
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	for _, arc := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(arc)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid object identifier %q", s)
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("invalid object identifier %q", s)
+	}
+	return oid, nil
+}
+
+// keySignatureAlgorithm selects X.509 signature algorithm of service key, ECDSA
+// hash follows curve size
+func keySignatureAlgorithm(pub stdcrypto.PublicKey) (x509.SignatureAlgorithm, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return x509.SHA256WithRSA, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return x509.ECDSAWithSHA256, nil
+		case elliptic.P384():
+			return x509.ECDSAWithSHA384, nil
+		case elliptic.P521():
+			return x509.ECDSAWithSHA512, nil
+		}
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return x509.PureEd25519, nil
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+// keySigner adapts standard library key to Signer, message is hashed first
+// except for Ed25519
+type keySigner struct {
+	key  stdcrypto.Signer
+	hash stdcrypto.Hash
+}
+
+func (s keySigner) Sign(data []byte) ([]byte, error) {
+	if _, ok := s.key.Public().(ed25519.PublicKey); ok {
+		return s.key.Sign(rand.Reader, data, stdcrypto.Hash(0))
+	}
+	h := s.hash.New()
+	h.Write(data)
+	return s.key.Sign(rand.Reader, h.Sum(nil), s.hash)
+}
+
+// Roots returns pool with last certificate of TSA chain
+func (tsa *TimeStampAuthority) Roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(tsa.chain[len(tsa.chain)-1])
+	return pool
+}
+
+// Timestamp issues token over digest, TSA certificates are included
+func (tsa *TimeStampAuthority) Timestamp(_ context.Context, digest []byte, hash stdcrypto.Hash) ([]byte, error) {
+	imprint, err := messageImprint(digest, hash)
+	if err != nil {
+		return nil, err
+	}
+	return tsa.issue(imprint, nil, true)
+}
+
+// issue creates token for message imprint, certificates are included when
+// requested
+func (tsa *TimeStampAuthority) issue(imprint tspMessageImprint, nonce *big.Int, certReq bool) ([]byte, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	tstInfo, err := asn1.Marshal(tspInfo{
+		Version:        1,
+		Policy:         tsa.policy,
+		MessageImprint: imprint,
+		SerialNumber:   serial,
+		// generalized time is encoded with second precision
+		GenTime:  tsa.now().UTC().Truncate(time.Second),
+		Accuracy: tspAccuracy{Seconds: 1},
+		Nonce:    nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := CMSHash(tsa.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(tstInfo)
+	digest := h.Sum(nil)
+
+	certHash := sha256.Sum256(tsa.chain[0].Raw)
+	signingCert, err := attribute(oidAttrSigningCertV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}})
+	if err != nil {
+		return nil, err
+	}
+
+	// signer certificate identifies signer, so it's always first in chain;
+	// remaining certificates are left out unless requested
+	chain := [][]byte{tsa.chain[0].Raw}
+	if certReq {
+		for _, c := range tsa.chain[1:] {
+			chain = append(chain, c.Raw)
+		}
+	}
+	return signCMS(oidTSTInfo, tstInfo, digest, [][]byte{signingCert}, chain, keySigner{key: tsa.key, hash: hash}, tsa.algorithm)
+}
+
+// Respond answers DER time-stamp request with DER time-stamp response,
+// invalid requests get rejection response. Error is returned only when
+// response can't be encoded.
+func (tsa *TimeStampAuthority) Respond(request []byte) ([]byte, error) {
+	var req tspRequest
+	if rest, err := asn1.Unmarshal(request, &req); err != nil || len(rest) > 0 {
+		return rejection(tspFailBadDataFormat, "malformed time-stamp request")
+	}
+	if req.Version != 1 {
+		return rejection(tspFailBadRequest, "unsupported request version")
+	}
+	if _, err := imprintHash(req.MessageImprint); err != nil {
+		return rejection(tspFailBadAlg, err.Error())
+	}
+	if len(req.ReqPolicy) > 0 && !req.ReqPolicy.Equal(tsa.policy) {
+		return rejection(tspFailUnacceptedPolicy, "requested policy is not supported")
+	}
+	if len(req.Extensions.FullBytes) > 0 {
+		return rejection(tspFailUnacceptedExtension, "request extensions are not supported")
+	}
+
+	token, err := tsa.issue(req.MessageImprint, req.Nonce, req.CertReq)
+	if err != nil {
+		return rejection(tspFailSystemFailure, "failed to issue time-stamp")
+	}
+	return asn1.Marshal(tspResponse{
+		Status:         tspStatusInfo{Status: tspStatusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+}
+
+// rejection encodes rejected time-stamp response with failure bit and reason
+func rejection(failure int, reason string) ([]byte, error) {
+	bits := make([]byte, failure/8+1)
+	bits[failure/8] = 0x80 >> (failure % 8)
+	return asn1.Marshal(tspResponse{Status: tspStatusInfo{
+		Status:       tspStatusRejection,
+		StatusString: []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(reason)}},
+		FailInfo:     asn1.BitString{Bytes: bits, BitLength: failure + 1},
+	}})
+}
+
+// TimeStampClient requests tokens from remote TSA over HTTP (RFC 3161
+// section 3.4). Token is checked to answer request, trust in TSA is
+// established by VerifyTimeStampToken.
+type TimeStampClient struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// Timestamp sends request with random nonce and returns token of response
+func (c *TimeStampClient) Timestamp(ctx context.Context, digest []byte, hash stdcrypto.Hash) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	request, err := NewTimeStampRequest(digest, hash, nonce)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", TimeStampQueryContentType)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TSA responded with HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTimeStampResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxTimeStampResponseSize {
+		return nil, errors.New("TSA response is too large")
+	}
+
+	token, err := ParseTimeStampResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	info, err := ParseTimeStampToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(info.HashedMessage, digest) || info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("time-stamp token doesn't answer request")
+	}
+	return token, nil
+}
+
+// TSAMaterial is PEM encoded output of GenerateTimeStampAuthority
+type TSAMaterial struct {
+	RootCert []byte
+	// Chain is TSA certificate followed by root
+	Chain []byte
+	Key   []byte
+}
+
+// GenerateTimeStampAuthority creates self-signed root and TSA certificate
+// signed by it, both with P-384 keys. TSA certificate has critical extended
+// key usage limited to time-stamping as required by RFC 3161.
+func GenerateTimeStampAuthority(name string, validity time.Duration) (*TSAMaterial, error) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	eku, err := asn1.Marshal([]asn1.ObjectIdentifier{oidKeyPurposeTimeStamp})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rootTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name + " TSA Root"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(2 * validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	tsaTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name + " TSA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		ExtraExtensions:       []pkix.Extension{{Id: oidExtKeyUsage, Critical: true, Value: eku}},
+	}
+	if rootTemplate.SerialNumber, err = randomSerial(); err != nil {
+		return nil, err
+	}
+	if tsaTemplate.SerialNumber, err = randomSerial(); err != nil {
+		return nil, err
+	}
+
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		return nil, err
+	}
+	tsaDER, err := x509.CreateCertificate(rand.Reader, tsaTemplate, root, &tsaKey.PublicKey, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	tsaKeyDER, err := x509.MarshalPKCS8PrivateKey(tsaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	rootPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER})
+	return &TSAMaterial{
+		RootCert: rootPEM,
+		Chain:    append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tsaDER}), rootPEM...),
+		Key:      pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: tsaKeyDER}),
+	}, nil
+}
@@ -0,0 +1,325 @@
+package crypto_test
+
+import (
+	"bytes"
+	"context"
+	stdcrypto "crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
+)
+
+// wire structures of RFC 3161, used to build requests and responses the
+// package itself would never produce
+type testImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type testTimeStampRequest struct {
+	Version        int
+	MessageImprint testImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     asn1.RawValue         `asn1:"optional,tag:0"`
+}
+
+type testStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+}
+
+type testTimeStampResponse struct {
+	Status         testStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+var (
+	oidTestSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidTestSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+func testTSA(t *testing.T) *crypto.TimeStampAuthority {
+	t.Helper()
+	material, err := crypto.GenerateTimeStampAuthority("Test", time.Hour)
+	if err != nil {
+		t.Fatalf("generate TSA: %v", err)
+	}
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "chain.pem"), material.Chain)
+	writeFile(t, filepath.Join(dir, "key.pem"), material.Key)
+	tsa, err := crypto.LoadTimeStampAuthority(filepath.Join(dir, "chain.pem"), filepath.Join(dir, "key.pem"), "")
+	if err != nil {
+		t.Fatalf("load TSA: %v", err)
+	}
+	return tsa
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return der
+}
+
+// grantedResponse wraps token into granted time-stamp response
+func grantedResponse(t *testing.T, token []byte) []byte {
+	t.Helper()
+	return mustMarshal(t, testTimeStampResponse{TimeStampToken: asn1.RawValue{FullBytes: token}})
+}
+
+func TestTimeStampAuthority_RoundTrip(t *testing.T) {
+	tsa := testTSA(t)
+	digest := sha256.Sum256([]byte("signature"))
+	nonce := big.NewInt(42)
+	request, err := crypto.NewTimeStampRequest(digest[:], stdcrypto.SHA256, nonce)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	response, err := tsa.Respond(request)
+	if err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	token, err := crypto.ParseTimeStampResponse(response)
+	if err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	info, err := crypto.ParseTimeStampToken(token)
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		t.Errorf("expected nonce %v, got %v", nonce, info.Nonce)
+	}
+	if info.HashAlgorithm != stdcrypto.SHA256 || !bytes.Equal(info.HashedMessage, digest[:]) {
+		t.Error("expected token to carry request imprint")
+	}
+	if !info.Policy.Equal(crypto.DefaultTimeStampPolicy) {
+		t.Errorf("expected default policy, got %v", info.Policy)
+	}
+
+	verified, err := crypto.VerifyTimeStampToken(token, digest[:], tsa.Roots())
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if verified.TSA == nil || !verified.GenTime.Equal(info.GenTime) {
+		t.Error("expected verified token to name TSA and keep its time")
+	}
+}
+
+func TestVerifyTimeStampToken_Errors(t *testing.T) {
+	tsa := testTSA(t)
+	digest := sha256.Sum256([]byte("signature"))
+	token, err := tsa.Timestamp(context.Background(), digest[:], stdcrypto.SHA256)
+	if err != nil {
+		t.Fatalf("timestamp: %v", err)
+	}
+	tampered := bytes.Clone(token)
+	tampered[len(tampered)-1] ^= 0x01
+
+	// detached CMS signature is well formed SignedData, but not a token
+	ca, _ := testCA(t)
+	cms := signDetached(t, ca, cmsSigners(t)[2], []byte("document"), time.Now())
+
+	other := sha256.Sum256([]byte("other signature"))
+	tests := map[string]struct {
+		token  []byte
+		digest []byte
+		roots  *x509.CertPool
+	}{
+		"garbage":         {token: []byte("not a token"), digest: digest[:], roots: tsa.Roots()},
+		"truncated":       {token: token[:len(token)/2], digest: digest[:], roots: tsa.Roots()},
+		"trailing data":   {token: append(bytes.Clone(token), 0x00), digest: digest[:], roots: tsa.Roots()},
+		"tampered":        {token: tampered, digest: digest[:], roots: tsa.Roots()},
+		"not a token":     {token: cms, digest: digest[:], roots: ca.Roots()},
+		"other digest":    {token: token, digest: other[:], roots: tsa.Roots()},
+		"untrusted TSA":   {token: token, digest: digest[:], roots: testTSA(t).Roots()},
+		"CA instead TSA":  {token: token, digest: digest[:], roots: ca.Roots()},
+		"no trusted root": {token: token, digest: digest[:]},
+	}
+	for name, tt := range tests {
+		if _, err := crypto.VerifyTimeStampToken(tt.token, tt.digest, tt.roots); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := crypto.ParseTimeStampToken(cms); err == nil {
+		t.Error("expected CMS signature without TSTInfo to fail parsing")
+	}
+}
+
+func TestParseTimeStampResponse_Malformed(t *testing.T) {
+	tsa := testTSA(t)
+	digest := sha256.Sum256([]byte("signature"))
+	token, err := tsa.Timestamp(context.Background(), digest[:], stdcrypto.SHA256)
+	if err != nil {
+		t.Fatalf("timestamp: %v", err)
+	}
+	valid := grantedResponse(t, token)
+	if _, err := crypto.ParseTimeStampResponse(valid); err != nil {
+		t.Fatalf("expected valid response to parse: %v", err)
+	}
+	rejected, err := tsa.Respond([]byte("garbage"))
+	if err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+
+	tests := map[string]struct {
+		response []byte
+		wantErr  string
+	}{
+		"empty":         {response: nil, wantErr: "malformed"},
+		"garbage":       {response: []byte("not a response"), wantErr: "malformed"},
+		"truncated":     {response: valid[:len(valid)-10], wantErr: "malformed"},
+		"trailing data": {response: append(bytes.Clone(valid), 0x00), wantErr: "malformed"},
+		"rejection":     {response: rejected, wantErr: "status 2"},
+		"waiting": {response: mustMarshal(t, testTimeStampResponse{Status: testStatusInfo{Status: 3}}),
+			wantErr: "status 3"},
+		"revocation warning": {response: mustMarshal(t, testTimeStampResponse{Status: testStatusInfo{Status: 4},
+			TimeStampToken: asn1.RawValue{FullBytes: token}}), wantErr: "status 4"},
+		"granted without token": {response: mustMarshal(t, testTimeStampResponse{}), wantErr: "no token"},
+	}
+	for name, tt := range tests {
+		_, err := crypto.ParseTimeStampResponse(tt.response)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error with %q, got %v", name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestTimeStampAuthority_RejectsRequests(t *testing.T) {
+	tsa := testTSA(t)
+	digest := sha256.Sum256([]byte("signature"))
+	imprint := testImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidTestSHA256}, HashedMessage: digest[:]}
+
+	tests := map[string]struct {
+		request []byte
+		reason  string
+	}{
+		"malformed": {request: []byte("garbage"), reason: "malformed time-stamp request"},
+		"version 2": {request: mustMarshal(t, testTimeStampRequest{Version: 2, MessageImprint: imprint}),
+			reason: "unsupported request version"},
+		"SHA-1 imprint": {request: mustMarshal(t, testTimeStampRequest{Version: 1, MessageImprint: testImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidTestSHA1}, HashedMessage: digest[:20]}}),
+			reason: "unsupported message imprint algorithm"},
+		"short imprint": {request: mustMarshal(t, testTimeStampRequest{Version: 1, MessageImprint: testImprint{
+			HashAlgorithm: imprint.HashAlgorithm, HashedMessage: digest[:16]}}),
+			reason: "hashed message has 16 bytes"},
+		"other policy": {request: mustMarshal(t, testTimeStampRequest{Version: 1, MessageImprint: imprint,
+			ReqPolicy: asn1.ObjectIdentifier{1, 2, 3}}), reason: "requested policy is not supported"},
+		"extensions": {request: mustMarshal(t, testTimeStampRequest{Version: 1, MessageImprint: imprint,
+			Extensions: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: []byte{0x30, 0x00}}}),
+			reason: "request extensions are not supported"},
+	}
+	for name, tt := range tests {
+		response, err := tsa.Respond(tt.request)
+		if err != nil {
+			t.Fatalf("%s: respond: %v", name, err)
+		}
+		_, err = crypto.ParseTimeStampResponse(response)
+		if err == nil || !strings.Contains(err.Error(), "status 2") || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("%s: expected rejection with %q, got %v", name, tt.reason, err)
+		}
+	}
+}
+
+func TestTimeStampClient_ChecksResponse(t *testing.T) {
+	tsa := testTSA(t)
+	digest := sha256.Sum256([]byte("signature"))
+	other := sha256.Sum256([]byte("other signature"))
+
+	// respond answers request parsed from body, tests tamper with it
+	respond := func(t *testing.T, body []byte, nonce func(*big.Int) *big.Int, imprint []byte) []byte {
+		var req testTimeStampRequest
+		if _, err := asn1.Unmarshal(body, &req); err != nil {
+			t.Fatalf("parse request: %v", err)
+		}
+		if imprint != nil {
+			req.MessageImprint.HashedMessage = imprint
+		}
+		req.Nonce = nonce(req.Nonce)
+		response, err := tsa.Respond(mustMarshal(t, req))
+		if err != nil {
+			t.Fatalf("respond: %v", err)
+		}
+		return response
+	}
+	same := func(n *big.Int) *big.Int { return n }
+
+	tests := map[string]struct {
+		status  int
+		reply   func(t *testing.T, body []byte) []byte
+		wantErr string
+	}{
+		"valid": {reply: func(t *testing.T, body []byte) []byte {
+			return respond(t, body, same, nil)
+		}},
+		"HTTP error": {status: http.StatusInternalServerError, reply: func(*testing.T, []byte) []byte { return nil },
+			wantErr: "HTTP 500"},
+		"garbage": {reply: func(*testing.T, []byte) []byte { return []byte("garbage") },
+			wantErr: "malformed time-stamp response"},
+		"too large": {reply: func(*testing.T, []byte) []byte { return make([]byte, 1<<20+1) },
+			wantErr: "too large"},
+		"rejection": {reply: func(*testing.T, []byte) []byte {
+			response, _ := tsa.Respond(nil)
+			return response
+		}, wantErr: "status 2"},
+		"other imprint": {reply: func(t *testing.T, body []byte) []byte {
+			return respond(t, body, same, other[:])
+		}, wantErr: "doesn't answer request"},
+		"other nonce": {reply: func(t *testing.T, body []byte) []byte {
+			return respond(t, body, func(n *big.Int) *big.Int { return new(big.Int).Add(n, big.NewInt(1)) }, nil)
+		}, wantErr: "doesn't answer request"},
+		"no nonce": {reply: func(t *testing.T, body []byte) []byte {
+			return respond(t, body, func(*big.Int) *big.Int { return nil }, nil)
+		}, wantErr: "doesn't answer request"},
+		"malformed token": {reply: func(t *testing.T, _ []byte) []byte {
+			return grantedResponse(t, mustMarshal(t, asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true}))
+		}, wantErr: "malformed time-stamp token"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Type") != crypto.TimeStampQueryContentType {
+					t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+				}
+				body := new(bytes.Buffer)
+				body.ReadFrom(r.Body)
+				reply := tt.reply(t, body.Bytes())
+				w.Header().Set("Content-Type", crypto.TimeStampReplyContentType)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write(reply)
+			}))
+			defer server.Close()
+
+			client := &crypto.TimeStampClient{URL: server.URL}
+			token, err := client.Timestamp(context.Background(), digest[:], stdcrypto.SHA256)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("timestamp: %v", err)
+				}
+				if _, err := crypto.VerifyTimeStampToken(token, digest[:], tsa.Roots()); err != nil {
+					t.Fatalf("verify: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error with %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
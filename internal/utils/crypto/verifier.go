@@ -0,0 +1,157 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// ErrInvalidSignature is returned when signature doesn't match signed data
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Verifier defines a contract for checking signatures produced by Signer.
+type Verifier interface {
+	Verify(signedData []byte, signature []byte) error
+}
+
+// RSAVerifier represents verifier object
+type RSAVerifier struct {
+	PublicKey  *rsa.PublicKey
+	Hash       HashAlgorithm
+	Padding    RSAPadding
+	SaltLength int
+}
+
+// NewRSAVerifier creates new verifier based on public key
+func NewRSAVerifier(publicKey []byte, opts SignatureOptions) (*RSAVerifier, error) {
+	if _, err := opts.Hash.cryptoHash(); err != nil {
+		return nil, err
+	}
+	if opts.Padding != "" && !slices.Contains(supportedPaddings, opts.Padding) {
+		return nil, fmt.Errorf("unsupported padding: %s", opts.Padding)
+	}
+	m := NewRSAMarshaler()
+	key, err := m.UnmarshalPublic(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &RSAVerifier{
+		PublicKey:  key,
+		Hash:       opts.Hash,
+		Padding:    opts.Padding,
+		SaltLength: opts.SaltLength,
+	}, nil
+}
+
+// Verify checks PKCS#1 v1.5 or PSS signature, same as RSASigner.Sign
+func (v *RSAVerifier) Verify(signedData []byte, signature []byte) error {
+	hash, digest, err := v.Hash.digest(signedData)
+	if err != nil {
+		return err
+	}
+	if v.Padding == PaddingPSS {
+		if err := rsa.VerifyPSS(v.PublicKey, hash, digest, signature, pssOptions(v.SaltLength)); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	if err := rsa.VerifyPKCS1v15(v.PublicKey, pkcs1DigestInfo(v.Hash, hash), digest, signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ECCVerifier represents verifier object
+type ECCVerifier struct {
+	PublicKey *ecdsa.PublicKey
+	Encoding  SignatureEncoding
+	Hash      HashAlgorithm
+}
+
+// NewECCVerifier creates new verifier based on public key, empty encoding
+// means ASN.1 DER
+func NewECCVerifier(publicKey []byte, opts SignatureOptions) (*ECCVerifier, error) {
+	encoding := opts.Encoding
+	if encoding == "" {
+		encoding = EncodingASN1DER
+	}
+	switch encoding {
+	case EncodingASN1DER, EncodingP1363, EncodingLegacyRaw:
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+	if _, err := opts.Hash.cryptoHash(); err != nil {
+		return nil, err
+	}
+	m := NewECCMarshaler()
+	key, err := m.DecodePublic(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ECCVerifier{PublicKey: key, Encoding: encoding, Hash: opts.Hash}, nil
+}
+
+// Verify checks ECDSA signature, same as ECCSigner.Sign
+func (v *ECCVerifier) Verify(signedData []byte, signature []byte) error {
+	_, hash, err := v.Hash.digest(signedData)
+	if err != nil {
+		return err
+	}
+	size := curveSize(v.PublicKey)
+
+	switch v.Encoding {
+	case EncodingP1363:
+		r, s, err := decodeP1363(signature, size)
+		if err != nil {
+			return err
+		}
+		if ecdsa.Verify(v.PublicKey, hash, r, s) {
+			return nil
+		}
+	case EncodingLegacyRaw:
+		// legacy signer concatenated r and s without padding, so leading zero
+		// bytes may be dropped from any of them. Try every split that fits curve size.
+		for split := len(signature) - size; split <= size; split++ {
+			if split <= 0 || split >= len(signature) {
+				continue
+			}
+			r := new(big.Int).SetBytes(signature[:split])
+			s := new(big.Int).SetBytes(signature[split:])
+			if ecdsa.Verify(v.PublicKey, hash, r, s) {
+				return nil
+			}
+		}
+	default:
+		if ecdsa.VerifyASN1(v.PublicKey, hash, signature) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// Ed25519Verifier represents verifier object
+type Ed25519Verifier struct {
+	PublicKey ed25519.PublicKey
+}
+
+// NewEd25519Verifier creates new verifier based on public key
+func NewEd25519Verifier(publicKey []byte) (*Ed25519Verifier, error) {
+	m := NewEd25519Marshaler()
+	key, err := m.DecodePublic(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Ed25519Verifier{PublicKey: key}, nil
+}
+
+// Verify checks pure Ed25519 signature, same as Ed25519Signer.Sign
+func (v *Ed25519Verifier) Verify(signedData []byte, signature []byte) error {
+	if !ed25519.Verify(v.PublicKey, signedData, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
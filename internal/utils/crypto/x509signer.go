@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	stdcrypto "crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MessageSigner adapts Signer to standard library crypto.MessageSigner, so
+// device keys, including keys living in token, can sign X.509 structures.
+// Signer hashes message itself, so X.509 signature algorithm has to match
+// its options, see X509SignatureAlgorithm.
+type MessageSigner struct {
+	PublicKey stdcrypto.PublicKey
+	Signer    Signer
+}
+
+func (s MessageSigner) Public() stdcrypto.PublicKey {
+	return s.PublicKey
+}
+
+// Sign of precomputed digest is not possible, signers only take whole message
+func (s MessageSigner) Sign(_ io.Reader, _ []byte, _ stdcrypto.SignerOpts) ([]byte, error) {
+	return nil, errors.New("signing of precomputed digest is not supported")
+}
+
+func (s MessageSigner) SignMessage(_ io.Reader, msg []byte, _ stdcrypto.SignerOpts) ([]byte, error) {
+	return s.Signer.Sign(msg)
+}
+
+// x509Algorithms are X.509 signature algorithms using the same hash
+type x509Algorithms struct {
+	pkcs1v15, pss, ecdsa x509.SignatureAlgorithm
+}
+
+var x509SignatureAlgorithms = map[HashAlgorithm]x509Algorithms{
+	HashSHA256: {x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.ECDSAWithSHA256},
+	HashSHA384: {x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384},
+	HashSHA512: {x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512},
+}
+
+// X509SignatureAlgorithm returns X.509 signature algorithm producing the same
+// signatures as signer of algorithm with given options. ECDSA signers have to
+// use ASN.1 DER encoding.
+func X509SignatureAlgorithm(algorithm string, opts SignatureOptions) (x509.SignatureAlgorithm, error) {
+	if algorithm == "ED25519" {
+		return x509.PureEd25519, nil
+	}
+	hashName := opts.Hash
+	// legacy ECC devices sign SHA-256 digests, legacy RSA signatures have
+	// no DigestInfo and can't be used in X.509
+	if hashName == "" && algorithm == "ECC" {
+		hashName = HashSHA256
+	}
+	algs, ok := x509SignatureAlgorithms[hashName]
+	if !ok {
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("hash %q can't be used in X.509 signatures", opts.Hash)
+	}
+
+	switch algorithm {
+	case "RSA":
+		if opts.Padding != PaddingPSS {
+			return algs.pkcs1v15, nil
+		}
+		// X.509 PSS parameters produced by standard library always use salt
+		// as long as hash
+		hash, _ := opts.Hash.cryptoHash()
+		if opts.SaltLength != 0 && opts.SaltLength != hash.Size() {
+			return x509.UnknownSignatureAlgorithm, fmt.Errorf("PSS salt length %d can't be used in X.509 signatures, only hash size", opts.SaltLength)
+		}
+		return algs.pss, nil
+	case "ECC":
+		return algs.ecdsa, nil
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+}
@@ -25,6 +25,14 @@ func (s SuccessJSON) HTTPStatus() int {
 	return http.StatusOK
 }
 
+// CreatedJSON struct is same what success, but sent for created resource
+type CreatedJSON SuccessJSON
+
+// HTTPStatus return http status for created response (201)
+func (c CreatedJSON) HTTPStatus() int {
+	return http.StatusCreated
+}
+
 // FailJSON struct is same what success, but with correct name in function
 type FailJSON SuccessJSON
 
@@ -57,6 +65,16 @@ func Success(w http.ResponseWriter, data interface{}, code int) {
 	RespondWithJSON(w, json)
 }
 
+// Created create json message with success status and data of created
+// resource
+func Created(w http.ResponseWriter, data interface{}) {
+	var json = CreatedJSON{
+		Status: "success",
+		Data:   data,
+	}
+	RespondWithJSON(w, json)
+}
+
 // Fail create json message with faile status and data
 func Fail(w http.ResponseWriter, data interface{}) {
 	var json = FailJSON{
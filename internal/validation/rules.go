@@ -2,19 +2,14 @@ package validation
 
 import (
 	"github.com/go-playground/validator/v10"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/utils/crypto"
 )
 
-// allowedAlgorithms
-var allowedAlgorithms = map[string]struct{}{
-	"RSA": {},
-	"ECC": {},
-}
-
 // registerRules
 func registerRules(v *validator.Validate) {
-	// algorithm = "RSA" | "ECC"
+	// algorithm = any algorithm registered in crypto registry
 	_ = v.RegisterValidation("algorithm", func(fl validator.FieldLevel) bool {
-		_, ok := allowedAlgorithms[fl.Field().String()]
+		_, ok := crypto.LookupAlgorithm(fl.Field().String())
 		return ok
 	})
 }
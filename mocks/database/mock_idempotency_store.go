@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+)
+
+// MockIdempotencyStore implement IdempotencyStore
+type MockIdempotencyStore struct {
+	ReserveFn       func(ctx context.Context, rec *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error)
+	ExtendFn        func(ctx context.Context, rec *domain.IdempotencyRecord) error
+	CompleteFn      func(ctx context.Context, rec *domain.IdempotencyRecord) error
+	ReleaseFn       func(ctx context.Context, rec *domain.IdempotencyRecord) error
+	DeleteExpiredFn func(ctx context.Context, now time.Time) (int, error)
+}
+
+// Reserve run func or return nil
+func (m *MockIdempotencyStore) Reserve(ctx context.Context, rec *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	if m.ReserveFn != nil {
+		return m.ReserveFn(ctx, rec)
+	}
+	return nil, nil
+}
+
+// Extend run func or return nil
+func (m *MockIdempotencyStore) Extend(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	if m.ExtendFn != nil {
+		return m.ExtendFn(ctx, rec)
+	}
+	return nil
+}
+
+// Complete run func or return nil
+func (m *MockIdempotencyStore) Complete(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	if m.CompleteFn != nil {
+		return m.CompleteFn(ctx, rec)
+	}
+	return nil
+}
+
+// Release run func or return nil
+func (m *MockIdempotencyStore) Release(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	if m.ReleaseFn != nil {
+		return m.ReleaseFn(ctx, rec)
+	}
+	return nil
+}
+
+// DeleteExpired run func or return zero
+func (m *MockIdempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	if m.DeleteExpiredFn != nil {
+		return m.DeleteExpiredFn(ctx, now)
+	}
+	return 0, nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+)
+
+// MockLogRepo implement LogRepository
+type MockLogRepo struct {
+	AppendFn         func(ctx context.Context, entries []*domain.LogEntry) error
+	ListFn           func(ctx context.Context) ([]*domain.LogEntry, error)
+	CreateTreeHeadFn func(ctx context.Context, h *domain.SignedTreeHead) error
+	LatestTreeHeadFn func(ctx context.Context) (*domain.SignedTreeHead, error)
+}
+
+// Append run func or return nil
+func (m *MockLogRepo) Append(ctx context.Context, entries []*domain.LogEntry) error {
+	if m.AppendFn != nil {
+		return m.AppendFn(ctx, entries)
+	}
+	return nil
+}
+
+// List run func or return empty list
+func (m *MockLogRepo) List(ctx context.Context) ([]*domain.LogEntry, error) {
+	if m.ListFn != nil {
+		return m.ListFn(ctx)
+	}
+	return []*domain.LogEntry{}, nil
+}
+
+// CreateTreeHead run func or return nil
+func (m *MockLogRepo) CreateTreeHead(ctx context.Context, h *domain.SignedTreeHead) error {
+	if m.CreateTreeHeadFn != nil {
+		return m.CreateTreeHeadFn(ctx, h)
+	}
+	return nil
+}
+
+// LatestTreeHead run func or return nil
+func (m *MockLogRepo) LatestTreeHead(ctx context.Context) (*domain.SignedTreeHead, error) {
+	if m.LatestTreeHeadFn != nil {
+		return m.LatestTreeHeadFn(ctx)
+	}
+	return nil, nil
+}
@@ -9,7 +9,10 @@ import (
 // MockSignatureRepo implement SignatureRepository
 type MockSignatureRepo struct {
 	CreateFn       func(ctx context.Context, s *domain.SignatureRecord) error
+	GetByIDFn      func(ctx context.Context, id string) (*domain.SignatureRecord, error)
 	ListByDeviceFn func(ctx context.Context, deviceID string) ([]*domain.SignatureRecord, error)
+
+	GetBySignatureFn func(ctx context.Context, deviceID, signature string) (*domain.SignatureRecord, error)
 }
 
 // Create run func or return nil
@@ -20,6 +23,14 @@ func (m *MockSignatureRepo) Create(ctx context.Context, s *domain.SignatureRecor
 	return nil
 }
 
+// GetByID run func or return nil
+func (m *MockSignatureRepo) GetByID(ctx context.Context, id string) (*domain.SignatureRecord, error) {
+	if m.GetByIDFn != nil {
+		return m.GetByIDFn(ctx, id)
+	}
+	return nil, nil
+}
+
 // ListByDevice run func or return empty list
 func (m *MockSignatureRepo) ListByDevice(ctx context.Context, deviceID string) ([]*domain.SignatureRecord, error) {
 	if m.ListByDeviceFn != nil {
@@ -27,3 +38,11 @@ func (m *MockSignatureRepo) ListByDevice(ctx context.Context, deviceID string) (
 	}
 	return []*domain.SignatureRecord{}, nil
 }
+
+// GetBySignature run func or return nil
+func (m *MockSignatureRepo) GetBySignature(ctx context.Context, deviceID, signature string) (*domain.SignatureRecord, error) {
+	if m.GetBySignatureFn != nil {
+		return m.GetBySignatureFn(ctx, deviceID, signature)
+	}
+	return nil, nil
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+	"github.com/piotrklosek/signing-service-challenge-go/internal/persistence"
+)
+
+// MockSigningStore implement SigningStore
+type MockSigningStore struct {
+	SignAtomicallyFn      func(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error)
+	SignBatchAtomicallyFn func(ctx context.Context, deviceID string, fn persistence.BatchSignFunc) ([]*domain.SignatureRecord, error)
+	UpdateCertificateFn   func(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error
+	UpdateStatusFn        func(ctx context.Context, deviceID string, status domain.DeviceStatus) error
+}
+
+// SignAtomically runs func or return nil
+func (m *MockSigningStore) SignAtomically(ctx context.Context, deviceID string, fn persistence.SignFunc) (*domain.SignatureRecord, error) {
+	if m.SignAtomicallyFn != nil {
+		return m.SignAtomicallyFn(ctx, deviceID, fn)
+	}
+	return nil, nil
+}
+
+// SignBatchAtomically runs func or return nil
+func (m *MockSigningStore) SignBatchAtomically(ctx context.Context, deviceID string, fn persistence.BatchSignFunc) ([]*domain.SignatureRecord, error) {
+	if m.SignBatchAtomicallyFn != nil {
+		return m.SignBatchAtomicallyFn(ctx, deviceID, fn)
+	}
+	return nil, nil
+}
+
+// UpdateCertificate runs func or return nil
+func (m *MockSigningStore) UpdateCertificate(ctx context.Context, deviceID string, keyVersion int, chain [][]byte) error {
+	if m.UpdateCertificateFn != nil {
+		return m.UpdateCertificateFn(ctx, deviceID, keyVersion, chain)
+	}
+	return nil
+}
+
+// UpdateStatus runs func or return nil
+func (m *MockSigningStore) UpdateStatus(ctx context.Context, deviceID string, status domain.DeviceStatus) error {
+	if m.UpdateStatusFn != nil {
+		return m.UpdateStatusFn(ctx, deviceID, status)
+	}
+	return nil
+}
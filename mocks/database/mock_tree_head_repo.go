@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+
+	"github.com/piotrklosek/signing-service-challenge-go/internal/domain"
+)
+
+// MockTreeHeadRepo implement TreeHeadRepository
+type MockTreeHeadRepo struct {
+	CreateFn       func(ctx context.Context, h *domain.TreeHead) error
+	ListByDeviceFn func(ctx context.Context, deviceID string) ([]*domain.TreeHead, error)
+}
+
+// Create run func or return nil
+func (m *MockTreeHeadRepo) Create(ctx context.Context, h *domain.TreeHead) error {
+	if m.CreateFn != nil {
+		return m.CreateFn(ctx, h)
+	}
+	return nil
+}
+
+// ListByDevice run func or return empty list
+func (m *MockTreeHeadRepo) ListByDevice(ctx context.Context, deviceID string) ([]*domain.TreeHead, error) {
+	if m.ListByDeviceFn != nil {
+		return m.ListByDeviceFn(ctx, deviceID)
+	}
+	return []*domain.TreeHead{}, nil
+}